@@ -0,0 +1,537 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jenian/que/internal/advisor"
+	"github.com/jenian/que/internal/batch"
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/ingestor"
+	"github.com/jenian/que/internal/logging"
+	"github.com/jenian/que/internal/sanitizer"
+	"github.com/jenian/que/internal/tracing"
+	"github.com/jenian/que/pkg/llm"
+	"github.com/spf13/cobra"
+)
+
+// batchOutputs map the --output values of `que batch` to the format and
+// extension of the result files
+var batchOutputs = map[string]struct{ format, ext string }{
+	"json-dir":     {advisor.FormatJSON, ".json"},
+	"markdown-dir": {advisor.FormatMarkdown, ".md"},
+	"text-dir":     {advisor.FormatText, ".txt"},
+}
+
+// defaultBatchResults is the results directory when none is given
+const defaultBatchResults = "que-results"
+
+// batchRetries is how many times a rate-limited file is retried
+const batchRetries = 3
+
+// batchBackoff is the first pause after the provider reports a rate limit;
+// it doubles on each retry (a variable so tests can shorten it)
+var batchBackoff = 15 * time.Second
+
+var (
+	batchProviderFlag string
+	batchModelFlag    string
+	batchDirFlag      string
+	batchGlobFlag     string
+	batchOutputFlag   string
+	batchWorkersFlag  int
+	batchRateFlag     int
+	batchForceFlag    bool
+	batchSmartFlag    bool
+	batchTriageFlag   string
+	batchNotifyFlag   []string
+)
+
+// batchQuotaExhausted is the manifest's stop reason when the provider keeps
+// rate limiting after the retries
+const batchQuotaExhausted = "rate limit or quota exhausted"
+
+// newBatchCmd returns the `que batch` subcommand, which analyzes every
+// matching file of a directory and writes one result file per input
+func newBatchCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "batch --dir DIR [flags] [RESULTS_DIR]",
+		Short: "Analyze every matching log file of a directory, one result file per log",
+		Long: `Analyze every file under --dir whose name matches --glob, with several
+workers and a cap on requests per minute. Each log is redacted like stdin
+input and its analysis is written to the results directory (default
+` + defaultBatchResults + `). Files already analyzed, recognized by the hash of their
+contents, are skipped, so an interrupted batch resumes where it stopped.`,
+		Example: `  que batch --dir logs/ --glob '*.log' -o json-dir results/
+  que batch --dir /var/log/app -o markdown-dir=reports --workers 2 --rate 20`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runBatch,
+	}
+
+	cmd.Flags().StringVarP(&batchProviderFlag, "provider", "p", "", "LLM provider to use ("+strings.Join(llm.ProviderNames(), ", ")+")")
+	cmd.Flags().StringVarP(&batchModelFlag, "model", "m", "", "Specific model override (e.g., gpt-4-turbo)")
+	cmd.Flags().StringVar(&batchDirFlag, "dir", "", "Directory to analyze (searched recursively)")
+	cmd.Flags().StringVar(&batchGlobFlag, "glob", "*.log", "Analyze files whose name matches this pattern")
+	cmd.Flags().StringVarP(&batchOutputFlag, "output", "o", "json-dir", "Result format and optional directory: json-dir, markdown-dir or text-dir, e.g. json-dir=results/")
+	cmd.Flags().IntVar(&batchWorkersFlag, "workers", 4, "Number of files analyzed at the same time")
+	cmd.Flags().IntVar(&batchRateFlag, "rate", 30, "Most requests per minute sent to the provider (0 for no limit)")
+	cmd.Flags().BoolVar(&batchForceFlag, "force", false, "Analyze files again even if they were analyzed before")
+	cmd.Flags().BoolVar(&batchSmartFlag, "smart-routing", false, "Ask a cheap triage model first and only query the selected model when it finds a problem")
+	cmd.Flags().StringVar(&batchTriageFlag, "triage-model", "", "Model for the --smart-routing first pass (default: the provider's cheapest recommended model)")
+	cmd.Flags().StringArrayVar(&batchNotifyFlag, "notify", nil, "Also send the analyses that found a problem to a notification sink, as for que --notify, e.g. email=oncall@example.com; can be repeated")
+	cmd.MarkFlagRequired("dir")
+
+	return cmd
+}
+
+func runBatch(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	selectProvider(cfg, batchProviderFlag)
+	cfg.Model = batchModelFlag
+	if batchSmartFlag {
+		cfg.SmartRouting = true
+	}
+	if batchTriageFlag != "" {
+		cfg.TriageModel = batchTriageFlag
+	}
+	cfg.Outputs = nil
+	cfg.Notify = batchNotifyFlag
+
+	if err := checkParanoid(cfg); err != nil {
+		return err
+	}
+	closeLog, err := logging.Init(cfg.LogLevel, cfg.LogFile)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	tracer := tracing.New(cfg.Tracing, Version)
+	defer func() {
+		if err := tracer.Flush(context.Background()); err != nil {
+			advisor.Report(cfg, "Tracing: %v", err)
+		}
+	}()
+
+	name, resultsDir, _ := strings.Cut(batchOutputFlag, "=")
+	output, ok := batchOutputs[name]
+	if !ok {
+		return fmt.Errorf("invalid batch output: %s (must be json-dir, markdown-dir or text-dir)", name)
+	}
+	if len(args) == 1 {
+		if resultsDir != "" && filepath.Clean(resultsDir) != filepath.Clean(args[0]) {
+			return fmt.Errorf("results directory given twice: %s and %s", resultsDir, args[0])
+		}
+		resultsDir = args[0]
+	}
+	if resultsDir == "" {
+		resultsDir = defaultBatchResults
+	}
+	if batchWorkersFlag < 1 {
+		return fmt.Errorf("--workers must be at least 1")
+	}
+	if batchRateFlag < 0 {
+		return fmt.Errorf("--rate must not be negative")
+	}
+
+	if err := llm.ValidateProvider(cfg.Provider); err != nil {
+		return err
+	}
+	resolveModel(cfg)
+	if err := resolvePromptVersion(cfg); err != nil {
+		return err
+	}
+	provider, _ := llm.LookupProvider(cfg.Provider)
+	if err := provider.CheckEnv(); err != nil {
+		return err
+	}
+	llmClient, err := llm.NewClient(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create LLM client: %w", err)
+	}
+	model := llm.ResolveModel(cfg.Provider, cfg.Model)
+	var triageClient llm.Client
+	if cfg.SmartRouting && llm.ResolveTriageModel(cfg.Provider, cfg.TriageModel) != model {
+		triageCfg := advisor.TriageConfig(cfg)
+		if triageClient, err = llm.NewClient(triageCfg); err != nil {
+			return fmt.Errorf("failed to create triage LLM client: %w", err)
+		}
+	}
+	cfg.DropKeys()
+	notify, err := advisor.NewSinks(cfg, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	sanitizer.Preload()
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		return err
+	}
+
+	files, err := batch.Find(batchDirFlag, batchGlobFlag)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no files matching %s in %s", batchGlobFlag, batchDirFlag)
+	}
+	if err := os.MkdirAll(resultsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create results directory: %w", err)
+	}
+	// Without the state file a paranoid batch can't resume, but leaves only the results behind
+	manifest := batch.NewManifest()
+	if !cfg.Paranoid {
+		if manifest, err = batch.LoadManifest(resultsDir); err != nil {
+			return err
+		}
+	}
+
+	var pending []batch.File
+	var escalated, retried int
+	for _, file := range files {
+		if !batchForceFlag && manifest.Done(file.Hash) {
+			continue
+		}
+		pending = append(pending, file)
+		if entry, ok := manifest.Entry(file.Hash); ok && !batchForceFlag {
+			if entry.Escalated {
+				escalated++
+			}
+			if entry.Error != "" {
+				retried++
+			}
+		}
+	}
+	if manifest.Stopped != "" {
+		advisor.Report(cfg, "Resuming a batch that stopped early (%s)", manifest.Stopped)
+	}
+	advisor.Report(cfg, "Analyzing %d of %d files in %s (%d already analyzed, %d failed before, %d past triage)",
+		len(pending), len(files), batchDirFlag, len(files)-len(pending), retried, escalated)
+
+	// The bar replaces the per-file stages, which would interleave
+	fileCfg := *cfg
+	fileCfg.UI.Quiet = true
+	analyzer := &batchAnalyzer{
+		cfg:        &fileCfg,
+		client:     llmClient,
+		triage:     triageClient,
+		redactor:   redactor,
+		limiter:    batch.NewLimiter(batchRateFlag),
+		manifest:   manifest,
+		resultsDir: resultsDir,
+		format:     output.format,
+		ext:        output.ext,
+		limit:      max(ingestor.MaxInputSize, llm.LogByteBudget(model)),
+		model:      model,
+		notify:     notify,
+		tracer:     tracer,
+	}
+
+	// Ctrl-C stops handing out files; those in flight finish and are
+	// recorded. A second Ctrl-C exits right away.
+	interrupted, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stopSignals()
+	ctx, cancel := context.WithCancelCause(interrupted)
+	defer cancel(nil)
+	analyzer.stop = cancel
+	go func() {
+		<-interrupted.Done()
+		stopSignals()
+	}()
+	ctx, span := tracer.Start(ctx, "batch", tracing.Internal)
+	span.SetAttr("que.batch.files", len(pending))
+	span.SetAttr("que.provider", cfg.Provider)
+	span.SetAttr("que.model", model)
+
+	bar := advisor.NewProgressBar(cfg, len(pending))
+	failed := batch.Run(ctx, pending, batchWorkersFlag, analyzer.analyze, func(file batch.File, err error) {
+		bar.Add(file.Rel)
+		if err != nil {
+			logging.Debug().Err(err).Str("file", file.Rel).Msg("Batch analysis failed")
+		}
+	})
+	bar.Finish()
+	if analyzer.usage != nil {
+		advisor.Report(cfg, "%s", advisor.FormatUsage(analyzer.usage))
+	}
+	for _, err := range analyzer.notifyErrors {
+		advisor.Report(cfg, "Notification failed: %v", err)
+	}
+
+	var failures int
+	for _, file := range pending {
+		if err, ok := failed[file.Rel]; ok && !errors.Is(err, context.Canceled) {
+			failures++
+			advisor.Report(cfg, "%s: %v", file.Rel, err)
+		}
+	}
+	span.SetAttr("que.batch.failures", failures)
+	span.End(context.Cause(ctx))
+
+	stopped := ""
+	if cause := context.Cause(ctx); errors.Is(cause, llm.ErrRateLimited) {
+		stopped = batchQuotaExhausted
+	} else if ctx.Err() != nil {
+		stopped = "interrupted"
+	}
+	if err := manifest.Stop(stopped); err != nil {
+		return err
+	}
+	if stopped != "" {
+		return fmt.Errorf("batch stopped early (%s); run the same command again to resume: %w", stopped, context.Cause(ctx))
+	}
+	if failures > 0 {
+		return fmt.Errorf("%d of %d files failed; run the batch again to retry them", failures, len(pending))
+	}
+	advisor.Report(cfg, "Results written to %s", resultsDir)
+	return nil
+}
+
+// batchAnalyzer runs the redact-and-analyze pipeline for the files of a batch
+type batchAnalyzer struct {
+	cfg        *config.Config
+	client     llm.Client
+	triage     llm.Client // Triage model client with --smart-routing, or nil
+	redactor   config.Redactor
+	limiter    *batch.Limiter
+	manifest   *batch.Manifest
+	resultsDir string
+	format     string
+	ext        string
+	limit      int
+	model      string // Model whose tokenizer counts the log budget
+	// stop ends the batch early, e.g. when the provider's quota is exhausted
+	stop context.CancelCauseFunc
+	// notify are the --notify sinks analyses that found a problem go to
+	notify []advisor.Sink
+	// tracer records a span per file and per stage, nil without tracing
+	tracer *tracing.Tracer
+
+	notifyMu     sync.Mutex
+	notifyErrors []error // Failed notifications, reported once the bar is done
+
+	usageMu sync.Mutex
+	usage   *config.Usage // Provider-reported usage of the analyses so far, if any
+}
+
+// addUsage adds the usage of an analysis to the batch's total
+func (b *batchAnalyzer) addUsage(analysis *advisor.Analysis) {
+	if analysis.Metadata == nil || analysis.Metadata.Usage == nil {
+		return
+	}
+	usage := analysis.Metadata.Usage
+	b.usageMu.Lock()
+	defer b.usageMu.Unlock()
+	if b.usage == nil {
+		b.usage = &config.Usage{}
+	}
+	b.usage.PromptTokens += usage.PromptTokens
+	b.usage.CompletionTokens += usage.CompletionTokens
+	b.usage.CacheReadTokens += usage.CacheReadTokens
+	b.usage.CacheWriteTokens += usage.CacheWriteTokens
+	// Triage and selected models are priced differently, so costs add up
+	// per analysis rather than from the token totals
+	if usage.CostUSD != nil {
+		cost := *usage.CostUSD
+		if b.usage.CostUSD != nil {
+			cost += *b.usage.CostUSD
+		}
+		b.usage.CostUSD = &cost
+	}
+}
+
+// analyze analyzes one file, writes its result file and records its
+// progress in the manifest, including why it failed
+func (b *batchAnalyzer) analyze(ctx context.Context, file batch.File) (err error) {
+	ctx, span := b.tracer.Start(ctx, "batch.file", tracing.Internal)
+	defer func() { span.End(err) }()
+	if span != nil {
+		// The name may carry secrets like the contents
+		name, _ := b.redactor.Redact(file.Rel)
+		span.SetAttr("que.file", name)
+		span.SetAttr("que.file.sha256", file.Hash)
+	}
+
+	_, ingest := b.tracer.Start(ctx, "ingest", tracing.Internal)
+	rawLog, err := b.read(file)
+	ingest.SetAttr("que.input.bytes", len(rawLog))
+	ingest.End(err)
+	if err != nil {
+		return err
+	}
+
+	_, redact := b.tracer.Start(ctx, "redact", tracing.Internal)
+	sanitizedLog, _, findings := b.redactor.RedactWithDetails(rawLog, true)
+	lineMap := sanitizer.MapLines(rawLog, findings)
+	payload := config.QueryPayload{
+		RawLog:       rawLog,
+		SanitizedLog: sanitizedLog,
+		Findings:     findings,
+		LineMap:      lineMap,
+		Truncated:    ingestor.Truncated(rawLog),
+	}
+	labelSources(&payload)
+	recognizeToolchain(&payload, "")
+	// The name often says which service the log is from, and may carry secrets like any input
+	payload.Hint = "This log was read from the file " + file.Rel + "."
+	payload.Findings = append(payload.Findings, sanitizer.RedactPayload(b.redactor, &payload)...)
+	redact.SetAttr("que.redactions", len(payload.Findings))
+	redact.End(nil)
+	budget := llm.LogBudget(b.cfg, payload)
+	if b.triage != nil {
+		// Both models see the same log, so it has to fit the smaller one
+		budget = min(budget, llm.LogBudget(advisor.TriageConfig(b.cfg), payload))
+	}
+	summarizeLog(&payload, budget, b.model)
+
+	entry, _ := b.manifest.Entry(file.Hash)
+	entry.File = file.Rel
+	entry.Attempts++
+	analysis, err := b.query(ctx, file, &entry, payload)
+	if err != nil {
+		// A canceled batch didn't get to try the file, so there is nothing to record
+		if !errors.Is(err, context.Canceled) {
+			entry.Error = err.Error()
+			if err := b.manifest.Record(file.Hash, entry); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+
+	b.addUsage(analysis)
+	span.SetAttr("que.severity", analysis.Severity())
+	span.SetAttr("que.category", analysis.Category())
+
+	result, err := analysis.Render(b.cfg, b.format)
+	if err != nil {
+		return err
+	}
+	name := batch.ResultName(file.Rel, b.ext)
+	path := filepath.Join(b.resultsDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to write result: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(result), 0644); err != nil {
+		return fmt.Errorf("failed to write result: %w", err)
+	}
+	entry.Result = name
+	entry.Severity = analysis.Severity()
+	entry.Category = analysis.Category()
+	entry.Error = ""
+	if err := b.manifest.Record(file.Hash, entry); err != nil {
+		return err
+	}
+	b.deliver(file, analysis)
+	return nil
+}
+
+// read reads a file's log, failing for an empty one
+func (b *batchAnalyzer) read(file batch.File) (string, error) {
+	f, err := os.Open(file.Path)
+	if err != nil {
+		return "", err
+	}
+	rawLog, err := ingestor.IngestFromReaderLimit(f, b.limit)
+	f.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to read: %w", err)
+	}
+	if strings.TrimSpace(rawLog) == "" {
+		return "", fmt.Errorf("file is empty")
+	}
+	return rawLog, nil
+}
+
+// deliver sends an analysis that found a problem to the --notify sinks. A
+// failed notification doesn't fail the file, whose result is written; it is
+// reported at the end of the batch.
+func (b *batchAnalyzer) deliver(file batch.File, analysis *advisor.Analysis) {
+	if len(b.notify) == 0 || analysis.NoProblem() {
+		return
+	}
+	analysis.Source = file.Rel
+	if err := advisor.Deliver(b.notify, analysis); err != nil {
+		b.notifyMu.Lock()
+		defer b.notifyMu.Unlock()
+		b.notifyErrors = append(b.notifyErrors, fmt.Errorf("%s: %w", file.Rel, err))
+	}
+}
+
+// query asks the triage model first with --smart-routing, unless an earlier
+// run already escalated the file, then the selected model. Rate-limited
+// requests pause every worker and are retried; when the retries run out the
+// provider's limit is exhausted, and the whole batch stops. An exhausted
+// quota stops it at once, since no wait brings it back.
+func (b *batchAnalyzer) query(ctx context.Context, file batch.File, entry *batch.Entry, payload config.QueryPayload) (*advisor.Analysis, error) {
+	// Ctrl-C lets the requests in flight finish, like the files they belong to
+	request := context.WithoutCancel(ctx)
+	if b.triage != nil && !entry.Escalated {
+		if err := b.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		triageCfg := advisor.TriageConfig(b.cfg)
+		span := b.startLLM(request, triageCfg, 0)
+		analysis := advisor.Triage(request, b.triage, b.cfg, payload)
+		span.SetAttr("que.escalated", analysis == nil)
+		endLLM(span, analysis, nil)
+		if analysis != nil {
+			return analysis, nil
+		}
+		// Keep the triage verdict in case the selected model's call fails
+		entry.Escalated = true
+		if err := b.manifest.Record(file.Hash, *entry); err != nil {
+			return nil, err
+		}
+	}
+
+	backoff := batchBackoff
+	for attempt := 0; ; attempt++ {
+		if err := b.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		span := b.startLLM(request, b.cfg, attempt)
+		analysis, err := advisor.Analyze(request, b.client, b.cfg, payload)
+		endLLM(span, analysis, err)
+		if !errors.Is(err, llm.ErrRateLimited) {
+			return analysis, err
+		}
+		if attempt == batchRetries || errors.Is(err, llm.ErrQuotaExceeded) {
+			if b.stop != nil {
+				b.stop(err)
+			}
+			return nil, err
+		}
+		logging.Debug().Str("file", file.Rel).Dur("backoff", backoff).Msg("Rate limited, pausing the batch")
+		b.limiter.Pause(backoff)
+		backoff *= 2
+	}
+}
+
+// startLLM starts the span of a request to the model of cfg
+func (b *batchAnalyzer) startLLM(ctx context.Context, cfg *config.Config, attempt int) *tracing.Span {
+	_, span := b.tracer.Start(ctx, "llm", tracing.Client)
+	span.SetAttr("gen_ai.system", cfg.Provider)
+	span.SetAttr("gen_ai.request.model", llm.ResolveModel(cfg.Provider, cfg.Model))
+	span.SetAttr("que.attempt", attempt+1)
+	return span
+}
+
+// endLLM ends the span of a request to a model with the tokens it used
+func endLLM(span *tracing.Span, analysis *advisor.Analysis, err error) {
+	if analysis != nil && analysis.Metadata != nil && analysis.Metadata.Usage != nil {
+		span.SetAttr("gen_ai.usage.input_tokens", analysis.Metadata.Usage.PromptTokens)
+		span.SetAttr("gen_ai.usage.output_tokens", analysis.Metadata.Usage.CompletionTokens)
+	}
+	span.End(err)
+}
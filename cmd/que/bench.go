@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/jenian/que/internal/advisor"
+	"github.com/jenian/que/internal/bench"
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/ingestor"
+	"github.com/jenian/que/internal/logging"
+	"github.com/jenian/que/internal/sanitizer"
+	"github.com/jenian/que/pkg/llm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	benchPromptsFlag   bool
+	benchProviderFlag  string
+	benchModelFlag     string
+	benchVersionsFlag  []string
+	benchCorpusFlag    string
+	benchOutputFlag    string
+	benchBaselineFlag  string
+	benchToleranceFlag float64
+)
+
+// newBenchCmd returns the `que bench` subcommand, which scores the prompts
+// against a corpus of failure logs with known root causes
+func newBenchCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bench --prompts [flags]",
+		Short: "Score prompt versions against a corpus of failure logs with known root causes",
+		Long: `Analyze every log of the benchmark corpus with each prompt version and score
+the analyses against what is known about the logs: whether there is a problem,
+its category and the terms its root cause should mention. Run it before and
+after changing a prompt or the response schema, with --baseline to fail when
+the score drops. The built-in corpus is internal/bench/testdata/corpus; every
+case costs a request to the provider.`,
+		Example: `  que bench --prompts -p claude
+  que bench --prompts --prompt-version v5,v6 -o json > before.json
+  que bench --prompts --prompt-version v5,v6 --baseline before.json`,
+		Args: cobra.NoArgs,
+		RunE: runBench,
+	}
+
+	cmd.Flags().BoolVar(&benchPromptsFlag, "prompts", false, "Benchmark the prompts and response schema")
+	cmd.Flags().StringVarP(&benchProviderFlag, "provider", "p", "", "LLM provider to use ("+strings.Join(llm.ProviderNames(), ", ")+")")
+	cmd.Flags().StringVarP(&benchModelFlag, "model", "m", "", "Specific model override (e.g., gpt-4-turbo)")
+	cmd.Flags().StringSliceVar(&benchVersionsFlag, "prompt-version", nil, fmt.Sprintf("Prompt versions to score, comma-separated (default %s)", llm.CurrentPromptVersion))
+	cmd.Flags().StringVar(&benchCorpusFlag, "corpus", "", "Directory of a corpus to use instead of the built-in one, with its cases in "+bench.CorpusFile)
+	cmd.Flags().StringVarP(&benchOutputFlag, "output", "o", advisor.FormatText, "Output format: text or json")
+	cmd.Flags().StringVar(&benchBaselineFlag, "baseline", "", "JSON results of an earlier run (-o json) to compare with; regressions fail the command")
+	cmd.Flags().Float64Var(&benchToleranceFlag, "tolerance", 5, "Points the score of a prompt version may drop from the baseline before it counts as a regression")
+
+	return cmd
+}
+
+func runBench(cmd *cobra.Command, args []string) error {
+	if !benchPromptsFlag {
+		return fmt.Errorf("choose what to benchmark: --prompts")
+	}
+	if benchOutputFlag != advisor.FormatText && benchOutputFlag != advisor.FormatJSON {
+		return fmt.Errorf("invalid output format: %s (must be text or json)", benchOutputFlag)
+	}
+	var baseline []bench.Report
+	if benchBaselineFlag != "" {
+		data, err := os.ReadFile(benchBaselineFlag)
+		if err != nil {
+			return fmt.Errorf("failed to read baseline: %w", err)
+		}
+		if err := json.Unmarshal(data, &baseline); err != nil {
+			return fmt.Errorf("invalid baseline %s (want the output of que bench -o json): %w", benchBaselineFlag, err)
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	selectProvider(cfg, benchProviderFlag)
+	cfg.Model = benchModelFlag
+	closeLog, err := logging.Init(cfg.LogLevel, cfg.LogFile)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	if err := llm.ValidateProvider(cfg.Provider); err != nil {
+		return err
+	}
+	resolveModel(cfg)
+	versions := benchVersionsFlag
+	if len(versions) == 0 {
+		versions = []string{cfg.PromptVersion}
+	}
+	templates := make([]llm.PromptTemplate, 0, len(versions))
+	names := make([]string, 0, len(versions))
+	for _, version := range versions {
+		tmpl, err := llm.GetPromptTemplate(strings.TrimSpace(version))
+		if err != nil {
+			return err
+		}
+		templates = append(templates, tmpl)
+		names = append(names, tmpl.Version)
+	}
+	// The scores are read from the response fields, which need the schema
+	cfg.NoSchema = false
+
+	cases, err := bench.Corpus()
+	if benchCorpusFlag != "" {
+		cases, err = bench.LoadDir(benchCorpusFlag)
+	}
+	if err != nil {
+		return err
+	}
+
+	provider, _ := llm.LookupProvider(cfg.Provider)
+	if err := provider.CheckEnv(); err != nil {
+		return err
+	}
+	client, err := llm.NewClient(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create LLM client: %w", err)
+	}
+	cfg.DropKeys()
+	sanitizer.Preload()
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		return err
+	}
+
+	model := llm.ResolveModel(cfg.Provider, cfg.Model)
+	advisor.Report(cfg, "Scoring %s on %d cases with %s", strings.Join(names, ", "), len(cases), strings.TrimSpace(cfg.Provider+" "+model))
+	bar := advisor.NewProgressBar(cfg, len(cases)*len(templates))
+	reports := make([]bench.Report, 0, len(templates))
+	for _, tmpl := range templates {
+		versionCfg := *cfg
+		versionCfg.PromptVersion = tmpl.Version
+		versionCfg.UI.Quiet = true
+		report := runBenchVersion(cmd.Context(), client, &versionCfg, redactor, cases, func(c bench.Case) { bar.Add(tmpl.Version + " " + c.File) })
+		report.Provider, report.Model = cfg.Provider, model
+		reports = append(reports, report)
+		if report.Errors == report.Cases {
+			bar.Finish()
+			return fmt.Errorf("every case failed with %s, e.g. %s: %s", tmpl.Version, report.Results[0].File, report.Results[0].Error)
+		}
+	}
+	bar.Finish()
+
+	if benchOutputFlag == advisor.FormatJSON {
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode results: %w", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		fmt.Print(bench.Format(reports))
+	}
+	for _, report := range reports {
+		if report.Usage != nil {
+			advisor.Report(cfg, "%s: %s", report.PromptVersion, advisor.FormatUsage(report.Usage))
+		}
+	}
+
+	var regressions []string
+	for _, report := range reports {
+		i := slices.IndexFunc(baseline, func(r bench.Report) bool { return r.PromptVersion == report.PromptVersion })
+		if i < 0 {
+			continue
+		}
+		regressions = append(regressions, bench.Compare(baseline[i], report, benchToleranceFlag)...)
+	}
+	if len(regressions) > 0 {
+		for _, regression := range regressions {
+			advisor.Report(cfg, "Regression: %s", regression)
+		}
+		return fmt.Errorf("the prompts score lower than the baseline %s", benchBaselineFlag)
+	}
+	return nil
+}
+
+// runBenchVersion analyzes and scores each case with cfg's prompt version,
+// calling done after each one
+func runBenchVersion(ctx context.Context, client llm.Client, cfg *config.Config, redactor config.Redactor, cases []bench.Case, done func(bench.Case)) bench.Report {
+	tmpl, _ := llm.GetPromptTemplate(cfg.PromptVersion)
+	categories := slices.Contains(tmpl.Fields, "category")
+	model := llm.ResolveModel(cfg.Provider, cfg.Model)
+
+	results := make([]bench.Result, 0, len(cases))
+	var usages []*config.Usage
+	for _, c := range cases {
+		analysis, err := analyzeBenchCase(ctx, client, cfg, redactor, c)
+		if analysis != nil && analysis.Metadata != nil {
+			usages = append(usages, analysis.Metadata.Usage)
+		}
+		results = append(results, bench.Score(c, analysis, err, categories))
+		done(c)
+	}
+	report := bench.Summarize(cfg.PromptVersion, results)
+	report.Usage = llm.AddUsage(model, usages...)
+	return report
+}
+
+// analyzeBenchCase runs a case's log through the pipeline of stdin input
+func analyzeBenchCase(ctx context.Context, client llm.Client, cfg *config.Config, redactor config.Redactor, c bench.Case) (*advisor.Analysis, error) {
+	sanitizedLog, _, findings := redactor.RedactWithDetails(c.Log, true)
+	payload := config.QueryPayload{
+		RawLog:       c.Log,
+		SanitizedLog: sanitizedLog,
+		Findings:     findings,
+		LineMap:      sanitizer.MapLines(c.Log, findings),
+		Truncated:    ingestor.Truncated(c.Log),
+		Hint:         c.Hint,
+	}
+	labelSources(&payload)
+	recognizeToolchain(&payload, "")
+	payload.Findings = append(payload.Findings, sanitizer.RedactPayload(redactor, &payload)...)
+	model := llm.ResolveModel(cfg.Provider, cfg.Model)
+	summarizeLog(&payload, llm.LogBudget(cfg, payload), model)
+	return advisor.Analyze(ctx, client, cfg, payload)
+}
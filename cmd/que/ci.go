@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jenian/que/internal/advisor"
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/forge"
+	"github.com/jenian/que/internal/httpclient"
+	"github.com/jenian/que/internal/ingestor"
+	"github.com/jenian/que/pkg/llm"
+	"github.com/spf13/cobra"
+)
+
+// ciTimeout bounds the forge API requests, including the log download
+const ciTimeout = 2 * time.Minute
+
+// ciHint tells the model what the CI input is
+const ciHint = "This is the output of a failed CI job, cut down to the step it failed in when that could be told. " +
+	"The attachment describes the job: where it ran, the failing step and the other jobs of the run that failed. " +
+	"The job ran on a CI runner, not on this machine. Explain why the step failed; " +
+	"say whether the fix belongs in the code, in the CI configuration (the workflow or .gitlab-ci.yml file) or in the runner's environment, e.g. a missing secret or tool version."
+
+var (
+	ciProviderFlag string
+	ciModelFlag    string
+	ciOutputFlag   string
+	ciHintFlag     string
+)
+
+// newCICmd returns the `que ci` subcommand, which analyzes a failed CI job
+// from the URL of its run
+func newCICmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ci RUN-URL",
+		Short: "Analyze a failed GitHub Actions or GitLab CI job from its URL",
+		Long: `Download the log of a failed CI job through the forge's API, cut it down to
+the step that failed and analyze it. The URL may name a GitHub Actions run or
+job, or a GitLab pipeline or job; for a run or pipeline the first failed job
+is analyzed. Private projects need a token in $GITHUB_TOKEN (or $GH_TOKEN)
+for GitHub, or $GITLAB_TOKEN (or $CI_JOB_TOKEN) for GitLab.`,
+		Example: `  que ci https://github.com/acme/api/actions/runs/9412345678
+  que ci https://github.com/acme/api/actions/runs/9412345678/job/25912345678
+  que ci https://gitlab.com/acme/api/-/jobs/7012345678 -o markdown`,
+		Args: cobra.ExactArgs(1),
+		RunE: runCI,
+	}
+
+	cmd.Flags().StringVarP(&ciProviderFlag, "provider", "p", "", "LLM provider to use ("+strings.Join(llm.ProviderNames(), ", ")+")")
+	cmd.Flags().StringVarP(&ciModelFlag, "model", "m", "", "Specific model override (e.g., gpt-4-turbo)")
+	cmd.Flags().StringVarP(&ciOutputFlag, "output", "o", advisor.FormatText, "Where to send the analysis, as for que --output")
+	cmd.Flags().StringVar(&ciHintFlag, "hint", "", "Extra context for the model that the log doesn't contain")
+
+	return cmd
+}
+
+func runCI(cmd *cobra.Command, args []string) error {
+	run, err := forge.ParseURL(args[0])
+	if err != nil {
+		return err
+	}
+
+	g, err := newGatherAnalysis(ciProviderFlag, ciModelFlag, ciOutputFlag)
+	if err != nil {
+		return err
+	}
+	defer g.Close()
+
+	doneFetching := advisor.StartStage(g.cfg, "Fetching the failed job")
+	job, err := forge.FailedJob(cmd.Context(), httpclient.New(ciTimeout), run, forge.TokenFromEnv(run.Forge))
+	doneFetching()
+	if err != nil {
+		return err
+	}
+	if job.Step != "" {
+		advisor.Report(g.cfg, "Analyzing step %q of job %q", job.Step, job.Name)
+	} else {
+		advisor.Report(g.cfg, "Analyzing job %q (the failing step couldn't be told)", job.Name)
+	}
+	log, err := ingestor.IngestFromReaderLimit(strings.NewReader(job.Log), g.inputLimit())
+	if err != nil {
+		return err
+	}
+
+	return g.analyze(cmd.Context(), gathered{
+		Log:         log,
+		Attachments: []config.Attachment{{Name: "CI job", Content: ciJobSummary(run, job)}},
+		Hint:        strings.TrimSpace(ciHint + "\n\n" + ciHintFlag),
+		Remote:      true,
+	})
+}
+
+// ciJobSummary describes a failed job for the model
+func ciJobSummary(run forge.Run, job *forge.Job) string {
+	lines := []string{
+		fmt.Sprintf("Forge: %s (%s)", run.Forge, run.Project),
+		fmt.Sprintf("Job: %s (%s)", job.Name, job.Status),
+	}
+	if job.URL != "" {
+		lines = append(lines, "URL: "+job.URL)
+	}
+	if job.Step != "" {
+		lines = append(lines, "Failing step: "+job.Step)
+	} else {
+		lines = append(lines, "Failing step: unknown, the log is the whole job's")
+	}
+	if len(job.OtherFailed) > 0 {
+		lines = append(lines, "Other failed jobs of the run: "+strings.Join(job.OtherFailed, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
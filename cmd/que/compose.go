@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jenian/que/internal/advisor"
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/ingestor"
+	"github.com/jenian/que/internal/logging"
+	"github.com/jenian/que/internal/proc"
+	"github.com/jenian/que/pkg/llm"
+	"github.com/spf13/cobra"
+)
+
+// composeTimeout bounds each docker compose command que runs
+const composeTimeout = time.Minute
+
+// composeFiles are the compose file names docker compose looks for without -f
+var composeFiles = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+// composeHint tells the model how the compose input is laid out and which
+// failures between services to look for
+const composeHint = "This is the output of `docker compose logs` for all services of a Docker Compose project, each line prefixed with the container that wrote it. " +
+	"The attachments hold the compose file and the state of each container (`docker compose ps`). " +
+	"Look for failures that cross services: a dependency that was unhealthy, still starting or exited when a service needed it (e.g. depends_on without condition: service_healthy), " +
+	"port conflicts, services reaching each other by the wrong host name or port, and containers in restart loops."
+
+var (
+	composeProviderFlag string
+	composeModelFlag    string
+	composeFileFlags    []string
+	composeProjectFlag  string
+	composeSinceFlag    string
+	composeTailFlag     int
+	composeOutputFlag   string
+	composeHintFlag     string
+)
+
+// newComposeCmd returns the `que compose` subcommand, which analyzes the
+// logs of all services of a Docker Compose project together
+func newComposeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compose [flags] [SERVICE...]",
+		Short: "Analyze the logs of a Docker Compose project for failures between its services",
+		Long: `Gather the logs of every service of a Docker Compose project (or only the
+given services) with docker compose logs, along with the state of its
+containers and the compose file, and analyze them together. The compose
+file is redacted like the logs before it is sent.`,
+		Example: `  que compose
+  que compose -f deploy/compose.prod.yaml --since 30m
+  que compose api db --tail 1000 -o markdown`,
+		RunE: runCompose,
+	}
+
+	cmd.Flags().StringVarP(&composeProviderFlag, "provider", "p", "", "LLM provider to use ("+strings.Join(llm.ProviderNames(), ", ")+")")
+	cmd.Flags().StringVarP(&composeModelFlag, "model", "m", "", "Specific model override (e.g., gpt-4-turbo)")
+	cmd.Flags().StringArrayVarP(&composeFileFlags, "file", "f", nil, "Compose file, as for docker compose -f; can be repeated (default: the one in the current directory)")
+	cmd.Flags().StringVar(&composeProjectFlag, "project-name", "", "Compose project name, as for docker compose -p")
+	cmd.Flags().StringVar(&composeSinceFlag, "since", "", "Only logs newer than this, e.g. 30m or 2024-05-01T10:00:00")
+	cmd.Flags().IntVar(&composeTailFlag, "tail", 500, "Last lines of each container's log to analyze (0 for all)")
+	cmd.Flags().StringVarP(&composeOutputFlag, "output", "o", advisor.FormatText, "Where to send the analysis, as for que --output")
+	cmd.Flags().StringVar(&composeHintFlag, "hint", "", "Extra context for the model that the logs don't contain")
+
+	return cmd
+}
+
+func runCompose(cmd *cobra.Command, services []string) error {
+	g, err := newGatherAnalysis(composeProviderFlag, composeModelFlag, composeOutputFlag)
+	if err != nil {
+		return err
+	}
+	defer g.Close()
+
+	doneGathering := advisor.StartStage(g.cfg, "Gathering compose logs")
+	logs, state, err := composeLogs(cmd.Context(), services, g.inputLimit())
+	doneGathering()
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(logs) == "" {
+		return fmt.Errorf("docker compose logs returned no output; is the project running?")
+	}
+	attachments, err := composeAttachments(state)
+	if err != nil {
+		return err
+	}
+
+	return g.analyze(cmd.Context(), gathered{
+		Log:         logs,
+		Attachments: attachments,
+		Hint:        strings.TrimSpace(composeHint + "\n\n" + composeHintFlag),
+		Interleave:  ingestor.InterleaveComposeLogs,
+	})
+}
+
+// composeArgs returns the docker compose command line for the selected
+// project, followed by args
+func composeArgs(args ...string) []string {
+	command := []string{"docker", "compose"}
+	for _, file := range composeFileFlags {
+		command = append(command, "-f", file)
+	}
+	if composeProjectFlag != "" {
+		command = append(command, "-p", composeProjectFlag)
+	}
+	return append(command, args...)
+}
+
+// composeLogs returns the timestamped logs of services (all if empty), capped
+// at limit bytes like stdin input, and the state of the project's containers
+func composeLogs(ctx context.Context, services []string, limit int) (string, string, error) {
+	limits := proc.Limits{Timeout: composeTimeout}
+	args := []string{"logs", "--no-color", "--timestamps"}
+	if composeTailFlag > 0 {
+		args = append(args, "--tail", fmt.Sprint(composeTailFlag))
+	}
+	if composeSinceFlag != "" {
+		args = append(args, "--since", composeSinceFlag)
+	}
+	output, err := proc.Output(ctx, limits, composeArgs(append(args, services...)...)...)
+	if err != nil {
+		return "", "", fmt.Errorf("docker compose logs failed: %w\n%s", err, strings.TrimSpace(output))
+	}
+	logs, err := ingestor.IngestFromReaderLimit(strings.NewReader(output), limit)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Health and exit codes tell dependency failures apart from crashes
+	state, err := proc.Output(ctx, limits, composeArgs("ps", "--all", "--format", "table {{.Service}}\t{{.Name}}\t{{.Status}}\t{{.Ports}}")...)
+	if err != nil {
+		logging.Warn().Err(err).Msg("Failed to list the compose containers")
+		state = ""
+	}
+	return logs, state, nil
+}
+
+// composeAttachments returns the compose files and container state to send
+// with the logs. The state comes first, since it is short and says most.
+func composeAttachments(state string) ([]config.Attachment, error) {
+	var attachments []config.Attachment
+	if state = strings.TrimSpace(state); state != "" {
+		attachments = append(attachments, config.Attachment{Name: "docker compose ps", Content: state})
+	}
+
+	files := composeFileFlags
+	if len(files) == 0 {
+		for _, name := range composeFiles {
+			if _, err := os.Stat(name); err == nil {
+				files = []string{name}
+				break
+			}
+		}
+	}
+	for _, path := range files {
+		attachment, err := ingestor.ReadAttachment(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read compose file: %w", err)
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, nil
+}
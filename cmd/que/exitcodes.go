@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jenian/que/pkg/llm"
+)
+
+// Exit codes let scripts distinguish failure classes without parsing stderr
+const (
+	exitCodeError           = 1
+	exitCodeAuth            = 3
+	exitCodeRateLimited     = 4
+	exitCodeContextTooLarge = 5
+	exitCodeContentFiltered = 6
+	exitCodeNotResolved     = 7
+	exitCodeInterrupted     = 130 // As shells report a command killed by SIGINT
+)
+
+// exitCodeFor maps an error returned by the pipeline to a process exit code
+func exitCodeFor(err error) int {
+	switch {
+	case errors.Is(err, llm.ErrAuth):
+		return exitCodeAuth
+	case errors.Is(err, llm.ErrRateLimited):
+		return exitCodeRateLimited
+	case errors.Is(err, llm.ErrContextTooLarge):
+		return exitCodeContextTooLarge
+	case errors.Is(err, llm.ErrContentFiltered):
+		return exitCodeContentFiltered
+	case errors.Is(err, errNotResolved):
+		return exitCodeNotResolved
+	case errors.Is(err, context.Canceled):
+		return exitCodeInterrupted
+	default:
+		return exitCodeError
+	}
+}
+
+// remediationHint returns a short suggestion for known failure classes, or "" if none applies
+func remediationHint(err error) string {
+	switch {
+	case errors.Is(err, llm.ErrAuth):
+		return "Check that QUE_CHATGPT_API_KEY / QUE_CLAUDE_API_KEY is set to a valid key for the selected provider."
+	case errors.Is(err, llm.ErrQuotaExceeded):
+		return "Your quota with the provider is exhausted. Check the plan and billing details of your account, or switch providers with --provider."
+	case errors.Is(err, llm.ErrRateLimited):
+		return "The provider is rate limiting requests or your quota is exhausted. Wait a moment and retry, or switch providers with --provider."
+	case errors.Is(err, llm.ErrContextTooLarge):
+		return "The log is too large for the selected model. Pipe a smaller excerpt (e.g. tail -n 200) or choose a model with a larger context window."
+	case errors.Is(err, llm.ErrModelNotFound):
+		return "The selected model isn't available to your API key. Check the --model value or omit it to use the provider's default."
+	case errors.Is(err, llm.ErrContentFiltered):
+		return "The provider's content filter rejected the request. Remove unrelated or user-generated sections from the log and try again, or pass --strip-on-filter to retry with only its error lines."
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jenian/que/internal/advisor"
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/ingestor"
+	"github.com/jenian/que/internal/logging"
+	"github.com/jenian/que/internal/sanitizer"
+	"github.com/jenian/que/pkg/llm"
+)
+
+// gatherAnalysis is the setup of a subcommand that collects its input itself
+// (que compose, que systemd, que ci) instead of reading it from stdin
+type gatherAnalysis struct {
+	cfg      *config.Config
+	client   llm.Client
+	sinks    []advisor.Sink
+	closeLog func() error
+}
+
+// newGatherAnalysis loads the configuration with the subcommand's provider,
+// model and --output flags, and creates the client and output sinks, so that
+// every mistake shows before anything is collected. Close releases the log file.
+func newGatherAnalysis(provider, model, output string) (*gatherAnalysis, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	selectProvider(cfg, provider)
+	cfg.Model = model
+	cfg.Outputs = strings.Split(output, ",")
+
+	if err := checkParanoid(cfg); err != nil {
+		return nil, err
+	}
+	closeLog, err := logging.Init(cfg.LogLevel, cfg.LogFile)
+	if err != nil {
+		return nil, err
+	}
+	g := &gatherAnalysis{cfg: cfg, closeLog: closeLog}
+	if err := g.setup(); err != nil {
+		closeLog()
+		return nil, err
+	}
+	return g, nil
+}
+
+// setup validates the configuration and creates the client and sinks
+func (g *gatherAnalysis) setup() error {
+	cfg := g.cfg
+	if err := llm.ValidateProvider(cfg.Provider); err != nil {
+		return err
+	}
+	resolveModel(cfg)
+	err := resolvePromptVersion(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.OutputFormat, err = advisor.ValidateOutputs(cfg.Outputs); err != nil {
+		return err
+	}
+	if cfg.OutputFormat == "" {
+		cfg.OutputFormat = advisor.FormatText
+	}
+
+	provider, _ := llm.LookupProvider(cfg.Provider)
+	if err := provider.CheckEnv(); err != nil {
+		return err
+	}
+	if g.client, err = llm.NewClient(cfg); err != nil {
+		return fmt.Errorf("failed to create LLM client: %w", err)
+	}
+	cfg.DropKeys()
+	if g.sinks, err = advisor.NewSinks(cfg, os.Stdout); err != nil {
+		return err
+	}
+	sanitizer.Preload()
+	return nil
+}
+
+// Close releases the diagnostic log file
+func (g *gatherAnalysis) Close() error {
+	return g.closeLog()
+}
+
+// inputLimit is the most bytes of collected log to read, as for stdin input
+func (g *gatherAnalysis) inputLimit() int {
+	return max(ingestor.MaxInputSize, llm.LogByteBudget(llm.ResolveModel(g.cfg.Provider, g.cfg.Model)))
+}
+
+// gathered is the input a subcommand collected
+type gathered struct {
+	Log         string              // The log to analyze, capped at inputLimit
+	Attachments []config.Attachment // Files and command output sent along, not yet redacted
+	Hint        string              // What the input is and what to look for
+	// Interleave puts the log's lines in time order (optional, see
+	// ingestor.InterleaveComposeLogs)
+	Interleave func(string) (string, config.LineMap, bool)
+	// Remote input was produced on another machine (e.g. a CI runner), so
+	// the system context of this one is left out
+	Remote bool
+}
+
+// analyze redacts input and everything sent with it, analyzes it and
+// delivers the analysis to the sinks
+func (g *gatherAnalysis) analyze(ctx context.Context, input gathered) error {
+	cfg := g.cfg
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		return err
+	}
+	sanitizedLog, count, findings := redactor.RedactWithDetails(input.Log, true)
+	payload := config.QueryPayload{
+		RawLog:       input.Log,
+		SanitizedLog: sanitizedLog,
+		LineMap:      sanitizer.MapLines(input.Log, findings),
+		Truncated:    ingestor.Truncated(input.Log),
+		Hint:         input.Hint,
+	}
+	if !input.Remote {
+		payload.SystemContext = gatherContext(cfg)
+	}
+	if input.Interleave != nil && !payload.Truncated {
+		if interleaved, lineMap, ok := input.Interleave(payload.SanitizedLog); ok {
+			payload.SanitizedLog = interleaved
+			payload.LineMap = payload.LineMap.Then(lineMap)
+		}
+	}
+	if omitted := recognizeToolchain(&payload, ""); omitted > 0 {
+		advisor.Report(cfg, "Kept the failing %s tasks and errors, left out %d lines of build output", payload.Toolchain, omitted)
+	}
+
+	for _, attachment := range input.Attachments {
+		var attachmentCount int
+		var attachmentFindings []config.FindingDetail
+		attachment.Content, attachmentCount, attachmentFindings = redactor.RedactWithDetails(attachment.Content, true)
+		count += attachmentCount
+		findings = append(findings, attachmentFindings...)
+		payload.Attachments = append(payload.Attachments, attachment)
+	}
+	if count > 0 {
+		advisor.Report(cfg, "Redacted %d potential secrets", count)
+	}
+	payload.Findings = append(findings, sanitizer.RedactPayload(redactor, &payload)...)
+	model := llm.ResolveModel(cfg.Provider, cfg.Model)
+	if report := summarizeLog(&payload, llm.LogBudget(cfg, payload), model); report.Summarized {
+		advisor.Report(cfg, "Input too large for %s, %s", model, report)
+	}
+
+	analysis, err := advisor.Analyze(ctx, g.client, cfg, payload)
+	if err != nil {
+		return fmt.Errorf("failed to get advice: %w", err)
+	}
+	return advisor.Deliver(g.sinks, analysis)
+}
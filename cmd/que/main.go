@@ -1,16 +1,27 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/jenian/que/internal/advisor"
 	"github.com/jenian/que/internal/config"
 	"github.com/jenian/que/internal/enricher"
+	"github.com/jenian/que/internal/httpclient"
 	"github.com/jenian/que/internal/ingestor"
+	"github.com/jenian/que/internal/logging"
 	"github.com/jenian/que/internal/sanitizer"
+	"github.com/jenian/que/internal/session"
+	"github.com/jenian/que/internal/summarizer"
 	"github.com/jenian/que/pkg/llm"
 	"github.com/spf13/cobra"
 )
@@ -21,152 +32,1055 @@ var (
 	Version = "dev"
 )
 
+const usageExamples = `  cat server.log | que
+  tail -n 50 error.log | que --provider claude
+  kubectl logs pod-name | que --no-context
+  cat error.log | que -i
+  kubectl logs payments-7d9f | que --session payments-outage -i`
+
 var (
 	providerFlag    string
 	modelFlag       string
 	verboseFlag     bool
 	noContextFlag   bool
 	dryRunFlag      bool
+	showPromptFlag  bool
+	showPromptOnly  bool
 	interactiveFlag bool
+	teeFlag         bool
+	outputFlag      string
+	outFileFlag     string
+	postmortemFlag  string
+	logLevelFlag    string
+	logFileFlag     string
+	promptVersion   string
+	dialectFlag     string
+	fewShotFlag     string
+	fewShotFile     string
+	hintFlag        string
+	logTypeFlag     string
+	sessionFlag     string
+	promptFileFlag  string
+	noSchemaFlag    bool
+	investigateFlag bool
+	maxRoundsFlag   int
+	contextFiles    []string
+	notifyFlags     []string
+	statsFlag       bool
+	quietFlag       bool
+	utcFlag         bool
+	paranoidFlag    bool
+	progressFlag    string
+	// progressJSON is set once the config asks for JSON progress events, so
+	// the final error is reported the same way
+	progressJSON bool
+	healthFlag   bool
+	smartFlag    bool
+	triageFlag   string
+	stripFlag    bool
+	baseURLFlag  string
+	retriesFlag  int
+	budgetFlag   time.Duration
+	timeoutFlag  time.Duration
+	maxTokens    int
+	temperature  float64
+	previousFlag string
 )
 
 func main() {
+	advisor.Version = Version
 	rootCmd := &cobra.Command{
 		Use:     "que",
 		Short:   "The pipe-able DevOps assistant",
 		Long:    fmt.Sprintf("Que is a CLI utility that analyzes logs and errors from stdin using LLMs to suggest fixes.\n\nVersion: %s", Version),
 		Version: Version,
+		Example: usageExamples,
 		RunE:    runQue,
+		// Errors are printed by main along with remediation hints
+		SilenceErrors: true,
+		SilenceUsage:  true,
 	}
 
-	rootCmd.Flags().StringVarP(&providerFlag, "provider", "p", "", "LLM provider to use (openai, claude)")
+	rootCmd.Flags().StringVarP(&providerFlag, "provider", "p", "", "LLM provider to use ("+strings.Join(llm.ProviderNames(), ", ")+")")
 	rootCmd.Flags().StringVarP(&modelFlag, "model", "m", "", "Specific model override (e.g., gpt-4-turbo)")
+	rootCmd.Flags().StringVar(&baseURLFlag, "base-url", "", "OpenAI-compatible API for the openai provider (e.g., http://localhost:8000/v1 for vLLM)")
 	rootCmd.Flags().BoolVarP(&verboseFlag, "verbose", "v", false, "Show what data is being sent (including redaction)")
+	rootCmd.Flags().StringArrayVar(&contextFiles, "context-file", nil, "Attach a file (e.g., docker-compose.yml) to the prompt; can be repeated")
 	rootCmd.Flags().BoolVar(&noContextFlag, "no-context", false, "Skip environment context gathering")
 	rootCmd.Flags().BoolVar(&dryRunFlag, "dry-run", false, "Perform redaction and context gathering but do not call API")
+	rootCmd.Flags().BoolVar(&showPromptFlag, "show-prompt", false, "Print the final prompt sent to the LLM (on stderr) before querying")
+	rootCmd.Flags().BoolVar(&showPromptOnly, "show-prompt-only", false, "Print the final prompt sent to the LLM and exit without querying")
 	rootCmd.Flags().BoolVarP(&interactiveFlag, "interactive", "i", false, "Enter interactive mode for follow-up questions")
+	rootCmd.Flags().StringVarP(&outputFlag, "output", "o", advisor.FormatText, "Where to send the analysis, comma-separated: text, markdown, json, problemmatcher, text-file, markdown-file, json-file, file=PATH, webhook[=URL], slack[=URL], teams[=URL], discord[=URL], email[=ADDRESS]")
+	rootCmd.Flags().StringArrayVar(&notifyFlags, "notify", nil, "Also send the analysis to a notification sink: webhook[=URL], slack[=URL], teams[=URL], discord[=URL], pagerduty[=KEY] or email[=ADDRESS]; can be repeated")
+	rootCmd.Flags().StringVar(&outFileFlag, "out", "", "Write the analysis to a file instead of stdout (e.g., analysis.md)")
+	rootCmd.Flags().StringVar(&postmortemFlag, "postmortem", "", "Also write a postmortem skeleton (summary, timeline, root cause, remediation, action items) to this markdown file")
+	rootCmd.Flags().BoolVar(&teeFlag, "tee", false, "Pass stdin through to stdout unmodified and print the analysis to stderr")
+	rootCmd.Flags().StringVar(&hintFlag, "hint", "", "Extra context for the model that the log doesn't contain (e.g., \"started after upgrading postgres to 16\")")
+	rootCmd.Flags().StringVar(&logTypeFlag, "log-type", "", "Treat the input as output of this tool ("+strings.Join(ingestor.Toolchains, ", ")+") instead of recognizing it, or none")
+	rootCmd.Flags().StringVar(&sessionFlag, "session", "", "Accumulate history, conversation and context files under a named session that can be resumed later")
+	rootCmd.Flags().StringVar(&previousFlag, "previous", "", "Compare with an earlier analysis, SESSION or SESSION:N (without a value: the latest run of --session), and report whether the issue is resolved")
+	rootCmd.Flags().Lookup("previous").NoOptDefVal = previousLatest
+	rootCmd.Flags().StringVar(&promptFileFlag, "system-prompt-file", "", "Replace the built-in system prompt with the contents of this file")
+	rootCmd.Flags().BoolVar(&noSchemaFlag, "no-schema", false, "Don't ask the model for the JSON response schema and print its answer as-is")
+	rootCmd.Flags().BoolVar(&investigateFlag, "investigate", false, "Let the model request read-only commands (each needs your approval) to confirm its diagnosis")
+	rootCmd.Flags().IntVar(&maxRoundsFlag, "max-rounds", advisor.DefaultInvestigateRounds, "Maximum number of command rounds for --investigate")
+	rootCmd.Flags().BoolVarP(&quietFlag, "quiet", "q", false, "Don't show progress stages and spinners on stderr (automatic in CI)")
+	rootCmd.Flags().BoolVar(&utcFlag, "utc", false, "Show timestamps in UTC instead of the local time zone")
+	rootCmd.Flags().BoolVar(&paranoidFlag, "paranoid", false, "Write nothing to disk: no sessions, diagnostic log file or command audit log")
+	rootCmd.Flags().StringVar(&progressFlag, "progress", "", "Progress output on stderr: auto (stages and spinners on a terminal) or json (JSON lines for wrappers)")
+	rootCmd.Flags().IntVar(&retriesFlag, "retries", config.DefaultRetries, "Retries of an API request after a server or network error (0 to fail at once)")
+	rootCmd.Flags().DurationVar(&timeoutFlag, "timeout", config.DefaultTimeout, "Time limit of an API request, including its retries (0 for none)")
+	rootCmd.Flags().IntVar(&maxTokens, "max-tokens", 0, "Most tokens the model may answer with (default 4096 for claude, the model's limit for openai)")
+	rootCmd.Flags().Float64Var(&temperature, "temperature", 0, "Sampling temperature from 0 to 2 (default: the provider's)")
+	rootCmd.Flags().DurationVar(&budgetFlag, "rate-limit-budget", config.DefaultRateLimitBudget, "Longest an API request waits in total for the provider's rate limit to pass (0 to fail at once)")
+	rootCmd.Flags().BoolVar(&healthFlag, "health-check", false, "Check the provider's key and model while reading input, failing before the analysis if they don't work")
+	rootCmd.Flags().BoolVar(&smartFlag, "smart-routing", false, "Ask a cheap triage model first and only query the selected model when it finds a problem")
+	rootCmd.Flags().StringVar(&triageFlag, "triage-model", "", "Model for the --smart-routing first pass (default: the provider's cheapest recommended model)")
+	rootCmd.Flags().BoolVar(&stripFlag, "strip-on-filter", false, "When the provider's content filter refuses the log, retry with only its error lines and stack traces without asking")
+	rootCmd.Flags().BoolVar(&statsFlag, "redaction-stats", false, "Print how many times each redaction rule fired at the end of the run")
+	rootCmd.Flags().StringVar(&logLevelFlag, "log-level", "", "Diagnostic log level (trace, debug, info, warn, error, disabled)")
+	rootCmd.Flags().StringVar(&promptVersion, "prompt-version", "", fmt.Sprintf("Pin the prompt template version (default %s)", llm.CurrentPromptVersion))
+	rootCmd.Flags().StringVar(&dialectFlag, "prompt-dialect", "", "Prompt layout: auto (from the provider and model), plain, xml, json or compact")
+	rootCmd.Flags().StringVar(&fewShotFlag, "few-shot", "", "Include example analyses in the prompt: auto (with the compact dialect), always or never")
+	rootCmd.Flags().StringVar(&fewShotFile, "few-shot-file", "", "Replace the built-in example analyses with those in this JSON file")
+	rootCmd.Flags().StringVar(&logFileFlag, "log-file", "", "Append debug-level diagnostic logs to this file (useful for bug reports)")
+
+	rootCmd.AddCommand(newRedactCmd())
+	rootCmd.AddCommand(newProvidersCmd())
+	rootCmd.AddCommand(newSessionsCmd())
+	rootCmd.AddCommand(newVerifyFixCmd())
+	rootCmd.AddCommand(newReportCmd())
+	rootCmd.AddCommand(newBatchCmd())
+	rootCmd.AddCommand(newComposeCmd())
+	rootCmd.AddCommand(newSystemdCmd())
+	rootCmd.AddCommand(newCICmd())
+	rootCmd.AddCommand(newBenchCmd())
+
+	// Ctrl-C cancels the requests in flight, so que cleans up the spinner and
+	// exits instead of being killed mid-request. Once canceled, signals get
+	// their default handling back, so a second Ctrl-C exits right away.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	if err != nil {
+		if progressJSON {
+			advisor.ReportError(err, remediationHint(err), exitCodeFor(err))
+			os.Exit(exitCodeFor(err))
+		}
+		if errors.Is(err, context.Canceled) {
+			fmt.Fprintln(os.Stderr, "Interrupted")
+			os.Exit(exitCodeInterrupted)
+		}
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		if hint := remediationHint(err); hint != "" {
+			color.New(color.FgYellow).Fprintf(os.Stderr, "Hint: %s\n", hint)
+		}
+		os.Exit(exitCodeFor(err))
 	}
 }
 
-func runQue(cmd *cobra.Command, args []string) error {
-	// Display header
-	printHeader()
-
-	// Load configuration
+// loadConfig builds the configuration shared by all commands from the config
+// file and environment variables; command flags are applied on top of it
+func loadConfig() (*config.Config, error) {
 	cfg := config.NewConfig()
+	if err := config.LoadFile(cfg, config.DefaultConfigPath()); err != nil {
+		return nil, err
+	}
+	llm.SetContextWindows(cfg.ContextWindows)
+	if err := llm.SetPromptDialects(cfg.PromptDialects); err != nil {
+		return nil, err
+	}
 
 	// Load environment variables
-	cfg.ChatGPTKey = os.Getenv("QUE_CHATGPT_API_KEY")
-	cfg.ClaudeKey = os.Getenv("QUE_CLAUDE_API_KEY")
+	cfg.LoadKeys()
+	if baseURL := os.Getenv("QUE_OPENAI_BASE_URL"); baseURL != "" {
+		cfg.OpenAIBaseURL = baseURL
+	}
+	if endpoint := os.Getenv("QUE_AZURE_OPENAI_ENDPOINT"); endpoint != "" {
+		cfg.Azure.Endpoint = endpoint
+	}
+	if apiVersion := os.Getenv("QUE_AZURE_OPENAI_API_VERSION"); apiVersion != "" {
+		cfg.Azure.APIVersion = apiVersion
+	}
+	if deployment := os.Getenv("QUE_AZURE_OPENAI_DEPLOYMENT"); deployment != "" {
+		cfg.Azure.Deployment = deployment
+	}
+	llm.SetDefaultModel("azure", cfg.Azure.Deployment)
 	if defaultProvider := os.Getenv("QUE_DEFAULT_PROVIDER"); defaultProvider != "" {
 		cfg.DefaultProvider = defaultProvider
 	}
+	cfg.LogLevel = os.Getenv("QUE_LOG_LEVEL")
+	cfg.LogFile = os.Getenv("QUE_LOG_FILE")
+	cfg.PromptVersion = os.Getenv("QUE_PROMPT_VERSION")
+	if dialect := os.Getenv("QUE_PROMPT_DIALECT"); dialect != "" {
+		cfg.PromptDialect = dialect
+	}
+	if fewShot := os.Getenv("QUE_FEW_SHOT"); fewShot != "" {
+		cfg.FewShot = fewShot
+	}
+	if file := os.Getenv("QUE_FEW_SHOT_FILE"); file != "" {
+		cfg.FewShotFile = file
+	}
+	if file := os.Getenv("QUE_MODELS_FILE"); file != "" {
+		cfg.ModelsFile = file
+	}
+	if cfg.ModelsFile != "" {
+		if err := llm.LoadModelCatalog(cfg.ModelsFile); err != nil {
+			return nil, err
+		}
+	}
+	if file := os.Getenv("QUE_CA_CERT"); file != "" {
+		cfg.CACert = file
+	}
+	if cfg.CACert != "" {
+		if err := httpclient.SetCACert(cfg.CACert); err != nil {
+			return nil, err
+		}
+	}
+	cfg.Session = os.Getenv("QUE_SESSION")
+	if value := os.Getenv("QUE_RETRIES"); value != "" {
+		retries, err := strconv.Atoi(value)
+		if err != nil || retries < 0 {
+			return nil, fmt.Errorf("invalid QUE_RETRIES %q: want a number of retries", value)
+		}
+		cfg.Retries = retries
+	}
+	if value := os.Getenv("QUE_RETRY_BACKOFF"); value != "" {
+		backoff, err := time.ParseDuration(value)
+		if err != nil || backoff <= 0 {
+			return nil, fmt.Errorf("invalid QUE_RETRY_BACKOFF %q: want a duration such as 2s", value)
+		}
+		cfg.RetryBackoff = backoff
+	}
+	llm.SetRetries(cfg.Retries, cfg.RetryBackoff)
+	if value := os.Getenv("QUE_RATE_LIMIT_BUDGET"); value != "" {
+		budget, err := time.ParseDuration(value)
+		if err != nil || budget < 0 {
+			return nil, fmt.Errorf("invalid QUE_RATE_LIMIT_BUDGET %q: want a duration such as 2m", value)
+		}
+		cfg.RateLimitBudget = budget
+	}
+	llm.SetRateLimitBudget(cfg.RateLimitBudget)
+	if value := os.Getenv("QUE_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("invalid QUE_TIMEOUT %q: want a duration such as 5m", value)
+		}
+		cfg.Timeout = timeout
+	}
+	if value := os.Getenv("QUE_MAX_TOKENS"); value != "" {
+		tokens, err := strconv.Atoi(value)
+		if err != nil || tokens <= 0 {
+			return nil, fmt.Errorf("invalid QUE_MAX_TOKENS %q: want a positive number of tokens", value)
+		}
+		cfg.MaxTokens = tokens
+	}
+	if value := os.Getenv("QUE_TEMPERATURE"); value != "" {
+		temperature, err := config.ParseTemperature(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid QUE_TEMPERATURE: %w", err)
+		}
+		cfg.Temperature = &temperature
+	}
+	if template := os.Getenv("QUE_REDACTION_PLACEHOLDER"); template != "" {
+		cfg.RedactionTemplate = template
+	}
+	if err := sanitizer.ValidatePlaceholderTemplate(cfg.RedactionTemplate); err != nil {
+		return nil, fmt.Errorf("invalid redaction placeholder: %w", err)
+	}
+	llm.SetRedactionTemplate(cfg.RedactionTemplate)
+	if webhookSecret := os.Getenv("QUE_WEBHOOK_SECRET"); webhookSecret != "" {
+		cfg.WebhookSecret = webhookSecret
+	}
+	// The standard OpenTelemetry variables, the traces one taken as-is
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		cfg.Tracing.Endpoint = endpoint
+	} else if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		cfg.Tracing.Endpoint = config.OTLPTracesURL(endpoint)
+	}
+	if value := os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"); value != "" {
+		headers, err := config.ParseOTLPHeaders(value)
+		if err != nil {
+			return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_HEADERS: %w", err)
+		}
+		cfg.Tracing.Headers = headers
+	}
+	if systemPromptFile := os.Getenv("QUE_SYSTEM_PROMPT_FILE"); systemPromptFile != "" {
+		cfg.SystemPromptFile = systemPromptFile
+	}
+	if envBool("QUE_NO_HEADER") {
+		cfg.UI.NoHeader = true
+	}
+	if envBool("QUE_NO_EMOJI") {
+		cfg.UI.NoEmoji = true
+	}
+	if spinnerStyle := os.Getenv("QUE_SPINNER"); spinnerStyle != "" {
+		cfg.UI.Spinner = spinnerStyle
+	}
+	if theme := os.Getenv("QUE_THEME"); theme != "" {
+		cfg.UI.Theme = theme
+	}
+	if envBool("QUE_SCREEN_READER") {
+		cfg.UI.ScreenReader = true
+	}
+	if envBool("QUE_QUIET") || quietFlag {
+		cfg.UI.Quiet = true
+	}
+	if envBool("QUE_UTC") || utcFlag {
+		cfg.UI.UTC = true
+	}
+	if envBool("QUE_PARANOID") || paranoidFlag {
+		cfg.Paranoid = true
+	}
+	if progress := os.Getenv("QUE_PROGRESS"); progress != "" {
+		cfg.UI.Progress = progress
+	}
+	if progressFlag != "" {
+		cfg.UI.Progress = progressFlag
+	}
+	if cfg.UI.Progress == advisor.ProgressJSON {
+		// Only JSON lines go to stderr, so skip the banner
+		progressJSON = true
+		cfg.UI.NoHeader = true
+	}
+	if cfg.UI.ScreenReader {
+		// Screen readers announce escape codes and decorative headers literally
+		color.NoColor = true
+		cfg.UI.NoHeader = true
+	}
+	if !cfg.UI.Quiet && !progressJSON {
+		llm.SetRateLimitNotice(printRateLimitNotice)
+	}
 
-	// Apply CLI flags
-	if providerFlag != "" {
-		cfg.Provider = providerFlag
-	} else {
-		cfg.Provider = cfg.DefaultProvider
+	return cfg, nil
+}
+
+// checkParanoid rejects settings that would write to disk in paranoid mode,
+// rather than silently dropping what the user asked for
+func checkParanoid(cfg *config.Config) error {
+	if !cfg.Paranoid {
+		return nil
+	}
+	if cfg.Session != "" {
+		return fmt.Errorf("--session stores the conversation on disk and cannot be used with --paranoid")
+	}
+	if cfg.LogFile != "" {
+		return fmt.Errorf("--log-file writes diagnostics to disk and cannot be used with --paranoid")
+	}
+	return nil
+}
+
+func runQue(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
 	}
+
+	// Display header
+	if !cfg.UI.NoHeader {
+		printHeader()
+	}
+
+	// Bare `que` in a terminal would otherwise block silently waiting for stdin.
+	// With -i it starts a chat instead, since there is nothing to read.
+	stdinIsTerminal := ingestor.StdinIsTerminal()
+	if stdinIsTerminal && (!interactiveFlag || dryRunFlag || showPromptOnly) {
+		printTTYGuidance()
+		return nil
+	}
+
+	// Apply CLI flags
+	selectProvider(cfg, providerFlag)
 	cfg.Model = modelFlag
 	cfg.Verbose = verboseFlag
 	cfg.NoContext = noContextFlag
 	cfg.DryRun = dryRunFlag
+	cfg.ShowPrompt = showPromptFlag
+	cfg.ShowPromptOnly = showPromptOnly
 	cfg.Interactive = interactiveFlag
+	cfg.Tee = teeFlag
+	cfg.Outputs = strings.Split(outputFlag, ",")
+	cfg.OutFile = outFileFlag
+	cfg.Postmortem = postmortemFlag
+	cfg.Notify = notifyFlags
+	if logLevelFlag != "" {
+		cfg.LogLevel = logLevelFlag
+	}
+	if logFileFlag != "" {
+		cfg.LogFile = logFileFlag
+	}
+	if promptVersion != "" {
+		cfg.PromptVersion = promptVersion
+	}
+	if dialectFlag != "" {
+		cfg.PromptDialect = dialectFlag
+	}
+	if fewShotFlag != "" {
+		cfg.FewShot = fewShotFlag
+	}
+	if fewShotFile != "" {
+		cfg.FewShotFile = fewShotFile
+	}
+	if sessionFlag != "" {
+		cfg.Session = sessionFlag
+	}
+	if promptFileFlag != "" {
+		cfg.SystemPromptFile = promptFileFlag
+	}
+	if noSchemaFlag {
+		cfg.NoSchema = true
+	}
+	if statsFlag {
+		cfg.RedactionStats = true
+	}
+	if healthFlag || envBool("QUE_HEALTH_CHECK") {
+		cfg.HealthCheck = true
+	}
+	if smartFlag || envBool("QUE_SMART_ROUTING") {
+		cfg.SmartRouting = true
+	}
+	if triageFlag != "" {
+		cfg.TriageModel = triageFlag
+	}
+	if stripFlag || envBool("QUE_STRIP_ON_FILTER") {
+		cfg.StripOnFilter = true
+	}
+	if baseURLFlag != "" {
+		cfg.OpenAIBaseURL = baseURLFlag
+	}
+	if cmd.Flags().Changed("retries") {
+		if retriesFlag < 0 {
+			return fmt.Errorf("--retries must not be negative")
+		}
+		cfg.Retries = retriesFlag
+		llm.SetRetries(cfg.Retries, cfg.RetryBackoff)
+	}
+	if cmd.Flags().Changed("rate-limit-budget") {
+		if budgetFlag < 0 {
+			return fmt.Errorf("--rate-limit-budget must not be negative")
+		}
+		cfg.RateLimitBudget = budgetFlag
+		llm.SetRateLimitBudget(cfg.RateLimitBudget)
+	}
+	if cmd.Flags().Changed("timeout") {
+		if timeoutFlag < 0 {
+			return fmt.Errorf("--timeout must not be negative")
+		}
+		cfg.Timeout = timeoutFlag
+	}
+	if cmd.Flags().Changed("max-tokens") {
+		if maxTokens <= 0 {
+			return fmt.Errorf("--max-tokens must be positive")
+		}
+		cfg.MaxTokens = maxTokens
+	}
+	if cmd.Flags().Changed("temperature") {
+		if temperature < 0 || temperature > 2 {
+			return fmt.Errorf("--temperature must be from 0 to 2")
+		}
+		cfg.Temperature = &temperature
+	}
+	cfg.Investigate = investigateFlag
+	cfg.InvestigateRounds = maxRoundsFlag
+	// Verbose mode implies debug diagnostics unless a level was chosen explicitly
+	if cfg.Verbose && cfg.LogLevel == "" {
+		cfg.LogLevel = "debug"
+	}
+
+	if err := checkParanoid(cfg); err != nil {
+		return err
+	}
+	closeLog, err := logging.Init(cfg.LogLevel, cfg.LogFile)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
 
 	// Validate provider
-	if cfg.Provider != "openai" && cfg.Provider != "claude" {
-		return fmt.Errorf("invalid provider: %s (must be 'openai' or 'claude')", cfg.Provider)
+	if err := llm.ValidateProvider(cfg.Provider); err != nil {
+		return err
 	}
+	resolveModel(cfg)
 
-	// Validate API key
-	if !cfg.DryRun {
-		if cfg.Provider == "openai" && cfg.ChatGPTKey == "" {
-			return fmt.Errorf("QUE_CHATGPT_API_KEY environment variable is required for OpenAI provider")
+	// Without an explicit --output, the severity routing table decides where the
+	// analysis goes; until the severity is known the default route applies
+	routed := len(cfg.Routes) > 0 && !cmd.Flags().Changed("output")
+	if routed {
+		if err := advisor.ValidateRoutes(cfg.Routes); err != nil {
+			return err
 		}
-		if cfg.Provider == "claude" && cfg.ClaudeKey == "" {
-			return fmt.Errorf("QUE_CLAUDE_API_KEY environment variable is required for Claude provider")
+		cfg.Outputs = advisor.DefaultRouteOutputs(cfg.Routes)
+	}
+
+	cfg.OutputFormat, err = advisor.ValidateOutputs(cfg.Outputs)
+	if err != nil {
+		return err
+	}
+	if cfg.OutputFormat == "" {
+		cfg.OutputFormat = advisor.FormatText
+	}
+
+	if err := advisor.ValidateSpinnerStyle(cfg.UI.Spinner); err != nil {
+		return err
+	}
+	if err := advisor.ValidateProgressMode(cfg.UI.Progress); err != nil {
+		return err
+	}
+	if err := advisor.ValidateTheme(cfg.UI.Theme, cfg.UI.SeverityColors); err != nil {
+		return err
+	}
+
+	if cfg.Tee && cfg.Interactive {
+		return fmt.Errorf("--tee cannot be combined with --interactive")
+	}
+
+	// Triage reads the status from the response schema
+	if cfg.SmartRouting && cfg.NoSchema {
+		return fmt.Errorf("--smart-routing cannot be combined with --no-schema")
+	}
+	// Nothing to save when the triage model is the selected model
+	if cfg.SmartRouting && llm.ResolveTriageModel(cfg.Provider, cfg.TriageModel) == llm.ResolveModel(cfg.Provider, cfg.Model) {
+		cfg.SmartRouting = false
+	}
+
+	if err := resolvePromptVersion(cfg); err != nil {
+		return err
+	}
+	if cfg.PromptDialect != "" {
+		if err := llm.ValidateDialect(cfg.PromptDialect); err != nil {
+			return err
+		}
+	}
+	if cfg.FewShot != "" {
+		if err := llm.ValidateFewShot(cfg.FewShot); err != nil {
+			return err
+		}
+	}
+	if logTypeFlag != "" && logTypeFlag != "none" && !slices.Contains(ingestor.Toolchains, logTypeFlag) {
+		return fmt.Errorf("unknown --log-type %q, want %s or none", logTypeFlag, strings.Join(ingestor.Toolchains, ", "))
+	}
+	if cfg.FewShotFile != "" {
+		if cfg.FewShotExamples, err = llm.LoadExamples(cfg.FewShotFile); err != nil {
+			return err
 		}
 	}
 
-	if cfg.Verbose {
-		fmt.Fprintf(os.Stderr, "Provider: %s\n", cfg.Provider)
-		if cfg.Model != "" {
-			fmt.Fprintf(os.Stderr, "Model: %s\n", cfg.Model)
+	if cfg.SystemPromptFile != "" {
+		data, err := os.ReadFile(cfg.SystemPromptFile)
+		if err != nil {
+			return fmt.Errorf("failed to read system prompt file: %w", err)
+		}
+		cfg.SystemPrompt = strings.TrimSpace(string(data))
+		if cfg.SystemPrompt == "" {
+			return fmt.Errorf("system prompt file %s is empty", cfg.SystemPromptFile)
 		}
 	}
 
-	// Pipeline: Ingestor → Enricher → Sanitizer → Advisor
-	rawLog, err := ingestor.Ingest()
+	// The analysis goes to stderr in tee mode, since stdout carries the pass-through data
+	analysisOut := io.Writer(os.Stdout)
+	if cfg.Tee {
+		analysisOut = os.Stderr
+	}
+	sinks, err := advisor.NewSinks(cfg, analysisOut)
 	if err != nil {
-		return fmt.Errorf("failed to ingest input: %w", err)
+		return err
+	}
+	if routed {
+		// Check every route's webhook URLs and keys now rather than after the analysis
+		for _, outputs := range cfg.Routes {
+			routeCfg := *cfg
+			routeCfg.Outputs = outputs
+			if _, err := advisor.NewSinks(&routeCfg, analysisOut); err != nil {
+				return err
+			}
+		}
 	}
 
-	if len(rawLog) == 0 {
-		return fmt.Errorf("no input provided on stdin")
+	// Catch bad command patterns before spending an API call
+	if cfg.Investigate {
+		if _, err := advisor.NewCommandPolicy(cfg); err != nil {
+			return err
+		}
+	}
+
+	// Open the named session up front so a bad name fails before reading stdin
+	var sess *session.Session
+	if cfg.Session != "" {
+		sess, err = session.Open(session.DefaultDir(), cfg.Session)
+		if err != nil {
+			return err
+		}
+		logging.Debug().Str("session", sess.Name).Int("runs", len(sess.Runs)).Msg("Opened session")
 	}
 
-	var ctx config.Context
-	if !cfg.NoContext {
-		ctx = enricher.Enrich()
-		if cfg.Verbose {
-			fmt.Fprintf(os.Stderr, "System Context: OS=%s, Arch=%s, Shell=%s\n", ctx.OS, ctx.Arch, ctx.Shell)
+	// Resolve the analysis to compare against before reading stdin, for the same reason
+	var previous *config.PreviousAnalysis
+	if previousFlag != "" {
+		if previous, err = loadPrevious(previousFlag, sess); err != nil {
+			return fmt.Errorf("--previous: %w", err)
 		}
 	}
 
-	redactor := sanitizer.NewRedactor()
-	var sanitizedLog string
-	var redactionCount int
+	// Validate API key
+	if !cfg.DryRun && !cfg.ShowPromptOnly {
+		provider, _ := llm.LookupProvider(cfg.Provider)
+		if err := provider.CheckEnv(); err != nil {
+			return err
+		}
+	}
 
-	if cfg.Verbose {
-		// In verbose mode, we still redact but don't show the count message
-		sanitizedLog, _ = redactor.Redact(rawLog)
-	} else {
-		sanitizedLog, redactionCount = redactor.Redact(rawLog)
-		if redactionCount > 0 {
-			fmt.Fprintf(os.Stderr, "Redacted %d potential secrets\n", redactionCount)
+	logging.Debug().Str("provider", cfg.Provider).Str("model", cfg.Model).Str("prompt_version", cfg.PromptVersion).Str("prompt_dialect", llm.PromptDialect(cfg)).Msg("Selected provider")
+
+	// Create LLM client (only if it will be queried)
+	var llmClient, triageClient llm.Client
+	checkProvider := func() error { return nil }
+	if !cfg.DryRun && !cfg.ShowPromptOnly {
+		llmClient, err = llm.NewClient(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to create LLM client: %w", err)
+		}
+		if cfg.SmartRouting {
+			if triageClient, err = llm.NewClient(advisor.TriageConfig(cfg)); err != nil {
+				return fmt.Errorf("failed to create triage LLM client: %w", err)
+			}
 		}
+		// Ping the provider while the input is read and redacted
+		if cfg.HealthCheck {
+			checkProvider = llm.StartHealthCheck(llmClient)
+		}
+		cfg.DropKeys()
+	}
+
+	// Size the input to the selected model's context window
+	model := llm.ResolveModel(cfg.Provider, cfg.Model)
+	// Read at least the default amount: the summarizer shrinks what doesn't
+	// fit better than cutting out the middle does
+	ingestLimit := max(ingestor.MaxInputSize, llm.LogByteBudget(model))
+
+	// Pipeline: Ingestor → Enricher → Sanitizer → Advisor
+	var rawLog string
+	if !stdinIsTerminal {
+		// Compile the redaction rules while waiting for the producer to finish
+		sanitizer.Preload()
+		doneIngesting := advisor.StartStage(cfg, "Ingesting")
+		if cfg.Tee {
+			rawLog, err = ingestor.IngestTee(os.Stdout, ingestLimit)
+		} else {
+			rawLog, err = ingestor.Ingest(ingestLimit)
+		}
+		doneIngesting()
+		if err != nil {
+			return fmt.Errorf("failed to ingest input: %w", err)
+		}
+		logging.Debug().Int("bytes", len(rawLog)).Msg("Ingested input")
+	}
+
+	if len(rawLog) == 0 {
+		if cfg.Interactive && !cfg.DryRun && !cfg.ShowPromptOnly {
+			return runChat(cmd.Context(), llmClient, cfg, sess)
+		}
+		return fmt.Errorf("no input provided on stdin")
+	}
+
+	ctx := gatherContext(cfg)
+
+	doneRedacting := advisor.StartStage(cfg, fmt.Sprintf("Redacting %d KB", (len(rawLog)+1023)/1024))
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		doneRedacting()
+		return err
+	}
+	sanitizedLog, redactionCount, findings := redactor.RedactWithDetails(rawLog, true)
+	lineMap := sanitizer.MapLines(rawLog, findings)
+	doneRedacting()
+
+	// In verbose mode, we still redact but don't show the count message
+	if !cfg.Verbose && redactionCount > 0 {
+		advisor.Report(cfg, "Redacted %d potential secrets", redactionCount)
 	}
 
 	payload := config.QueryPayload{
 		RawLog:        rawLog,
 		SanitizedLog:  sanitizedLog,
 		SystemContext: ctx,
+		Findings:      findings,
+		LineMap:       lineMap,
+		Previous:      previous,
+		Truncated:     ingestor.Truncated(rawLog),
+	}
+	labelSources(&payload)
+	if omitted := recognizeToolchain(&payload, logTypeFlag); omitted > 0 {
+		advisor.Report(cfg, "Kept the failing %s tasks and errors, left out %d lines of build output", payload.Toolchain, omitted)
 	}
 
-	// Create LLM client (only if not in dry-run mode)
-	var llmClient llm.Client
-	if !cfg.DryRun {
-		var err error
-		llmClient, err = llm.NewClient(cfg)
+	payload.Hint = strings.TrimSpace(hintFlag)
+
+	for _, path := range contextFiles {
+		attachment, err := ingestor.ReadAttachment(path)
 		if err != nil {
-			return fmt.Errorf("failed to create LLM client: %w", err)
+			return fmt.Errorf("failed to read context file: %w", err)
 		}
+		var count int
+		var fileFindings []config.FindingDetail
+		attachment.Content, count, fileFindings = redactor.RedactWithDetails(attachment.Content, true)
+		findings = append(findings, fileFindings...)
+		if count > 0 && !cfg.Verbose {
+			// The path may hold a secret too, e.g. a token in a presigned URL
+			name, _ := redactor.Redact(path)
+			advisor.Report(cfg, "Redacted %d potential secrets in %s", count, name)
+		}
+		if sess != nil {
+			sess.AddAttachment(attachment)
+		} else {
+			payload.Attachments = append(payload.Attachments, attachment)
+		}
+	}
+	// Context files attached earlier in the session stay attached
+	if sess != nil {
+		payload.Attachments = sess.Attachments
+	}
+	// What the tool that wrote the log ran with is only sent for this query,
+	// since the working directory may change within a session
+	if toolchain := inspectToolchain(cmd.Context(), cfg, payload); len(toolchain) > 0 {
+		payload.Attachments = append(slices.Clip(payload.Attachments), toolchain...)
+	}
+	// Everything besides the log leaves the machine too: the hint, the system
+	// context, the attachments and the previous analysis
+	findings = append(findings, sanitizer.RedactPayload(redactor, &payload)...)
+	payload.Findings = findings
+
+	// Shrink the log if it would overflow the selected model's context window
+	// next to the rest of the prompt
+	budget := llm.LogBudget(cfg, payload)
+	if cfg.SmartRouting {
+		// Both models see the same log, so it has to fit the smaller one
+		budget = min(budget, llm.LogBudget(advisor.TriageConfig(cfg), payload))
+	}
+	if report := summarizeLog(&payload, budget, model); report.Summarized {
+		advisor.Report(cfg, "Input too large for %s, %s", model, report)
+	}
+
+	if cfg.RedactionStats {
+		defer printRedactionStats(os.Stderr, findings)
+	}
+
+	// Show the final prompt independently of the much noisier --verbose output
+	if cfg.ShowPromptOnly {
+		fmt.Print(advisor.FormatPrompt(cfg, payload))
+		return nil
+	}
+	if cfg.ShowPrompt {
+		fmt.Fprint(os.Stderr, advisor.FormatPrompt(cfg, payload))
+	}
+
+	// Dry runs only describe the request, so they bypass the sinks
+	if cfg.DryRun {
+		report, err := advisor.Advise(cmd.Context(), llmClient, cfg, payload)
+		if err != nil {
+			return fmt.Errorf("failed to get advice: %w", err)
+		}
+		if cfg.OutFile != "" && report != "" {
+			if err := os.WriteFile(cfg.OutFile, []byte(report), 0644); err != nil {
+				return fmt.Errorf("failed to write output file: %w", err)
+			}
+			advisor.Report(cfg, "Dry-run report written to %s", cfg.OutFile)
+			return nil
+		}
+		fmt.Fprint(analysisOut, report)
+		return nil
+	}
+
+	if err := checkProvider(); err != nil {
+		return fmt.Errorf("provider health check failed: %w", err)
 	}
 
 	// Call advisor
-	response, err := advisor.Advise(llmClient, cfg, payload)
+	var analysis *advisor.Analysis
+	if triageClient != nil {
+		analysis, err = advisor.AnalyzeWithTriage(cmd.Context(), triageClient, llmClient, cfg, payload)
+	} else {
+		analysis, err = advisor.Analyze(cmd.Context(), llmClient, cfg, payload)
+	}
+	if err != nil {
+		analysis, err = advisor.RetryContentFiltered(cmd.Context(), llmClient, cfg, payload, err)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to get advice: %w", err)
 	}
 
-	// Output response
-	fmt.Print(response)
+	if cfg.Investigate && !analysis.NoProblem() {
+		analysis, err = advisor.Investigate(cmd.Context(), llmClient, cfg, payload, analysis, redactor)
+		if err != nil {
+			return fmt.Errorf("investigation failed: %w", err)
+		}
+	}
+
+	if routed {
+		cfg.Outputs = advisor.RouteOutputs(cfg.Routes, analysis)
+		if sinks, err = advisor.NewSinks(cfg, analysisOut); err != nil {
+			return err
+		}
+		logging.Debug().Str("severity", analysis.Severity()).Strs("outputs", cfg.Outputs).Msg("Routed analysis")
+	}
+
+	if err := advisor.Deliver(sinks, analysis); err != nil {
+		return fmt.Errorf("failed to deliver analysis: %w", err)
+	}
+	response := analysis.Text()
+
+	if sess != nil {
+		sess.RecordRun(session.Run{
+			Provider:      cfg.Provider,
+			Model:         model,
+			PromptVersion: cfg.PromptVersion,
+			Hint:          payload.Hint,
+			Response:      response,
+			Category:      analysis.Category(),
+		}, advisor.InitialUserMessage(payload))
+		if err := sess.Save(); err != nil {
+			return err
+		}
+	}
 
 	// Handle interactive mode (only if problems were detected)
-	// Skip interactive mode if the response indicates no problems
-	noProblemsDetected := strings.Contains(response, "no problems detected")
-	if cfg.Interactive && !cfg.DryRun && !noProblemsDetected {
-		return advisor.RunInteractive(llmClient, cfg, payload, response)
+	if cfg.Interactive && !analysis.NoProblem() {
+		if sess != nil {
+			// Follow-ups see everything discussed earlier in the session
+			return advisor.RunConversation(cmd.Context(), llmClient, cfg, sess.Conversation, advisor.ConversationOptions{
+				OnTurn: func(history []string) error {
+					sess.Conversation = history
+					return sess.Save()
+				},
+				Analysis: analysis,
+				Redactor: redactor,
+			})
+		}
+		return advisor.RunInteractive(cmd.Context(), llmClient, cfg, payload, analysis, redactor)
 	}
 
 	return nil
 }
 
+// selectProvider sets cfg.Provider from the --provider flag, falling back to the default provider
+func selectProvider(cfg *config.Config, flag string) {
+	if flag != "" {
+		cfg.Provider = flag
+		return
+	}
+	cfg.Provider = cfg.DefaultProvider
+	// A build with a single provider uses it whatever the default says
+	if available := llm.ProviderNames(); len(available) == 1 {
+		cfg.Provider = available[0]
+	}
+}
+
+// resolvePromptVersion checks the prompt version pinned in cfg and replaces
+// it, or the empty default, with the version of the template it selects, so
+// the version that was used can be reported and recorded
+func resolvePromptVersion(cfg *config.Config) error {
+	tmpl, err := llm.GetPromptTemplate(cfg.PromptVersion)
+	if err != nil {
+		return err
+	}
+	cfg.PromptVersion = tmpl.Version
+	return nil
+}
+
+// resolveModel replaces a model alias in cfg.Model, or the provider's default
+// model when there is none, with the model ID it stands for, and warns when
+// the configured model is deprecated or not one of the provider's
+func resolveModel(cfg *config.Config) {
+	model := llm.ResolveModel(cfg.Provider, cfg.Model)
+	if id := llm.ResolveAlias(cfg, model); id != model {
+		logging.Debug().Str("alias", model).Str("model", id).Msg("Resolved model alias")
+		model = id
+	}
+	if cfg.Model != "" {
+		if warning := llm.ModelWarning(cfg, model); warning != "" {
+			advisor.Report(cfg, "Warning: %s", warning)
+		}
+	}
+	if model != "" {
+		cfg.Model = model
+	}
+}
+
+// previousLatest is the --previous value used when the flag is given without
+// one; "@" can't start a session name
+const previousLatest = "@latest"
+
+// loadPrevious resolves a --previous reference to the analysis it names
+func loadPrevious(ref string, sess *session.Session) (*config.PreviousAnalysis, error) {
+	source, n := sess, 0
+	if ref == previousLatest {
+		if sess == nil {
+			return nil, fmt.Errorf("a value is required without --session")
+		}
+	} else {
+		name, number, err := session.ParseRunRef(ref)
+		if err != nil {
+			return nil, err
+		}
+		n = number
+		if sess == nil || sess.Name != name {
+			if source, err = session.Open(session.DefaultDir(), name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	run, err := source.RunAt(n)
+	if err != nil {
+		return nil, err
+	}
+	return advisor.NewPreviousAnalysis(run.Response, run.Timestamp), nil
+}
+
+// labelSources tells the model which pods and containers the lines of a
+// kubectl logs --prefix log come from and, when kubectl wrote timestamps,
+// interleaves the containers' lines in time order. A truncated log keeps its
+// order, since the cut would end up next to unrelated lines.
+func labelSources(payload *config.QueryPayload) {
+	payload.Sources = ingestor.KubectlSources(payload.SanitizedLog)
+	if payload.Sources == nil || payload.Truncated {
+		return
+	}
+	interleaved, lineMap, ok := ingestor.InterleaveByTimestamp(payload.SanitizedLog)
+	if !ok {
+		return
+	}
+	payload.SanitizedLog = interleaved
+	payload.LineMap = payload.LineMap.Then(lineMap)
+	payload.Interleaved = true
+	logging.Debug().Int("containers", len(payload.Sources)).Bool("reordered", lineMap != nil).Msg("Interleaved kubectl log by timestamp")
+}
+
+// recognizeToolchain sets the tool that wrote the log, the one named by
+// logType or else the one recognized in it, and reduces the output of mobile
+// builds to their failures. It returns how many lines were left out.
+func recognizeToolchain(payload *config.QueryPayload, logType string) int {
+	switch logType {
+	case "":
+		payload.Toolchain = ingestor.DetectToolchain(payload.SanitizedLog)
+	case "none":
+		payload.Toolchain = ""
+	default:
+		payload.Toolchain = logType
+	}
+	filtered, report := summarizer.FilterBuild(payload.Toolchain, payload.SanitizedLog)
+	if report.LinesOmitted == 0 {
+		return 0
+	}
+	payload.SanitizedLog = filtered
+	payload.LineMap = payload.LineMap.Then(report.LineMap)
+	payload.Filtered = true
+	logging.Debug().Str("toolchain", payload.Toolchain).Int("omitted", report.LinesOmitted).Msg("Filtered build output")
+	return report.LinesOmitted
+}
+
+// summarizeLog shrinks the log of payload to budget tokens of model, keeping
+// its line map in step
+func summarizeLog(payload *config.QueryPayload, budget int, model string) summarizer.Report {
+	var report summarizer.Report
+	payload.SanitizedLog, report = summarizer.Summarize(payload.SanitizedLog, budget, model)
+	payload.LineMap = payload.LineMap.Then(report.LineMap)
+	payload.Summarized = report.Summarized
+	return report
+}
+
+// printRateLimitNotice tells the user an API request waits for a rate limit,
+// on its own line even while a spinner is running
+func printRateLimitNotice(message string) {
+	if ingestor.IsTerminal(os.Stderr) && !color.NoColor {
+		message = "\r\x1b[K" + color.YellowString(message)
+	}
+	fmt.Fprintln(os.Stderr, message)
+}
+
+// newRedactor builds the redactor with cfg's placeholders, failing on a broken
+// .gitleaks-custom.toml rather than running with rules the user didn't intend
+func newRedactor(cfg *config.Config) (config.Redactor, error) {
+	ruleset, err := sanitizer.LoadRuleset(sanitizer.CustomConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid custom redaction rules: %w", err)
+	}
+	return sanitizer.NewRedactor(sanitizer.WithRuleset(ruleset), sanitizer.WithPlaceholderTemplate(cfg.RedactionTemplate)), nil
+}
+
+// printRedactionStats prints a compact table of how often each rule fired
+func printRedactionStats(w io.Writer, findings []config.FindingDetail) {
+	counts := sanitizer.CountByRule(findings)
+	if len(counts) == 0 {
+		fmt.Fprintln(w, "\nRedactions by rule: none")
+		return
+	}
+
+	width := 0
+	for _, rc := range counts {
+		width = max(width, len(rc.RuleID))
+	}
+	fmt.Fprintln(w, "\nRedactions by rule:")
+	for _, rc := range counts {
+		fmt.Fprintf(w, "  %-*s  ×%d\n", width, rc.RuleID, rc.Count)
+	}
+}
+
+// runChat starts an interactive session without a piped log. A named session
+// is resumed where it left off; otherwise the chat opens with the system context.
+func runChat(ctx context.Context, llmClient llm.Client, cfg *config.Config, sess *session.Session) error {
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		return err
+	}
+	system := gatherContext(cfg)
+	sanitizer.RedactContext(redactor, &system)
+
+	if sess == nil {
+		return advisor.RunConversation(ctx, llmClient, cfg, advisor.StartChat(system), advisor.ConversationOptions{Redactor: redactor})
+	}
+
+	if len(sess.Conversation) == 0 {
+		sess.Conversation = advisor.StartChat(system)
+	}
+	return advisor.RunConversation(ctx, llmClient, cfg, sess.Conversation, advisor.ConversationOptions{
+		OnTurn: func(history []string) error {
+			sess.Conversation = history
+			return sess.Save()
+		},
+		Redactor: redactor,
+	})
+}
+
+// gatherContext collects the host environment unless --no-context is set
+func gatherContext(cfg *config.Config) config.Context {
+	if cfg.NoContext {
+		return config.Context{}
+	}
+	defer advisor.StartStage(cfg, "Enriching")()
+	ctx := enricher.Enrich()
+	ctx.Timestamp = ctx.Timestamp.In(cfg.UI.Location())
+	logging.Debug().Str("os", ctx.OS).Str("arch", ctx.Arch).Str("shell", ctx.Shell).Msg("Gathered system context")
+	return ctx
+}
+
+// inspectToolchain gathers the versions and configuration of the build tool
+// that wrote the log unless --no-context is set
+func inspectToolchain(ctx context.Context, cfg *config.Config, payload config.QueryPayload) []config.Attachment {
+	if cfg.NoContext || payload.Toolchain == "" {
+		return nil
+	}
+	defer advisor.StartStage(cfg, "Inspecting "+payload.Toolchain)()
+	attachments := enricher.Toolchain(ctx, payload.Toolchain, payload.SanitizedLog)
+	logging.Debug().Str("toolchain", payload.Toolchain).Int("attachments", len(attachments)).Msg("Gathered toolchain context")
+	return attachments
+}
+
 // printHeader displays a nice visual header with the tool name and version
 func printHeader() {
 	// Use bold cyan for the main text
@@ -177,3 +1091,22 @@ func printHeader() {
 	headerColor.Fprint(os.Stderr, "[ Que? ]")
 	versionColor.Fprintf(os.Stderr, "  version %s\n\n", Version)
 }
+
+// envBool reports whether the environment variable name is set to a true value (1, true, yes)
+func envBool(name string) bool {
+	switch strings.ToLower(os.Getenv(name)) {
+	case "1", "true", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// printTTYGuidance explains how to feed input to que when stdin is a terminal
+func printTTYGuidance() {
+	hintColor := color.New(color.FgYellow)
+
+	hintColor.Fprintln(os.Stderr, "No input piped to que. Pipe logs or errors into it, for example:")
+	fmt.Fprintf(os.Stderr, "\n%s\n\n", usageExamples)
+	fmt.Fprintln(os.Stderr, "Run 'que --help' for all flags.")
+}
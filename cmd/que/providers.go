@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/pkg/llm"
+	"github.com/spf13/cobra"
+)
+
+// newProvidersCmd returns the `que providers` command group
+func newProvidersCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "providers",
+		Short: "Show the LLM providers included in this build",
+		Args:  cobra.NoArgs,
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the LLM providers included in this build and the provider plugins on PATH, whether they are configured, and which one is used",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			selectProvider(cfg, "")
+			printProviders(os.Stdout, append(llm.Providers(), llm.Plugins()...), cfg.Provider)
+			fmt.Fprintf(os.Stdout, "\nWithout --provider, que uses %s (%s)\n", cfg.Provider, selectionReason(cfg))
+			return nil
+		},
+	})
+	return cmd
+}
+
+// printProviders writes one line per provider with its default model, the
+// environment variables it needs and whether they are all set, or the path
+// of a plugin. The selected provider is marked with "*".
+func printProviders(w io.Writer, providers []llm.Provider, selected string) {
+	if len(providers) == 0 {
+		fmt.Fprintln(w, "No providers are included in this build")
+		return
+	}
+
+	nameWidth, modelWidth, envWidth := len("PROVIDER"), len("DEFAULT MODEL"), len("ENVIRONMENT")
+	for _, p := range providers {
+		nameWidth = max(nameWidth, len(p.Name))
+		modelWidth = max(modelWidth, len(p.DefaultModel))
+		envWidth = max(envWidth, len(strings.Join(p.EnvVars, ", ")))
+	}
+
+	fmt.Fprintf(w, "  %-*s  %-*s  %-*s  %s\n", nameWidth, "PROVIDER", modelWidth, "DEFAULT MODEL", envWidth, "ENVIRONMENT", "STATUS")
+	for _, p := range providers {
+		status := "ready"
+		if p.Plugin != "" {
+			status = "plugin " + p.Plugin
+		} else if missing := p.MissingEnv(); len(missing) > 0 {
+			status = "missing " + strings.Join(missing, ", ")
+		}
+		marker := " "
+		if p.Name == selected {
+			marker = "*"
+		}
+		fmt.Fprintf(w, "%s %-*s  %-*s  %-*s  %s\n", marker, nameWidth, p.Name, modelWidth, p.DefaultModel, envWidth, strings.Join(p.EnvVars, ", "), status)
+	}
+}
+
+// selectionReason explains where the provider selectProvider chose for cfg came from
+func selectionReason(cfg *config.Config) string {
+	switch {
+	case len(llm.ProviderNames()) == 1:
+		return "the only provider in this build"
+	case os.Getenv("QUE_DEFAULT_PROVIDER") != "":
+		return "from QUE_DEFAULT_PROVIDER"
+	case cfg.DefaultProvider != config.NewConfig().DefaultProvider:
+		return "from default_provider in " + config.DefaultConfigPath()
+	default:
+		return "the built-in default; change it with QUE_DEFAULT_PROVIDER or default_provider in " + config.DefaultConfigPath()
+	}
+}
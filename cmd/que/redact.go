@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/sanitizer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	redactStreamFlag bool
+	redactWindowFlag int
+	redactDelayFlag  time.Duration
+)
+
+// newRedactCmd returns the `que redact` subcommand, which only redacts stdin
+// and never contacts an LLM
+func newRedactCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "redact",
+		Short: "Redact secrets from stdin and write the result to stdout, without analysis",
+		Example: `  cat app.log | que redact > app.redacted.log
+  tail -F app.log | que redact --stream | vector --config shipper.toml`,
+		Args: cobra.NoArgs,
+		RunE: runRedact,
+	}
+
+	cmd.Flags().BoolVar(&redactStreamFlag, "stream", false, "Filter line by line with bounded latency instead of reading all input first (for log shippers)")
+	cmd.Flags().IntVar(&redactWindowFlag, "window", sanitizer.DefaultStreamWindow, "Lines of context used to detect secrets spanning lines in --stream mode")
+	cmd.Flags().DurationVar(&redactDelayFlag, "max-delay", sanitizer.DefaultStreamMaxDelay, "Longest a line may be held back in --stream mode")
+
+	return cmd
+}
+
+func runRedact(cmd *cobra.Command, args []string) error {
+	// Compile the redaction rules while the first input is still on its way
+	sanitizer.Preload()
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	if redactStreamFlag {
+		count, err = sanitizer.RedactStream(os.Stdin, os.Stdout, redactor, sanitizer.StreamOptions{
+			Window:   redactWindowFlag,
+			MaxDelay: redactDelayFlag,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to redact stream: %w", err)
+		}
+	} else {
+		count, err = redactAll(os.Stdin, os.Stdout, redactor)
+		if err != nil {
+			return err
+		}
+	}
+
+	if count > 0 {
+		fmt.Fprintf(os.Stderr, "Redacted %d potential secrets\n", count)
+	}
+	return nil
+}
+
+// redactAll redacts all of r to w. Unlike the input of an analysis it is
+// never truncated: a filter must not drop the middle of a large log.
+func redactAll(r io.Reader, w io.Writer, redactor config.Redactor) (int, error) {
+	rawLog, err := io.ReadAll(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to ingest input: %w", err)
+	}
+	defer clear(rawLog)
+	redacted, count := redactor.Redact(string(rawLog))
+	if _, err := io.WriteString(w, redacted); err != nil {
+		return count, fmt.Errorf("failed to write output: %w", err)
+	}
+	return count, nil
+}
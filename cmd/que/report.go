@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/jenian/que/internal/session"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportCommitFlag string
+	reportRefFlag    string
+)
+
+// newReportCmd returns the `que report` command group, which files recorded
+// analyses in other systems
+func newReportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "File a recorded analysis somewhere else",
+		Args:  cobra.NoArgs,
+	}
+
+	gitNote := &cobra.Command{
+		Use:   "git-note SESSION[:N]",
+		Short: "Attach an analysis recorded in a session to a commit as a git note",
+		Long: `Attach an analysis recorded in a session (by default its latest run) to a
+commit as a git note, keeping a record of what broke and how it was fixed in
+the repository history. The analysis was made from redacted input and is
+redacted again before it is written. Notes are appended, so a commit can
+collect several analyses.`,
+		Example: `  kubectl logs payments-7d9f | que --session payments-outage
+  git commit -am "Raise the payments DB pool size"
+  que report git-note payments-outage
+  git log --notes=que`,
+		Args: cobra.ExactArgs(1),
+		RunE: runReportGitNote,
+	}
+	gitNote.Flags().StringVar(&reportCommitFlag, "commit", "HEAD", "Commit to attach the note to")
+	gitNote.Flags().StringVar(&reportRefFlag, "ref", "que", "Notes ref to write to (see git notes --ref)")
+	cmd.AddCommand(gitNote)
+
+	return cmd
+}
+
+func runReportGitNote(cmd *cobra.Command, args []string) error {
+	name, n, err := session.ParseRunRef(args[0])
+	if err != nil {
+		return err
+	}
+	sess, err := session.Open(session.DefaultDir(), name)
+	if err != nil {
+		return err
+	}
+	run, err := sess.RunAt(n)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		return err
+	}
+
+	note, count := redactor.Redact(gitNoteText(sess.Name, run))
+	if err := addGitNote("", reportRefFlag, reportCommitFlag, note); err != nil {
+		return err
+	}
+	if count > 0 {
+		fmt.Fprintf(os.Stderr, "Redacted %d potential secrets\n", count)
+	}
+	fmt.Fprintf(os.Stderr, "Added the analysis to the notes of %s (show them with: git log --notes=%s)\n", reportCommitFlag, reportRefFlag)
+	return nil
+}
+
+// gitNoteText renders a recorded run as a git note: a line saying where the
+// analysis comes from, then the analysis as recorded (plain text)
+func gitNoteText(sessionName string, run session.Run) string {
+	source := fmt.Sprintf("que analysis from session %s, %s", sessionName, run.Timestamp.UTC().Format("2006-01-02 15:04:05 MST"))
+	if run.Model != "" && run.PromptVersion != "" {
+		source += fmt.Sprintf(" (%s/%s, prompt %s)", run.Provider, run.Model, run.PromptVersion)
+	} else if run.Model != "" {
+		source += fmt.Sprintf(" (%s/%s)", run.Provider, run.Model)
+	}
+	if run.Hint != "" {
+		source += "\nHint: " + run.Hint
+	}
+	return source + "\n\n" + strings.TrimSpace(run.Response) + "\n"
+}
+
+// addGitNote appends note to the notes of commit under refs/notes/ref,
+// running git in dir ("" for the current directory)
+func addGitNote(dir, ref, commit, note string) error {
+	command := exec.Command("git", "notes", "--ref", ref, "append", "-F", "-", commit)
+	command.Dir = dir
+	command.Stdin = strings.NewReader(note)
+	var stderr bytes.Buffer
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("git notes failed: %s", message)
+		}
+		return fmt.Errorf("git notes failed: %w", err)
+	}
+	return nil
+}
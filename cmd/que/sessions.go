@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jenian/que/internal/session"
+	"github.com/spf13/cobra"
+)
+
+// newSessionsCmd returns the `que sessions` command group
+func newSessionsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sessions",
+		Short: "Show the named sessions recorded with --session",
+		Args:  cobra.NoArgs,
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list [SESSION]",
+		Short: "List the recorded sessions, or the runs of one session with the provider, model and prompt version of each",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				sess, err := session.Open(session.DefaultDir(), args[0])
+				if err != nil {
+					return err
+				}
+				if len(sess.Runs) == 0 {
+					return fmt.Errorf("session %s has no recorded runs", sess.Name)
+				}
+				printRuns(os.Stdout, sess.Runs)
+				return nil
+			}
+			sessions, err := session.List(session.DefaultDir())
+			if err != nil {
+				return err
+			}
+			printSessions(os.Stdout, sessions)
+			return nil
+		},
+	})
+	return cmd
+}
+
+// printSessions writes one line per session with its number of runs and
+// when it was last updated
+func printSessions(w io.Writer, sessions []*session.Session) {
+	if len(sessions) == 0 {
+		fmt.Fprintln(w, "No sessions have been recorded")
+		return
+	}
+
+	nameWidth := len("SESSION")
+	for _, s := range sessions {
+		nameWidth = max(nameWidth, len(s.Name))
+	}
+
+	fmt.Fprintf(w, "%-*s  %4s  %s\n", nameWidth, "SESSION", "RUNS", "UPDATED")
+	for _, s := range sessions {
+		fmt.Fprintf(w, "%-*s  %4d  %s\n", nameWidth, s.Name, len(s.Runs), s.UpdatedAt.Local().Format("2006-01-02 15:04"))
+	}
+}
+
+// printRuns writes one line per run with its number (as used by SESSION:N),
+// when it ran, the provider and model, the prompt version and the category.
+// Runs recorded before prompt versions were stored show "-".
+func printRuns(w io.Writer, runs []session.Run) {
+	modelWidth := len("MODEL")
+	for _, r := range runs {
+		modelWidth = max(modelWidth, len(r.Provider+"/"+r.Model))
+	}
+
+	fmt.Fprintf(w, "%3s  %-16s  %-*s  %-6s  %s\n", "RUN", "TIME", modelWidth, "MODEL", "PROMPT", "CATEGORY")
+	for i, r := range runs {
+		fmt.Fprintf(w, "%3d  %-16s  %-*s  %-6s  %s\n", i+1, r.Timestamp.Local().Format("2006-01-02 15:04"), modelWidth, r.Provider+"/"+r.Model, orDash(r.PromptVersion), orDash(r.Category))
+	}
+}
+
+// orDash returns s, or "-" for an empty column
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
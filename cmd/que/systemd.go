@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jenian/que/internal/advisor"
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/ingestor"
+	"github.com/jenian/que/internal/proc"
+	"github.com/jenian/que/pkg/llm"
+	"github.com/spf13/cobra"
+)
+
+// systemdTimeout bounds each systemctl and journalctl command que runs
+const systemdTimeout = 30 * time.Second
+
+// systemdHint tells the model what the systemd input is and which start
+// failures to look for
+const systemdHint = "This is the journal of the systemd unit %s. " +
+	"The attachments hold its `systemctl status`, its unit file with drop-ins (`systemctl cat`) and whether the files the unit refers to exist on this host. " +
+	"Explain why the service fails to start or keeps restarting: ExecStart errors and systemd exit statuses (e.g. 203/EXEC, 200/CHDIR, 217/USER, 226/NAMESPACE), " +
+	"permission problems for the unit's User, a missing EnvironmentFile or WorkingDirectory, start timeouts and restart limits. " +
+	"The fix should say which unit file or drop-in to change and end with systemctl daemon-reload and a restart."
+
+var (
+	systemdProviderFlag string
+	systemdModelFlag    string
+	systemdUserFlag     bool
+	systemdLinesFlag    int
+	systemdSinceFlag    string
+	systemdOutputFlag   string
+	systemdHintFlag     string
+)
+
+// newSystemdCmd returns the `que systemd` subcommand, which analyzes why a
+// systemd unit fails to start
+func newSystemdCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "systemd UNIT",
+		Short: "Analyze why a systemd unit fails to start",
+		Long: `Gather the status, recent journal entries and unit file (with drop-ins) of
+a systemd unit, check that the files it refers to exist, and analyze why the
+service fails to start. A unit without a type suffix is taken as a .service.`,
+		Example: `  que systemd nginx
+  que systemd --since "1 hour ago" postgresql@16-main
+  que systemd --user syncthing`,
+		Args: cobra.ExactArgs(1),
+		RunE: runSystemd,
+	}
+
+	cmd.Flags().StringVarP(&systemdProviderFlag, "provider", "p", "", "LLM provider to use ("+strings.Join(llm.ProviderNames(), ", ")+")")
+	cmd.Flags().StringVarP(&systemdModelFlag, "model", "m", "", "Specific model override (e.g., gpt-4-turbo)")
+	cmd.Flags().BoolVar(&systemdUserFlag, "user", false, "Analyze a unit of the user's service manager (systemctl --user)")
+	cmd.Flags().IntVarP(&systemdLinesFlag, "lines", "n", 200, "Most recent journal entries to analyze")
+	cmd.Flags().StringVar(&systemdSinceFlag, "since", "", "Only journal entries newer than this, as for journalctl --since")
+	cmd.Flags().StringVarP(&systemdOutputFlag, "output", "o", advisor.FormatText, "Where to send the analysis, as for que --output")
+	cmd.Flags().StringVar(&systemdHintFlag, "hint", "", "Extra context for the model that the journal doesn't contain")
+
+	return cmd
+}
+
+func runSystemd(cmd *cobra.Command, args []string) error {
+	unit := args[0]
+	if !strings.Contains(unit, ".") {
+		unit += ".service"
+	}
+
+	g, err := newGatherAnalysis(systemdProviderFlag, systemdModelFlag, systemdOutputFlag)
+	if err != nil {
+		return err
+	}
+	defer g.Close()
+
+	doneGathering := advisor.StartStage(g.cfg, "Gathering "+unit)
+	journal, attachments, err := systemdInput(cmd.Context(), unit, g.inputLimit())
+	doneGathering()
+	if err != nil {
+		return err
+	}
+
+	return g.analyze(cmd.Context(), gathered{
+		Log:         journal,
+		Attachments: attachments,
+		Hint:        strings.TrimSpace(fmt.Sprintf(systemdHint, unit) + "\n\n" + systemdHintFlag),
+	})
+}
+
+// systemdInput returns the journal of unit, capped at limit bytes like stdin
+// input, and its status, unit file and file checks as attachments
+func systemdInput(ctx context.Context, unit string, limit int) (string, []config.Attachment, error) {
+	scope := "--system"
+	if systemdUserFlag {
+		scope = "--user"
+	}
+
+	unitFile, err := systemdOutput(ctx, "systemctl", scope, "cat", "--no-pager", unit)
+	if err != nil {
+		return "", nil, fmt.Errorf("no unit %s: %w", unit, err)
+	}
+	// systemctl status exits non-zero for a unit that isn't running, which is
+	// the point of looking at it. The journal already holds its log lines.
+	status, _ := proc.Output(ctx, proc.Limits{Timeout: systemdTimeout}, "systemctl", scope, "status", "--no-pager", "--full", "--lines", "0", unit)
+	journalArgs := []string{"journalctl", scope, "--unit", unit, "--no-pager", "--output", "short-iso", "--lines", fmt.Sprint(systemdLinesFlag)}
+	if systemdSinceFlag != "" {
+		journalArgs = append(journalArgs, "--since", systemdSinceFlag)
+	}
+	journal, err := systemdOutput(ctx, journalArgs...)
+	if err != nil {
+		return "", nil, err
+	}
+	journal, err = ingestor.IngestFromReaderLimit(strings.NewReader(journal), limit)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var attachments []config.Attachment
+	if status = strings.TrimSpace(status); status != "" {
+		attachments = append(attachments, config.Attachment{Name: "systemctl status " + unit, Content: status})
+	}
+	attachments = append(attachments, config.Attachment{Name: "systemctl cat " + unit, Content: unitFile})
+	if checks := unitFileChecks(unitFile); checks != "" {
+		attachments = append(attachments, config.Attachment{Name: "files referenced by " + unit, Content: checks})
+	}
+	return journal, attachments, nil
+}
+
+// systemdOutput runs a systemctl or journalctl command and returns its output
+func systemdOutput(ctx context.Context, args ...string) (string, error) {
+	output, err := proc.Output(ctx, proc.Limits{Timeout: systemdTimeout}, args...)
+	output = strings.TrimSpace(output)
+	if err != nil {
+		if output != "" {
+			return "", fmt.Errorf("%s failed: %w\n%s", args[0], err, output)
+		}
+		return "", fmt.Errorf("%s failed: %w", args[0], err)
+	}
+	return output, nil
+}
+
+// unitFileChecks reports whether the programs, directories and environment
+// files a unit file (as printed by systemctl cat) refers to exist, and their
+// permissions. Environment files are only checked, never read, since they
+// usually hold secrets.
+func unitFileChecks(unitFile string) string {
+	var checks []string
+	check := func(key, path string) {
+		path = strings.TrimLeft(path, "-@:+!")
+		// Specifiers like %h and unexpanded variables can't be resolved here
+		if !filepath.IsAbs(path) || strings.ContainsAny(path, "%$") {
+			return
+		}
+		info, err := os.Stat(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			checks = append(checks, fmt.Sprintf("%s=%s: does not exist", key, path))
+		case err != nil:
+			checks = append(checks, fmt.Sprintf("%s=%s: %v", key, path, err))
+		default:
+			checks = append(checks, fmt.Sprintf("%s=%s: exists, %s", key, path, info.Mode()))
+		}
+	}
+
+	for _, line := range strings.Split(unitFile, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || strings.HasPrefix(key, "#") || strings.HasPrefix(key, ";") {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "ExecStart", "ExecStartPre", "ExecStartPost":
+			if fields := strings.Fields(value); len(fields) > 0 {
+				check(key, fields[0])
+			}
+		case "WorkingDirectory", "EnvironmentFile":
+			// A leading "-" makes a missing file or directory acceptable
+			if strings.HasPrefix(value, "-") {
+				break
+			}
+			check(key, value)
+		}
+	}
+	return strings.Join(checks, "\n")
+}
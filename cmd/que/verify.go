@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/jenian/que/internal/advisor"
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/ingestor"
+	"github.com/jenian/que/internal/logging"
+	"github.com/jenian/que/internal/sanitizer"
+	"github.com/jenian/que/internal/session"
+	"github.com/jenian/que/pkg/llm"
+	"github.com/spf13/cobra"
+)
+
+// errNotResolved is returned by verify-fix when the rerun still shows a problem
+var errNotResolved = errors.New("the fix did not resolve the issue")
+
+var (
+	verifyProviderFlag string
+	verifyModelFlag    string
+	verifySessionFlag  string
+	verifyPreviousFlag string
+	verifyTimeoutFlag  time.Duration
+)
+
+// newVerifyFixCmd returns the `que verify-fix` subcommand, which reruns a
+// failing command after a fix and checks the result against the analysis
+func newVerifyFixCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify-fix [flags] -- COMMAND [ARGS...]",
+		Short: "Rerun a failing command after applying a fix and check whether the analyzed issue is resolved",
+		Example: `  kubectl logs payments-7d9f | que --session payments-outage
+  # ...apply the suggested fix...
+  que verify-fix --session payments-outage -- kubectl rollout status deploy/payments`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runVerifyFix,
+	}
+
+	cmd.Flags().StringVarP(&verifyProviderFlag, "provider", "p", "", "LLM provider to use ("+strings.Join(llm.ProviderNames(), ", ")+")")
+	cmd.Flags().StringVarP(&verifyModelFlag, "model", "m", "", "Specific model override (e.g., gpt-4-turbo)")
+	cmd.Flags().StringVar(&verifySessionFlag, "session", "", "Session holding the original analysis; the result is recorded there too")
+	cmd.Flags().StringVar(&verifyPreviousFlag, "previous", "", "Analysis to verify, SESSION or SESSION:N (default: the latest run of --session)")
+	cmd.Flags().DurationVar(&verifyTimeoutFlag, "timeout", 5*time.Minute, "Longest the command may run")
+
+	return cmd
+}
+
+func runVerifyFix(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	selectProvider(cfg, verifyProviderFlag)
+	cfg.Model = verifyModelFlag
+	if verifySessionFlag != "" {
+		cfg.Session = verifySessionFlag
+	}
+
+	if err := checkParanoid(cfg); err != nil {
+		return err
+	}
+	closeLog, err := logging.Init(cfg.LogLevel, cfg.LogFile)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	if err := llm.ValidateProvider(cfg.Provider); err != nil {
+		return err
+	}
+	resolveModel(cfg)
+	if err := resolvePromptVersion(cfg); err != nil {
+		return err
+	}
+
+	// Everything that can fail without running the command is checked first
+	var sess *session.Session
+	if cfg.Session != "" {
+		if sess, err = session.Open(session.DefaultDir(), cfg.Session); err != nil {
+			return err
+		}
+	}
+	ref := verifyPreviousFlag
+	if ref == "" {
+		if sess == nil {
+			return fmt.Errorf("verify-fix needs --session or --previous to know which analysis to verify")
+		}
+		ref = previousLatest
+	}
+	previous, err := loadPrevious(ref, sess)
+	if err != nil {
+		return fmt.Errorf("--previous: %w", err)
+	}
+	provider, _ := llm.LookupProvider(cfg.Provider)
+	if err := provider.CheckEnv(); err != nil {
+		return err
+	}
+	llmClient, err := llm.NewClient(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create LLM client: %w", err)
+	}
+	cfg.DropKeys()
+	cfg.Outputs = []string{advisor.FormatText}
+	cfg.OutputFormat = advisor.FormatText
+	sinks, err := advisor.NewSinks(cfg, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	sanitizer.Preload()
+	commandLine := strings.Join(args, " ")
+	fmt.Fprintf(os.Stderr, "$ %s\n", commandLine)
+	model := llm.ResolveModel(cfg.Provider, cfg.Model)
+	output, exitCode, err := runVerifyCommand(args, verifyTimeoutFlag, max(ingestor.MaxInputSize, llm.LogByteBudget(model)), os.Stderr)
+	if err != nil {
+		return fmt.Errorf("failed to run %s: %w", args[0], err)
+	}
+
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		return err
+	}
+	sanitizedLog, count, findings := redactor.RedactWithDetails(output, true)
+	if count > 0 {
+		advisor.Report(cfg, "Redacted %d potential secrets", count)
+	}
+	payload := config.QueryPayload{
+		RawLog:        output,
+		SanitizedLog:  sanitizedLog,
+		SystemContext: gatherContext(cfg),
+		Findings:      findings,
+		Previous:      previous,
+		Truncated:     ingestor.Truncated(output),
+	}
+	// The command line may carry secrets just like the hint does
+	payload.Hint = fmt.Sprintf("This is the output of `%s` (exit code %d), rerun after applying the suggested fix.", commandLine, exitCode)
+	payload.Findings = append(payload.Findings, sanitizer.RedactPayload(redactor, &payload)...)
+	summarizeLog(&payload, llm.LogBudget(cfg, payload), model)
+
+	analysis, err := advisor.Analyze(cmd.Context(), llmClient, cfg, payload)
+	if err != nil {
+		return fmt.Errorf("failed to get advice: %w", err)
+	}
+	if err := advisor.Deliver(sinks, analysis); err != nil {
+		return err
+	}
+
+	if sess != nil {
+		sess.RecordRun(session.Run{
+			Provider:      cfg.Provider,
+			Model:         llm.ResolveModel(cfg.Provider, cfg.Model),
+			PromptVersion: cfg.PromptVersion,
+			Hint:          payload.Hint,
+			Response:      analysis.Raw,
+			Category:      analysis.Category(),
+		}, advisor.InitialUserMessage(payload))
+		if err := sess.Save(); err != nil {
+			return err
+		}
+	}
+
+	if verdict := analysis.Comparison(); verdict != "resolved" {
+		logging.Debug().Str("comparison", verdict).Int("exit_code", exitCode).Msg("Fix not verified")
+		return errNotResolved
+	}
+	return nil
+}
+
+// runVerifyCommand runs args without a shell, echoing its output to w as it
+// arrives. It returns the combined output, capped at limit bytes like stdin
+// input, and the exit code; a command that ran but failed is not an error.
+func runVerifyCommand(args []string, timeout time.Duration, limit int, w io.Writer) (string, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	command := exec.CommandContext(ctx, args[0], args[1:]...)
+	command.Env = config.CommandEnv(os.Environ())
+	command.Stdout = io.MultiWriter(&output, w)
+	command.Stderr = command.Stdout
+
+	exitCode := 0
+	if err := command.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return "", 0, err
+		}
+		exitCode = exitErr.ExitCode()
+		if ctx.Err() != nil {
+			fmt.Fprintf(&output, "\n(command killed after %s)\n", timeout)
+		}
+	}
+
+	capped, err := ingestor.IngestFromReaderLimit(&output, limit)
+	if err != nil {
+		return "", 0, err
+	}
+	return capped, exitCode, nil
+}
@@ -2,51 +2,243 @@ package advisor
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
 	"regexp"
 	"strings"
 	"time"
 
-	"github.com/briandowns/spinner"
 	"github.com/fatih/color"
 	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/logging"
+	"github.com/jenian/que/internal/textutil"
 	"github.com/jenian/que/pkg/llm"
 )
 
-// Advise processes the payload and returns formatted advice from the LLM
-func Advise(client llm.Client, cfg *config.Config, payload config.QueryPayload) (string, error) {
+// Advise processes the payload and returns formatted advice from the LLM.
+// Canceling ctx (e.g. on Ctrl-C) aborts the query.
+func Advise(ctx context.Context, client llm.Client, cfg *config.Config, payload config.QueryPayload) (string, error) {
 	// Handle dry-run mode
 	if cfg.DryRun {
 		return handleDryRun(cfg, payload)
 	}
 
-	// Show spinner while waiting for LLM response
-	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
-	s.Suffix = " Analyzing..."
-	s.Writer = os.Stderr
-	s.Start()
-	defer s.Stop() // Always stop spinner, even on error
+	analysis, err := Analyze(ctx, client, cfg, payload)
+	if err != nil {
+		return "", err
+	}
+
+	// Parse and format the JSON response in the selected output format
+	return analysis.Format(cfg.OutputFormat, renderOptionsFor(cfg))
+}
+
+// Analysis is the model's answer for one run, which each output sink renders
+// in its own format
+type Analysis struct {
+	Raw           string // Response exactly as returned by the model
+	NoSchema      bool   // Raw is free-form text rather than the JSON schema
+	EvidenceLines []int  // Input lines quoted as evidence (see locateEvidence)
+	// FixWarnings flag fix commands that don't suit the analyzed system (see lintFix)
+	FixWarnings []string
+	// Previous is the analysis the log was compared against (--previous), if any
+	Previous *config.PreviousAnalysis
+	// Metadata describes how the analysis was produced, for JSON output
+	Metadata *config.RunMetadata
+	// Source names the analyzed log in notifications, e.g. a file of a batch (optional)
+	Source string
+}
+
+// Version is the que version reported in JSON output metadata; main sets it
+// from its build-time version
+var Version = "dev"
 
+// Analyze queries the LLM for payload and returns the unformatted analysis
+func Analyze(ctx context.Context, client llm.Client, cfg *config.Config, payload config.QueryPayload) (*Analysis, error) {
 	// Query the LLM using the injected client
-	response, err := client.QueryWithPayload(cfg, payload)
+	doneQuerying := StartStage(cfg, "Querying "+llm.ResolveModel(cfg.Provider, cfg.Model))
+	start := time.Now()
+	response, usage, err := llm.QueryWithPayload(ctx, client, cfg, payload)
+	elapsed := time.Since(start)
+	doneQuerying()
+	reportUsage(cfg, usage)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	doneParsing := StartStage(cfg, "Parsing")
+	defer doneParsing()
+	analysis := newAnalysis(cfg, payload, response)
+	analysis.Metadata = runMetadata(cfg, payload, response, elapsed, usage)
+	return analysis, nil
+}
+
+// runMetadata describes the query of payload that returned response after
+// elapsed, using usage tokens if the provider reported them
+func runMetadata(cfg *config.Config, payload config.QueryPayload, response string, elapsed time.Duration, usage *config.Usage) *config.RunMetadata {
+	promptVersion := cfg.PromptVersion
+	if promptVersion == "" {
+		promptVersion = llm.CurrentPromptVersion
+	}
+	systemPrompt, userPrompt := llm.BuildPrompts(cfg, payload)
+	model := llm.ResolveModel(cfg.Provider, cfg.Model)
+	return &config.RunMetadata{
+		QueVersion:            Version,
+		PromptVersion:         promptVersion,
+		PromptDialect:         llm.PromptDialect(cfg),
+		Provider:              cfg.Provider,
+		Model:                 model,
+		DurationMS:            elapsed.Milliseconds(),
+		EstimatedInputTokens:  llm.CountTokens(model, systemPrompt) + llm.CountTokens(model, userPrompt),
+		EstimatedOutputTokens: llm.CountTokens(model, response),
+		Redactions:            len(payload.Findings),
+		Truncated:             payload.Truncated,
+		Summarized:            payload.Summarized,
+		Usage:                 usage,
+	}
+}
+
+// newAnalysis wraps a model response for payload, locating its evidence in the input
+func newAnalysis(cfg *config.Config, payload config.QueryPayload, response string) *Analysis {
+	analysis := &Analysis{Raw: response, NoSchema: cfg.NoSchema, Previous: payload.Previous}
+	if !cfg.NoSchema {
+		if llmResp, err := parseResponse(response); err == nil {
+			analysis.EvidenceLines = locateEvidence(string(llmResp.Evidence), payload)
+			analysis.FixWarnings = lintFix(llmResp.Fix, payload.SystemContext)
+		}
 	}
+	return analysis
+}
 
-	// Parse and format the JSON response
-	formatted, err := parseAndFormatResponse(response)
+// Format renders the analysis in the given output format
+func (a *Analysis) Format(format string, opts renderOptions) (string, error) {
+	// Without the schema there is no JSON to parse, so show the answer as-is
+	if a.NoSchema {
+		return strings.TrimRight(a.Raw, "\n") + "\n", nil
+	}
+	llmResp, err := parseResponse(a.Raw)
 	if err != nil {
-		// If parsing fails, return the raw response with an error message
-		return fmt.Sprintf("Error parsing LLM response: %v\n\nRaw response:\n%s", err, response), nil
+		return formatParseError(err, a.Raw, format)
 	}
+	llmResp.EvidenceLines = a.EvidenceLines
+	llmResp.FixWarnings = a.FixWarnings
+	// Scripts get the provenance and the difference from the previous
+	// analysis along with the verdict
+	if format == FormatJSON {
+		if a.Previous != nil {
+			llmResp.Diff = diffAnalyses(a.Previous, llmResp)
+		}
+		llmResp.Metadata = a.Metadata
+	}
+	return renderResponse(llmResp, format, opts)
+}
+
+// Render renders the analysis in format with cfg's display settings but
+// without colors, for writing to files
+func (a *Analysis) Render(cfg *config.Config, format string) (string, error) {
+	opts := renderOptionsFor(cfg)
+	opts.Colored = false
+	return a.Format(format, opts)
+}
+
+// Text renders the analysis as plain text, suitable for conversation history
+func (a *Analysis) Text() string {
+	text, _ := a.Format(FormatText, renderOptions{Emoji: true})
+	return text
+}
 
-	return formatted, nil
+// Severity returns the normalized severity reported by the model, or "" if
+// it didn't report one (prompt v1, --no-schema) or it is unknown
+func (a *Analysis) Severity() string {
+	if a.NoSchema {
+		return ""
+	}
+	llmResp, err := parseResponse(a.Raw)
+	if err != nil {
+		return ""
+	}
+	severity := strings.ToLower(strings.TrimSpace(llmResp.Severity))
+	if !isSeverity(severity) {
+		return ""
+	}
+	return severity
+}
+
+// Comparison returns the model's verdict on the previous analysis
+// ("resolved", "unchanged", "regressed" or "changed"), or "" if the log wasn't
+// compared against one or the verdict is unknown
+func (a *Analysis) Comparison() string {
+	if a.NoSchema {
+		return ""
+	}
+	llmResp, err := parseResponse(a.Raw)
+	if err != nil {
+		return ""
+	}
+	comparison := strings.ToLower(strings.TrimSpace(llmResp.Comparison))
+	if _, ok := comparisonColors[comparison]; !ok {
+		return ""
+	}
+	return comparison
+}
+
+// NoProblem reports whether the model found nothing wrong
+func (a *Analysis) NoProblem() bool {
+	if a.NoSchema {
+		return false
+	}
+	llmResp, err := parseResponse(a.Raw)
+	return err == nil && classifyResponse(llmResp) == "no_problem"
+}
+
+// Status returns the model's verdict, "no_problem", "insufficient_data" or
+// "problem_detected", or "" if the response couldn't be parsed
+func (a *Analysis) Status() string {
+	if a.NoSchema {
+		return ""
+	}
+	llmResp, err := parseResponse(a.Raw)
+	if err != nil {
+		return ""
+	}
+	return classifyResponse(llmResp)
+}
+
+// RootCause returns the root cause reported by the model, or "" if the
+// response couldn't be parsed
+func (a *Analysis) RootCause() string {
+	if a.NoSchema {
+		return ""
+	}
+	llmResp, err := parseResponse(a.Raw)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(llmResp.RootCause)
+}
+
+// FormatPrompt renders the final system and user prompts exactly as they will
+// be sent, after templates, context, truncation and redaction have been applied
+func FormatPrompt(cfg *config.Config, payload config.QueryPayload) string {
+	systemPrompt, userPrompt := llm.BuildPrompts(cfg, payload)
+
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("=== LLM Prompt (%s) ===\n", cfg.PromptVersion))
+	output.WriteString(fmt.Sprintf("System Prompt:\n%s\n\n", systemPrompt))
+	output.WriteString(fmt.Sprintf("User Prompt:\n%s\n\n", userPrompt))
+	output.WriteString("=== End Prompt ===\n")
+	return output.String()
 }
 
 // handleDryRun shows what would be sent without making an API call
 func handleDryRun(cfg *config.Config, payload config.QueryPayload) (string, error) {
+	// JSON dry-runs are the command's real output, so they go to stdout instead
+	if cfg.OutputFormat == FormatJSON {
+		return formatDryRunJSON(cfg, payload)
+	}
+
 	var output string
 
 	output += "=== DRY RUN MODE ===\n\n"
@@ -54,6 +246,9 @@ func handleDryRun(cfg *config.Config, payload config.QueryPayload) (string, erro
 	if cfg.Model != "" {
 		output += fmt.Sprintf("Model: %s\n", cfg.Model)
 	}
+	if cfg.PromptVersion != "" {
+		output += fmt.Sprintf("Prompt version: %s\n", cfg.PromptVersion)
+	}
 	output += "\n"
 
 	// Show system context
@@ -62,19 +257,30 @@ func handleDryRun(cfg *config.Config, payload config.QueryPayload) (string, erro
 		output += fmt.Sprintf("  OS: %s\n", payload.SystemContext.OS)
 		output += fmt.Sprintf("  Arch: %s\n", payload.SystemContext.Arch)
 		output += fmt.Sprintf("  Shell: %s\n", payload.SystemContext.Shell)
-		output += fmt.Sprintf("  Timestamp: %s\n", payload.SystemContext.Timestamp.Format("2006-01-02 15:04:05"))
+		output += fmt.Sprintf("  Timestamp: %s\n", payload.SystemContext.Timestamp.Format(displayTime))
 		output += "\n"
 	}
 
+	if payload.Hint != "" {
+		output += fmt.Sprintf("Hint: %s\n\n", payload.Hint)
+	}
+
 	// Show sanitized log preview
 	output += "Sanitized Log (first 500 chars):\n"
-	preview := payload.SanitizedLog
-	if len(preview) > 500 {
-		preview = preview[:500] + "... [truncated]"
-	}
-	output += preview + "\n\n"
+	output += textutil.Truncate(payload.SanitizedLog, 500) + "\n\n"
 
 	output += "Full sanitized log length: " + fmt.Sprintf("%d", len(payload.SanitizedLog)) + " characters\n"
+
+	if len(payload.Attachments) > 0 {
+		output += "\nAttached files:\n"
+		for _, attachment := range payload.Attachments {
+			suffix := ""
+			if attachment.Truncated {
+				suffix = ", truncated"
+			}
+			output += fmt.Sprintf("  %s (%d characters%s)\n", attachment.Name, len(attachment.Content), suffix)
+		}
+	}
 	output += "\n"
 	output += "=== Would query LLM API (skipped in dry-run mode) ===\n"
 
@@ -103,31 +309,68 @@ func extractJSON(response string) string {
 
 // parseAndFormatResponse parses the JSON response and formats it for console output
 func parseAndFormatResponse(rawResponse string) (string, error) {
+	llmResp, err := parseResponse(rawResponse)
+	if err != nil {
+		return "", err
+	}
+	return formatText(llmResp, renderOptions{Colored: true, Emoji: true}), nil
+}
+
+// parseResponse extracts and parses the structured JSON response from the LLM
+func parseResponse(rawResponse string) (config.LLMResponse, error) {
 	// Extract JSON from potential markdown wrappers
 	jsonStr := extractJSON(rawResponse)
 
 	// Parse JSON
 	var llmResp config.LLMResponse
 	if err := json.Unmarshal([]byte(jsonStr), &llmResp); err != nil {
-		return "", fmt.Errorf("failed to parse JSON: %w", err)
+		return config.LLMResponse{}, fmt.Errorf("failed to parse JSON: %w", err)
 	}
 
-	// Handle different status cases
+	return llmResp, nil
+}
+
+// classifyResponse determines which of the three response cases applies,
+// falling back to field heuristics when the model omits the status
+func classifyResponse(llmResp config.LLMResponse) string {
 	status := strings.ToLower(strings.TrimSpace(llmResp.Status))
 
 	// Case 1: no problems detected
 	if status == "no_problem" || (status == "" && strings.TrimSpace(llmResp.RootCause) == "" && strings.TrimSpace(string(llmResp.Evidence)) == "") {
-		return "Your log looks good, no problems detected!\n", nil
+		return "no_problem"
 	}
 
 	// Case 2: Problem detected but insufficient data
 	if status == "insufficient_data" || (status == "" && strings.TrimSpace(llmResp.Fix) == "" && strings.TrimSpace(string(llmResp.Evidence)) != "") {
+		return "insufficient_data"
+	}
+
+	// Case 3: Problem detected with solution
+	return "problem_detected"
+}
+
+// newColor creates a color that is disabled when output isn't meant for a terminal
+func newColor(colored bool, attrs ...color.Attribute) *color.Color {
+	c := color.New(attrs...)
+	if !colored {
+		c.DisableColor()
+	}
+	return c
+}
+
+// formatText formats a parsed response for console output
+func formatText(llmResp config.LLMResponse, opts renderOptions) string {
+	switch classifyResponse(llmResp) {
+	case "no_problem":
+		return noProblemsMessage + "\n"
+
+	case "insufficient_data":
 		var output strings.Builder
-		titleColor := color.New(color.FgCyan, color.Bold)
-		messageColor := color.New(color.FgYellow)
+		titleColor := newColor(opts.Colored, color.FgCyan, color.Bold)
+		messageColor := newColor(opts.Colored, color.FgYellow)
 
 		// Show evidence
-		output.WriteString(titleColor.Sprint("Evidence"))
+		output.WriteString(titleColor.Sprint(evidenceTitle(llmResp)))
 		output.WriteString("\n\n")
 		evidenceLines := strings.Split(strings.TrimSpace(string(llmResp.Evidence)), "\n")
 		for _, line := range evidenceLines {
@@ -135,18 +378,39 @@ func parseAndFormatResponse(rawResponse string) (string, error) {
 			output.WriteString("\n")
 		}
 		output.WriteString("\n")
+		output.WriteString(formatTimelineText(llmResp.Timeline, titleColor, opts))
+		output.WriteString(formatDiagnosticsText(llmResp.Diagnostics, titleColor))
 
-		// Show message
-		output.WriteString(messageColor.Sprint("⚠️  Problem detected but insufficient data for a clear solution. Please provide more context or logs."))
+		// Show message, listing exactly what is missing when the model said
+		items := missingItems(llmResp.Missing)
+		if len(items) == 0 {
+			output.WriteString(messageColor.Sprint(withEmoji("⚠️  ", insufficientDataMessage, opts.Emoji)))
+			output.WriteString("\n")
+			return output.String()
+		}
+		output.WriteString(messageColor.Sprint(withEmoji("⚠️  ", missingDataMessage, opts.Emoji)))
 		output.WriteString("\n")
+		for _, item := range items {
+			output.WriteString("  - " + item + "\n")
+		}
 
-		return output.String(), nil
+		return output.String()
 	}
 
-	// Case 3: Problem detected with solution - show full output
-	titleColor := color.New(color.FgCyan, color.Bold)
+	// Problem detected with solution - show full output
+	titleColor := newColor(opts.Colored, color.FgCyan, color.Bold)
 	var output strings.Builder
 
+	// Severity line
+	if severity := formatSeverity(llmResp.Severity, opts); severity != "" {
+		output.WriteString("\n")
+		output.WriteString(severity)
+		output.WriteString("\n")
+	}
+	if category := normalizeCategory(llmResp.Category); category != "" {
+		output.WriteString("Category: " + category + "\n")
+	}
+
 	// Root Cause section
 	if strings.TrimSpace(llmResp.RootCause) != "" {
 		output.WriteString(titleColor.Sprintln())
@@ -158,7 +422,7 @@ func parseAndFormatResponse(rawResponse string) (string, error) {
 
 	// Evidence section
 	if strings.TrimSpace(string(llmResp.Evidence)) != "" {
-		output.WriteString(titleColor.Sprint("Evidence"))
+		output.WriteString(titleColor.Sprint(evidenceTitle(llmResp)))
 		output.WriteString("\n\n")
 		evidenceLines := strings.Split(strings.TrimSpace(string(llmResp.Evidence)), "\n")
 		for _, line := range evidenceLines {
@@ -168,36 +432,87 @@ func parseAndFormatResponse(rawResponse string) (string, error) {
 		output.WriteString("\n")
 	}
 
-	// Fix section
+	// Timeline section
+	output.WriteString(formatTimelineText(llmResp.Timeline, titleColor, opts))
+
+	// Fix section, under a banner if it would delete data
+	output.WriteString(formatDestructiveText(destructiveCommands(llmResp.Fix), opts))
 	if strings.TrimSpace(llmResp.Fix) != "" {
 		output.WriteString(titleColor.Sprint("Fix"))
 		output.WriteString("\n\n")
-		fixLines := strings.Split(strings.TrimSpace(llmResp.Fix), "\n")
-		for _, line := range fixLines {
-			output.WriteString(line)
+		if steps := fixSteps(llmResp.Fix); steps != nil {
+			output.WriteString(formatStepsList(steps))
+		} else {
+			fixLines := strings.Split(strings.TrimSpace(llmResp.Fix), "\n")
+			for _, line := range fixLines {
+				output.WriteString(line)
+				output.WriteString("\n")
+			}
+		}
+		if len(llmResp.FixWarnings) > 0 {
+			warningColor := newColor(opts.Colored, color.FgYellow)
 			output.WriteString("\n")
+			for _, warning := range llmResp.FixWarnings {
+				output.WriteString(warningColor.Sprint(withEmoji("⚠️  ", warning, opts.Emoji)))
+				output.WriteString("\n")
+			}
 		}
 	}
 
-	return output.String(), nil
+	return output.String()
 }
 
-// RunInteractive starts an interactive conversation session
-func RunInteractive(client llm.Client, cfg *config.Config, payload config.QueryPayload, initialResponse string) error {
-	// Build initial user message with log context
-	initialUserMessage := buildInitialUserMessage(payload)
+// ConversationOptions are the optional parts of an interactive conversation
+type ConversationOptions struct {
+	// OnTurn, if set, is called with the updated history after every answer,
+	// so callers can persist it
+	OnTurn func(history []string) error
+	// Analysis is the analysis under discussion; its suggested diagnostics
+	// can be run with /run N
+	Analysis *Analysis
+	// Redactor redacts typed questions and diagnostic output before they
+	// are sent to the model. Without one, /run only lists the diagnostics.
+	Redactor config.Redactor
+}
 
+// RunInteractive starts an interactive conversation session about analysis
+func RunInteractive(ctx context.Context, client llm.Client, cfg *config.Config, payload config.QueryPayload, analysis *Analysis, redactor config.Redactor) error {
 	// Conversation history: [user1, assistant1, user2, assistant2, ...]
 	conversationHistory := []string{
-		initialUserMessage, // User: "Here's the log, analyze it"
-		initialResponse,    // Assistant: Initial analysis
+		InitialUserMessage(payload), // User: "Here's the log, analyze it"
+		analysis.Text(),             // Assistant: Initial analysis
 	}
 
+	return RunConversation(ctx, client, cfg, conversationHistory, ConversationOptions{Analysis: analysis, Redactor: redactor})
+}
+
+// RunConversation runs the interactive loop, continuing from conversationHistory.
+// Ctrl-C while a question is answered cancels that question only; at the
+// prompt it exits as usual.
+func RunConversation(ctx context.Context, client llm.Client, cfg *config.Config, conversationHistory []string, opts ConversationOptions) error {
 	// Create a prompt color for better UX
 	promptColor := color.New(color.FgCyan, color.Bold)
 
+	// Hand Ctrl-C back to the default handler, which the prompt relies on to exit
+	signal.Reset(os.Interrupt)
+
 	fmt.Fprintf(os.Stderr, "\n")
-	promptColor.Fprintf(os.Stderr, "💬 Interactive mode - Ask follow-up questions (type 'exit' or 'quit' to exit)\n\n")
+	promptColor.Fprintf(os.Stderr, "%s\n\n", withEmoji("💬 ", "Interactive mode - Ask follow-up questions (type 'exit' or 'quit' to exit, /help for commands)", !cfg.UI.NoEmoji))
+
+	// Questions go to whichever provider and model were last selected
+	chat := newChatState(client, cfg)
+	if opts.Analysis != nil {
+		chat.diagnostics = opts.Analysis.Diagnostics()
+		chat.steps = opts.Analysis.FixSteps()
+	}
+	if (len(chat.diagnostics) > 0 || len(chat.steps) > 0) && opts.Redactor != nil {
+		// Typing /run N is the approval, so no second prompt is needed
+		runner, err := newInvestigator(client, cfg, opts.Redactor, func(ProposedCommand) bool { return true })
+		if err != nil {
+			logging.Warn().Err(err).Msg("Suggested diagnostics can't be run")
+		}
+		chat.runner = runner
+	}
 
 	// Open terminal for reading (works even when stdin is piped)
 	tty, err := os.OpenFile("/dev/tty", os.O_RDONLY, 0)
@@ -229,20 +544,71 @@ func RunInteractive(client llm.Client, cfg *config.Config, payload config.QueryP
 			fmt.Fprintf(os.Stderr, "Exiting interactive mode.\n")
 			break
 		}
+		if userInput == "/run" || strings.HasPrefix(userInput, "/run ") {
+			list, question, err := chat.runDiagnostic(userInput)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n\n", err)
+				continue
+			}
+			if question == "" {
+				fmt.Fprintf(os.Stderr, "%s\n\n", list)
+				continue
+			}
+			userInput = question
+		} else if userInput == "/apply" || strings.HasPrefix(userInput, "/apply ") {
+			n, step, err := chat.pickStep(strings.Fields(userInput))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n\n", err)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "\nStep %d changes this system:\n  $ %s\nRun this command? [y/N] ", n, step.Command)
+			if !readYes(scanner) || !confirmDestructive(scanner, os.Stderr, step.Command) {
+				fmt.Fprintf(os.Stderr, "Not applied.\n\n")
+				continue
+			}
+			output, question, err := chat.applyStep(n, step)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n\n", err)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "%s\n\n", output)
+			userInput = question
+		} else if strings.HasPrefix(userInput, "/") {
+			message, err := chat.handleCommand(userInput)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n\n", err)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s\n\n", message)
+			}
+			continue
+		}
+
+		// Questions may quote log lines or config values, so they leave the machine redacted
+		if opts.Redactor != nil {
+			var count int
+			if userInput, count = opts.Redactor.Redact(userInput); count > 0 {
+				fmt.Fprintf(os.Stderr, "Redacted %d potential secrets in your question\n", count)
+			}
+		}
 
 		// Show spinner while waiting for response
-		s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
-		s.Suffix = " Thinking..."
-		s.Writer = os.Stderr
-		s.Start()
+		stopSpinner := startSpinner(&chat.cfg, " Thinking...")
 
-		// Query LLM with follow-up question using the injected client
-		response, err := client.QueryWithHistory(cfg, conversationHistory, userInput)
+		// Query LLM with follow-up question using the active client
+		questionCtx, stopInterrupt := signal.NotifyContext(ctx, os.Interrupt)
+		response, usage, err := llm.QueryWithHistory(questionCtx, chat.client, &chat.cfg, conversationHistory, userInput)
+		interrupted := err != nil && questionCtx.Err() != nil && ctx.Err() == nil
+		stopInterrupt()
 
-		s.Stop()
+		stopSpinner()
+		reportUsage(&chat.cfg, usage)
 
+		if interrupted {
+			fmt.Fprintf(os.Stderr, "Question canceled.\n\n")
+			continue
+		}
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			logging.Error().Err(err).Msg("Follow-up query failed")
 			continue
 		}
 
@@ -252,6 +618,11 @@ func RunInteractive(client llm.Client, cfg *config.Config, payload config.QueryP
 
 		// Update conversation history
 		conversationHistory = append(conversationHistory, userInput, response)
+		if opts.OnTurn != nil {
+			if err := opts.OnTurn(conversationHistory); err != nil {
+				logging.Warn().Err(err).Msg("Failed to save conversation")
+			}
+		}
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -261,32 +632,68 @@ func RunInteractive(client llm.Client, cfg *config.Config, payload config.QueryP
 	return nil
 }
 
-// buildInitialUserMessage creates the initial user message with log context
-func buildInitialUserMessage(payload config.QueryPayload) string {
+// InitialUserMessage creates the initial user message with log context
+func InitialUserMessage(payload config.QueryPayload) string {
 	var parts []string
 
-	parts = append(parts, "Please analyze the following log data:")
+	parts = append(parts, llm.LogMessageHeader)
 	parts = append(parts, "")
 
 	// Include system context if available (same format as initial query)
 	if payload.SystemContext.OS != "" {
-		ctx := payload.SystemContext
-		contextInfo := fmt.Sprintf("System Environment:\n- OS: %s\n- Architecture: %s\n- Shell: %s\n- Timestamp: %s",
-			ctx.OS, ctx.Arch, ctx.Shell, ctx.Timestamp.Format(time.RFC3339))
-		parts = append(parts, contextInfo)
+		parts = append(parts, formatSystemContext(payload.SystemContext))
+		parts = append(parts, "")
+	}
+
+	if payload.Hint != "" {
+		parts = append(parts, "User-Provided Context:\n"+payload.Hint)
 		parts = append(parts, "")
 	}
 
 	parts = append(parts, "=== Original Log Data ===")
 
-	// Include sanitized log (first 2000 chars to keep context manageable)
-	logPreview := payload.SanitizedLog
-	if len(logPreview) > 2000 {
-		logPreview = logPreview[:2000] + "... [truncated]"
-	}
-	parts = append(parts, logPreview)
+	// Include the whole sanitized log, which already fits the model's budget:
+	// follow-ups need it, and with Claude this message is the cached prefix,
+	// which a cut-down log would leave under the minimum cacheable length
+	parts = append(parts, payload.SanitizedLog)
 	parts = append(parts, "")
 	parts = append(parts, "=== End Original Log Data ===")
 
+	for _, attachment := range payload.Attachments {
+		parts = append(parts, "")
+		parts = append(parts, fmt.Sprintf("=== Attached File: %s ===", attachment.Name))
+		parts = append(parts, textutil.Truncate(attachment.Content, 2000))
+		parts = append(parts, fmt.Sprintf("=== End Attached File: %s ===", attachment.Name))
+	}
+
+	if summary := llm.RedactionSummary(strings.Join(parts, "\n")); summary != "" {
+		parts = append(parts, "", summary)
+	}
+
 	return strings.Join(parts, "\n")
 }
+
+// blankChatAcknowledgement stands in for the initial analysis when a chat
+// starts without a log, so the history keeps alternating user and assistant turns
+const blankChatAcknowledgement = "Got it. What are you debugging?"
+
+// StartChat returns the opening conversation history for an interactive
+// session that starts without any piped log
+func StartChat(ctx config.Context) []string {
+	var parts []string
+
+	parts = append(parts, "I'd like help with a DevOps problem. I haven't shared any log data yet.")
+
+	if ctx.OS != "" {
+		parts = append(parts, "")
+		parts = append(parts, formatSystemContext(ctx))
+	}
+
+	return []string{strings.Join(parts, "\n"), blankChatAcknowledgement}
+}
+
+// formatSystemContext renders the host environment for conversation messages
+func formatSystemContext(ctx config.Context) string {
+	return fmt.Sprintf("System Environment:\n- OS: %s\n- Architecture: %s\n- Shell: %s\n- Timestamp: %s",
+		ctx.OS, ctx.Arch, ctx.Shell, ctx.Timestamp.Format(time.RFC3339))
+}
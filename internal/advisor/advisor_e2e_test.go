@@ -1,9 +1,11 @@
 package advisor
 
 import (
+	"context"
 	"encoding/json"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jenian/que/internal/config"
 )
@@ -195,7 +197,7 @@ func TestAdvise_DryRun(t *testing.T) {
 	}
 	
 	// In dry-run mode, client can be nil
-	result, err := Advise(nil, cfg, payload)
+	result, err := Advise(context.Background(), nil, cfg, payload)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -206,3 +208,249 @@ func TestAdvise_DryRun(t *testing.T) {
 	}
 }
 
+
+func TestFormatResponse_Markdown(t *testing.T) {
+	mockResponse := mockLLMResponse("problem_detected", "Database is down", "ERROR connection refused", "systemctl start postgresql")
+
+	result, err := formatResponse(mockResponse, nil, FormatMarkdown, renderOptions{Emoji: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, want := range []string{"## Root Cause", "Database is down", "## Evidence", "## Fix", "systemctl start postgresql"} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Markdown output should contain %q, got:\n%s", want, result)
+		}
+	}
+}
+
+func TestFormatResponse_JSON(t *testing.T) {
+	mockResponse := mockLLMResponse("", "Database is down", "ERROR connection refused", "systemctl start postgresql")
+
+	result, err := formatResponse(mockResponse, nil, FormatJSON, renderOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var parsed config.LLMResponse
+	if err := json.Unmarshal([]byte(result), &parsed); err != nil {
+		t.Fatalf("JSON output should be valid JSON: %v\n%s", err, result)
+	}
+	if parsed.Status != "problem_detected" {
+		t.Errorf("Status = %q, want inferred %q", parsed.Status, "problem_detected")
+	}
+}
+
+func TestFormatResponse_TextWithoutColor(t *testing.T) {
+	mockResponse := mockLLMResponse("problem_detected", "Database is down", "ERROR connection refused", "systemctl start postgresql")
+
+	result, err := formatResponse(mockResponse, nil, FormatText, renderOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Contains(result, "\x1b[") {
+		t.Errorf("Uncolored text output should not contain ANSI escapes, got: %q", result)
+	}
+}
+
+func TestAdvise_DryRunJSON(t *testing.T) {
+	cfg := &config.Config{
+		DryRun:        true,
+		Provider:      "openai",
+		OutputFormat:  FormatJSON,
+		PromptVersion: "v1",
+	}
+
+	payload := config.QueryPayload{
+		RawLog:       "token=ghp_secret\nERROR boom",
+		SanitizedLog: "token=<REDACTED_GITHUB_TOKEN>\nERROR boom",
+		Findings: []config.FindingDetail{
+			{RuleID: "github-pat", Description: "GitHub token", Secret: "ghp_secret", Placeholder: "<REDACTED_GITHUB_TOKEN>", StartLine: 1, EndLine: 1},
+		},
+	}
+
+	result, err := Advise(context.Background(), nil, cfg, payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var report map[string]interface{}
+	if err := json.Unmarshal([]byte(result), &report); err != nil {
+		t.Fatalf("Dry-run JSON should be valid JSON: %v\n%s", err, result)
+	}
+	if report["model"] != "gpt-4o" {
+		t.Errorf("model = %v, want gpt-4o", report["model"])
+	}
+	if !strings.Contains(report["user_prompt"].(string), "ERROR boom") {
+		t.Error("user_prompt should contain the sanitized log")
+	}
+	if strings.Contains(result, "ghp_secret") {
+		t.Error("Dry-run JSON must not contain redacted secret values")
+	}
+	if redactions := report["redactions"].([]interface{}); len(redactions) != 1 {
+		t.Errorf("Expected 1 redaction, got %d", len(redactions))
+	} else if placeholder := redactions[0].(map[string]interface{})["placeholder"]; placeholder != "<REDACTED_GITHUB_TOKEN>" {
+		t.Errorf("placeholder = %v, want <REDACTED_GITHUB_TOKEN>", placeholder)
+	}
+	if report["placeholder_template"] != config.DefaultRedactionTemplate {
+		t.Errorf("placeholder_template = %v, want the default", report["placeholder_template"])
+	}
+}
+
+func TestFormatPrompt(t *testing.T) {
+	cfg := &config.Config{Provider: "openai", PromptVersion: "v1"}
+	payload := config.QueryPayload{SanitizedLog: "ERROR <REDACTED_PASSWORD> rejected"}
+
+	result := FormatPrompt(cfg, payload)
+
+	for _, want := range []string{"System Prompt:", "User Prompt:", "ERROR <REDACTED_PASSWORD> rejected", "=== End Prompt ==="} {
+		if !strings.Contains(result, want) {
+			t.Errorf("FormatPrompt() should contain %q, got:\n%s", want, result)
+		}
+	}
+}
+
+func TestFormatResponse_NoEmoji(t *testing.T) {
+	mockResponse := mockLLMResponse("insufficient_data", "Server error", "ERROR 500", "")
+
+	result, err := formatResponse(mockResponse, nil, FormatText, renderOptions{Emoji: false})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Contains(result, "⚠️") {
+		t.Errorf("Output should not contain emoji when disabled, got: %q", result)
+	}
+	if !strings.Contains(result, "insufficient data") {
+		t.Error("Output should still contain the insufficient data warning")
+	}
+}
+
+func TestFormatResponse_Severity(t *testing.T) {
+	resp := config.LLMResponse{
+		Status:    "problem_detected",
+		Severity:  "high",
+		RootCause: "Disk full",
+		Evidence:  "ERROR no space left on device",
+		Fix:       "df -h",
+	}
+	jsonData, _ := json.Marshal(resp)
+
+	tests := []struct {
+		name    string
+		opts    renderOptions
+		want    string
+		notWant string
+	}{
+		{"default theme", renderOptions{Emoji: true}, "🟠 Severity: HIGH", ""},
+		{"no emoji", renderOptions{Emoji: false}, "Severity: HIGH", "🟠"},
+		{"high contrast", renderOptions{Theme: "high-contrast"}, "[!!] Severity: HIGH", ""},
+		{"screen reader", renderOptions{Theme: "high-contrast", ScreenReader: true}, "Severity: HIGH", "[!!]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := formatResponse(string(jsonData), nil, FormatText, tt.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !strings.Contains(result, tt.want) {
+				t.Errorf("Output should contain %q, got:\n%s", tt.want, result)
+			}
+			if tt.notWant != "" && strings.Contains(result, tt.notWant) {
+				t.Errorf("Output should not contain %q, got:\n%s", tt.notWant, result)
+			}
+		})
+	}
+}
+
+func TestRenderOptionsFor_ScreenReader(t *testing.T) {
+	cfg := &config.Config{UI: config.UIConfig{ScreenReader: true}}
+
+	opts := renderOptionsFor(cfg)
+	if opts.Colored || opts.Emoji {
+		t.Errorf("Screen-reader mode should disable colors and emoji, got %+v", opts)
+	}
+}
+
+func TestProgressEnabled_QuietAndCI(t *testing.T) {
+	t.Setenv("CI", "")
+	if progressEnabled(&config.Config{UI: config.UIConfig{Quiet: true}}) {
+		t.Error("Progress should be disabled in quiet mode")
+	}
+
+	t.Setenv("CI", "true")
+	if progressEnabled(config.NewConfig()) {
+		t.Error("Progress should be disabled in CI")
+	}
+}
+
+func TestFormatElapsed(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{850 * time.Millisecond, "850ms"},
+		{1234567 * time.Microsecond, "1.2s"},
+		{42 * time.Second, "42.0s"},
+	}
+
+	for _, tt := range tests {
+		if got := formatElapsed(tt.d); got != tt.want {
+			t.Errorf("formatElapsed(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTheme(t *testing.T) {
+	tests := []struct {
+		name    string
+		theme   string
+		colors  map[string]string
+		wantErr bool
+	}{
+		{"empty", "", nil, false},
+		{"high contrast", "high-contrast", nil, false},
+		{"unknown theme", "neon", nil, true},
+		{"valid override", "", map[string]string{"critical": "bold red"}, false},
+		{"unknown severity", "", map[string]string{"fatal": "red"}, true},
+		{"unknown color", "", map[string]string{"low": "chartreuse"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTheme(tt.theme, tt.colors)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTheme() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInitialUserMessage_KeepsWholeLog(t *testing.T) {
+	// Well over Anthropic's 1024-token minimum, so follow-ups can cache it
+	log := strings.Repeat("2024-01-15 10:00:00 ERROR connection refused by db:5432\n", 200) + "last line"
+	msg := InitialUserMessage(config.QueryPayload{SanitizedLog: log})
+	if !strings.Contains(msg, log) {
+		t.Error("Initial message should hold the whole sanitized log")
+	}
+}
+
+func TestStartChat(t *testing.T) {
+	history := StartChat(config.Context{OS: "linux", Arch: "amd64", Shell: "zsh"})
+
+	// History must alternate user/assistant turns
+	if len(history) != 2 {
+		t.Fatalf("StartChat() returned %d messages, want 2", len(history))
+	}
+	if !strings.Contains(history[0], "OS: linux") {
+		t.Errorf("Opening message should contain the system context, got:\n%s", history[0])
+	}
+	if strings.Contains(history[0], "Original Log Data") {
+		t.Error("Opening message should not reference log data")
+	}
+
+	noContext := StartChat(config.Context{})
+	if strings.Contains(noContext[0], "System Environment") {
+		t.Error("Opening message should omit the system context when none was gathered")
+	}
+}
@@ -0,0 +1,48 @@
+package advisor
+
+import "strings"
+
+// categories are the problem classes the model can report (prompt v4+)
+var categories = []string{"network", "auth", "config", "resource", "dependency", "code-bug"}
+
+// categoryRoutePrefix marks routing table keys that match a category
+// rather than a severity, e.g. "category:auth"
+const categoryRoutePrefix = "category:"
+
+// Categories returns the problem classes the model can report
+func Categories() []string {
+	return append([]string(nil), categories...)
+}
+
+// isCategory reports whether s is a known category
+func isCategory(s string) bool {
+	for _, category := range categories {
+		if s == category {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeCategory returns category in canonical form, or "" if it is unknown
+func normalizeCategory(category string) string {
+	category = strings.ToLower(strings.TrimSpace(category))
+	category = strings.ReplaceAll(category, "_", "-")
+	if !isCategory(category) {
+		return ""
+	}
+	return category
+}
+
+// Category returns the normalized problem category reported by the model, or
+// "" if it didn't report one (prompt v3 and earlier, --no-schema) or it is unknown
+func (a *Analysis) Category() string {
+	if a.NoSchema {
+		return ""
+	}
+	llmResp, err := parseResponse(a.Raw)
+	if err != nil {
+		return ""
+	}
+	return normalizeCategory(llmResp.Category)
+}
@@ -0,0 +1,47 @@
+package advisor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnalysis_Category(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{`{"status": "problem_detected", "category": "network"}`, "network"},
+		{`{"status": "problem_detected", "category": "Code_Bug"}`, "code-bug"},
+		{`{"status": "problem_detected", "category": "gremlins"}`, ""},
+		{`{"status": "problem_detected"}`, ""},
+		{"not json", ""},
+	}
+
+	for _, tt := range tests {
+		if got := (&Analysis{Raw: tt.raw}).Category(); got != tt.want {
+			t.Errorf("Category() for %s = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+	if got := (&Analysis{Raw: tests[0].raw, NoSchema: true}).Category(); got != "" {
+		t.Errorf("Category() with NoSchema = %q, want empty", got)
+	}
+}
+
+func TestFormatResponse_Category(t *testing.T) {
+	response := `{"status": "problem_detected", "severity": "high", "category": "Resource", "root_cause": "OOM", "evidence": "killed", "fix": "raise limit"}`
+
+	text, _ := formatResponse(response, nil, FormatText, renderOptions{ScreenReader: true})
+	if !strings.Contains(text, "Severity: HIGH\nCategory: resource\n") {
+		t.Errorf("text output should show the category under the severity:\n%s", text)
+	}
+
+	markdown, _ := formatResponse(response, nil, FormatMarkdown, renderOptions{})
+	if !strings.Contains(markdown, "Category: `resource`") {
+		t.Errorf("markdown output should show the category:\n%s", markdown)
+	}
+
+	jsonOut, _ := formatResponse(response, nil, FormatJSON, renderOptions{})
+	if !strings.Contains(jsonOut, `"category": "resource"`) {
+		t.Errorf("JSON output should contain the normalized category:\n%s", jsonOut)
+	}
+}
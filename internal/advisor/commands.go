@@ -0,0 +1,209 @@
+package advisor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/ingestor"
+	"github.com/jenian/que/internal/platform"
+	"github.com/jenian/que/internal/policy"
+	"github.com/jenian/que/pkg/llm"
+)
+
+// chatHelp lists the slash commands understood in interactive mode
+const chatHelp = `Commands:
+  /model              Show the provider and model answering questions
+  /model NAME         Switch to another model of the current provider
+  /provider NAME [M]  Switch provider, optionally with model M
+  /run [N]            List the suggested diagnostics, or run number N
+  /steps              List the steps of the fix
+  /copy N             Copy the command of fix step N to the clipboard
+  /apply N            Run fix step N after confirmation and discuss the result
+  /help               Show this help
+  exit, quit          Leave interactive mode`
+
+// chatState holds the client answering interactive questions. Switching
+// provider or model replaces the client but keeps the conversation.
+type chatState struct {
+	client    llm.Client
+	cfg       config.Config
+	newClient func(cfg *config.Config) (llm.Client, error)
+
+	// diagnostics are the commands /run can pick from; runner is nil when
+	// commands can't be run in this conversation
+	diagnostics []ProposedCommand
+	runner      *investigator
+
+	// steps are the fix steps /copy and /apply pick from. /copy puts them on
+	// the system clipboard with copyText, or failing that asks the terminal
+	// to (clipboard, nil when stderr isn't one).
+	steps     []config.FixStep
+	copyText  func(text string) error
+	clipboard io.Writer
+}
+
+// newChatState starts from client and a copy of cfg, so switches made during
+// the conversation don't leak back to the caller
+func newChatState(client llm.Client, cfg *config.Config) *chatState {
+	s := &chatState{client: client, cfg: *cfg, newClient: llm.NewClient, copyText: platform.Copy}
+	if ingestor.IsTerminal(os.Stderr) {
+		s.clipboard = os.Stderr
+	}
+	return s
+}
+
+// describe names the provider and model currently in use
+func (s *chatState) describe() string {
+	return fmt.Sprintf("%s (%s)", s.cfg.Provider, llm.ResolveModel(s.cfg.Provider, s.cfg.Model))
+}
+
+// handleCommand runs a slash command and returns the message to show. On
+// error the current client stays in use.
+func (s *chatState) handleCommand(input string) (string, error) {
+	fields := strings.Fields(input)
+	switch fields[0] {
+	case "/help":
+		return chatHelp, nil
+	case "/model":
+		if len(fields) == 1 {
+			return "Using " + s.describe(), nil
+		}
+		if len(fields) > 2 {
+			return "", fmt.Errorf("usage: /model NAME")
+		}
+		return s.switchTo(s.cfg.Provider, fields[1])
+	case "/provider":
+		if len(fields) == 1 {
+			return "Using " + s.describe() + "; available: " + strings.Join(llm.ProviderNames(), ", "), nil
+		}
+		if len(fields) > 3 {
+			return "", fmt.Errorf("usage: /provider NAME [MODEL]")
+		}
+		model := ""
+		if len(fields) == 3 {
+			model = fields[2]
+		}
+		return s.switchTo(fields[1], model)
+	case "/steps":
+		if len(s.steps) == 0 {
+			return "", fmt.Errorf("the fix has no separate steps")
+		}
+		return strings.TrimSuffix(formatStepsList(s.steps), "\n"), nil
+	case "/copy":
+		n, step, err := s.pickStep(fields)
+		if err != nil {
+			return "", err
+		}
+		if err := s.copyText(step.Command); err != nil {
+			// Over SSH there is no local clipboard tool, but the terminal has one
+			if s.clipboard == nil {
+				return "", fmt.Errorf("can't copy step %d: %w", n, err)
+			}
+			if err := copyWithTerminal(s.clipboard, step.Command); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("Copied step %d to the clipboard", n), nil
+	default:
+		return "", fmt.Errorf("unknown command %s (try /help)", fields[0])
+	}
+}
+
+// runDiagnostic handles /run. Without a number it lists the suggested
+// diagnostics; with one it runs that command through the command policy and
+// audit log and returns the question that sends its output to the model.
+// Picking the number is the user's approval.
+func (s *chatState) runDiagnostic(input string) (list string, question string, err error) {
+	fields := strings.Fields(input)
+	if len(s.diagnostics) == 0 {
+		return "", "", fmt.Errorf("no diagnostics were suggested")
+	}
+	if len(fields) == 1 {
+		return strings.TrimSuffix(formatDiagnosticsList(s.diagnostics), "\n"), "", nil
+	}
+	n, err := strconv.Atoi(fields[1])
+	if len(fields) > 2 || err != nil {
+		return "", "", fmt.Errorf("usage: /run [N]")
+	}
+	if n < 1 || n > len(s.diagnostics) {
+		return "", "", fmt.Errorf("no diagnostic %d; pick 1-%d", n, len(s.diagnostics))
+	}
+	if s.runner == nil {
+		return "", "", fmt.Errorf("diagnostics can't be run in this conversation")
+	}
+
+	cmd := s.diagnostics[n-1]
+	result, _, err := s.runner.handle(cmd)
+	if err != nil {
+		return "", "", err
+	}
+	return "", fmt.Sprintf("I ran a suggested diagnostic:\n\n$ %s\n%s\n\nWhat does this tell us?", cmd.Command, result), nil
+}
+
+// pickStep returns the fix step with a command that the number in a /copy or
+// /apply command line names
+func (s *chatState) pickStep(fields []string) (int, config.FixStep, error) {
+	if len(s.steps) == 0 {
+		return 0, config.FixStep{}, fmt.Errorf("the fix has no separate steps")
+	}
+	if len(fields) != 2 {
+		return 0, config.FixStep{}, fmt.Errorf("usage: %s N", fields[0])
+	}
+	n, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, config.FixStep{}, fmt.Errorf("usage: %s N", fields[0])
+	}
+	if n < 1 || n > len(s.steps) {
+		return 0, config.FixStep{}, fmt.Errorf("no step %d; pick 1-%d", n, len(s.steps))
+	}
+	step := s.steps[n-1]
+	if step.Command == "" {
+		return 0, config.FixStep{}, fmt.Errorf("step %d has no command", n)
+	}
+	return n, step, nil
+}
+
+// applyStep handles /apply once the user confirmed it: it runs fix step n in
+// the shell, audited like diagnostics, and returns the redacted output and
+// the question that sends it to the model
+func (s *chatState) applyStep(n int, step config.FixStep) (output string, question string, err error) {
+	if s.runner == nil {
+		return "", "", fmt.Errorf("fix steps can't be applied in this conversation")
+	}
+	entry := policy.AuditEntry{Command: step.Command, Reason: fmt.Sprintf("fix step %d", n), Decision: policy.DecisionRan}
+	if err := s.runner.record(entry); err != nil {
+		return "", "", err
+	}
+	output = s.runner.execute(shellArgs(step.Command))
+	return output, fmt.Sprintf("I applied step %d of the fix:\n\n$ %s\n%s\n\nDid it work, and what should I do next?", n, step.Command, output), nil
+}
+
+// switchTo replaces the client with one for provider and model
+func (s *chatState) switchTo(provider, model string) (string, error) {
+	if err := llm.ValidateProvider(provider); err != nil {
+		return "", err
+	}
+	if p, ok := llm.LookupProvider(provider); ok {
+		if err := p.CheckEnv(); err != nil {
+			return "", err
+		}
+	}
+
+	next := s.cfg
+	next.Provider = provider
+	next.Model = model
+	// The keys were dropped once the first client was created
+	next.LoadKeys()
+	client, err := s.newClient(&next)
+	next.DropKeys()
+	if err != nil {
+		return "", fmt.Errorf("failed to create LLM client: %w", err)
+	}
+	s.client = client
+	s.cfg = next
+	return "Switched to " + s.describe(), nil
+}
@@ -0,0 +1,86 @@
+//go:build !noopenai && !noclaude && !minimal
+
+package advisor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/pkg/llm"
+)
+
+func TestChatState_HandleCommand(t *testing.T) {
+	t.Setenv("QUE_CLAUDE_API_KEY", "test-key")
+	t.Setenv("QUE_CHATGPT_API_KEY", "test-key")
+
+	original := &scriptedClient{}
+	chat := newChatState(original, &config.Config{Provider: "openai", Model: "gpt-4o-mini"})
+	var created []config.Config
+	chat.newClient = func(cfg *config.Config) (llm.Client, error) {
+		created = append(created, *cfg)
+		return &scriptedClient{}, nil
+	}
+
+	if msg, err := chat.handleCommand("/model"); err != nil || !strings.Contains(msg, "gpt-4o-mini") {
+		t.Errorf("/model = %q, %v, want the current model", msg, err)
+	}
+
+	if _, err := chat.handleCommand("/model gpt-4.1"); err != nil {
+		t.Fatalf("/model gpt-4.1 error = %v", err)
+	}
+	if chat.cfg.Provider != "openai" || chat.cfg.Model != "gpt-4.1" || chat.client == original {
+		t.Errorf("after /model: provider = %q, model = %q, want openai/gpt-4.1 with a new client", chat.cfg.Provider, chat.cfg.Model)
+	}
+
+	if _, err := chat.handleCommand("/provider claude"); err != nil {
+		t.Fatalf("/provider claude error = %v", err)
+	}
+	if chat.cfg.Provider != "claude" || chat.cfg.Model != "" {
+		t.Errorf("after /provider: provider = %q, model = %q, want claude with its default model", chat.cfg.Provider, chat.cfg.Model)
+	}
+	if len(created) != 2 {
+		t.Errorf("created %d clients, want 2", len(created))
+	}
+
+	for _, input := range []string{"/provider bedrock", "/frobnicate", "/model a b"} {
+		if _, err := chat.handleCommand(input); err == nil {
+			t.Errorf("%s error = nil, want error", input)
+		}
+	}
+	if chat.cfg.Provider != "claude" || chat.cfg.Model != "" {
+		t.Errorf("failed commands changed provider/model to %q/%q", chat.cfg.Provider, chat.cfg.Model)
+	}
+}
+
+func TestChatState_SwitchNeedsAPIKey(t *testing.T) {
+	t.Setenv("QUE_CLAUDE_API_KEY", "")
+	chat := newChatState(&scriptedClient{}, &config.Config{Provider: "openai"})
+
+	_, err := chat.handleCommand("/provider claude")
+	if err == nil || !strings.Contains(err.Error(), "QUE_CLAUDE_API_KEY") {
+		t.Errorf("/provider claude = %v, want an error naming QUE_CLAUDE_API_KEY", err)
+	}
+	if chat.cfg.Provider != "openai" {
+		t.Errorf("provider = %q after failed switch, want openai", chat.cfg.Provider)
+	}
+}
+
+func TestChatState_SwitchAfterDropKeys(t *testing.T) {
+	t.Setenv("QUE_CLAUDE_API_KEY", "test-key")
+	t.Setenv("QUE_CHATGPT_API_KEY", "test-key")
+	cfg := &config.Config{Provider: "openai"}
+	cfg.LoadKeys()
+	cfg.DropKeys()
+
+	chat := newChatState(&scriptedClient{}, cfg)
+	if _, err := chat.handleCommand("/provider claude"); err != nil {
+		t.Fatalf("/provider claude after DropKeys error = %v", err)
+	}
+	if chat.cfg.Provider != "claude" {
+		t.Errorf("provider = %q, want claude", chat.cfg.Provider)
+	}
+	if chat.cfg.ClaudeKey != "" || chat.cfg.ChatGPTKey != "" {
+		t.Error("the switch left the API keys in the conversation's config")
+	}
+}
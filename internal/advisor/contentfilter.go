@@ -0,0 +1,81 @@
+package advisor
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/summarizer"
+	"github.com/jenian/que/pkg/llm"
+)
+
+// strippedHint tells the model why it only sees part of the log
+const strippedHint = "Only the error lines of this log and the stack traces following them are included; the rest was left out because the provider's content filter refused the full log."
+
+// RetryContentFiltered handles the provider's content filter refusing to
+// analyze payload (err). It explains the refusal and, when cfg.StripOnFilter
+// is set or the user agrees at the terminal, analyzes the log again reduced
+// to its error lines and their stack traces (see summarizer.Strip). Any
+// other error, or a declined retry, returns err unchanged.
+func RetryContentFiltered(ctx context.Context, client llm.Client, cfg *config.Config, payload config.QueryPayload, err error) (*Analysis, error) {
+	if !errors.Is(err, llm.ErrContentFiltered) {
+		return nil, err
+	}
+	Report(cfg, "%s", explainContentFilter(err))
+
+	stripped, report := summarizer.Strip(payload.SanitizedLog)
+	if report.RelevantKept == 0 {
+		return nil, err
+	}
+	if report.LinesOmitted == 0 {
+		// Every line is an error line, so a retry would send the same log
+		return nil, err
+	}
+	kept := 0
+	for _, line := range report.LineMap {
+		if line > 0 {
+			kept++
+		}
+	}
+
+	question := fmt.Sprintf("Retry with only the %d error and stack trace lines, leaving out %d others?", kept, report.LinesOmitted)
+	if !cfg.StripOnFilter && !confirm(cfg, question) {
+		return nil, err
+	}
+	Report(cfg, "Retrying with %d error and stack trace lines (%d lines left out)", kept, report.LinesOmitted)
+
+	payload.SanitizedLog = stripped
+	payload.LineMap = payload.LineMap.Then(report.LineMap)
+	payload.Hint = strings.TrimSpace(payload.Hint + "\n\n" + strippedHint)
+	return Analyze(ctx, client, cfg, payload)
+}
+
+// explainContentFilter describes a content filter refusal for the user
+func explainContentFilter(err error) string {
+	flagged := "the log"
+	if categories := llm.ContentFilterCategories(err); len(categories) > 0 {
+		flagged = "the log as " + strings.ReplaceAll(strings.Join(categories, ", "), "_", "-")
+	}
+	return fmt.Sprintf("The provider's content filter refused the request: it flagged %s. "+
+		"Logs sometimes carry user-generated text, such as request bodies or chat messages, that trips these filters.", flagged)
+}
+
+// confirm asks question at the terminal and reports whether the user said
+// yes. Without someone to ask (CI, quiet mode, JSON progress, no terminal)
+// the answer is no.
+func confirm(cfg *config.Config, question string) bool {
+	if !progressEnabled(cfg) || jsonProgress(cfg) {
+		return false
+	}
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return false
+	}
+	defer tty.Close()
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	return readYes(bufio.NewScanner(tty))
+}
@@ -0,0 +1,122 @@
+package advisor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/jenian/que/internal/config"
+)
+
+// destructivePatterns match command lines that delete data or override
+// safety checks, with why they are flagged
+var destructivePatterns = []struct {
+	re     *regexp.Regexp
+	reason string
+}{
+	{regexp.MustCompile(`\bkubectl\s+(.*\s)?delete\b`), "deletes Kubernetes resources"},
+	{regexp.MustCompile(`(?i)\bdrop\s+(table|database|schema|index|user|role)\b`), "drops database objects"},
+	{regexp.MustCompile(`(?i)\btruncate\s+(table\s+)?\w+`), "empties a database table"},
+	{regexp.MustCompile(`(?i)\bdelete\s+from\s+[\w."]+\s*(;|$)`), "deletes every row of a table"},
+	{regexp.MustCompile(`\bgit\s+(reset\s+--hard|clean\s+-\w*f|push\s+(.*\s)?(-f|--force)\b)`), "discards or overwrites git history"},
+	{regexp.MustCompile(`\b(mkfs(\.\w+)?|wipefs|fdisk|parted)\s`), "reformats or repartitions a disk"},
+	{regexp.MustCompile(`\bdd\s+.*\bof=/dev/`), "overwrites a block device"},
+	{regexp.MustCompile(`\bdocker\s+(system\s+prune|volume\s+(rm|prune)|rm\s+(.*\s)?-\w*v)`), "deletes Docker volumes or data"},
+	{regexp.MustCompile(`\b(terraform\s+destroy|helm\s+(uninstall|delete))\b`), "tears down infrastructure"},
+	{regexp.MustCompile(`\bchmod\s+(-\w+\s+)*-R\s+(-\w+\s+)*0?777\b`), "makes a directory tree writable by everyone"},
+	{regexp.MustCompile(`\s--force\b`), "overrides a safety check (--force)"},
+}
+
+// rmFlags captures the options of an rm command
+var rmFlags = regexp.MustCompile(`\brm((\s+-[-\w]+)+)`)
+
+// destructiveReason returns why command is destructive, or "" if it isn't
+func destructiveReason(command string) string {
+	if match := rmFlags.FindStringSubmatch(command); match != nil && forcedRecursive(strings.Fields(match[1])) {
+		return "deletes files recursively without asking"
+	}
+	for _, p := range destructivePatterns {
+		if p.re.MatchString(command) {
+			return p.reason
+		}
+	}
+	return ""
+}
+
+// forcedRecursive reports whether rm flags ask for both -r and -f
+func forcedRecursive(flags []string) bool {
+	recursive, force := false, false
+	for _, flag := range flags {
+		switch {
+		case flag == "--recursive":
+			recursive = true
+		case flag == "--force":
+			force = true
+		case !strings.HasPrefix(flag, "--"):
+			recursive = recursive || strings.ContainsAny(flag, "rR")
+			force = force || strings.Contains(flag, "f")
+		}
+	}
+	return recursive && force
+}
+
+// destructiveCommands returns the lines of fix that would delete data or
+// force changes, for the warning shown above the fix
+func destructiveCommands(fix string) []config.DestructiveCommand {
+	var commands []config.DestructiveCommand
+	for _, line := range strings.Split(fix, "\n") {
+		line = listMarker.ReplaceAllString(strings.TrimSpace(line), "")
+		if reason := destructiveReason(line); reason != "" {
+			commands = append(commands, config.DestructiveCommand{Command: line, Reason: reason})
+		}
+	}
+	return commands
+}
+
+// confirmDestructive asks a second time before a destructive command runs,
+// accepting only a typed "yes". Other commands need no second confirmation.
+func confirmDestructive(scanner *bufio.Scanner, w io.Writer, command string) bool {
+	reason := destructiveReason(command)
+	if reason == "" {
+		return true
+	}
+	color.New(color.FgRed, color.Bold).Fprintf(w, "This command is destructive: it %s.\n", reason)
+	fmt.Fprint(w, "Type yes to run it anyway: ")
+	return scanner.Scan() && strings.ToLower(strings.TrimSpace(scanner.Text())) == "yes"
+}
+
+// formatDestructiveText renders the warning banner for destructive fix
+// commands, or "" if there are none
+func formatDestructiveText(commands []config.DestructiveCommand, opts renderOptions) string {
+	if len(commands) == 0 {
+		return ""
+	}
+	bannerColor := newColor(opts.Colored, color.FgRed, color.Bold)
+	var output strings.Builder
+	output.WriteString(bannerColor.Sprint(withEmoji("⛔ ", "DESTRUCTIVE: review these commands before running them", opts.Emoji)))
+	output.WriteString("\n")
+	for _, cmd := range commands {
+		output.WriteString(bannerColor.Sprint("  " + cmd.Command))
+		output.WriteString("\n    " + cmd.Reason + "\n")
+	}
+	output.WriteString("\n")
+	return output.String()
+}
+
+// formatDestructiveMarkdown renders the warning banner as a markdown quote,
+// or "" if there are none
+func formatDestructiveMarkdown(commands []config.DestructiveCommand, opts renderOptions) string {
+	if len(commands) == 0 {
+		return ""
+	}
+	var output strings.Builder
+	output.WriteString("> **" + withEmoji("⛔ ", "DESTRUCTIVE: review these commands before running them", opts.Emoji) + "**\n>\n")
+	for _, cmd := range commands {
+		output.WriteString("> - `" + cmd.Command + "`: " + cmd.Reason + "\n")
+	}
+	output.WriteString("\n")
+	return output.String()
+}
@@ -0,0 +1,84 @@
+package advisor
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+func TestDestructiveReason(t *testing.T) {
+	tests := []struct {
+		command     string
+		destructive bool
+	}{
+		{"rm -rf /var/lib/docker", true},
+		{"sudo rm -fr ./build", true},
+		{"rm -r -f cache", true},
+		{"rm --recursive --force cache", true},
+		{"rm -f /tmp/app.pid", false},
+		{"rm -r old-logs", false},
+		{"kubectl delete ns payments", true},
+		{"kubectl -n payments delete pod api-7d9f", true},
+		{"kubectl get pods", false},
+		{`psql -c "DROP TABLE sessions"`, true},
+		{"DELETE FROM sessions;", true},
+		{"DELETE FROM sessions WHERE expires_at < now();", false},
+		{"TRUNCATE audit_log", true},
+		{"git push --force origin main", true},
+		{"git reset --hard HEAD~1", true},
+		{"docker volume prune", true},
+		{"terraform destroy -target=module.db", true},
+		{"helm upgrade api ./chart --force", true},
+		{"systemctl restart nginx", false},
+	}
+
+	for _, tt := range tests {
+		if got := destructiveReason(tt.command) != ""; got != tt.destructive {
+			t.Errorf("destructiveReason(%q) flagged = %v, want %v", tt.command, got, tt.destructive)
+		}
+	}
+}
+
+func TestDestructiveCommands_Output(t *testing.T) {
+	response := `{"status": "problem_detected", "severity": "high", "root_cause": "Corrupt index", "evidence": "index corrupted", "fix": "1. Back up the data\n2. ` + "`psql -c 'DROP INDEX users_email_idx'`" + `"}`
+	analysis := newAnalysis(config.NewConfig(), config.QueryPayload{}, response)
+
+	text, _ := analysis.Format(FormatText, renderOptions{})
+	if !strings.Contains(text, "DESTRUCTIVE") || !strings.Contains(text, "drops database objects") {
+		t.Errorf("Text output should warn about the DROP, got:\n%s", text)
+	}
+	if strings.Index(text, "DESTRUCTIVE") > strings.Index(text, "Fix") {
+		t.Errorf("The warning should come before the fix, got:\n%s", text)
+	}
+	markdown, _ := analysis.Format(FormatMarkdown, renderOptions{})
+	if !strings.Contains(markdown, "> **DESTRUCTIVE") {
+		t.Errorf("Markdown output should quote the warning, got:\n%s", markdown)
+	}
+	jsonOut, _ := analysis.Format(FormatJSON, renderOptions{})
+	if !strings.Contains(jsonOut, `"destructive_commands": [`) {
+		t.Errorf("JSON output should include destructive_commands, got:\n%s", jsonOut)
+	}
+}
+
+func TestConfirmDestructive(t *testing.T) {
+	tests := []struct {
+		command string
+		answer  string
+		want    bool
+	}{
+		{"systemctl restart nginx", "", true},
+		{"rm -rf /var/cache/app", "yes\n", true},
+		{"rm -rf /var/cache/app", "y\n", false},
+		{"rm -rf /var/cache/app", "", false},
+	}
+
+	for _, tt := range tests {
+		scanner := bufio.NewScanner(strings.NewReader(tt.answer))
+		if got := confirmDestructive(scanner, io.Discard, tt.command); got != tt.want {
+			t.Errorf("confirmDestructive(%q, %q) = %v, want %v", tt.command, tt.answer, got, tt.want)
+		}
+	}
+}
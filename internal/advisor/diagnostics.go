@@ -0,0 +1,80 @@
+package advisor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/jenian/que/internal/config"
+)
+
+// diagnosticsTitle heads the list of suggested read-only commands
+const diagnosticsTitle = "Suggested Diagnostics"
+
+// proposedCommands converts the diagnostics in a response, dropping empty commands
+func proposedCommands(diagnostics []config.DiagnosticCommand) []ProposedCommand {
+	var commands []ProposedCommand
+	for _, d := range diagnostics {
+		if command := strings.TrimSpace(d.Command); command != "" {
+			commands = append(commands, ProposedCommand{Command: command, Reason: strings.TrimSpace(d.Reason)})
+		}
+	}
+	return commands
+}
+
+// Diagnostics returns the read-only commands the model suggested to gather
+// more evidence, or nil if it suggested none (prompt v4 and earlier, --no-schema)
+func (a *Analysis) Diagnostics() []ProposedCommand {
+	if a.NoSchema {
+		return nil
+	}
+	llmResp, err := parseResponse(a.Raw)
+	if err != nil {
+		return nil
+	}
+	return proposedCommands(llmResp.Diagnostics)
+}
+
+// formatDiagnosticsText renders the suggested commands as a numbered list
+// under a heading, or "" if the model suggested none
+func formatDiagnosticsText(diagnostics []config.DiagnosticCommand, titleColor *color.Color) string {
+	commands := proposedCommands(diagnostics)
+	if len(commands) == 0 {
+		return ""
+	}
+
+	return titleColor.Sprint(diagnosticsTitle) + "\n\n" + formatDiagnosticsList(commands) + "\n"
+}
+
+// formatDiagnosticsList renders commands as a plain numbered list
+func formatDiagnosticsList(commands []ProposedCommand) string {
+	var output strings.Builder
+	for i, cmd := range commands {
+		fmt.Fprintf(&output, "  %d. $ %s\n", i+1, cmd.Command)
+		if cmd.Reason != "" {
+			fmt.Fprintf(&output, "     %s\n", cmd.Reason)
+		}
+	}
+	return output.String()
+}
+
+// formatDiagnosticsMarkdown renders the suggested commands as a numbered
+// markdown list, or "" if the model suggested none
+func formatDiagnosticsMarkdown(diagnostics []config.DiagnosticCommand) string {
+	commands := proposedCommands(diagnostics)
+	if len(commands) == 0 {
+		return ""
+	}
+
+	var output strings.Builder
+	output.WriteString("## " + diagnosticsTitle + "\n\n")
+	for i, cmd := range commands {
+		fmt.Fprintf(&output, "%d. `%s`", i+1, cmd.Command)
+		if cmd.Reason != "" {
+			output.WriteString(" — " + cmd.Reason)
+		}
+		output.WriteString("\n")
+	}
+	output.WriteString("\n")
+	return output.String()
+}
@@ -0,0 +1,143 @@
+package advisor
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+const diagnosticsResponse = `{
+	"status": "insufficient_data",
+	"severity": "medium",
+	"root_cause": "Pod web-1 is crashing",
+	"evidence": "Back-off restarting failed container",
+	"fix": "",
+	"diagnostics": [
+		{"command": "kubectl describe pod web-1", "reason": "check recent events"},
+		{"command": "  "},
+		{"command": "kubectl logs web-1 --previous"}
+	]
+}`
+
+func TestFormatResponse_Diagnostics(t *testing.T) {
+	text, err := formatResponse(diagnosticsResponse, nil, FormatText, renderOptions{})
+	if err != nil {
+		t.Fatalf("formatResponse() error = %v", err)
+	}
+	want := "Suggested Diagnostics\n\n" +
+		"  1. $ kubectl describe pod web-1\n" +
+		"     check recent events\n" +
+		"  2. $ kubectl logs web-1 --previous\n"
+	if !strings.Contains(text, want) {
+		t.Errorf("text output missing numbered diagnostics:\n%s", text)
+	}
+
+	markdown, _ := formatResponse(diagnosticsResponse, nil, FormatMarkdown, renderOptions{})
+	if !strings.Contains(markdown, "## Suggested Diagnostics\n\n1. `kubectl describe pod web-1` — check recent events\n2. `kubectl logs web-1 --previous`\n") {
+		t.Errorf("markdown output missing diagnostics list:\n%s", markdown)
+	}
+
+	// Diagnostics only make sense while evidence is missing
+	solved := strings.Replace(diagnosticsResponse, `"insufficient_data"`, `"problem_detected"`, 1)
+	solved = strings.Replace(solved, `"fix": ""`, `"fix": "raise the memory limit"`, 1)
+	if text, _ := formatResponse(solved, nil, FormatText, renderOptions{}); strings.Contains(text, "Suggested Diagnostics") {
+		t.Errorf("diagnostics should not be shown once a fix is known:\n%s", text)
+	}
+}
+
+func TestAnalysisDiagnostics(t *testing.T) {
+	got := (&Analysis{Raw: diagnosticsResponse}).Diagnostics()
+	if len(got) != 2 || got[0].Command != "kubectl describe pod web-1" || got[1].Command != "kubectl logs web-1 --previous" {
+		t.Errorf("Diagnostics() = %+v", got)
+	}
+	if got := (&Analysis{Raw: diagnosticsResponse, NoSchema: true}).Diagnostics(); got != nil {
+		t.Errorf("Diagnostics() with --no-schema = %+v, want nil", got)
+	}
+}
+
+func TestInvestigate_StartsWithSuggestedDiagnostics(t *testing.T) {
+	client := &scriptedClient{responses: []string{
+		`{"done": true, "commands": []}`,
+		mockLLMResponse("problem_detected", "OOMKilled", "CrashLoopBackOff", "raise memory limit"),
+	}}
+	var ran []string
+	inv := newTestInvestigator(client, map[string]bool{"kubectl describe pod web-1": true}, &ran)
+
+	final, err := inv.investigate(context.Background(), config.QueryPayload{SanitizedLog: "ERROR"}, &Analysis{Raw: diagnosticsResponse})
+	if err != nil {
+		t.Fatalf("investigate() error = %v", err)
+	}
+	if len(ran) != 1 || ran[0] != "kubectl describe pod web-1" {
+		t.Errorf("The approved suggestion should run without asking the model first, ran %q", ran)
+	}
+	if !strings.HasPrefix(client.questions[0], "Command results:") {
+		t.Errorf("The first question should carry the suggestion results, got %q", client.questions[0])
+	}
+	if !strings.Contains(final.Raw, "OOMKilled") {
+		t.Errorf("Expected the final diagnosis, got %q", final.Raw)
+	}
+}
+
+func TestChatRunDiagnostic(t *testing.T) {
+	var ran []string
+	chat := &chatState{
+		diagnostics: (&Analysis{Raw: diagnosticsResponse}).Diagnostics(),
+		runner:      newTestInvestigator(&scriptedClient{}, map[string]bool{"kubectl logs web-1 --previous": true}, &ran),
+	}
+
+	list, question, err := chat.runDiagnostic("/run")
+	if err != nil || question != "" || !strings.Contains(list, "2. $ kubectl logs web-1 --previous") {
+		t.Errorf("/run should list the diagnostics, got %q, %q, %v", list, question, err)
+	}
+
+	for _, input := range []string{"/run 0", "/run 3", "/run two", "/run 1 2"} {
+		if _, _, err := chat.runDiagnostic(input); err == nil {
+			t.Errorf("%s: expected an error", input)
+		}
+	}
+
+	_, question, err = chat.runDiagnostic("/run 2")
+	if err != nil {
+		t.Fatalf("/run 2 error = %v", err)
+	}
+	if len(ran) != 1 || ran[0] != "kubectl logs web-1 --previous" {
+		t.Errorf("/run 2 should run the second diagnostic, ran %q", ran)
+	}
+	if !strings.Contains(question, "$ kubectl logs web-1 --previous") || strings.Contains(question, "hunter2") {
+		t.Errorf("question should carry the redacted output, got %q", question)
+	}
+
+	if _, _, err := (&chatState{}).runDiagnostic("/run 1"); err == nil {
+		t.Error("/run without diagnostics should fail")
+	}
+}
+
+func TestFormatResponse_Missing(t *testing.T) {
+	response := strings.Replace(diagnosticsResponse, `"fix": "",`, `"fix": "", "missing": ["the nginx error log (/var/log/nginx/error.log)", " ", "the upstream service's logs"],`, 1)
+
+	text, err := formatResponse(response, nil, FormatText, renderOptions{})
+	if err != nil {
+		t.Fatalf("formatResponse() error = %v", err)
+	}
+	want := "To continue, please provide:\n" +
+		"  - the nginx error log (/var/log/nginx/error.log)\n" +
+		"  - the upstream service's logs\n"
+	if !strings.Contains(text, want) {
+		t.Errorf("text output should list what is missing:\n%s", text)
+	}
+	if strings.Contains(text, insufficientDataMessage) {
+		t.Errorf("the generic warning should be replaced by the specific requests:\n%s", text)
+	}
+
+	markdown, _ := formatResponse(response, nil, FormatMarkdown, renderOptions{})
+	if !strings.Contains(markdown, "please provide:\n>\n> - the nginx error log (/var/log/nginx/error.log)\n> - the upstream service's logs\n") {
+		t.Errorf("markdown output should list what is missing:\n%s", markdown)
+	}
+
+	// Without specifics the generic warning remains
+	if text, _ := formatResponse(diagnosticsResponse, nil, FormatText, renderOptions{}); !strings.Contains(text, insufficientDataMessage) {
+		t.Errorf("expected the generic warning:\n%s", text)
+	}
+}
@@ -0,0 +1,413 @@
+package advisor
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/httpclient"
+	"github.com/jenian/que/internal/textutil"
+)
+
+// Email formats the "email" sink sends in
+const (
+	EmailHTML     = "html"     // An HTML report with the markdown as the plain-text alternative
+	EmailMarkdown = "markdown" // The markdown report as plain text
+)
+
+// emailTimeout bounds how long delivery to the mail server may take
+const emailTimeout = 30 * time.Second
+
+// Ports of the mail server
+const (
+	defaultSMTPPort = 587 // Submission, upgraded with STARTTLS
+	smtpsPort       = 465 // Submission over implicit TLS
+)
+
+// emailSink emails analyses that found a problem through an SMTP server.
+// Analyses without problems aren't sent, so a scheduled run only mails when
+// there is something to look at.
+type emailSink struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	to       []string
+	format   string
+	opts     renderOptions
+}
+
+// newEmailSink builds the email sink from cfg.Email, sending to the address
+// target instead of the configured recipients if given. The SMTP password is read
+// from QUE_SMTP_PASSWORD.
+func newEmailSink(cfg *config.Config, target string, opts renderOptions) (*emailSink, error) {
+	email := cfg.Email
+	if email.Host == "" {
+		return nil, fmt.Errorf("--output email requires a mail server (email.host in %s)", config.DefaultConfigPath())
+	}
+	to := email.To
+	if target != "" {
+		to = []string{target}
+	}
+	var recipients []string
+	for _, address := range to {
+		if address = strings.TrimSpace(address); address != "" {
+			recipients = append(recipients, address)
+		}
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("--output email requires a recipient (email=ADDRESS or email.to in %s)", config.DefaultConfigPath())
+	}
+
+	format := strings.ToLower(email.Format)
+	if format == "" {
+		format = EmailHTML
+	}
+	if format != EmailHTML && format != EmailMarkdown {
+		return nil, fmt.Errorf("invalid email.format: %s (must be %s or %s)", email.Format, EmailHTML, EmailMarkdown)
+	}
+	port := email.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	from := email.From
+	if from == "" && strings.Contains(email.Username, "@") {
+		from = email.Username
+	}
+	if from == "" {
+		hostname, _ := os.Hostname()
+		if hostname == "" {
+			hostname = "localhost"
+		}
+		from = "que@" + hostname
+	}
+
+	return &emailSink{
+		host:     email.Host,
+		port:     port,
+		username: email.Username,
+		password: os.Getenv("QUE_SMTP_PASSWORD"),
+		from:     from,
+		to:       recipients,
+		format:   format,
+		opts:     opts,
+	}, nil
+}
+
+func (s *emailSink) Name() string { return SinkEmail }
+
+func (s *emailSink) Write(analysis *Analysis) error {
+	if analysis.NoProblem() {
+		return nil
+	}
+	markdown, err := analysis.Format(FormatMarkdown, s.opts)
+	if err != nil {
+		return err
+	}
+	var html string
+	if s.format == EmailHTML {
+		if html, err = formatEmailHTML(analysis, markdown); err != nil {
+			return err
+		}
+	}
+	hostname, _ := os.Hostname()
+	message, err := buildEmail(s.from, s.to, emailSubject(analysis, hostname), markdown, html, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := s.send(message); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Analysis emailed to %s\n", strings.Join(s.to, ", "))
+	return nil
+}
+
+// send delivers message to the recipients through the mail server. The
+// connection is encrypted with implicit TLS on port 465, or upgraded with
+// STARTTLS when the server offers it; credentials are never sent over an
+// unencrypted connection to another host.
+func (s *emailSink) send(message []byte) error {
+	addr := net.JoinHostPort(s.host, strconv.Itoa(s.port))
+	dialer := &net.Dialer{Timeout: emailTimeout}
+	var conn net.Conn
+	var err error
+	if s.port == smtpsPort {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, httpclient.TLSConfig(s.host))
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to mail server: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(emailTimeout))
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to mail server: %w", err)
+	}
+	defer client.Close()
+	if s.port != smtpsPort {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(httpclient.TLSConfig(s.host)); err != nil {
+				return fmt.Errorf("failed to start TLS with mail server: %w", err)
+			}
+		}
+	}
+	if s.username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return fmt.Errorf("mail server %s doesn't offer authentication, remove email.username to send without it", s.host)
+		}
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return fmt.Errorf("mail server authentication failed: %w", err)
+		}
+	}
+	if err := client.Mail(s.from); err != nil {
+		return fmt.Errorf("mail server rejected sender %s: %w", s.from, err)
+	}
+	for _, to := range s.to {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("mail server rejected recipient %s: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return client.Quit()
+}
+
+// emailSubject summarizes the analysis in a subject line: its severity, the
+// log and host it is about and the start of the root cause
+func emailSubject(analysis *Analysis, hostname string) string {
+	subject := "que: problem detected"
+	if severity := analysis.Severity(); severity != "" {
+		subject = "que: " + severity + " severity problem"
+	}
+	if analysis.Source != "" {
+		subject += " in " + analysis.Source
+	}
+	if hostname != "" {
+		subject += " on " + hostname
+	}
+	if analysis.NoSchema {
+		return subject
+	}
+	llmResp, err := parseResponse(analysis.Raw)
+	if err != nil {
+		return subject
+	}
+	if classifyResponse(llmResp) == "insufficient_data" {
+		return subject + " (more data needed)"
+	}
+	firstLine, _, _ := strings.Cut(strings.TrimSpace(llmResp.RootCause), "\n")
+	rootCause := strings.Join(strings.Fields(firstLine), " ")
+	if rootCause == "" {
+		return subject
+	}
+	return subject + ": " + textutil.Truncate(rootCause, 100)
+}
+
+// buildEmail returns the MIME message with the markdown report as its body,
+// or as the plain-text alternative of html when html is set
+func buildEmail(from string, to []string, subject, markdown, html string, date time.Time) ([]byte, error) {
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", from)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+
+	if html == "" {
+		message.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		message.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&message, markdown); err != nil {
+			return nil, err
+		}
+		return message.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&message)
+	fmt.Fprintf(&message, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", markdown},
+		{"text/html; charset=utf-8", html},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return message.Bytes(), nil
+}
+
+// writeQuotedPrintable writes body quoted-printable encoded, which keeps
+// long log lines within the line length limit of SMTP
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// emailReport is what the HTML email template renders
+type emailReport struct {
+	Severity      string
+	Category      string
+	RootCause     string
+	EvidenceTitle string
+	Evidence      string
+	Timeline      []config.TimelineEvent
+	Missing       []string
+	Diagnostics   []ProposedCommand
+	Destructive   []config.DestructiveCommand
+	FixSteps      []config.FixStep
+	Fix           string
+	FixWarnings   []string
+	Text          string // The report as-is when it has no structure to lay out
+	Hostname      string
+}
+
+// emailTemplate lays out the report with inline styles, which mail clients
+// keep while they drop style sheets
+var emailTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: -apple-system, 'Segoe UI', Helvetica, Arial, sans-serif; line-height: 1.5; color: #1f2328; max-width: 50em;">
+{{- if .Text}}
+<pre style="white-space: pre-wrap; font-family: Menlo, Consolas, monospace; font-size: 13px;">{{.Text}}</pre>
+{{- else}}
+{{- if or .Severity .Category}}
+<p>{{if .Severity}}<strong>{{.Severity}}</strong>{{end}}{{if and .Severity .Category}} &middot; {{end}}{{if .Category}}Category: <code>{{.Category}}</code>{{end}}</p>
+{{- end}}
+{{- if .RootCause}}
+<h2>Root Cause</h2>
+<p style="white-space: pre-wrap;">{{.RootCause}}</p>
+{{- end}}
+{{- if .Evidence}}
+<h2>{{.EvidenceTitle}}</h2>
+<pre style="white-space: pre-wrap; background: #f6f8fa; padding: 8px; font-family: Menlo, Consolas, monospace; font-size: 13px;">{{.Evidence}}</pre>
+{{- end}}
+{{- if .Timeline}}
+<h2>Timeline</h2>
+<table style="border-collapse: collapse;">
+{{- range .Timeline}}
+<tr><td style="padding: 2px 12px 2px 0; white-space: nowrap; vertical-align: top;"><code>{{.Time}}</code></td><td style="padding: 2px 0;">{{.Event}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Diagnostics}}
+<h2>Diagnostic Commands</h2>
+<ol>
+{{- range .Diagnostics}}
+<li><code>{{.Command}}</code>{{if .Reason}} &mdash; {{.Reason}}{{end}}</li>
+{{- end}}
+</ol>
+{{- end}}
+{{- if .Missing}}
+<p><strong>Problem detected but insufficient data for a clear solution. To continue, please provide:</strong></p>
+<ul>
+{{- range .Missing}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- if .Destructive}}
+<div style="border-left: 4px solid #cf222e; padding: 4px 12px; margin: 16px 0;">
+<p><strong>DESTRUCTIVE: review these commands before running them</strong></p>
+<ul>
+{{- range .Destructive}}
+<li><code>{{.Command}}</code>: {{.Reason}}</li>
+{{- end}}
+</ul>
+</div>
+{{- end}}
+{{- if .FixSteps}}
+<h2>Fix</h2>
+<ol>
+{{- range .FixSteps}}
+<li>{{.Description}}{{if .Command}}<pre style="white-space: pre-wrap; background: #f6f8fa; padding: 8px; font-family: Menlo, Consolas, monospace; font-size: 13px;">{{.Command}}</pre>{{end}}</li>
+{{- end}}
+</ol>
+{{- else if .Fix}}
+<h2>Fix</h2>
+<pre style="white-space: pre-wrap; background: #f6f8fa; padding: 8px; font-family: Menlo, Consolas, monospace; font-size: 13px;">{{.Fix}}</pre>
+{{- end}}
+{{- range .FixWarnings}}
+<p style="color: #9a6700;">&#9888; {{.}}</p>
+{{- end}}
+{{- end}}
+<p style="color: #656d76; font-size: 12px; margin-top: 24px;">Sent by que{{if .Hostname}} from {{.Hostname}}{{end}}. The analysis was made from redacted input.</p>
+</body>
+</html>
+`))
+
+// formatEmailHTML renders the analysis as an HTML report. Answers without the
+// schema, or that don't parse, are shown as their markdown text.
+func formatEmailHTML(analysis *Analysis, markdown string) (string, error) {
+	report := emailReport{}
+	report.Hostname, _ = os.Hostname()
+	llmResp, err := parseResponse(analysis.Raw)
+	if analysis.NoSchema || err != nil {
+		report.Text = markdown
+	} else {
+		llmResp.EvidenceLines = analysis.EvidenceLines
+		status := classifyResponse(llmResp)
+		report.Severity = formatSeverity(llmResp.Severity, renderOptions{ScreenReader: true})
+		report.Category = normalizeCategory(llmResp.Category)
+		if status == "problem_detected" {
+			report.RootCause = strings.TrimSpace(llmResp.RootCause)
+		}
+		report.Evidence = strings.TrimSpace(string(llmResp.Evidence))
+		report.EvidenceTitle = evidenceTitle(llmResp)
+		report.Timeline = llmResp.Timeline
+		if status == "insufficient_data" {
+			report.Diagnostics = proposedCommands(llmResp.Diagnostics)
+			report.Missing = missingItems(llmResp.Missing)
+			if len(report.Missing) == 0 {
+				report.Missing = []string{"more context or logs"}
+			}
+		} else {
+			report.Destructive = destructiveCommands(llmResp.Fix)
+			if report.FixSteps = fixSteps(llmResp.Fix); report.FixSteps == nil {
+				report.Fix = strings.TrimSpace(llmResp.Fix)
+			}
+			report.FixWarnings = analysis.FixWarnings
+		}
+	}
+
+	var html strings.Builder
+	if err := emailTemplate.Execute(&html, report); err != nil {
+		return "", fmt.Errorf("failed to render email: %w", err)
+	}
+	return html.String(), nil
+}
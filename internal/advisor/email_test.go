@@ -0,0 +1,221 @@
+package advisor
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// fakeSMTPServer accepts one message on a local port and hands it to the
+// returned channel, along with the recipients. It offers neither STARTTLS
+// nor AUTH.
+func fakeSMTPServer(t *testing.T) (int, <-chan []string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+		reply("220 localhost ESMTP")
+		var recipients []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "MAIL FROM"):
+				reply("250 OK")
+			case strings.HasPrefix(command, "RCPT TO"):
+				recipients = append(recipients, strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>"))
+				reply("250 OK")
+			case command == "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				received <- append(recipients, data.String())
+				reply("250 OK")
+			case command == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, received
+}
+
+func TestEmailSink(t *testing.T) {
+	port, received := fakeSMTPServer(t)
+	cfg := &config.Config{
+		Notify: []string{"email"},
+		Email:  config.EmailConfig{Host: "127.0.0.1", Port: port, From: "que@example.com", To: []string{"oncall@example.com"}},
+	}
+	sinks, err := NewSinks(cfg, io.Discard)
+	if err != nil {
+		t.Fatalf("NewSinks() error = %v", err)
+	}
+
+	// Nothing is sent without a problem
+	if err := Deliver(sinks, &Analysis{Raw: mockLLMResponse("no_problem", "", "", "")}); err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+	select {
+	case <-received:
+		t.Fatal("an analysis without problems was emailed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	analysis := &Analysis{Raw: mockLLMResponse("problem_detected", "The disk <sda1> is full", "ERROR no space left on device", "df -h"), Source: "app.log"}
+	if err := Deliver(sinks, analysis); err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+	var got []string
+	select {
+	case got = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email received")
+	}
+	if len(got) != 2 || got[0] != "oncall@example.com" {
+		t.Fatalf("recipients = %q, want oncall@example.com", got[:len(got)-1])
+	}
+
+	message, err := mail.ReadMessage(strings.NewReader(got[1]))
+	if err != nil {
+		t.Fatalf("invalid message: %v", err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if !strings.HasPrefix(subject, "que: problem detected in app.log") || !strings.HasSuffix(subject, ": The disk <sda1> is full") {
+		t.Errorf("Subject = %q, want the source and root cause", subject)
+	}
+	mediaType, params, _ := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, want multipart/alternative", mediaType)
+	}
+	parts := multipart.NewReader(message.Body, params["boundary"])
+	var bodies []string
+	for {
+		part, err := parts.NextPart()
+		if err != nil {
+			break
+		}
+		body, _ := io.ReadAll(part)
+		bodies = append(bodies, string(body))
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("got %d parts, want plain text and HTML", len(bodies))
+	}
+	if !strings.Contains(bodies[0], "## Root Cause") {
+		t.Errorf("plain text part = %q, want the markdown report", bodies[0])
+	}
+	if !strings.Contains(bodies[1], "The disk &lt;sda1&gt; is full") || !strings.Contains(bodies[1], "<h2>Fix</h2>") {
+		t.Errorf("HTML part = %q, want the escaped report", bodies[1])
+	}
+}
+
+func TestNewEmailSink(t *testing.T) {
+	tests := []struct {
+		name    string
+		email   config.EmailConfig
+		target  string
+		wantErr string
+	}{
+		{"no server", config.EmailConfig{To: []string{"a@example.com"}}, "", "email.host"},
+		{"no recipient", config.EmailConfig{Host: "smtp.example.com"}, "", "recipient"},
+		{"bad format", config.EmailConfig{Host: "smtp.example.com", Format: "pdf"}, "a@example.com", "email.format"},
+		{"target", config.EmailConfig{Host: "smtp.example.com"}, "a@example.com", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink, err := newEmailSink(&config.Config{Email: tt.email}, tt.target, renderOptions{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("newEmailSink() error = %v, want it to mention %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newEmailSink() error = %v", err)
+			}
+			if sink.port != defaultSMTPPort || sink.format != EmailHTML || strings.Join(sink.to, ",") != tt.target {
+				t.Errorf("newEmailSink() = %+v, want the defaults and the target as recipient", sink)
+			}
+		})
+	}
+}
+
+func TestBuildEmail_Markdown(t *testing.T) {
+	date := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	longLine := strings.Repeat("x", 2000)
+	message, err := buildEmail("que@example.com", []string{"a@example.com", "b@example.com"}, "que: Überlauf", "## Root Cause\n\n"+longLine+"\n", "", date)
+	if err != nil {
+		t.Fatalf("buildEmail() error = %v", err)
+	}
+	for _, line := range strings.Split(string(message), "\r\n") {
+		if len(line) > 998 {
+			t.Fatalf("line of %d characters exceeds the SMTP limit", len(line))
+		}
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(string(message)))
+	if err != nil {
+		t.Fatalf("invalid message: %v", err)
+	}
+	if got := parsed.Header.Get("To"); got != "a@example.com, b@example.com" {
+		t.Errorf("To = %q", got)
+	}
+	if got, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject")); got != "que: Überlauf" {
+		t.Errorf("Subject = %q", got)
+	}
+	if got := parsed.Header.Get("Date"); got != date.Format(time.RFC1123Z) {
+		t.Errorf("Date = %q", got)
+	}
+	body, _ := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if !strings.Contains(string(body), longLine) {
+		t.Error("body doesn't decode to the report")
+	}
+}
+
+func TestEmailSubject(t *testing.T) {
+	analysis := &Analysis{Raw: `{"status": "problem_detected", "severity": "high", "root_cause": "Connection pool\nexhausted", "evidence": "x", "fix": "y"}`}
+	if got := emailSubject(analysis, "web-1"); got != "que: high severity problem on web-1: Connection pool" {
+		t.Errorf("emailSubject() = %q", got)
+	}
+	insufficient := &Analysis{Raw: mockLLMResponse("insufficient_data", "", "timeout", "")}
+	if got := emailSubject(insufficient, ""); got != "que: problem detected (more data needed)" {
+		t.Errorf("emailSubject() = %q", got)
+	}
+	if got := emailSubject(&Analysis{Raw: "free text", NoSchema: true}, "web-1"); got != "que: problem detected on web-1" {
+		t.Errorf("emailSubject() without the schema = %q", got)
+	}
+}
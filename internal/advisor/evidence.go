@@ -0,0 +1,67 @@
+package advisor
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// minEvidenceLength skips evidence fragments too short to identify a log line
+const minEvidenceLength = 8
+
+// locateEvidence finds the lines of the raw input that evidence quotes. The
+// model sees the sanitized log, so each evidence line is matched there and
+// mapped back through payload.LineMap. Evidence the model paraphrased rather
+// than quoted has no line and is skipped.
+func locateEvidence(evidence string, payload config.QueryPayload) []int {
+	if strings.TrimSpace(evidence) == "" {
+		return nil
+	}
+	logLines := strings.Split(payload.SanitizedLog, "\n")
+
+	seen := make(map[int]bool)
+	var lines []int
+	for _, quoted := range strings.Split(evidence, "\n") {
+		quoted = strings.TrimSpace(quoted)
+		if len(quoted) < minEvidenceLength {
+			continue
+		}
+		for i, logLine := range logLines {
+			if !strings.Contains(logLine, quoted) {
+				continue
+			}
+			if line := payload.LineMap.Original(i + 1); line > 0 && !seen[line] {
+				seen[line] = true
+				lines = append(lines, line)
+			}
+			break
+		}
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// evidenceTitle is the heading of the evidence section, with line numbers when known
+func evidenceTitle(llmResp config.LLMResponse) string {
+	if len(llmResp.EvidenceLines) == 0 {
+		return "Evidence"
+	}
+	return "Evidence (" + formatLineNumbers(llmResp.EvidenceLines) + ")"
+}
+
+// formatLineNumbers renders lines as "line 12" or "lines 12, 40"
+func formatLineNumbers(lines []int) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	numbers := make([]string, len(lines))
+	for i, line := range lines {
+		numbers[i] = strconv.Itoa(line)
+	}
+	if len(lines) == 1 {
+		return "line " + numbers[0]
+	}
+	return "lines " + strings.Join(numbers, ", ")
+}
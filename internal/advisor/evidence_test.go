@@ -0,0 +1,69 @@
+package advisor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+func TestLocateEvidence(t *testing.T) {
+	payload := config.QueryPayload{
+		// Raw line 2 was a multi-line key collapsed by redaction, and raw
+		// lines 5-9 were summarized away
+		SanitizedLog: "starting\nkey=<REDACTED_PRIVATE_KEY> loaded\nERROR dial tcp 10.0.0.5:5432: connection refused\n... [SUMMARIZED: 5 lines] ...\nFATAL giving up after 3 retries",
+		LineMap:      config.LineMap{1, 2, 4, 0, 10},
+	}
+
+	tests := []struct {
+		name     string
+		evidence string
+		want     []int
+	}{
+		{"quoted lines", "FATAL giving up after 3 retries\nERROR dial tcp 10.0.0.5:5432: connection refused", []int{4, 10}},
+		{"partial quote", "  connection refused", []int{4}},
+		{"paraphrased", "the database was unreachable", nil},
+		{"too short", "ERROR", nil},
+		{"marker line", "SUMMARIZED: 5 lines", nil},
+		{"empty", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := locateEvidence(tt.evidence, payload)
+			if len(got) != len(tt.want) {
+				t.Fatalf("locateEvidence() = %v, want %v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("locateEvidence() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAnalysis_EvidenceLines(t *testing.T) {
+	payload := config.QueryPayload{
+		SanitizedLog: "INFO ok\nERROR disk /dev/sda1 is full\nINFO retrying",
+	}
+	response := `{"status": "problem_detected", "severity": "high", "root_cause": "Disk full", "evidence": "ERROR disk /dev/sda1 is full", "fix": "df -h"}`
+
+	analysis := newAnalysis(config.NewConfig(), payload, response)
+	if len(analysis.EvidenceLines) != 1 || analysis.EvidenceLines[0] != 2 {
+		t.Fatalf("EvidenceLines = %v, want [2]", analysis.EvidenceLines)
+	}
+
+	text, _ := analysis.Format(FormatText, renderOptions{})
+	if !strings.Contains(text, "Evidence (line 2)") {
+		t.Errorf("Text output should show the evidence line, got:\n%s", text)
+	}
+	markdown, _ := analysis.Format(FormatMarkdown, renderOptions{})
+	if !strings.Contains(markdown, "## Evidence (line 2)") {
+		t.Errorf("Markdown output should show the evidence line, got:\n%s", markdown)
+	}
+	jsonOut, _ := analysis.Format(FormatJSON, renderOptions{})
+	if !strings.Contains(jsonOut, `"evidence_lines": [`) {
+		t.Errorf("JSON output should include evidence_lines, got:\n%s", jsonOut)
+	}
+}
@@ -0,0 +1,167 @@
+package advisor
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// inlineCode matches the `code spans` fixes often wrap commands in
+var inlineCode = regexp.MustCompile("`([^`\n]+)`")
+
+// commandSeparator splits a command line into the simple commands it chains
+var commandSeparator = regexp.MustCompile(`&&|\|\||[;|]`)
+
+// listMarker is the prompt or list numbering in front of a command in a fix
+var listMarker = regexp.MustCompile(`^(\$|#|>|[-*]|\d+[.)])\s+`)
+
+// linuxOnlyCommands are commands that exist on Linux but not on macOS, with
+// what to use there instead
+var linuxOnlyCommands = map[string]string{
+	"apt":                    "use `brew install`",
+	"apt-get":                "use `brew install`",
+	"yum":                    "use `brew install`",
+	"dnf":                    "use `brew install`",
+	"apk":                    "use `brew install`",
+	"pacman":                 "use `brew install`",
+	"zypper":                 "use `brew install`",
+	"systemctl":              "use `launchctl` or `brew services`",
+	"service":                "use `launchctl` or `brew services`",
+	"journalctl":             "use `log show`",
+	"ip":                     "use `ifconfig` or `route`",
+	"update-ca-certificates": "add the certificate to the keychain with `security add-trusted-cert`",
+}
+
+// macOnlyCommands are commands that exist on macOS but not on Linux
+var macOnlyCommands = map[string]string{
+	"launchctl": "use `systemctl`",
+	"pbcopy":    "use `xclip` or `wl-copy`",
+	"pbpaste":   "use `xclip -o` or `wl-paste`",
+	"diskutil":  "use `lsblk` or `df`",
+}
+
+// unixOnlyCommands are commands that don't exist in a Windows shell
+var unixOnlyCommands = map[string]string{
+	"chmod": "use `icacls`",
+	"chown": "use `icacls`",
+	"grep":  "use `Select-String`",
+	"ln":    "use `New-Item -ItemType SymbolicLink`",
+}
+
+// lintFix checks the commands in fix against the system the analysis is for
+// and returns a warning for each one that won't work there as written, such
+// as apt-get on macOS or GNU sed syntax under BSD sed. The model is told the
+// OS and shell but doesn't always heed them. An unknown OS is not checked.
+func lintFix(fix string, ctx config.Context) []string {
+	var warnings []string
+	seen := make(map[string]bool)
+	warn := func(warning string) {
+		if !seen[warning] {
+			seen[warning] = true
+			warnings = append(warnings, warning)
+		}
+	}
+
+	for _, args := range fixCommands(fix) {
+		name := args[0]
+		switch ctx.OS {
+		case "darwin":
+			if instead, ok := linuxOnlyCommands[name]; ok {
+				warn("`" + name + "` is not available on macOS; " + instead)
+			}
+			if name == "sed" && gnuInPlace(args) {
+				warn("`sed -i` needs a backup suffix with macOS sed; use `sed -i ''`")
+			}
+		case "linux":
+			if instead, ok := macOnlyCommands[name]; ok {
+				warn("`" + name + "` is a macOS command; " + instead + " on Linux")
+			}
+			if name == "sed" && bsdInPlace(args) {
+				warn("`sed -i ''` is macOS syntax; GNU sed takes `sed -i` without the empty suffix")
+			}
+		case "windows":
+			if _, ok := linuxOnlyCommands[name]; ok && name != "ip" {
+				warn("`" + name + "` is not available on Windows; use `winget` or the WSL shell")
+			} else if instead, ok := unixOnlyCommands[name]; ok {
+				warn("`" + name + "` is not available on Windows; " + instead)
+			}
+		}
+
+		switch ctx.Shell {
+		case "pwsh", "powershell", "cmd", "csh", "tcsh", "nu":
+			if name == "export" {
+				warn("`export` doesn't set variables in " + ctx.Shell + "; " + setVariable(ctx.Shell))
+			}
+		}
+	}
+	return warnings
+}
+
+// fixCommands returns the simple commands in fix as argument lists: each line
+// and code span is split at && || ; and |, with list markers, prompts and
+// sudo removed. Prose lines yield "commands" that match no rule.
+func fixCommands(fix string) [][]string {
+	var candidates []string
+	for _, line := range strings.Split(fix, "\n") {
+		candidates = append(candidates, line)
+		for _, span := range inlineCode.FindAllStringSubmatch(line, -1) {
+			candidates = append(candidates, span[1])
+		}
+	}
+
+	var commands [][]string
+	for _, candidate := range candidates {
+		for _, part := range commandSeparator.Split(candidate, -1) {
+			part = listMarker.ReplaceAllString(strings.TrimSpace(part), "")
+			args := strings.Fields(part)
+			if len(args) > 1 && args[0] == "sudo" && !strings.HasPrefix(args[1], "-") {
+				args = args[1:]
+			}
+			if len(args) > 0 {
+				commands = append(commands, args)
+			}
+		}
+	}
+	return commands
+}
+
+// gnuInPlace reports whether sed args use -i without the suffix BSD sed requires
+func gnuInPlace(args []string) bool {
+	for i, arg := range args {
+		if arg == "-i" {
+			return i+1 >= len(args) || !isEmptySuffix(args[i+1])
+		}
+	}
+	return false
+}
+
+// bsdInPlace reports whether sed args pass BSD sed's empty -i suffix, which
+// GNU sed takes as the script
+func bsdInPlace(args []string) bool {
+	for i, arg := range args {
+		if arg == "-i" {
+			return i+1 < len(args) && isEmptySuffix(args[i+1])
+		}
+	}
+	return false
+}
+
+// isEmptySuffix reports whether arg is an empty quoted string
+func isEmptySuffix(arg string) bool {
+	return arg == "''" || arg == `""`
+}
+
+// setVariable tells how to set an environment variable in shell
+func setVariable(shell string) string {
+	switch shell {
+	case "cmd":
+		return "use `set NAME=value`"
+	case "csh", "tcsh":
+		return "use `setenv NAME value`"
+	case "nu":
+		return "use `$env.NAME = value`"
+	default:
+		return "use `$env:NAME = \"value\"`"
+	}
+}
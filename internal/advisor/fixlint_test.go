@@ -0,0 +1,109 @@
+package advisor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+func TestLintFix(t *testing.T) {
+	tests := []struct {
+		name string
+		fix  string
+		ctx  config.Context
+		want []string
+	}{
+		{
+			name: "apt-get on macOS",
+			fix:  "1. Install the client:\n   sudo apt-get install -y postgresql-client",
+			ctx:  config.Context{OS: "darwin", Shell: "zsh"},
+			want: []string{"`apt-get` is not available on macOS; use `brew install`"},
+		},
+		{
+			name: "code span in prose",
+			fix:  "Restart it with `systemctl restart nginx` and check `journalctl -u nginx`.",
+			ctx:  config.Context{OS: "darwin"},
+			want: []string{
+				"`systemctl` is not available on macOS; use `launchctl` or `brew services`",
+				"`journalctl` is not available on macOS; use `log show`",
+			},
+		},
+		{
+			name: "GNU sed on macOS",
+			fix:  "sed -i 's/5432/5433/' config.yaml && make restart",
+			ctx:  config.Context{OS: "darwin"},
+			want: []string{"`sed -i` needs a backup suffix with macOS sed; use `sed -i ''`"},
+		},
+		{
+			name: "BSD sed on macOS",
+			fix:  "sed -i '' 's/5432/5433/' config.yaml",
+			ctx:  config.Context{OS: "darwin"},
+		},
+		{
+			name: "BSD sed on Linux",
+			fix:  "$ sed -i '' 's/5432/5433/' config.yaml",
+			ctx:  config.Context{OS: "linux"},
+			want: []string{"`sed -i ''` is macOS syntax; GNU sed takes `sed -i` without the empty suffix"},
+		},
+		{
+			name: "GNU sed on Linux",
+			fix:  "sed -i 's/5432/5433/' config.yaml",
+			ctx:  config.Context{OS: "linux"},
+		},
+		{
+			name: "export in PowerShell",
+			fix:  "export DATABASE_URL=postgres://db:5432/app\nchmod 600 key.pem",
+			ctx:  config.Context{OS: "windows", Shell: "pwsh"},
+			want: []string{
+				"`export` doesn't set variables in pwsh; use `$env:NAME = \"value\"`",
+				"`chmod` is not available on Windows; use `icacls`",
+			},
+		},
+		{
+			name: "repeated command warns once",
+			fix:  "apt-get update && apt-get install -y curl",
+			ctx:  config.Context{OS: "darwin"},
+			want: []string{"`apt-get` is not available on macOS; use `brew install`"},
+		},
+		{
+			name: "unknown system",
+			fix:  "apt-get install -y curl",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lintFix(tt.fix, tt.ctx); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lintFix() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalysis_FixWarnings(t *testing.T) {
+	payload := config.QueryPayload{
+		SanitizedLog:  "ERROR psql: command not found",
+		SystemContext: config.Context{OS: "darwin", Shell: "zsh"},
+	}
+	response := `{"status": "problem_detected", "severity": "low", "root_cause": "psql is missing", "evidence": "ERROR psql: command not found", "fix": "sudo apt-get install postgresql-client"}`
+
+	analysis := newAnalysis(config.NewConfig(), payload, response)
+	if len(analysis.FixWarnings) != 1 {
+		t.Fatalf("FixWarnings = %q, want one warning", analysis.FixWarnings)
+	}
+
+	text, _ := analysis.Format(FormatText, renderOptions{})
+	if !strings.Contains(text, "`apt-get` is not available on macOS") {
+		t.Errorf("Text output should warn about the fix, got:\n%s", text)
+	}
+	markdown, _ := analysis.Format(FormatMarkdown, renderOptions{})
+	if !strings.Contains(markdown, "> `apt-get` is not available on macOS") {
+		t.Errorf("Markdown output should quote the warning, got:\n%s", markdown)
+	}
+	jsonOut, _ := analysis.Format(FormatJSON, renderOptions{})
+	if !strings.Contains(jsonOut, `"fix_warnings": [`) {
+		t.Errorf("JSON output should include fix_warnings, got:\n%s", jsonOut)
+	}
+}
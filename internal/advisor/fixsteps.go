@@ -0,0 +1,195 @@
+package advisor
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// minFixSteps is the number of commands from which a fix is shown as steps
+const minFixSteps = 2
+
+// commandWord matches the first word of a command, as opposed to prose
+var commandWord = regexp.MustCompile(`^[a-z][a-z0-9._/-]*$`)
+
+// parseFixSteps splits fix into ordered steps, one per command. Commands are
+// taken from code fences, "$ " prompts, code spans that look like commands
+// and bare command lines; the prose before a command describes its step.
+// Prose after the last command becomes a final step without a command.
+func parseFixSteps(fix string) []config.FixStep {
+	var steps []config.FixStep
+	var notes []string
+	addStep := func(description, command string) {
+		notes = append(notes, description)
+		steps = append(steps, config.FixStep{Description: joinNotes(notes), Command: command})
+		notes = nil
+	}
+
+	inFence := false
+	for _, line := range strings.Split(fix, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+			continue
+		}
+		if trimmed == "" {
+			continue
+		}
+		if inFence {
+			// Comments in a code block describe the command after them
+			if comment, ok := strings.CutPrefix(trimmed, "#"); ok {
+				notes = append(notes, strings.TrimSpace(comment))
+			} else {
+				addStep("", strings.TrimPrefix(trimmed, "$ "))
+			}
+			continue
+		}
+		text := trimmed
+		if !strings.HasPrefix(text, "$ ") {
+			text = listMarker.ReplaceAllString(text, "")
+		}
+		if command, ok := strings.CutPrefix(text, "$ "); ok {
+			addStep("", strings.TrimSpace(command))
+			continue
+		}
+		if commands := commandSpans(text); len(commands) > 0 {
+			description := text
+			for _, command := range commands {
+				description = strings.Replace(description, "`"+command+"`", "", 1)
+			}
+			addStep(description, commands[0])
+			for _, command := range commands[1:] {
+				addStep("", command)
+			}
+			continue
+		}
+		if looksLikeCommand(text) {
+			addStep("", text)
+			continue
+		}
+		notes = append(notes, text)
+	}
+
+	if description := joinNotes(notes); description != "" {
+		steps = append(steps, config.FixStep{Description: description})
+	}
+	return steps
+}
+
+// commandSpans returns the code spans in line that look like commands
+func commandSpans(line string) []string {
+	var commands []string
+	for _, span := range inlineCode.FindAllStringSubmatch(line, -1) {
+		if looksLikeCommand(span[1]) {
+			commands = append(commands, strings.TrimSpace(span[1]))
+		}
+	}
+	return commands
+}
+
+// looksLikeCommand reports whether text reads as a command line rather than
+// prose: a lowercase program name followed by arguments, not ending a sentence
+func looksLikeCommand(text string) bool {
+	fields := strings.Fields(text)
+	if len(fields) < 2 || !commandWord.MatchString(fields[0]) {
+		return false
+	}
+	return !strings.HasSuffix(text, ".") && !strings.HasSuffix(text, ":")
+}
+
+// joinNotes joins the prose describing a step into one line
+func joinNotes(notes []string) string {
+	var parts []string
+	for _, note := range notes {
+		note = strings.TrimSpace(strings.Join(strings.Fields(note), " "))
+		note = strings.TrimSpace(strings.TrimSuffix(note, ":"))
+		if note != "" {
+			parts = append(parts, note)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// fixSteps returns the steps of fix, or nil if it has fewer than minFixSteps
+// commands and reads better as written
+func fixSteps(fix string) []config.FixStep {
+	steps := parseFixSteps(fix)
+	commands := 0
+	for _, step := range steps {
+		if step.Command != "" {
+			commands++
+		}
+	}
+	if commands < minFixSteps {
+		return nil
+	}
+	return steps
+}
+
+// FixSteps returns the fix as numbered steps, or nil if it holds fewer than
+// two commands or there is no parsed fix (--no-schema)
+func (a *Analysis) FixSteps() []config.FixStep {
+	if a.NoSchema {
+		return nil
+	}
+	llmResp, err := parseResponse(a.Raw)
+	if err != nil {
+		return nil
+	}
+	return fixSteps(llmResp.Fix)
+}
+
+// formatStepsList renders steps as a plain numbered list, each command on its
+// own line under the step's description
+func formatStepsList(steps []config.FixStep) string {
+	var output strings.Builder
+	for i, step := range steps {
+		switch {
+		case step.Description == "":
+			fmt.Fprintf(&output, "  %d. $ %s\n", i+1, step.Command)
+		case step.Command == "":
+			fmt.Fprintf(&output, "  %d. %s\n", i+1, step.Description)
+		default:
+			fmt.Fprintf(&output, "  %d. %s\n     $ %s\n", i+1, step.Description, step.Command)
+		}
+	}
+	return output.String()
+}
+
+// formatStepsMarkdown renders steps as a numbered markdown list with each
+// command in its own code block, ready to copy
+func formatStepsMarkdown(steps []config.FixStep) string {
+	var output strings.Builder
+	for i, step := range steps {
+		if step.Description == "" {
+			fmt.Fprintf(&output, "%d. `%s`\n", i+1, step.Command)
+			continue
+		}
+		fmt.Fprintf(&output, "%d. %s\n", i+1, step.Description)
+		if step.Command != "" {
+			output.WriteString("\n   ```\n   " + step.Command + "\n   ```\n\n")
+		}
+	}
+	return output.String()
+}
+
+// copyWithTerminal asks the terminal on w to put text on the clipboard with
+// the OSC 52 escape sequence, which also works over SSH and inside tmux
+func copyWithTerminal(w io.Writer, text string) error {
+	_, err := fmt.Fprintf(w, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	return err
+}
+
+// shellArgs runs command in the platform's shell, since fix steps often use
+// pipes, redirections and variables
+func shellArgs(command string) []string {
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C", command}
+	}
+	return []string{"sh", "-c", command}
+}
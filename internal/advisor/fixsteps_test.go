@@ -0,0 +1,145 @@
+package advisor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/platform"
+)
+
+func TestParseFixSteps(t *testing.T) {
+	tests := []struct {
+		name string
+		fix  string
+		want []config.FixStep
+	}{
+		{
+			name: "numbered prose with code spans",
+			fix:  "1. Raise the connection limit: `psql -c 'ALTER SYSTEM SET max_connections = 200'`\n2. Restart the database with `systemctl restart postgresql`\n3. Watch the pool recover.",
+			want: []config.FixStep{
+				{Description: "Raise the connection limit", Command: "psql -c 'ALTER SYSTEM SET max_connections = 200'"},
+				{Description: "Restart the database with", Command: "systemctl restart postgresql"},
+				{Description: "Watch the pool recover."},
+			},
+		},
+		{
+			name: "code fence with comments",
+			fix:  "Free up space:\n```\n# Remove old journal files\njournalctl --vacuum-size=500M\ndocker system prune -f\n```",
+			want: []config.FixStep{
+				{Description: "Free up space Remove old journal files", Command: "journalctl --vacuum-size=500M"},
+				{Command: "docker system prune -f"},
+			},
+		},
+		{
+			name: "prompts and bare commands",
+			fix:  "$ kubectl rollout undo deploy/payments\nkubectl rollout status deploy/payments",
+			want: []config.FixStep{
+				{Command: "kubectl rollout undo deploy/payments"},
+				{Command: "kubectl rollout status deploy/payments"},
+			},
+		},
+		{
+			name: "prose only",
+			fix:  "Rotate the API key in the vault. Set `port: 5433` in config.yaml.",
+			want: []config.FixStep{
+				{Description: "Rotate the API key in the vault. Set `port: 5433` in config.yaml."},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseFixSteps(tt.fix); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseFixSteps() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFixSteps_SingleCommand(t *testing.T) {
+	if steps := fixSteps("Restart it: `systemctl restart nginx`"); steps != nil {
+		t.Errorf("fixSteps() = %+v, want nil for a single command", steps)
+	}
+}
+
+func TestAnalysis_FixSteps(t *testing.T) {
+	response := `{"status": "problem_detected", "severity": "high", "root_cause": "Disk full", "evidence": "no space left on device", "fix": "1. Clean the journal: ` + "`journalctl --vacuum-size=500M`" + `\n2. Prune images: ` + "`docker image prune -a`" + `"}`
+	analysis := newAnalysis(config.NewConfig(), config.QueryPayload{}, response)
+
+	text, _ := analysis.Format(FormatText, renderOptions{})
+	if !strings.Contains(text, "  1. Clean the journal\n     $ journalctl --vacuum-size=500M\n  2. Prune images\n     $ docker image prune -a\n") {
+		t.Errorf("Text output should number the steps, got:\n%s", text)
+	}
+	markdown, _ := analysis.Format(FormatMarkdown, renderOptions{})
+	if !strings.Contains(markdown, "1. Clean the journal\n\n   ```\n   journalctl --vacuum-size=500M\n   ```\n") {
+		t.Errorf("Markdown output should give each command its own block, got:\n%s", markdown)
+	}
+	jsonOut, _ := analysis.Format(FormatJSON, renderOptions{})
+	if !strings.Contains(jsonOut, `"fix_steps": [`) {
+		t.Errorf("JSON output should include fix_steps, got:\n%s", jsonOut)
+	}
+}
+
+func TestChatState_Steps(t *testing.T) {
+	var clipboard bytes.Buffer
+	var ran []string
+	chat := &chatState{
+		steps: []config.FixStep{
+			{Description: "Clean the journal", Command: "journalctl --vacuum-size=500M"},
+			{Description: "Check the disk again by hand"},
+		},
+		copyText:  func(text string) error { return platform.ErrNoClipboard },
+		clipboard: &clipboard,
+		runner:    newTestInvestigator(&scriptedClient{}, nil, &ran),
+	}
+
+	if list, err := chat.handleCommand("/steps"); err != nil || !strings.Contains(list, "1. Clean the journal") {
+		t.Errorf("/steps = %q, %v, want the step list", list, err)
+	}
+
+	if _, err := chat.handleCommand("/copy 1"); err != nil {
+		t.Fatalf("/copy 1 error = %v", err)
+	}
+	want := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte("journalctl --vacuum-size=500M")) + "\a"
+	if clipboard.String() != want {
+		t.Errorf("/copy 1 wrote %q, want %q", clipboard.String(), want)
+	}
+
+	var copied []string
+	chat.copyText = func(text string) error {
+		copied = append(copied, text)
+		return nil
+	}
+	clipboard.Reset()
+	if _, err := chat.handleCommand("/copy 1"); err != nil {
+		t.Fatalf("/copy 1 error = %v", err)
+	}
+	if len(copied) != 1 || clipboard.Len() != 0 {
+		t.Errorf("/copy 1 copied %q and wrote %q to the terminal, want only the system clipboard", copied, clipboard.String())
+	}
+
+	for _, input := range []string{"/copy", "/copy 3", "/copy 2", "/copy x"} {
+		if _, err := chat.handleCommand(input); err == nil {
+			t.Errorf("%s error = nil, want error", input)
+		}
+	}
+
+	n, step, err := chat.pickStep([]string{"/apply", "1"})
+	if err != nil {
+		t.Fatalf("pickStep() error = %v", err)
+	}
+	output, question, err := chat.applyStep(n, step)
+	if err != nil {
+		t.Fatalf("applyStep() error = %v", err)
+	}
+	if len(ran) != 1 || !strings.HasSuffix(ran[0], "journalctl --vacuum-size=500M") {
+		t.Errorf("ran %q, want the step's command in a shell", ran)
+	}
+	if strings.Contains(output, "hunter2") || !strings.Contains(question, "I applied step 1") {
+		t.Errorf("applyStep() = %q, %q, want redacted output sent to the model", output, question)
+	}
+}
@@ -0,0 +1,234 @@
+package advisor
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/pkg/llm"
+)
+
+// Output formats supported by --output
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+	FormatJSON     = "json"
+	// FormatProblemMatcher prints "file:line: severity: message" lines for editor problem matchers
+	FormatProblemMatcher = "problemmatcher"
+	// FormatPostmortem is a markdown postmortem skeleton, written to a file
+	FormatPostmortem = "postmortem"
+)
+
+const (
+	noProblemsMessage       = "Your log looks good, no problems detected!"
+	insufficientDataMessage = "Problem detected but insufficient data for a clear solution. Please provide more context or logs."
+	missingDataMessage      = "Problem detected but insufficient data for a clear solution. To continue, please provide:"
+)
+
+// missingItems returns the non-empty requests from a response's missing field
+func missingItems(missing []string) []string {
+	var items []string
+	for _, item := range missing {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// formatResponse parses the raw LLM response and renders it in the given format.
+// Parse failures are rendered rather than returned so the user still sees the raw answer.
+func formatResponse(rawResponse string, evidenceLines []int, format string, opts renderOptions) (string, error) {
+	llmResp, err := parseResponse(rawResponse)
+	if err != nil {
+		return formatParseError(err, rawResponse, format)
+	}
+
+	llmResp.EvidenceLines = evidenceLines
+	return renderResponse(llmResp, format, opts)
+}
+
+// formatParseError renders a response that couldn't be parsed, with the raw answer
+func formatParseError(err error, rawResponse string, format string) (string, error) {
+	if format == FormatJSON {
+		return formatJSONError(err, rawResponse)
+	}
+	return fmt.Sprintf("Error parsing LLM response: %v\n\nRaw response:\n%s", err, rawResponse), nil
+}
+
+// renderResponse renders a parsed response in the given format
+func renderResponse(llmResp config.LLMResponse, format string, opts renderOptions) (string, error) {
+	switch format {
+	case FormatJSON:
+		llmResp.FixSteps = fixSteps(llmResp.Fix)
+		llmResp.DestructiveCommands = destructiveCommands(llmResp.Fix)
+		return formatJSON(llmResp)
+	case FormatProblemMatcher:
+		return formatProblemMatcher(llmResp), nil
+	case FormatPostmortem:
+		return formatPostmortem(llmResp, opts), nil
+	case FormatMarkdown:
+		if comparison := formatComparison(llmResp, renderOptions{ScreenReader: true}); comparison != "" {
+			return "**" + strings.TrimSuffix(comparison, "\n") + "**\n\n" + formatMarkdown(llmResp, opts), nil
+		}
+		return formatMarkdown(llmResp, opts), nil
+	default:
+		return formatComparison(llmResp, opts) + formatText(llmResp, opts), nil
+	}
+}
+
+// formatJSON renders the parsed response as indented JSON
+func formatJSON(llmResp config.LLMResponse) (string, error) {
+	llmResp.Status = classifyResponse(llmResp)
+	llmResp.Category = normalizeCategory(llmResp.Category)
+	data, err := json.MarshalIndent(llmResp, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JSON output: %w", err)
+	}
+	return string(data) + "\n", nil
+}
+
+// formatJSONError renders a parse failure as JSON so consumers always get valid JSON
+func formatJSONError(parseErr error, rawResponse string) (string, error) {
+	data, err := json.MarshalIndent(map[string]string{
+		"error":        parseErr.Error(),
+		"raw_response": rawResponse,
+	}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JSON output: %w", err)
+	}
+	return string(data) + "\n", nil
+}
+
+// formatMarkdown renders the parsed response as a markdown document
+func formatMarkdown(llmResp config.LLMResponse, opts renderOptions) string {
+	var output strings.Builder
+	status := classifyResponse(llmResp)
+
+	if status == "no_problem" {
+		return noProblemsMessage + "\n"
+	}
+
+	if status == "problem_detected" {
+		if severity := formatSeverity(llmResp.Severity, renderOptions{ScreenReader: true}); severity != "" {
+			output.WriteString("**")
+			output.WriteString(severity)
+			output.WriteString("**\n\n")
+		}
+		if category := normalizeCategory(llmResp.Category); category != "" {
+			output.WriteString("Category: `" + category + "`\n\n")
+		}
+	}
+
+	if rootCause := strings.TrimSpace(llmResp.RootCause); rootCause != "" && status == "problem_detected" {
+		output.WriteString("## Root Cause\n\n")
+		output.WriteString(rootCause)
+		output.WriteString("\n\n")
+	}
+
+	if evidence := strings.TrimSpace(string(llmResp.Evidence)); evidence != "" {
+		output.WriteString("## " + evidenceTitle(llmResp) + "\n\n```\n")
+		output.WriteString(evidence)
+		output.WriteString("\n```\n\n")
+	}
+
+	output.WriteString(formatTimelineMarkdown(llmResp.Timeline, opts))
+
+	if status == "insufficient_data" {
+		output.WriteString(formatDiagnosticsMarkdown(llmResp.Diagnostics))
+		items := missingItems(llmResp.Missing)
+		output.WriteString("> ")
+		if len(items) == 0 {
+			output.WriteString(withEmoji("⚠️ ", insufficientDataMessage, opts.Emoji))
+			output.WriteString("\n")
+			return output.String()
+		}
+		output.WriteString(withEmoji("⚠️ ", missingDataMessage, opts.Emoji))
+		output.WriteString("\n>\n")
+		for _, item := range items {
+			output.WriteString("> - " + item + "\n")
+		}
+		return output.String()
+	}
+
+	output.WriteString(formatDestructiveMarkdown(destructiveCommands(llmResp.Fix), opts))
+	if steps := fixSteps(llmResp.Fix); steps != nil {
+		output.WriteString("## Fix\n\n")
+		output.WriteString(formatStepsMarkdown(steps))
+	} else if fix := strings.TrimSpace(llmResp.Fix); fix != "" {
+		output.WriteString("## Fix\n\n```\n")
+		output.WriteString(fix)
+		output.WriteString("\n```\n")
+	}
+	if len(llmResp.FixWarnings) > 0 {
+		output.WriteString("\n")
+		for _, warning := range llmResp.FixWarnings {
+			output.WriteString("> " + withEmoji("⚠️ ", warning, opts.Emoji) + "\n")
+		}
+	}
+
+	return output.String()
+}
+
+// dryRunReport is the machine-readable description of what a run would send
+type dryRunReport struct {
+	Provider              string            `json:"provider"`
+	Model                 string            `json:"model"`
+	PromptVersion         string            `json:"prompt_version"`
+	SystemPrompt          string            `json:"system_prompt"`
+	UserPrompt            string            `json:"user_prompt"`
+	SanitizedLog          string            `json:"sanitized_log"`
+	EstimatedInputTokens  int               `json:"estimated_input_tokens"`
+	EstimatedInputCostUSD *float64          `json:"estimated_input_cost_usd,omitempty"`
+	PlaceholderTemplate   string            `json:"placeholder_template"` // {type}, {rule} and {n} tokens, see Placeholder
+	Redactions            []dryRunRedaction `json:"redactions"`
+}
+
+// dryRunRedaction describes one redacted secret without revealing its value
+type dryRunRedaction struct {
+	RuleID      string `json:"rule_id"`
+	Description string `json:"description"`
+	Placeholder string `json:"placeholder"`    // What the secret reads as in the sanitized log
+	File        string `json:"file,omitempty"` // Redacted like the log
+	StartLine   int    `json:"start_line"`
+	EndLine     int    `json:"end_line"`
+}
+
+// formatDryRunJSON renders the exact prompt and redaction findings as JSON
+func formatDryRunJSON(cfg *config.Config, payload config.QueryPayload) (string, error) {
+	systemPrompt, userPrompt := llm.BuildPrompts(cfg, payload)
+	model := llm.ResolveModel(cfg.Provider, cfg.Model)
+
+	report := dryRunReport{
+		Provider:             cfg.Provider,
+		Model:                model,
+		PromptVersion:        cfg.PromptVersion,
+		SystemPrompt:         systemPrompt,
+		UserPrompt:           userPrompt,
+		SanitizedLog:         payload.SanitizedLog,
+		EstimatedInputTokens: llm.CountTokens(model, systemPrompt) + llm.CountTokens(model, userPrompt),
+		PlaceholderTemplate:  cmp.Or(cfg.RedactionTemplate, config.DefaultRedactionTemplate),
+		Redactions:           []dryRunRedaction{},
+	}
+	if cost, ok := llm.EstimateCost(model, report.EstimatedInputTokens, 0); ok {
+		report.EstimatedInputCostUSD = &cost
+	}
+	for _, finding := range payload.Findings {
+		report.Redactions = append(report.Redactions, dryRunRedaction{
+			RuleID:      finding.RuleID,
+			Description: finding.Description,
+			Placeholder: finding.Placeholder,
+			File:        finding.File,
+			StartLine:   finding.StartLine,
+			EndLine:     finding.EndLine,
+		})
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode dry-run report: %w", err)
+	}
+	return string(data) + "\n", nil
+}
@@ -0,0 +1,277 @@
+package advisor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/policy"
+	"github.com/jenian/que/internal/proc"
+	"github.com/jenian/que/internal/textutil"
+	"github.com/jenian/que/pkg/llm"
+)
+
+// DefaultInvestigateRounds is the number of command rounds --investigate allows by default
+const DefaultInvestigateRounds = 3
+
+const (
+	// commandTimeout bounds how long a single approved command may run
+	commandTimeout = 30 * time.Second
+	// maxCommandOutput caps the output of one command sent back to the model
+	maxCommandOutput = 8 * 1024
+)
+
+// ProposedCommand is a read-only command the model asked to run
+type ProposedCommand struct {
+	Command string `json:"command"`
+	Reason  string `json:"reason"`
+}
+
+// investigationStep is the model's answer to the investigate prompt
+type investigationStep struct {
+	Done     bool              `json:"done"`
+	Commands []ProposedCommand `json:"commands"`
+}
+
+// investigator runs the approval-gated investigation loop. approve, run and
+// audit are fields so tests can replace the terminal, the host and the log.
+type investigator struct {
+	client   llm.Client
+	cfg      *config.Config
+	redactor config.Redactor
+	policy   *policy.Policy
+	approve  func(cmd ProposedCommand) bool
+	run      func(ctx context.Context, args []string) (string, error)
+	audit    func(entry policy.AuditEntry) error
+	out      io.Writer
+}
+
+// NewCommandPolicy builds the command policy configured in cfg
+func NewCommandPolicy(cfg *config.Config) (*policy.Policy, error) {
+	return policy.New(cfg.Commands.Allow, cfg.Commands.Deny)
+}
+
+// Investigate lets the model request read-only commands to confirm its initial
+// analysis. Commands outside the command policy are refused outright; the rest
+// are shown to the user and only run after explicit approval. Every decision is
+// audited, and outputs are redacted before being sent back. Diagnostics
+// suggested in the initial analysis make up the first round. After at most
+// cfg.InvestigateRounds rounds the model gives its final diagnosis.
+func Investigate(ctx context.Context, client llm.Client, cfg *config.Config, payload config.QueryPayload, initial *Analysis, redactor config.Redactor) (*Analysis, error) {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return nil, fmt.Errorf("--investigate needs a terminal to approve commands: %w", err)
+	}
+	defer tty.Close()
+
+	inv, err := newInvestigator(client, cfg, redactor, promptApproval(bufio.NewScanner(tty), os.Stderr))
+	if err != nil {
+		return nil, err
+	}
+	return inv.investigate(ctx, payload, initial)
+}
+
+// newInvestigator builds an investigator that checks commands against the
+// configured policy, asks approve before running them on this host and
+// audits every decision
+func newInvestigator(client llm.Client, cfg *config.Config, redactor config.Redactor, approve func(cmd ProposedCommand) bool) (*investigator, error) {
+	commandPolicy, err := NewCommandPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Paranoid mode keeps nothing on disk, not even the audit trail
+	audit := func(policy.AuditEntry) error { return nil }
+	if !cfg.Paranoid {
+		auditPath := cfg.Commands.AuditLog
+		if auditPath == "" {
+			auditPath = policy.DefaultAuditPath(config.DefaultStateDir())
+		}
+		if auditPath == "" {
+			return nil, fmt.Errorf("could not determine audit log location; set commands.audit_log")
+		}
+		audit = policy.NewAuditLog(auditPath).Record
+	}
+
+	return &investigator{
+		client:   client,
+		cfg:      cfg,
+		redactor: redactor,
+		policy:   commandPolicy,
+		approve:  approve,
+		run:      runCommand,
+		audit:    audit,
+		out:      os.Stderr,
+	}, nil
+}
+
+func (inv *investigator) investigate(ctx context.Context, payload config.QueryPayload, initial *Analysis) (*Analysis, error) {
+	tmpl, err := llm.GetPromptTemplate(inv.cfg.PromptVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	history := []string{InitialUserMessage(payload), initial.Raw}
+	question := tmpl.Investigate
+	ranCommands := false
+	var usages []*config.Usage // Of the rounds, for the final metadata
+
+	rounds := inv.cfg.InvestigateRounds
+	if rounds <= 0 {
+		rounds = DefaultInvestigateRounds
+	}
+
+	headerColor := color.New(color.FgCyan, color.Bold)
+
+	// The commands the analysis already suggested need no extra round trip
+	suggested := initial.Diagnostics()
+
+	for round := 1; round <= rounds; round++ {
+		var step investigationStep
+		if round == 1 && len(suggested) > 0 {
+			step.Commands = suggested
+		} else {
+			stopSpinner := startSpinner(inv.cfg, " Investigating...")
+			response, usage, err := llm.QueryWithHistory(ctx, inv.client, inv.cfg, history, question)
+			stopSpinner()
+			reportUsage(inv.cfg, usage)
+			usages = append(usages, usage)
+			if err != nil {
+				return nil, err
+			}
+			history = append(history, question, response)
+
+			if err := json.Unmarshal([]byte(extractJSON(response)), &step); err != nil {
+				return nil, fmt.Errorf("failed to parse investigation step: %w", err)
+			}
+		}
+		if step.Done || len(step.Commands) == 0 {
+			break
+		}
+
+		headerColor.Fprintf(inv.out, "\nInvestigation round %d/%d\n", round, rounds)
+
+		var results []string
+		for _, cmd := range step.Commands {
+			result, ran, err := inv.handle(cmd)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, fmt.Sprintf("$ %s\n%s", cmd.Command, result))
+			ranCommands = ranCommands || ran
+		}
+
+		question = "Command results:\n\n" + strings.Join(results, "\n\n") + "\n\n" + tmpl.Investigate
+	}
+
+	// Nothing new was learned, so the initial analysis stands
+	if !ranCommands {
+		return initial, nil
+	}
+
+	final := "Based on everything above, give your final diagnosis."
+	if !inv.cfg.NoSchema {
+		final += strings.Join(tmpl.Instructions, "\n")
+	}
+
+	stopSpinner := startSpinner(inv.cfg, " Analyzing...")
+	start := time.Now()
+	response, usage, err := llm.QueryWithHistory(ctx, inv.client, inv.cfg, history, final)
+	elapsed := time.Since(start)
+	stopSpinner()
+	reportUsage(inv.cfg, usage)
+	if err != nil {
+		return nil, err
+	}
+	analysis := newAnalysis(inv.cfg, payload, response)
+	// The investigation's rounds are billed along with the final diagnosis
+	model := llm.ResolveModel(inv.cfg.Provider, inv.cfg.Model)
+	analysis.Metadata = runMetadata(inv.cfg, payload, response, elapsed, llm.AddUsage(model, append(usages, usage)...))
+	return analysis, nil
+}
+
+// handle passes a proposed command through the policy and approval gates,
+// runs it if both allow it, and audits the decision. It returns the result
+// to report to the model and whether the command ran. Audit failures abort
+// the investigation: no command runs unless it can be recorded.
+func (inv *investigator) handle(cmd ProposedCommand) (string, bool, error) {
+	entry := policy.AuditEntry{Command: cmd.Command, Reason: cmd.Reason}
+	args := strings.Fields(cmd.Command)
+
+	if allowed, why := inv.policy.Check(args); !allowed {
+		entry.Decision = policy.DecisionBlocked
+		entry.Detail = why
+		fmt.Fprintf(inv.out, "\nBlocked by command policy (%s):\n  $ %s\n", why, cmd.Command)
+		return "(not run: blocked by policy, " + why + ")", false, inv.record(entry)
+	}
+
+	if !inv.approve(cmd) {
+		entry.Decision = policy.DecisionDeclined
+		return "(not run: declined by the user)", false, inv.record(entry)
+	}
+
+	// Record the intent before running, so a crash mid-command is still audited
+	entry.Decision = policy.DecisionRan
+	if err := inv.record(entry); err != nil {
+		return "", false, err
+	}
+	return inv.execute(args), true, nil
+}
+
+// record writes entry to the audit log
+func (inv *investigator) record(entry policy.AuditEntry) error {
+	if err := inv.audit(entry); err != nil {
+		return fmt.Errorf("refusing to continue without an audit trail: %w", err)
+	}
+	return nil
+}
+
+// execute runs an approved command and returns its redacted, size-capped output
+func (inv *investigator) execute(args []string) string {
+	output, err := inv.run(context.Background(), args)
+	if err != nil {
+		output = strings.TrimSpace(output + "\n(error: " + err.Error() + ")")
+	}
+	output = textutil.Truncate(output, maxCommandOutput)
+
+	redacted, count := inv.redactor.Redact(output)
+	if count > 0 && !inv.cfg.Verbose {
+		fmt.Fprintf(inv.out, "Redacted %d potential secrets in output of %s\n", count, args[0])
+	}
+	return redacted
+}
+
+// runCommand executes args without a shell and without que's credentials in
+// its environment, and returns combined stdout and stderr
+func runCommand(ctx context.Context, args []string) (string, error) {
+	return proc.Output(ctx, proc.Limits{Timeout: commandTimeout, MaxOutput: maxCommandOutput}, args...)
+}
+
+// promptApproval returns an approval gate that asks on w and reads the answer
+// from scanner. Anything other than an explicit yes declines the command.
+func promptApproval(scanner *bufio.Scanner, w io.Writer) func(cmd ProposedCommand) bool {
+	return func(cmd ProposedCommand) bool {
+		fmt.Fprintf(w, "\nThe model wants to run:\n  $ %s\n", cmd.Command)
+		if cmd.Reason != "" {
+			fmt.Fprintf(w, "  Reason: %s\n", cmd.Reason)
+		}
+		fmt.Fprint(w, "Run this command? [y/N] ")
+		return readYes(scanner)
+	}
+}
+
+// readYes reads an answer from scanner and reports whether it is an explicit yes
+func readYes(scanner *bufio.Scanner) bool {
+	if !scanner.Scan() {
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	return answer == "y" || answer == "yes"
+}
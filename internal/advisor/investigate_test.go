@@ -0,0 +1,166 @@
+package advisor
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/policy"
+)
+
+// scriptedClient answers QueryWithHistory with canned responses in order
+type scriptedClient struct {
+	responses []string
+	questions []string
+}
+
+func (c *scriptedClient) QueryWithPayload(ctx context.Context, cfg *config.Config, payload config.QueryPayload) (string, error) {
+	return "", nil
+}
+
+func (c *scriptedClient) QueryWithHistory(ctx context.Context, cfg *config.Config, history []string, question string) (string, error) {
+	c.questions = append(c.questions, question)
+	response := c.responses[0]
+	c.responses = c.responses[1:]
+	return response, nil
+}
+
+// stubRedactor replaces a fixed secret
+type stubRedactor struct{}
+
+func (stubRedactor) Redact(input string) (string, int) {
+	return strings.ReplaceAll(input, "hunter2", "<REDACTED>"), strings.Count(input, "hunter2")
+}
+
+func (stubRedactor) RedactWithDetails(input string, verbose bool) (string, int, []config.FindingDetail) {
+	redacted, count := stubRedactor{}.Redact(input)
+	return redacted, count, nil
+}
+
+func newTestInvestigator(client *scriptedClient, approved map[string]bool, ran *[]string) *investigator {
+	commandPolicy, _ := policy.New(nil, nil)
+	return &investigator{
+		client:   client,
+		cfg:      &config.Config{InvestigateRounds: 2, UI: config.UIConfig{Spinner: "none"}},
+		redactor: stubRedactor{},
+		policy:   commandPolicy,
+		audit:    func(entry policy.AuditEntry) error { return nil },
+		approve:  func(cmd ProposedCommand) bool { return approved[cmd.Command] },
+		run: func(ctx context.Context, args []string) (string, error) {
+			*ran = append(*ran, strings.Join(args, " "))
+			return "Status: CrashLoopBackOff password=hunter2", nil
+		},
+		out: io.Discard,
+	}
+}
+
+func TestInvestigate_ApprovedCommands(t *testing.T) {
+	client := &scriptedClient{responses: []string{
+		`{"done": false, "commands": [{"command": "kubectl describe pod web-1", "reason": "events"}, {"command": "kubectl get events"}]}`,
+		`{"done": true, "commands": []}`,
+		mockLLMResponse("problem_detected", "OOMKilled", "CrashLoopBackOff", "raise memory limit"),
+	}}
+	var ran []string
+	inv := newTestInvestigator(client, map[string]bool{"kubectl describe pod web-1": true}, &ran)
+
+	initial := &Analysis{Raw: mockLLMResponse("insufficient_data", "Pod crashing", "ERROR", "")}
+	final, err := inv.investigate(context.Background(), config.QueryPayload{SanitizedLog: "ERROR"}, initial)
+	if err != nil {
+		t.Fatalf("investigate() error = %v", err)
+	}
+
+	if len(ran) != 1 || ran[0] != "kubectl describe pod web-1" {
+		t.Errorf("Only the approved command should run, ran %q", ran)
+	}
+	results := client.questions[1]
+	if strings.Contains(results, "hunter2") {
+		t.Error("Command output must be redacted before it is sent to the model")
+	}
+	if !strings.Contains(results, "declined by the user") {
+		t.Error("Declined commands should be reported to the model")
+	}
+	if !strings.Contains(final.Raw, "OOMKilled") {
+		t.Errorf("Expected the final diagnosis, got %q", final.Raw)
+	}
+}
+
+func TestInvestigate_NothingRunKeepsInitialAnalysis(t *testing.T) {
+	client := &scriptedClient{responses: []string{`{"done": true, "commands": []}`}}
+	var ran []string
+	inv := newTestInvestigator(client, nil, &ran)
+
+	initial := &Analysis{Raw: mockLLMResponse("problem_detected", "Disk full", "ENOSPC", "df -h")}
+	final, err := inv.investigate(context.Background(), config.QueryPayload{}, initial)
+	if err != nil {
+		t.Fatalf("investigate() error = %v", err)
+	}
+	if final != initial {
+		t.Error("The initial analysis should stand when no commands ran")
+	}
+}
+
+func TestInvestigate_PolicyBlocksBeforeApproval(t *testing.T) {
+	client := &scriptedClient{responses: []string{
+		`{"done": false, "commands": [{"command": "kubectl delete pod web-1"}, {"command": "kubectl get pods"}]}`,
+		`{"done": true, "commands": []}`,
+		mockLLMResponse("problem_detected", "OOMKilled", "CrashLoopBackOff", "raise memory limit"),
+	}}
+	var ran []string
+	// Approve everything: the policy alone must stop the destructive command
+	inv := newTestInvestigator(client, map[string]bool{"kubectl delete pod web-1": true, "kubectl get pods": true}, &ran)
+
+	var audited []policy.AuditEntry
+	inv.audit = func(entry policy.AuditEntry) error {
+		audited = append(audited, entry)
+		return nil
+	}
+
+	if _, err := inv.investigate(context.Background(), config.QueryPayload{}, &Analysis{Raw: mockLLMResponse("insufficient_data", "", "ERROR", "")}); err != nil {
+		t.Fatalf("investigate() error = %v", err)
+	}
+
+	if len(ran) != 1 || ran[0] != "kubectl get pods" {
+		t.Errorf("Only the allowed command should run, ran %q", ran)
+	}
+	if len(audited) != 2 || audited[0].Decision != policy.DecisionBlocked || audited[1].Decision != policy.DecisionRan {
+		t.Errorf("Unexpected audit trail: %+v", audited)
+	}
+	if !strings.Contains(client.questions[1], "blocked by policy") {
+		t.Error("Blocked commands should be reported to the model")
+	}
+}
+
+func TestInvestigate_AuditFailureStopsCommands(t *testing.T) {
+	client := &scriptedClient{responses: []string{
+		`{"done": false, "commands": [{"command": "kubectl get pods"}]}`,
+	}}
+	var ran []string
+	inv := newTestInvestigator(client, map[string]bool{"kubectl get pods": true}, &ran)
+	inv.audit = func(entry policy.AuditEntry) error { return io.ErrShortWrite }
+
+	if _, err := inv.investigate(context.Background(), config.QueryPayload{}, &Analysis{Raw: "{}"}); err == nil {
+		t.Error("investigate() should fail when the audit log can't be written")
+	}
+	if len(ran) != 0 {
+		t.Errorf("No command should run without an audit trail, ran %q", ran)
+	}
+}
+
+func TestNewInvestigator_ParanoidSkipsAuditLog(t *testing.T) {
+	stateDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", stateDir)
+
+	inv, err := newInvestigator(&scriptedClient{}, &config.Config{Paranoid: true}, stubRedactor{}, nil)
+	if err != nil {
+		t.Fatalf("newInvestigator() error = %v", err)
+	}
+	if err := inv.record(policy.AuditEntry{Command: "kubectl get pods", Decision: policy.DecisionRan}); err != nil {
+		t.Fatalf("record() error = %v", err)
+	}
+	if entries, _ := os.ReadDir(stateDir); len(entries) != 0 {
+		t.Errorf("paranoid mode wrote to the state directory: %v", entries)
+	}
+}
@@ -0,0 +1,114 @@
+package advisor
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/pkg/llm"
+)
+
+func TestAnalyze_JSONMetadata(t *testing.T) {
+	client := &payloadClient{response: `{"status": "problem_detected", "severity": "high", "root_cause": "OOM", "evidence": "killed", "fix": "raise limit"}`}
+	cfg := &config.Config{Provider: "claude", Model: "claude-3-5-haiku-20241022", UI: config.UIConfig{Quiet: true}}
+	payload := config.QueryPayload{
+		SanitizedLog: "worker killed <REDACTED_API_KEY>",
+		Findings:     []config.FindingDetail{{RuleID: "generic-api-key"}},
+		Truncated:    true,
+	}
+
+	analysis, err := Analyze(context.Background(), client, cfg, payload)
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+	output, err := analysis.Format(FormatJSON, renderOptions{})
+	if err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+
+	var resp config.LLMResponse
+	if err := json.Unmarshal([]byte(output), &resp); err != nil {
+		t.Fatalf("JSON output doesn't parse: %v\n%s", err, output)
+	}
+	meta := resp.Metadata
+	if meta == nil {
+		t.Fatalf("JSON output has no metadata:\n%s", output)
+	}
+	if meta.QueVersion != Version || meta.Provider != "claude" || meta.Model != "claude-3-5-haiku-20241022" {
+		t.Errorf("metadata = %+v, want que %s, claude and the selected model", meta, Version)
+	}
+	if want := llm.PromptDialect(cfg); meta.PromptVersion == "" || meta.PromptDialect != want {
+		t.Errorf("prompt version %q dialect %q, want the current version and %s", meta.PromptVersion, meta.PromptDialect, want)
+	}
+	if meta.EstimatedInputTokens == 0 || meta.EstimatedOutputTokens == 0 {
+		t.Errorf("token estimates = %d in, %d out, want both set", meta.EstimatedInputTokens, meta.EstimatedOutputTokens)
+	}
+	if meta.Redactions != 1 || !meta.Truncated || meta.Summarized {
+		t.Errorf("redactions %d truncated %v summarized %v, want 1, true, false", meta.Redactions, meta.Truncated, meta.Summarized)
+	}
+	if meta.Usage != nil {
+		t.Errorf("usage = %+v, want none from a client that doesn't report it", meta.Usage)
+	}
+}
+
+// usageClient is a payloadClient that reports usage
+type usageClient struct {
+	payloadClient
+	usage *config.Usage
+}
+
+func (c *usageClient) QueryWithPayloadUsage(ctx context.Context, cfg *config.Config, payload config.QueryPayload) (string, *config.Usage, error) {
+	response, err := c.QueryWithPayload(ctx, cfg, payload)
+	return response, c.usage, err
+}
+
+func (c *usageClient) QueryWithHistoryUsage(ctx context.Context, cfg *config.Config, history []string, question string) (string, *config.Usage, error) {
+	response, err := c.QueryWithHistory(ctx, cfg, history, question)
+	return response, c.usage, err
+}
+
+func TestAnalyze_JSONUsage(t *testing.T) {
+	cost := 0.0125
+	client := &usageClient{
+		payloadClient: payloadClient{response: `{"status": "no_problem", "root_cause": "", "evidence": "", "fix": ""}`},
+		usage:         &config.Usage{PromptTokens: 4200, CompletionTokens: 150, CostUSD: &cost},
+	}
+	cfg := &config.Config{Provider: "openai", Model: "gpt-4o", UI: config.UIConfig{Quiet: true}}
+
+	analysis, err := Analyze(context.Background(), client, cfg, config.QueryPayload{SanitizedLog: "all good"})
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+	output, err := analysis.Format(FormatJSON, renderOptions{})
+	if err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+
+	var resp struct {
+		Metadata struct {
+			Usage map[string]any `json:"usage"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal([]byte(output), &resp); err != nil {
+		t.Fatalf("JSON output doesn't parse: %v\n%s", err, output)
+	}
+	usage := resp.Metadata.Usage
+	if usage["prompt_tokens"] != 4200.0 || usage["completion_tokens"] != 150.0 || usage["estimated_cost_usd"] != cost {
+		t.Errorf("usage = %v, want the tokens and cost the provider reported", usage)
+	}
+}
+
+func TestFormatUsage(t *testing.T) {
+	cost := 0.00421
+	if got, want := FormatUsage(&config.Usage{PromptTokens: 1234, CompletionTokens: 56, CostUSD: &cost}), "Tokens: 1234 prompt + 56 completion (~$0.0042)"; got != want {
+		t.Errorf("FormatUsage() = %q, want %q", got, want)
+	}
+	// Models without a list price have no cost
+	if got, want := FormatUsage(&config.Usage{PromptTokens: 10, CompletionTokens: 5}), "Tokens: 10 prompt + 5 completion"; got != want {
+		t.Errorf("FormatUsage() = %q, want %q", got, want)
+	}
+	if got, want := FormatUsage(&config.Usage{PromptTokens: 9000, CompletionTokens: 50, CacheReadTokens: 8500}), "Tokens: 9000 prompt (8500 cached) + 50 completion"; got != want {
+		t.Errorf("FormatUsage() = %q, want %q", got, want)
+	}
+}
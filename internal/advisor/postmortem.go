@@ -0,0 +1,100 @@
+package advisor
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// todo marks the parts of a postmortem the analysis can't fill in
+const todo = "_TODO_"
+
+// formatPostmortem renders the analysis as a markdown postmortem skeleton:
+// summary, timeline, root cause, remediation and action items, pre-filled
+// from the analysis and with TODO markers where people have to fill in what
+// the log can't tell (impact, owners, lessons learned)
+func formatPostmortem(llmResp config.LLMResponse, opts renderOptions) string {
+	status := classifyResponse(llmResp)
+	rootCause := strings.TrimSpace(llmResp.RootCause)
+	fix := strings.TrimSpace(llmResp.Fix)
+	if status != "problem_detected" {
+		rootCause, fix = "", ""
+	}
+
+	var output strings.Builder
+	title := firstLine(rootCause)
+	if title == "" {
+		title = todo
+	}
+	output.WriteString("# Postmortem: " + title + "\n\n")
+
+	severity, category := todo, todo
+	if s := strings.ToLower(strings.TrimSpace(llmResp.Severity)); isSeverity(s) && status == "problem_detected" {
+		severity = strings.ToUpper(s[:1]) + s[1:]
+	}
+	if c := normalizeCategory(llmResp.Category); c != "" {
+		category = "`" + c + "`"
+	}
+	loc := opts.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	output.WriteString("| | |\n|---|---|\n")
+	output.WriteString("| Status | Draft |\n")
+	output.WriteString("| Drafted | " + time.Now().In(loc).Format("2006-01-02") + " |\n")
+	output.WriteString("| Severity | " + severity + " |\n")
+	output.WriteString("| Category | " + category + " |\n")
+	output.WriteString("| Authors | " + todo + " |\n\n")
+
+	output.WriteString("## Summary\n\n")
+	if rootCause != "" {
+		output.WriteString(title + "\n\n")
+	}
+	output.WriteString("Impact: " + todo + " (who was affected, how, and for how long)\n\n")
+
+	if timeline := formatTimelineMarkdown(llmResp.Timeline, opts); timeline != "" {
+		output.WriteString(timeline)
+	} else {
+		output.WriteString("## Timeline\n\n| Time | Event |\n|------|-------|\n| " + todo + " | " + todo + " |\n\n")
+	}
+	output.WriteString("- Detected: " + todo + "\n- Mitigated: " + todo + "\n- Resolved: " + todo + "\n\n")
+
+	output.WriteString("## Root Cause\n\n")
+	if rootCause != "" {
+		output.WriteString(rootCause + "\n\n")
+	} else {
+		output.WriteString(todo + "\n\n")
+		if items := missingItems(llmResp.Missing); len(items) > 0 {
+			output.WriteString("The analysis needed more data to determine it:\n\n")
+			for _, item := range items {
+				output.WriteString("- " + item + "\n")
+			}
+			output.WriteString("\n")
+		}
+	}
+
+	if evidence := strings.TrimSpace(string(llmResp.Evidence)); evidence != "" {
+		output.WriteString("### " + evidenceTitle(llmResp) + "\n\n```\n" + evidence + "\n```\n\n")
+	}
+
+	output.WriteString("## Remediation\n\n")
+	if fix != "" {
+		output.WriteString("```\n" + fix + "\n```\n\n")
+	} else {
+		output.WriteString(todo + "\n\n")
+	}
+
+	output.WriteString("## Action Items\n\n| Action | Owner | Due |\n|--------|-------|-----|\n")
+	if fix != "" {
+		output.WriteString("| Apply and verify the fix: " + strings.NewReplacer("|", "\\|", "`", "").Replace(firstLine(fix)) + " | " + todo + " | " + todo + " |\n")
+	}
+	output.WriteString("| Add monitoring or alerting that detects this earlier | " + todo + " | " + todo + " |\n")
+	output.WriteString("| " + todo + " | | |\n\n")
+
+	output.WriteString("## Lessons Learned\n\n")
+	output.WriteString("- What went well: " + todo + "\n")
+	output.WriteString("- What went wrong: " + todo + "\n")
+	output.WriteString("- Where we got lucky: " + todo + "\n")
+	return output.String()
+}
@@ -0,0 +1,84 @@
+package advisor
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+func TestFormatResponse_Postmortem(t *testing.T) {
+	response := `{
+		"status": "problem_detected",
+		"severity": "high",
+		"category": "resource",
+		"root_cause": "The connection pool is exhausted\nsecond line",
+		"evidence": "FATAL too many clients already",
+		"fix": "ALTER SYSTEM SET max_connections = 200;",
+		"timeline": [{"time": "2024-01-15T10:00:00Z", "event": "pool saturated"}, {"time": "2024-01-15T10:02:00Z", "event": "first 503"}]
+	}`
+
+	got, err := formatResponse(response, []int{7}, FormatPostmortem, renderOptions{})
+	if err != nil {
+		t.Fatalf("formatResponse() error = %v", err)
+	}
+	for _, want := range []string{
+		"# Postmortem: The connection pool is exhausted\n",
+		"| Severity | High |",
+		"| Category | `resource` |",
+		"## Summary\n\nThe connection pool is exhausted\n\nImpact: _TODO_",
+		"| Since first |",
+		"## Root Cause\n\nThe connection pool is exhausted\nsecond line\n",
+		"### Evidence (line 7)",
+		"## Remediation\n\n```\nALTER SYSTEM SET max_connections = 200;\n```",
+		"| Apply and verify the fix: ALTER SYSTEM SET max_connections = 200; | _TODO_ | _TODO_ |",
+		"## Lessons Learned",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("postmortem missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestFormatPostmortem_InsufficientData(t *testing.T) {
+	response := `{"status": "insufficient_data", "severity": "medium", "root_cause": "", "evidence": "", "fix": "", "missing": ["the database logs"]}`
+
+	got, _ := formatResponse(response, nil, FormatPostmortem, renderOptions{})
+	for _, want := range []string{
+		"# Postmortem: _TODO_",
+		"| Severity | _TODO_ |",
+		"## Root Cause\n\n_TODO_\n\nThe analysis needed more data to determine it:\n\n- the database logs\n",
+		"## Remediation\n\n_TODO_",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("postmortem missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "Apply and verify the fix") {
+		t.Error("a postmortem without a fix should not list applying it as an action item")
+	}
+}
+
+func TestNewSinks_Postmortem(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "postmortem.md")
+	cfg := &config.Config{Outputs: []string{"text"}, Postmortem: path}
+	sinks, err := NewSinks(cfg, io.Discard)
+	if err != nil {
+		t.Fatalf("NewSinks() error = %v", err)
+	}
+	if err := Deliver(sinks, &Analysis{Raw: mockLLMResponse("problem_detected", "Database is down", "ERROR connection refused", "systemctl start postgresql")}); err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.HasPrefix(string(data), "# Postmortem: Database is down") {
+		t.Errorf("postmortem file = %q, %v", data, err)
+	}
+
+	cfg.NoSchema = true
+	if _, err := NewSinks(cfg, io.Discard); err == nil {
+		t.Error("NewSinks() should reject a postmortem with NoSchema")
+	}
+}
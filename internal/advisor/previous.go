@@ -0,0 +1,124 @@
+package advisor
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/fatih/color"
+	"github.com/jenian/que/internal/config"
+)
+
+// comparisonColors colors the --previous verdicts by how good the news is
+var comparisonColors = map[string]color.Attribute{
+	"resolved":  color.FgGreen,
+	"unchanged": color.FgYellow,
+	"changed":   color.FgYellow,
+	"regressed": color.FgRed,
+}
+
+// NewPreviousAnalysis turns a recorded model response into the previous
+// analysis a new log is compared against. Responses without the JSON schema
+// are passed on verbatim as the root cause.
+func NewPreviousAnalysis(response string, timestamp time.Time) *config.PreviousAnalysis {
+	previous := &config.PreviousAnalysis{Timestamp: timestamp}
+	llmResp, err := parseResponse(response)
+	if err != nil {
+		previous.RootCause = strings.TrimSpace(response)
+		return previous
+	}
+	if classifyResponse(llmResp) == "no_problem" {
+		previous.RootCause = "No problem was detected."
+		return previous
+	}
+	previous.RootCause = strings.TrimSpace(llmResp.RootCause)
+	previous.Fix = strings.TrimSpace(llmResp.Fix)
+	previous.Category = normalizeCategory(llmResp.Category)
+	if severity := strings.ToLower(strings.TrimSpace(llmResp.Severity)); isSeverity(severity) {
+		previous.Severity = severity
+	}
+	return previous
+}
+
+// sameThreshold is the similarity from which two free-text fields are taken
+// to say the same thing in different words
+const sameThreshold = 0.6
+
+// diffAnalyses compares the current response with the previous analysis,
+// field by field. Severity and category are only compared when the previous
+// analysis recorded them.
+func diffAnalyses(previous *config.PreviousAnalysis, llmResp config.LLMResponse) *config.AnalysisDiff {
+	rootCause, fix := strings.TrimSpace(llmResp.RootCause), strings.TrimSpace(llmResp.Fix)
+	if classifyResponse(llmResp) == "no_problem" {
+		rootCause = "No problem was detected."
+	}
+	fields := []config.FieldDiff{
+		{Field: "root_cause", Previous: previous.RootCause, Current: rootCause},
+		{Field: "fix", Previous: previous.Fix, Current: fix},
+	}
+	if previous.Severity != "" {
+		fields = append(fields, config.FieldDiff{Field: "severity", Previous: previous.Severity, Current: strings.ToLower(strings.TrimSpace(llmResp.Severity))})
+	}
+	if previous.Category != "" {
+		fields = append(fields, config.FieldDiff{Field: "category", Previous: previous.Category, Current: normalizeCategory(llmResp.Category)})
+	}
+
+	diff := &config.AnalysisDiff{Differs: []string{}}
+	var total float64
+	for i := range fields {
+		field := &fields[i]
+		field.Similarity = similarity(field.Previous, field.Current)
+		if field.Similarity < sameThreshold {
+			diff.Differs = append(diff.Differs, field.Field)
+		}
+		total += field.Similarity
+	}
+	diff.Fields = fields
+	diff.Agreement = math.Round(total/float64(len(fields))*100) / 100
+	return diff
+}
+
+// similarity is the Jaccard index of the words of a and b, rounded to two
+// decimals: 1 when they use the same words, 0 when they share none. Two empty
+// fields are the same.
+func similarity(a, b string) float64 {
+	wordsA, wordsB := wordSet(a), wordSet(b)
+	if len(wordsA) == 0 && len(wordsB) == 0 {
+		return 1
+	}
+	shared := 0
+	for word := range wordsA {
+		if wordsB[word] {
+			shared++
+		}
+	}
+	union := len(wordsA) + len(wordsB) - shared
+	return math.Round(float64(shared)/float64(union)*100) / 100
+}
+
+// wordSet returns the distinct lowercase words of s, ignoring punctuation
+func wordSet(s string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words[word] = true
+	}
+	return words
+}
+
+// formatComparison renders the verdict on the previous analysis as a line
+// preceding the analysis, or "" if the log wasn't compared
+func formatComparison(llmResp config.LLMResponse, opts renderOptions) string {
+	comparison := strings.ToLower(strings.TrimSpace(llmResp.Comparison))
+	attr, ok := comparisonColors[comparison]
+	if !ok {
+		return ""
+	}
+	label := "Since the previous analysis: " + comparison
+	if opts.ScreenReader {
+		return label + "\n"
+	}
+	return newColor(opts.Colored, attr, color.Bold).Sprint(label) + "\n"
+}
@@ -0,0 +1,129 @@
+package advisor
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenian/que/internal/config"
+)
+
+func TestNewPreviousAnalysis(t *testing.T) {
+	ts := time.Date(2026, 10, 15, 9, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		response  string
+		rootCause string
+		fix       string
+	}{
+		{"problem", `{"status": "problem_detected", "root_cause": "Pool exhausted", "evidence": "too many clients", "fix": "raise max_connections"}`, "Pool exhausted", "raise max_connections"},
+		{"no problem", `{"status": "no_problem", "root_cause": "", "evidence": "", "fix": ""}`, "No problem was detected.", ""},
+		{"free-form", "The pool is exhausted.\n", "The pool is exhausted.", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := NewPreviousAnalysis(tt.response, ts)
+			if previous.RootCause != tt.rootCause || previous.Fix != tt.fix || !previous.Timestamp.Equal(ts) {
+				t.Errorf("NewPreviousAnalysis() = %+v, want root cause %q and fix %q", previous, tt.rootCause, tt.fix)
+			}
+		})
+	}
+}
+
+func TestFormatResponse_Comparison(t *testing.T) {
+	response := `{"status": "no_problem", "root_cause": "", "evidence": "", "fix": "", "comparison": "resolved"}`
+
+	text, _ := formatResponse(response, nil, FormatText, renderOptions{})
+	if !strings.HasPrefix(text, "Since the previous analysis: resolved\n") {
+		t.Errorf("text output = %q, want it to start with the comparison", text)
+	}
+
+	markdown, _ := formatResponse(response, nil, FormatMarkdown, renderOptions{})
+	if !strings.HasPrefix(markdown, "**Since the previous analysis: resolved**\n\n") {
+		t.Errorf("markdown output = %q, want it to start with the comparison", markdown)
+	}
+
+	jsonOut, _ := formatResponse(response, nil, FormatJSON, renderOptions{})
+	if !strings.Contains(jsonOut, `"comparison": "resolved"`) {
+		t.Errorf("JSON output = %s, want the comparison field", jsonOut)
+	}
+
+	plain, _ := formatResponse(`{"status": "no_problem", "root_cause": "", "evidence": "", "fix": ""}`, nil, FormatText, renderOptions{})
+	if strings.Contains(plain, "previous analysis") {
+		t.Errorf("text output = %q, want no comparison without --previous", plain)
+	}
+}
+
+func TestAnalysis_Comparison(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{`{"status": "no_problem", "comparison": "Resolved"}`, "resolved"},
+		{`{"status": "problem_detected", "root_cause": "x", "comparison": "regressed"}`, "regressed"},
+		{`{"status": "problem_detected", "root_cause": "x", "comparison": "maybe"}`, ""},
+		{`{"status": "problem_detected", "root_cause": "x"}`, ""},
+		{"not json", ""},
+	}
+
+	for _, tt := range tests {
+		if got := (&Analysis{Raw: tt.raw}).Comparison(); got != tt.want {
+			t.Errorf("Comparison() for %s = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestAnalysis_FormatJSONDiff(t *testing.T) {
+	previous := NewPreviousAnalysis(`{"status": "problem_detected", "severity": "high", "category": "resource", "root_cause": "The connection pool is exhausted", "evidence": "too many clients", "fix": "raise max_connections"}`, time.Now())
+	if previous.Severity != "high" || previous.Category != "resource" {
+		t.Fatalf("NewPreviousAnalysis() = %+v, want severity and category", previous)
+	}
+
+	analysis := &Analysis{
+		Raw:      `{"status": "problem_detected", "severity": "critical", "category": "resource", "root_cause": "The connection pool is exhausted again", "evidence": "too many clients", "fix": "add pgbouncer in front of the database", "comparison": "regressed"}`,
+		Previous: previous,
+	}
+	out, err := analysis.Format(FormatJSON, renderOptions{})
+	if err != nil {
+		t.Fatalf("Format() error = %v", err)
+	}
+	var parsed config.LLMResponse
+	if err := json.Unmarshal([]byte(out), &parsed); err != nil || parsed.Diff == nil {
+		t.Fatalf("JSON output should contain a diff: %v\n%s", err, out)
+	}
+	diff := parsed.Diff
+	if strings.Join(diff.Differs, ",") != "fix,severity" {
+		t.Errorf("differs = %v, want the fix and severity", diff.Differs)
+	}
+	if len(diff.Fields) != 4 || diff.Fields[0].Similarity < sameThreshold || diff.Fields[3].Similarity != 1 {
+		t.Errorf("fields = %+v", diff.Fields)
+	}
+	if diff.Agreement <= 0 || diff.Agreement >= 1 {
+		t.Errorf("agreement = %v, want partial agreement", diff.Agreement)
+	}
+
+	// Without --previous there is nothing to diff
+	analysis.Previous = nil
+	if out, _ := analysis.Format(FormatJSON, renderOptions{}); strings.Contains(out, `"diff"`) {
+		t.Errorf("JSON output without a previous analysis should have no diff:\n%s", out)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"", "", 1},
+		{"Pool exhausted.", "pool EXHAUSTED", 1},
+		{"pool exhausted", "disk full", 0},
+		{"the pool is exhausted", "the disk is full", 0.33},
+	}
+	for _, tt := range tests {
+		if got := similarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("similarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package advisor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/pkg/llm"
+)
+
+// sourceFrame matches "path/file.ext:LINE" as written in Go, Node, Java, Rust
+// and Ruby stack traces and in compiler output
+var sourceFrame = regexp.MustCompile(`((?:[A-Za-z]:)?[\w./\\@-]*\.(?:go|py|js|mjs|cjs|jsx|ts|tsx|java|kt|scala|rb|rs|c|cc|cpp|h|hpp|cs|php|swift|ex|exs|erl)):(\d+)`)
+
+// pythonFrame matches Python traceback lines: File "app.py", line 12
+var pythonFrame = regexp.MustCompile(`File "([^"]+)", line (\d+)`)
+
+// problemSeverities maps analysis severities to the levels editor problem
+// matchers recognize
+var problemSeverities = map[string]string{
+	"critical": "error",
+	"high":     "error",
+	"medium":   "warning",
+	"low":      "warning",
+	"info":     "info",
+}
+
+// maskedPlaceholder matches what maskPlaceholders puts in place of a
+// redaction placeholder
+var maskedPlaceholder = regexp.MustCompile(`queRedacted(\d+)x`)
+
+// sourceLocation is a file and line referenced in the evidence
+type sourceLocation struct {
+	File string
+	Line int
+}
+
+// sourceLocations returns the files and lines referenced by stack frames in
+// text, in order of appearance and without duplicates
+func sourceLocations(text string) []sourceLocation {
+	text, unmask := maskPlaceholders(text)
+	seen := make(map[sourceLocation]bool)
+	var locations []sourceLocation
+	for _, line := range strings.Split(text, "\n") {
+		matches := pythonFrame.FindAllStringSubmatch(line, -1)
+		if len(matches) == 0 {
+			matches = sourceFrame.FindAllStringSubmatch(line, -1)
+		}
+		for _, m := range matches {
+			n, err := strconv.Atoi(m[2])
+			if err != nil || n == 0 {
+				continue
+			}
+			location := sourceLocation{File: unmask(m[1]), Line: n}
+			if !seen[location] {
+				seen[location] = true
+				locations = append(locations, location)
+			}
+		}
+	}
+	return locations
+}
+
+// maskPlaceholders replaces the redaction placeholders in text with words the
+// path patterns accept, so a path with a redacted part (e.g. a token in a
+// presigned URL) is kept whole rather than cut at the placeholder. The
+// returned function puts the placeholders back.
+func maskPlaceholders(text string) (string, func(string) string) {
+	var placeholders []string
+	masked := llm.RedactionPlaceholderPattern().ReplaceAllStringFunc(text, func(placeholder string) string {
+		placeholders = append(placeholders, placeholder)
+		return fmt.Sprintf("queRedacted%dx", len(placeholders)-1)
+	})
+	unmask := func(s string) string {
+		return maskedPlaceholder.ReplaceAllStringFunc(s, func(word string) string {
+			i, err := strconv.Atoi(maskedPlaceholder.FindStringSubmatch(word)[1])
+			if err != nil || i >= len(placeholders) {
+				return word
+			}
+			return placeholders[i]
+		})
+	}
+	return masked, unmask
+}
+
+// formatProblemMatcher renders the analysis as "file:line: severity: message"
+// lines, the format of compiler diagnostics that editor problem matchers
+// (e.g. VS Code's $gcc) parse. Each source location in the evidence gets a
+// line; without any, the evidence lines of the input are used, under the file
+// name "stdin". A clean log produces no lines.
+func formatProblemMatcher(llmResp config.LLMResponse) string {
+	status := classifyResponse(llmResp)
+	if status == "no_problem" {
+		return ""
+	}
+
+	severity := problemSeverities[strings.ToLower(strings.TrimSpace(llmResp.Severity))]
+	if severity == "" {
+		severity = "error"
+	}
+	message := firstLine(llmResp.RootCause)
+	if message == "" {
+		message = insufficientDataMessage
+	}
+	if category := normalizeCategory(llmResp.Category); category != "" {
+		message = "[" + category + "] " + message
+	}
+
+	locations := sourceLocations(string(llmResp.Evidence))
+	if len(locations) == 0 {
+		for _, line := range llmResp.EvidenceLines {
+			locations = append(locations, sourceLocation{File: "stdin", Line: line})
+		}
+	}
+	if len(locations) == 0 {
+		locations = []sourceLocation{{File: "stdin", Line: 1}}
+	}
+
+	var output strings.Builder
+	for _, location := range locations {
+		fmt.Fprintf(&output, "%s:%d: %s: %s\n", location.File, location.Line, severity, message)
+	}
+	return output.String()
+}
+
+// firstLine returns the first non-empty line of s, trimmed
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+package advisor
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestFormatResponse_ProblemMatcher(t *testing.T) {
+	response := `{
+		"status": "problem_detected",
+		"severity": "high",
+		"category": "code_bug",
+		"root_cause": "nil map write in the cache\nsecond line",
+		"evidence": "panic: assignment to entry in nil map\n\t/app/cache/store.go:42 +0x1d\nat Object.<anonymous> (/srv/web/index.js:10:5)\n  File \"worker.py\", line 7, in run\n\t/app/cache/store.go:42 +0x1d",
+		"fix": "initialize the map"
+	}`
+
+	got, err := formatResponse(response, nil, FormatProblemMatcher, renderOptions{})
+	if err != nil {
+		t.Fatalf("formatResponse() error = %v", err)
+	}
+	want := "/app/cache/store.go:42: error: [code-bug] nil map write in the cache\n" +
+		"/srv/web/index.js:10: error: [code-bug] nil map write in the cache\n" +
+		"worker.py:7: error: [code-bug] nil map write in the cache\n"
+	if got != want {
+		t.Errorf("problem matcher output =\n%s\nwant\n%s", got, want)
+	}
+
+	// VS Code's $gcc problem matcher must accept every line
+	gcc := regexp.MustCompile(`^(.*?):(\d+):(\d*):?\s+(?:fatal\s+)?(warning|error):\s+(.*)$`)
+	for _, line := range strings.Split(strings.TrimSpace(got), "\n") {
+		if !gcc.MatchString(line) {
+			t.Errorf("line %q doesn't match the $gcc problem matcher", line)
+		}
+	}
+}
+
+func TestFormatProblemMatcher_FallsBackToInputLines(t *testing.T) {
+	response := `{"status": "insufficient_data", "severity": "medium", "root_cause": "", "evidence": "ERROR upstream timed out", "fix": ""}`
+
+	got, _ := formatResponse(response, []int{12, 40}, FormatProblemMatcher, renderOptions{})
+	want := "stdin:12: warning: " + insufficientDataMessage + "\nstdin:40: warning: " + insufficientDataMessage + "\n"
+	if got != want {
+		t.Errorf("problem matcher output = %q, want %q", got, want)
+	}
+
+	clean := `{"status": "no_problem", "severity": "info", "root_cause": "", "evidence": "", "fix": ""}`
+	if got, _ := formatResponse(clean, nil, FormatProblemMatcher, renderOptions{}); got != "" {
+		t.Errorf("a clean log should produce no problems, got %q", got)
+	}
+}
+
+func TestSourceLocations_KeepsRedactedPaths(t *testing.T) {
+	evidence := "panic at /cache/<REDACTED_AWS_SECRET_KEY>/sync/store.go:42\n\t/app/main.go:7"
+
+	got := sourceLocations(evidence)
+	want := []sourceLocation{{File: "/cache/<REDACTED_AWS_SECRET_KEY>/sync/store.go", Line: 42}, {File: "/app/main.go", Line: 7}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("sourceLocations() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+package advisor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// Progress modes for --progress
+const (
+	// ProgressAuto shows stages with spinners when stderr is a terminal
+	ProgressAuto = "auto"
+	// ProgressJSON writes stages and messages as JSON lines on stderr
+	ProgressJSON = "json"
+)
+
+// pipelineStages are the stages of a run in order, used to report how far
+// along it is. Stage names are the first word of StartStage labels.
+var pipelineStages = []string{"ingesting", "enriching", "redacting", "querying", "parsing"}
+
+// progressEvent is one line of --progress json output
+type progressEvent struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"` // "stage", "progress", "message" or "error"
+	Stage     string    `json:"stage,omitempty"`
+	Status    string    `json:"status,omitempty"` // "started" or "finished" for stages
+	Message   string    `json:"message"`
+	Hint      string    `json:"hint,omitempty"`
+	ElapsedMS *int64    `json:"elapsed_ms,omitempty"`
+	Percent   *int      `json:"percent,omitempty"`
+	ExitCode  int       `json:"exit_code,omitempty"`
+}
+
+var (
+	// progressOut receives JSON progress events; tests replace it
+	progressOut io.Writer = os.Stderr
+	progressMu  sync.Mutex
+)
+
+// ValidateProgressMode returns an error if mode is not a known progress mode
+func ValidateProgressMode(mode string) error {
+	if mode == "" || mode == ProgressAuto || mode == ProgressJSON {
+		return nil
+	}
+	return fmt.Errorf("invalid progress mode: %s (must be %s or %s)", mode, ProgressAuto, ProgressJSON)
+}
+
+// jsonProgress reports whether progress goes out as JSON lines
+func jsonProgress(cfg *config.Config) bool {
+	return cfg.UI.Progress == ProgressJSON && !cfg.UI.Quiet
+}
+
+// emitProgress writes event as one JSON line
+func emitProgress(event progressEvent) {
+	event.Time = time.Now().UTC()
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	progressOut.Write(append(data, '\n'))
+}
+
+// startJSONStage emits the start of a stage and returns a function that emits its end
+func startJSONStage(label string) func() {
+	stage := strings.ToLower(strings.Fields(label + " ")[0])
+	emitProgress(progressEvent{Type: "stage", Stage: stage, Status: "started", Message: label})
+
+	start := time.Now()
+	return func() {
+		elapsed := time.Since(start).Milliseconds()
+		event := progressEvent{Type: "stage", Stage: stage, Status: "finished", Message: label, ElapsedMS: &elapsed}
+		for i, name := range pipelineStages {
+			if name == stage {
+				percent := (i + 1) * 100 / len(pipelineStages)
+				event.Percent = &percent
+			}
+		}
+		emitProgress(event)
+	}
+}
+
+// Report shows a diagnostic message on stderr, as a JSON event with
+// --progress json
+func Report(cfg *config.Config, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	if cfg.UI.Progress == ProgressJSON {
+		emitProgress(progressEvent{Type: "message", Message: message})
+		return
+	}
+	fmt.Fprintln(os.Stderr, message)
+}
+
+// ReportError emits the error that ends a run as a JSON event, for
+// --progress json
+func ReportError(err error, hint string, exitCode int) {
+	emitProgress(progressEvent{Type: "error", Message: err.Error(), Hint: hint, ExitCode: exitCode})
+}
@@ -0,0 +1,88 @@
+package advisor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// captureProgress redirects JSON progress events for the rest of the test
+func captureProgress(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	saved := progressOut
+	progressOut = &buf
+	t.Cleanup(func() { progressOut = saved })
+	return &buf
+}
+
+func decodeEvents(t *testing.T, buf *bytes.Buffer) []progressEvent {
+	var events []progressEvent
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var event progressEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("progress line %q is not JSON: %v", line, err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestStartStage_JSON(t *testing.T) {
+	buf := captureProgress(t)
+	cfg := &config.Config{UI: config.UIConfig{Progress: ProgressJSON}}
+
+	StartStage(cfg, "Querying gpt-4o")()
+	StartStage(cfg, "Loading plugins")()
+
+	events := decodeEvents(t, buf)
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want start and finish for 2 stages:\n%s", len(events), buf)
+	}
+	start, finish := events[0], events[1]
+	if start.Type != "stage" || start.Stage != "querying" || start.Status != "started" || start.Message != "Querying gpt-4o" {
+		t.Errorf("start event = %+v", start)
+	}
+	if finish.Status != "finished" || finish.ElapsedMS == nil || finish.Percent == nil || *finish.Percent != 80 {
+		t.Errorf("finish event = %+v, want elapsed time and 80%%", finish)
+	}
+	if events[3].Percent != nil {
+		t.Errorf("a stage outside the pipeline should have no percentage, got %d", *events[3].Percent)
+	}
+
+	// Quiet mode silences stages in any format
+	buf.Reset()
+	cfg.UI.Quiet = true
+	StartStage(cfg, "Parsing")()
+	if buf.Len() != 0 {
+		t.Errorf("quiet mode should emit no stages, got %s", buf)
+	}
+}
+
+func TestReport_JSON(t *testing.T) {
+	buf := captureProgress(t)
+	Report(&config.Config{UI: config.UIConfig{Progress: ProgressJSON, Quiet: true}}, "Redacted %d potential secrets", 3)
+	ReportError(errors.New("rate limited by provider"), "Wait a moment", 4)
+
+	events := decodeEvents(t, buf)
+	if len(events) != 2 || events[0].Type != "message" || events[0].Message != "Redacted 3 potential secrets" {
+		t.Errorf("message event = %+v", events)
+	}
+	if events[1].Type != "error" || events[1].Hint != "Wait a moment" || events[1].ExitCode != 4 {
+		t.Errorf("error event = %+v", events[1])
+	}
+}
+
+func TestValidateProgressMode(t *testing.T) {
+	for _, mode := range []string{"", ProgressAuto, ProgressJSON} {
+		if err := ValidateProgressMode(mode); err != nil {
+			t.Errorf("ValidateProgressMode(%q) error = %v", mode, err)
+		}
+	}
+	if err := ValidateProgressMode("xml"); err == nil {
+		t.Error("ValidateProgressMode(xml) should fail")
+	}
+}
@@ -0,0 +1,67 @@
+package advisor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// progressBarWidth is the number of cells in the progress bar
+const progressBarWidth = 30
+
+// ProgressBar shows how many of a known number of items are done, redrawn in
+// place on a terminal or as JSON events with --progress json
+type ProgressBar struct {
+	total    int
+	done     int
+	terminal bool
+	json     bool
+	mu       sync.Mutex
+}
+
+// NewProgressBar starts a progress bar for total items. Like stages, it is
+// silent in quiet mode, in CI and when stderr isn't a terminal.
+func NewProgressBar(cfg *config.Config, total int) *ProgressBar {
+	bar := &ProgressBar{total: total, json: jsonProgress(cfg), terminal: progressEnabled(cfg)}
+	bar.draw("")
+	return bar
+}
+
+// Add marks one item as done, item being its name
+func (b *ProgressBar) Add(item string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.done++
+	b.draw(item)
+}
+
+// Finish ends the bar's line so later output starts on a fresh one
+func (b *ProgressBar) Finish() {
+	if b.terminal && !b.json {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// draw shows the current state; callers hold b.mu except at creation
+func (b *ProgressBar) draw(item string) {
+	percent := 100
+	if b.total > 0 {
+		percent = b.done * 100 / b.total
+	}
+	if b.json {
+		if item != "" {
+			emitProgress(progressEvent{Type: "progress", Message: item, Percent: &percent})
+		}
+		return
+	}
+	if !b.terminal {
+		return
+	}
+	filled := progressBarWidth * percent / 100
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", progressBarWidth-filled)
+	// \033[K clears what's left of a longer previous item name
+	fmt.Fprintf(os.Stderr, "\r%s %d/%d %s\033[K", bar, b.done, b.total, item)
+}
@@ -0,0 +1,58 @@
+package advisor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultRoute is the routing table key used for analyses without a routed severity
+const defaultRoute = "default"
+
+// ValidateRoutes checks a severity routing table: keys must be severities,
+// "category:" followed by a category, or "default", and every entry must be a
+// valid --output list
+func ValidateRoutes(routes map[string][]string) error {
+	for severity, outputs := range routes {
+		if category, ok := strings.CutPrefix(severity, categoryRoutePrefix); ok {
+			if !isCategory(category) {
+				return fmt.Errorf("invalid route: %s (category must be one of %s)", severity, strings.Join(categories, ", "))
+			}
+		} else if severity != defaultRoute && !isSeverity(severity) {
+			return fmt.Errorf("invalid route: %s (must be one of %s, %s, or %s<category>)", severity, strings.Join(severityLevels, ", "), defaultRoute, categoryRoutePrefix)
+		}
+		if _, err := ValidateOutputs(outputs); err != nil {
+			return fmt.Errorf("route %s: %w", severity, err)
+		}
+	}
+	return nil
+}
+
+// RouteOutputs returns the --output entries an analysis should be delivered to
+// according to routes: the entry for its category, else the entry for its
+// severity, else the "default" entry, else plain text on stdout. Analyses
+// without problems always use the default.
+func RouteOutputs(routes map[string][]string, analysis *Analysis) []string {
+	if !analysis.NoProblem() {
+		if category := analysis.Category(); category != "" {
+			if outputs, ok := routes[categoryRoutePrefix+category]; ok {
+				return outputs
+			}
+		}
+		if outputs, ok := routes[analysis.Severity()]; ok {
+			return outputs
+		}
+	}
+	if outputs, ok := routes[defaultRoute]; ok {
+		return outputs
+	}
+	return []string{FormatText}
+}
+
+// DefaultRouteOutputs returns the outputs of the default route, used before
+// the severity is known (e.g. for --dry-run)
+func DefaultRouteOutputs(routes map[string][]string) []string {
+	if outputs, ok := routes[defaultRoute]; ok {
+		return outputs
+	}
+	return []string{FormatText}
+}
@@ -0,0 +1,501 @@
+package advisor
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/httpclient"
+	"github.com/jenian/que/internal/textutil"
+)
+
+// Sink names accepted by --output. Entries may carry a target as name=target,
+// e.g. "json-file=analysis.json", "slack=https://hooks.slack.com/..." or
+// "email=oncall@example.com".
+const (
+	SinkTerminal     = "terminal" // Same as "text"
+	SinkFile         = "file"     // Format inferred from the file extension
+	SinkTextFile     = "text-file"
+	SinkMarkdownFile = "markdown-file"
+	SinkJSONFile     = "json-file"
+	SinkPostmortem   = "postmortem-file"
+	SinkWebhook      = "webhook"
+	SinkSlack        = "slack"
+	SinkTeams        = "teams"
+	SinkDiscord      = "discord"
+	SinkPagerDuty    = "pagerduty"
+	SinkEmail        = "email"
+)
+
+// stdoutSinks map the sinks that print the analysis to their output format
+var stdoutSinks = map[string]string{
+	FormatText:           FormatText,
+	SinkTerminal:         FormatText,
+	FormatMarkdown:       FormatMarkdown,
+	FormatJSON:           FormatJSON,
+	FormatProblemMatcher: FormatProblemMatcher,
+}
+
+// fileSinks map the file sinks to their output format and default file name
+var fileSinks = map[string]struct{ format, defaultPath string }{
+	SinkTextFile:     {FormatText, "que-analysis.txt"},
+	SinkMarkdownFile: {FormatMarkdown, "que-analysis.md"},
+	SinkJSONFile:     {FormatJSON, "que-analysis.json"},
+	SinkPostmortem:   {FormatPostmortem, "que-postmortem.md"},
+	SinkFile:         {"", ""},
+}
+
+// webhookTimeout bounds how long delivery to a webhook may take
+const webhookTimeout = 10 * time.Second
+
+// chatSinks map the chat webhooks, which get the markdown analysis as a
+// message, to the environment variable holding their default URL
+var chatSinks = map[string]string{
+	SinkSlack:   "QUE_SLACK_WEBHOOK_URL",
+	SinkTeams:   "QUE_TEAMS_WEBHOOK_URL",
+	SinkDiscord: "QUE_DISCORD_WEBHOOK_URL",
+}
+
+// discordMessageLimit is the most characters Discord accepts in a message
+const discordMessageLimit = 2000
+
+// SignatureHeader carries the HMAC-SHA256 of a webhook body when a secret is configured
+const SignatureHeader = "X-Que-Signature-256"
+
+// pagerDutyURL is the PagerDuty Events API v2 endpoint (a variable so tests can replace it)
+var pagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// pagerDutySeverities maps analysis severities to PagerDuty event severities
+var pagerDutySeverities = map[string]string{
+	"critical": "critical",
+	"high":     "error",
+	"medium":   "warning",
+	"low":      "info",
+	"info":     "info",
+}
+
+// Sink receives a finished analysis. One run can fan out to several sinks.
+type Sink interface {
+	Name() string
+	Write(analysis *Analysis) error
+}
+
+// ValidateOutputs checks the --output entries and returns the format of the
+// sink printing to stdout, or "" if none does
+func ValidateOutputs(outputs []string) (string, error) {
+	var stdoutFormat string
+	for _, output := range outputs {
+		name, target := splitOutput(output)
+		if format, ok := stdoutSinks[name]; ok {
+			if stdoutFormat != "" {
+				return "", fmt.Errorf("only one of text, terminal, markdown, json or problemmatcher can be used in --output")
+			}
+			if target != "" {
+				return "", fmt.Errorf("--output %s does not take a target; use --out or %s-file=PATH", name, format)
+			}
+			stdoutFormat = format
+			continue
+		}
+		if _, ok := fileSinks[name]; ok {
+			if name == SinkFile && target == "" {
+				return "", fmt.Errorf("--output file requires a path, e.g. file=analysis.md")
+			}
+			continue
+		}
+		if isNotifySink(name) {
+			continue
+		}
+		return "", fmt.Errorf("invalid output: %s (must be one of %s)", output, strings.Join(sinkNames(), ", "))
+	}
+	return stdoutFormat, nil
+}
+
+// ValidateNotify checks the --notify entries, which may only be notification
+// sinks (webhook, slack, teams, discord, pagerduty, email)
+func ValidateNotify(notify []string) error {
+	for _, entry := range notify {
+		name, _ := splitOutput(entry)
+		if !isNotifySink(name) {
+			return fmt.Errorf("invalid notification: %s (must be one of %s)", entry, strings.Join(notifySinkNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// isNotifySink reports whether name is a notification sink, which sends the
+// analysis elsewhere rather than printing or saving it
+func isNotifySink(name string) bool {
+	_, chat := chatSinks[name]
+	return chat || name == SinkWebhook || name == SinkPagerDuty || name == SinkEmail
+}
+
+// NewSinks builds the sinks for cfg.Outputs followed by cfg.Notify and the
+// cfg.Postmortem file. The stdout sink writes to stdout (or to cfg.OutFile if
+// set). Webhook URLs default to QUE_WEBHOOK_URL, QUE_SLACK_WEBHOOK_URL,
+// QUE_TEAMS_WEBHOOK_URL and QUE_DISCORD_WEBHOOK_URL.
+func NewSinks(cfg *config.Config, stdout io.Writer) ([]Sink, error) {
+	if _, err := ValidateOutputs(cfg.Outputs); err != nil {
+		return nil, err
+	}
+	if err := ValidateNotify(cfg.Notify); err != nil {
+		return nil, err
+	}
+
+	// Only the terminal gets colors; files and webhooks get plain text
+	plain := renderOptionsFor(cfg)
+	plain.Colored = false
+
+	outputs := append(append([]string{}, cfg.Outputs...), cfg.Notify...)
+	if cfg.Postmortem != "" {
+		outputs = append(outputs, SinkPostmortem+"="+cfg.Postmortem)
+	}
+
+	var sinks []Sink
+	for _, output := range outputs {
+		name, target := splitOutput(output)
+
+		if format, ok := stdoutSinks[name]; ok {
+			if err := checkSchema(cfg, name, format); err != nil {
+				return nil, err
+			}
+			if cfg.OutFile != "" {
+				sinks = append(sinks, &fileSink{path: cfg.OutFile, format: format, opts: plain})
+			} else {
+				sinks = append(sinks, &writerSink{name: name, w: stdout, format: format, opts: renderOptionsFor(cfg)})
+			}
+			continue
+		}
+
+		if file, ok := fileSinks[name]; ok {
+			path := target
+			if path == "" {
+				path = file.defaultPath
+			}
+			format := file.format
+			if format == "" {
+				format = formatForPath(path)
+			}
+			if err := checkSchema(cfg, name, format); err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, &fileSink{path: path, format: format, opts: plain})
+			continue
+		}
+
+		if name == SinkEmail {
+			sink, err := newEmailSink(cfg, target, plain)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+			continue
+		}
+
+		if name == SinkPagerDuty {
+			if err := checkSchema(cfg, name, FormatJSON); err != nil {
+				return nil, err
+			}
+			routingKey := target
+			if routingKey == "" {
+				routingKey = os.Getenv("QUE_PAGERDUTY_ROUTING_KEY")
+			}
+			if routingKey == "" {
+				return nil, fmt.Errorf("--output pagerduty requires a routing key (pagerduty=KEY or the QUE_PAGERDUTY_ROUTING_KEY environment variable)")
+			}
+			sinks = append(sinks, &pagerDutySink{
+				routingKey: routingKey,
+				client:     httpclient.New(webhookTimeout),
+			})
+			continue
+		}
+
+		if name == SinkWebhook {
+			if err := checkSchema(cfg, name, FormatJSON); err != nil {
+				return nil, err
+			}
+		}
+		url := target
+		if url == "" {
+			url = os.Getenv(webhookEnv(name))
+		}
+		if url == "" {
+			return nil, fmt.Errorf("--output %s requires a URL (%s=URL or the %s environment variable)", name, name, webhookEnv(name))
+		}
+		sink := &webhookSink{
+			url:    url,
+			kind:   name,
+			opts:   plain,
+			client: httpclient.New(webhookTimeout),
+		}
+		if name == SinkWebhook {
+			sink.secret = cfg.WebhookSecret
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// Deliver writes analysis to every sink. A failing sink doesn't stop the
+// others; all failures are returned together.
+func Deliver(sinks []Sink, analysis *Analysis) error {
+	var errs []error
+	for _, sink := range sinks {
+		if err := sink.Write(analysis); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writerSink prints the analysis to a stream such as stdout
+type writerSink struct {
+	name   string
+	w      io.Writer
+	format string
+	opts   renderOptions
+}
+
+func (s *writerSink) Name() string { return s.name }
+
+func (s *writerSink) Write(analysis *Analysis) error {
+	output, err := analysis.Format(s.format, s.opts)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(s.w, output)
+	return err
+}
+
+// fileSink writes the analysis to a file
+type fileSink struct {
+	path   string
+	format string
+	opts   renderOptions
+}
+
+func (s *fileSink) Name() string { return s.path }
+
+func (s *fileSink) Write(analysis *Analysis) error {
+	output, err := analysis.Format(s.format, s.opts)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path, []byte(output), 0644); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Analysis written to %s\n", s.path)
+	return nil
+}
+
+// webhookSink posts the analysis to an HTTP endpoint. Generic webhooks get the
+// JSON output, signed with HMAC-SHA256 if a secret is set; Slack, Teams and
+// Discord incoming webhooks get the markdown analysis as a message.
+type webhookSink struct {
+	url    string
+	kind   string // SinkWebhook or one of chatSinks
+	secret string
+	opts   renderOptions
+	client *http.Client
+}
+
+func (s *webhookSink) Name() string { return s.kind }
+
+func (s *webhookSink) Write(analysis *Analysis) error {
+	var body []byte
+	if s.kind == SinkWebhook {
+		output, err := analysis.Format(FormatJSON, s.opts)
+		if err != nil {
+			return err
+		}
+		body = []byte(output)
+	} else {
+		text, err := analysis.Format(FormatMarkdown, s.opts)
+		if err != nil {
+			return err
+		}
+		body, err = json.Marshal(chatMessage(s.kind, text))
+		if err != nil {
+			return fmt.Errorf("failed to encode %s message: %w", s.kind, err)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.secret != "" {
+		req.Header.Set(SignatureHeader, SignPayload(s.secret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post analysis: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// chatMessage returns the payload posting the markdown text to the incoming
+// webhook of a chat service. Teams gets it as an adaptive card, whose text
+// blocks render markdown; Discord caps messages at 2000 characters.
+func chatMessage(kind, text string) any {
+	switch kind {
+	case SinkTeams:
+		return map[string]any{
+			"type": "message",
+			"attachments": []map[string]any{{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]any{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"body":    []map[string]any{{"type": "TextBlock", "text": text, "wrap": true}},
+					"msteams": map[string]string{"width": "Full"},
+				},
+			}},
+		}
+	case SinkDiscord:
+		// Leave room for the marker and for closing a code block cut in half
+		content := textutil.Truncate(text, discordMessageLimit-len(textutil.TruncationMarker)-len("\n```"))
+		if strings.Count(content, "```")%2 == 1 {
+			content += "\n```"
+		}
+		return map[string]string{"content": content}
+	default:
+		return map[string]string{"text": text}
+	}
+}
+
+// SignPayload returns the signature header value for body: "sha256=" followed
+// by the hex HMAC-SHA256 of body keyed with secret. Receivers should recompute
+// it and compare with hmac.Equal.
+func SignPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// pagerDutySink triggers a PagerDuty incident through the Events API v2
+type pagerDutySink struct {
+	routingKey string
+	client     *http.Client
+}
+
+func (s *pagerDutySink) Name() string { return SinkPagerDuty }
+
+func (s *pagerDutySink) Write(analysis *Analysis) error {
+	llmResp, err := parseResponse(analysis.Raw)
+	if err != nil {
+		return err
+	}
+
+	severity, ok := pagerDutySeverities[analysis.Severity()]
+	if !ok {
+		severity = "error"
+	}
+	summary := strings.TrimSpace(llmResp.RootCause)
+	if summary == "" {
+		summary = "que detected a problem"
+	}
+	source, _ := os.Hostname()
+	if source == "" {
+		source = "que"
+	}
+
+	llmResp.Status = classifyResponse(llmResp)
+	payload := map[string]interface{}{
+		// PagerDuty rejects summaries over 1024 characters
+		"summary":        textutil.Truncate(summary, 1000),
+		"source":         source,
+		"severity":       severity,
+		"custom_details": llmResp,
+	}
+	if category := analysis.Category(); category != "" {
+		payload["class"] = category
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"routing_key":  s.routingKey,
+		"event_action": "trigger",
+		"payload":      payload,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode pagerduty event: %w", err)
+	}
+
+	resp, err := s.client.Post(pagerDutyURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post analysis: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("pagerduty returned %s", resp.Status)
+	}
+	return nil
+}
+
+// checkSchema rejects JSON, problem matcher and postmortem outputs when the
+// response schema is disabled, since there would be nothing structured to emit
+func checkSchema(cfg *config.Config, name, format string) error {
+	if cfg.NoSchema && (format == FormatJSON || format == FormatProblemMatcher || format == FormatPostmortem) {
+		return fmt.Errorf("--output %s requires the response schema and cannot be combined with --no-schema", name)
+	}
+	return nil
+}
+
+// splitOutput splits an --output entry into its sink name and optional target
+func splitOutput(output string) (string, string) {
+	name, target, _ := strings.Cut(strings.TrimSpace(output), "=")
+	return strings.ToLower(name), target
+}
+
+// formatForPath infers the output format from a file extension
+func formatForPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".md", ".markdown":
+		return FormatMarkdown
+	default:
+		return FormatText
+	}
+}
+
+// webhookEnv returns the environment variable holding the default URL of
+// the webhook sink name
+func webhookEnv(name string) string {
+	if env, ok := chatSinks[name]; ok {
+		return env
+	}
+	return "QUE_WEBHOOK_URL"
+}
+
+// sinkNames lists the accepted --output sink names for error messages
+func sinkNames() []string {
+	return []string{
+		FormatText, SinkTerminal, FormatMarkdown, FormatJSON, FormatProblemMatcher,
+		SinkFile, SinkTextFile, SinkMarkdownFile, SinkJSONFile, SinkPostmortem,
+		SinkWebhook, SinkSlack, SinkTeams, SinkDiscord, SinkPagerDuty, SinkEmail,
+	}
+}
+
+// notifySinkNames lists the notification sinks for error messages
+func notifySinkNames() []string {
+	return []string{SinkWebhook, SinkSlack, SinkTeams, SinkDiscord, SinkPagerDuty, SinkEmail}
+}
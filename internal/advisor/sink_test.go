@@ -0,0 +1,344 @@
+package advisor
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+func TestValidateOutputs(t *testing.T) {
+	tests := []struct {
+		name       string
+		outputs    []string
+		wantFormat string
+		wantErr    bool
+	}{
+		{"default", []string{"text"}, FormatText, false},
+		{"terminal alias", []string{"terminal"}, FormatText, false},
+		{"terminal and json file", []string{"terminal", "json-file"}, FormatText, false},
+		{"json and webhook", []string{"json", "webhook=http://localhost/hook"}, FormatJSON, false},
+		{"file only", []string{"file=report.md"}, "", false},
+		{"two stdout sinks", []string{"text", "json"}, "", true},
+		{"file without path", []string{"file"}, "", true},
+		{"stdout sink with target", []string{"json=out.json"}, "", true},
+		{"unknown sink", []string{"carrier-pigeon"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := ValidateOutputs(tt.outputs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateOutputs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if format != tt.wantFormat {
+				t.Errorf("ValidateOutputs() format = %q, want %q", format, tt.wantFormat)
+			}
+		})
+	}
+}
+
+func TestDeliver_FanOut(t *testing.T) {
+	var webhookBody, slackBody []byte
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		webhookBody, _ = io.ReadAll(r.Body)
+	}))
+	defer webhook.Close()
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slackBody, _ = io.ReadAll(r.Body)
+	}))
+	defer slack.Close()
+
+	jsonPath := filepath.Join(t.TempDir(), "analysis.json")
+	cfg := &config.Config{Outputs: []string{
+		"terminal",
+		"json-file=" + jsonPath,
+		"webhook=" + webhook.URL,
+		"slack=" + slack.URL,
+	}}
+
+	var stdout bytes.Buffer
+	sinks, err := NewSinks(cfg, &stdout)
+	if err != nil {
+		t.Fatalf("NewSinks() error = %v", err)
+	}
+
+	analysis := &Analysis{Raw: mockLLMResponse("problem_detected", "Database is down", "ERROR connection refused", "systemctl start postgresql")}
+	if err := Deliver(sinks, analysis); err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+
+	if !strings.Contains(stdout.String(), "Database is down") {
+		t.Errorf("Terminal sink output missing analysis, got:\n%s", stdout.String())
+	}
+
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatalf("JSON file not written: %v", err)
+	}
+	var parsed config.LLMResponse
+	if err := json.Unmarshal(data, &parsed); err != nil || parsed.RootCause != "Database is down" {
+		t.Errorf("JSON file should contain the analysis, got:\n%s", data)
+	}
+
+	if err := json.Unmarshal(webhookBody, &parsed); err != nil || parsed.RootCause != "Database is down" {
+		t.Errorf("Webhook should receive the JSON analysis, got:\n%s", webhookBody)
+	}
+
+	var message map[string]string
+	if err := json.Unmarshal(slackBody, &message); err != nil || !strings.Contains(message["text"], "Database is down") {
+		t.Errorf("Slack should receive a text message, got:\n%s", slackBody)
+	}
+}
+
+func TestDeliver_ChatSinks(t *testing.T) {
+	bodies := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bodies[r.URL.Path], _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+	t.Setenv("QUE_DISCORD_WEBHOOK_URL", server.URL+"/discord")
+
+	cfg := &config.Config{Notify: []string{"teams=" + server.URL + "/teams", "discord"}}
+	sinks, err := NewSinks(cfg, io.Discard)
+	if err != nil {
+		t.Fatalf("NewSinks() error = %v", err)
+	}
+	fix := "```\n" + strings.Repeat("kubectl rollout restart deploy/api\n", 100) + "```"
+	analysis := &Analysis{Raw: mockLLMResponse("problem_detected", "Database is down", "ERROR connection refused", fix)}
+	if err := Deliver(sinks, analysis); err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+
+	var card struct {
+		Type        string `json:"type"`
+		Attachments []struct {
+			ContentType string `json:"contentType"`
+			Content     struct {
+				Type string `json:"type"`
+				Body []struct {
+					Type string `json:"type"`
+					Text string `json:"text"`
+				} `json:"body"`
+			} `json:"content"`
+		} `json:"attachments"`
+	}
+	if err := json.Unmarshal(bodies["/teams"], &card); err != nil || len(card.Attachments) != 1 {
+		t.Fatalf("Teams should receive a message with one card, got:\n%s", bodies["/teams"])
+	}
+	attachment := card.Attachments[0]
+	if attachment.ContentType != "application/vnd.microsoft.card.adaptive" || attachment.Content.Type != "AdaptiveCard" ||
+		len(attachment.Content.Body) != 1 || !strings.Contains(attachment.Content.Body[0].Text, "Database is down") {
+		t.Errorf("Teams should receive the analysis as an adaptive card, got:\n%s", bodies["/teams"])
+	}
+
+	var message map[string]string
+	if err := json.Unmarshal(bodies["/discord"], &message); err != nil || !strings.Contains(message["content"], "Database is down") {
+		t.Fatalf("Discord should receive a content message, got:\n%s", bodies["/discord"])
+	}
+	if content := message["content"]; len(content) > discordMessageLimit || strings.Count(content, "```")%2 != 0 {
+		t.Errorf("Discord message of %d bytes, want at most %d with its code blocks closed:\n%s", len(content), discordMessageLimit, content)
+	}
+}
+
+func TestNewSinks_ChatSinkWithoutURL(t *testing.T) {
+	t.Setenv("QUE_TEAMS_WEBHOOK_URL", "")
+	_, err := NewSinks(&config.Config{Outputs: []string{"teams"}}, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "QUE_TEAMS_WEBHOOK_URL") {
+		t.Errorf("NewSinks() error = %v, want it to name QUE_TEAMS_WEBHOOK_URL", err)
+	}
+}
+
+func TestDeliver_WebhookFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Outputs: []string{"text", "webhook=" + server.URL}}
+	var stdout bytes.Buffer
+	sinks, err := NewSinks(cfg, &stdout)
+	if err != nil {
+		t.Fatalf("NewSinks() error = %v", err)
+	}
+
+	err = Deliver(sinks, &Analysis{Raw: mockLLMResponse("no_problem", "", "", "")})
+	if err == nil {
+		t.Fatal("Deliver() should report the failing webhook")
+	}
+	if stdout.Len() == 0 {
+		t.Error("A failing webhook should not prevent other sinks from writing")
+	}
+}
+
+func TestNewSinks_NoSchemaRejectsJSON(t *testing.T) {
+	cfg := &config.Config{Outputs: []string{"text", "json-file"}, NoSchema: true}
+	if _, err := NewSinks(cfg, io.Discard); err == nil {
+		t.Error("NewSinks() should reject JSON sinks with NoSchema")
+	}
+}
+
+func TestRouteOutputs(t *testing.T) {
+	routes := map[string][]string{
+		"critical": {"pagerduty", "slack"},
+		"high":     {"slack"},
+		"default":  {"text"},
+	}
+
+	withSeverity := func(status, severity string) *Analysis {
+		data, _ := json.Marshal(config.LLMResponse{Status: status, Severity: severity, RootCause: "boom", Fix: "fix"})
+		return &Analysis{Raw: string(data)}
+	}
+
+	tests := []struct {
+		name     string
+		analysis *Analysis
+		want     string
+	}{
+		{"critical", withSeverity("problem_detected", "critical"), "pagerduty,slack"},
+		{"high", withSeverity("problem_detected", "HIGH"), "slack"},
+		{"unrouted severity", withSeverity("problem_detected", "low"), "text"},
+		{"no severity", withSeverity("problem_detected", ""), "text"},
+		{"no problem", withSeverity("no_problem", "critical"), "text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.Join(RouteOutputs(routes, tt.analysis), ",")
+			if got != tt.want {
+				t.Errorf("RouteOutputs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := RouteOutputs(map[string][]string{"critical": {"slack"}}, withSeverity("problem_detected", "low")); len(got) != 1 || got[0] != FormatText {
+		t.Errorf("Without a default route, output should fall back to text, got %q", got)
+	}
+}
+
+func TestRouteOutputs_Category(t *testing.T) {
+	routes := map[string][]string{
+		"category:auth": {"pagerduty"},
+		"high":          {"slack"},
+		"default":       {"text"},
+	}
+
+	withCategory := func(status, severity, category string) *Analysis {
+		data, _ := json.Marshal(config.LLMResponse{Status: status, Severity: severity, Category: category, RootCause: "boom", Fix: "fix"})
+		return &Analysis{Raw: string(data)}
+	}
+
+	tests := []struct {
+		name     string
+		analysis *Analysis
+		want     string
+	}{
+		{"category wins over severity", withCategory("problem_detected", "high", "auth"), "pagerduty"},
+		{"category is normalized", withCategory("problem_detected", "low", " Auth "), "pagerduty"},
+		{"unrouted category falls back to severity", withCategory("problem_detected", "high", "network"), "slack"},
+		{"no problem", withCategory("no_problem", "info", "auth"), "text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.Join(RouteOutputs(routes, tt.analysis), ",")
+			if got != tt.want {
+				t.Errorf("RouteOutputs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRoutes(t *testing.T) {
+	if err := ValidateRoutes(map[string][]string{"critical": {"slack"}, "default": {"text"}}); err != nil {
+		t.Errorf("ValidateRoutes() unexpected error = %v", err)
+	}
+	if err := ValidateRoutes(map[string][]string{"fatal": {"slack"}}); err == nil {
+		t.Error("ValidateRoutes() should reject unknown severities")
+	}
+	if err := ValidateRoutes(map[string][]string{"high": {"carrier-pigeon"}}); err == nil {
+		t.Error("ValidateRoutes() should reject unknown outputs")
+	}
+	if err := ValidateRoutes(map[string][]string{"category:auth": {"pagerduty"}}); err != nil {
+		t.Errorf("ValidateRoutes() unexpected error for a category route = %v", err)
+	}
+	if err := ValidateRoutes(map[string][]string{"category:cosmic-rays": {"slack"}}); err == nil {
+		t.Error("ValidateRoutes() should reject unknown categories")
+	}
+}
+
+func TestPagerDutySink(t *testing.T) {
+	var event map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	original := pagerDutyURL
+	pagerDutyURL = server.URL
+	defer func() { pagerDutyURL = original }()
+
+	sinks, err := NewSinks(&config.Config{Outputs: []string{"pagerduty=test-key"}}, io.Discard)
+	if err != nil {
+		t.Fatalf("NewSinks() error = %v", err)
+	}
+
+	data, _ := json.Marshal(config.LLMResponse{Status: "problem_detected", Severity: "critical", RootCause: "Database is down"})
+	if err := Deliver(sinks, &Analysis{Raw: string(data)}); err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+
+	if event["routing_key"] != "test-key" || event["event_action"] != "trigger" {
+		t.Errorf("Unexpected event: %v", event)
+	}
+	payload := event["payload"].(map[string]interface{})
+	if payload["summary"] != "Database is down" || payload["severity"] != "critical" {
+		t.Errorf("Unexpected event payload: %v", payload)
+	}
+}
+
+func TestWebhookSink_Signature(t *testing.T) {
+	var body []byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Notify: []string{"webhook=" + server.URL}, WebhookSecret: "s3cret"}
+	sinks, err := NewSinks(cfg, io.Discard)
+	if err != nil {
+		t.Fatalf("NewSinks() error = %v", err)
+	}
+	if err := Deliver(sinks, &Analysis{Raw: mockLLMResponse("problem_detected", "Disk full", "ENOSPC", "df -h")}); err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+
+	if signature == "" {
+		t.Fatal("Signed webhook should carry the signature header")
+	}
+	if signature != SignPayload("s3cret", body) {
+		t.Errorf("Signature %q does not match the body", signature)
+	}
+	if !strings.HasPrefix(signature, "sha256=") {
+		t.Errorf("Signature should be prefixed with sha256=, got %q", signature)
+	}
+}
+
+func TestValidateNotify(t *testing.T) {
+	if err := ValidateNotify([]string{"webhook=https://example.com/hook", "slack", "teams", "discord=https://discord.com/api/webhooks/1/x", "pagerduty=key", "email=oncall@example.com"}); err != nil {
+		t.Errorf("ValidateNotify() unexpected error = %v", err)
+	}
+	if err := ValidateNotify([]string{"json-file"}); err == nil {
+		t.Error("ValidateNotify() should only accept notification sinks")
+	}
+}
@@ -0,0 +1,133 @@
+package advisor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// Severity levels the model may report (prompt v2+), from most to least severe
+var severityLevels = []string{"critical", "high", "medium", "low", "info"}
+
+// severityStyle describes how one severity is displayed
+type severityStyle struct {
+	Attrs  []color.Attribute
+	Symbol string // Marker shown before the label
+	Emoji  bool   // Symbol is an emoji and is hidden when emoji are disabled
+}
+
+// themes maps theme names to per-severity styles
+var themes = map[string]map[string]severityStyle{
+	"default": {
+		"critical": {Attrs: []color.Attribute{color.FgRed, color.Bold}, Symbol: "🔴", Emoji: true},
+		"high":     {Attrs: []color.Attribute{color.FgRed}, Symbol: "🟠", Emoji: true},
+		"medium":   {Attrs: []color.Attribute{color.FgYellow}, Symbol: "🟡", Emoji: true},
+		"low":      {Attrs: []color.Attribute{color.FgBlue}, Symbol: "🔵", Emoji: true},
+		"info":     {Attrs: []color.Attribute{color.FgHiBlack}, Symbol: "⚪", Emoji: true},
+	},
+	// high-contrast uses bright backgrounds and ASCII markers that survive any font
+	"high-contrast": {
+		"critical": {Attrs: []color.Attribute{color.FgHiWhite, color.BgRed, color.Bold}, Symbol: "[!!!]"},
+		"high":     {Attrs: []color.Attribute{color.FgBlack, color.BgHiYellow, color.Bold}, Symbol: "[!!]"},
+		"medium":   {Attrs: []color.Attribute{color.FgBlack, color.BgHiWhite, color.Bold}, Symbol: "[!]"},
+		"low":      {Attrs: []color.Attribute{color.FgHiWhite, color.Bold}, Symbol: "[-]"},
+		"info":     {Attrs: []color.Attribute{color.FgHiWhite}, Symbol: "[i]"},
+	},
+}
+
+// colorNames maps color names accepted in ui.severity_colors to attributes
+var colorNames = map[string]color.Attribute{
+	"black":     color.FgBlack,
+	"red":       color.FgRed,
+	"green":     color.FgGreen,
+	"yellow":    color.FgYellow,
+	"blue":      color.FgBlue,
+	"magenta":   color.FgMagenta,
+	"cyan":      color.FgCyan,
+	"white":     color.FgWhite,
+	"gray":      color.FgHiBlack,
+	"bold":      color.Bold,
+	"underline": color.Underline,
+}
+
+// ValidateTheme returns an error if theme or any severity color override is unknown
+func ValidateTheme(theme string, severityColors map[string]string) error {
+	if theme != "" {
+		if _, ok := themes[theme]; !ok {
+			names := make([]string, 0, len(themes))
+			for name := range themes {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("invalid theme: %s (must be one of %s)", theme, strings.Join(names, ", "))
+		}
+	}
+	for severity, spec := range severityColors {
+		if !isSeverity(severity) {
+			return fmt.Errorf("invalid severity in ui.severity_colors: %s (must be one of %s)", severity, strings.Join(severityLevels, ", "))
+		}
+		if _, err := parseColorSpec(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isSeverity reports whether s is a known severity level
+func isSeverity(s string) bool {
+	for _, level := range severityLevels {
+		if s == level {
+			return true
+		}
+	}
+	return false
+}
+
+// parseColorSpec parses a space separated list of color names such as "bold red"
+func parseColorSpec(spec string) ([]color.Attribute, error) {
+	var attrs []color.Attribute
+	for _, name := range strings.Fields(strings.ToLower(spec)) {
+		attr, ok := colorNames[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid color %q in ui.severity_colors", name)
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs, nil
+}
+
+// formatSeverity renders the severity label according to the render options.
+// It returns "" if the severity is missing or unknown.
+func formatSeverity(severity string, opts renderOptions) string {
+	severity = strings.ToLower(strings.TrimSpace(severity))
+	if !isSeverity(severity) {
+		return ""
+	}
+
+	label := "Severity: " + strings.ToUpper(severity)
+	if opts.ScreenReader {
+		return label
+	}
+
+	theme, ok := themes[opts.Theme]
+	if !ok {
+		theme = themes["default"]
+	}
+	style := theme[severity]
+
+	attrs := style.Attrs
+	if spec, ok := opts.SeverityColors[severity]; ok {
+		if parsed, err := parseColorSpec(spec); err == nil {
+			attrs = parsed
+		}
+	}
+
+	// Emoji symbols are dropped when emoji are disabled; ASCII markers are kept
+	if style.Symbol != "" && (opts.Emoji || !style.Emoji) {
+		label = style.Symbol + " " + label
+	}
+
+	return newColor(opts.Colored, attrs...).Sprint(label)
+}
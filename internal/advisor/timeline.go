@@ -0,0 +1,175 @@
+package advisor
+
+import (
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/jenian/que/internal/config"
+)
+
+// zonedTimeLayouts parse log timestamps that carry a zone and so can be shown
+// in the user's time zone
+var zonedTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02 15:04:05.999999999 -0700",
+	"02/Jan/2006:15:04:05 -0700", // nginx and Apache access logs
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// localTimeLayouts parse log timestamps without a zone; they are shown as
+// written but still used for durations. Fractional seconds after the seconds
+// field (with "." or ",") are accepted by all of them.
+var localTimeLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006/01/02 15:04:05",
+	time.Stamp,
+	"15:04:05",
+}
+
+// displayTime is how converted timeline times are shown
+const displayTime = "2006-01-02 15:04:05 MST"
+
+// timelineRow is a timeline event prepared for display
+type timelineRow struct {
+	Time   string // Time in the user's zone, or as written if it has no zone
+	Offset string // Time since the first timestamped event, "" if unknown
+	Event  string
+}
+
+// parseLogTime parses a timestamp as written in a log. zoned reports whether
+// it carried a time zone.
+func parseLogTime(s string) (t time.Time, zoned bool, ok bool) {
+	for _, layout := range zonedTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true, true
+		}
+	}
+	for _, layout := range localTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, false, true
+		}
+	}
+	return time.Time{}, false, false
+}
+
+// timelineRows converts zoned times to loc (time.Local if nil) and, when
+// every timestamp parses and they are in order, computes each event's offset
+// from the first one. span is the time from the first to the last event, or
+// 0 if unknown.
+func timelineRows(timeline []config.TimelineEvent, loc *time.Location) (rows []timelineRow, span time.Duration) {
+	if loc == nil {
+		loc = time.Local
+	}
+
+	var first, last time.Time
+	ordered := true
+	times := make([]time.Time, len(timeline))
+	for i, e := range timeline {
+		row := timelineRow{Time: strings.TrimSpace(e.Time), Event: strings.TrimSpace(e.Event)}
+		if row.Time != "" {
+			t, zoned, ok := parseLogTime(row.Time)
+			switch {
+			case !ok:
+				ordered = false
+			case first.IsZero():
+				first = t
+			case t.Before(last):
+				ordered = false
+			}
+			if ok {
+				last, times[i] = t, t
+				if zoned {
+					row.Time = t.In(loc).Format(displayTime)
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	if !ordered || !last.After(first) {
+		return rows, 0
+	}
+	for i := range rows {
+		if !times[i].IsZero() && times[i].After(first) {
+			rows[i].Offset = "+" + formatDuration(times[i].Sub(first))
+		}
+	}
+	return rows, last.Sub(first)
+}
+
+// formatDuration renders d compactly, e.g. "4m32s", rounding to the second
+// unless it is shorter than that
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+// formatTimelineText renders the timeline as an aligned table under a
+// heading, followed by how long it spans, or "" if the model reported none
+func formatTimelineText(timeline []config.TimelineEvent, titleColor *color.Color, opts renderOptions) string {
+	if len(timeline) == 0 {
+		return ""
+	}
+	rows, span := timelineRows(timeline, opts.Location)
+
+	timeWidth, offsetWidth := 0, 0
+	for _, row := range rows {
+		timeWidth = max(timeWidth, len(row.Time))
+		offsetWidth = max(offsetWidth, len(row.Offset))
+	}
+
+	var output strings.Builder
+	output.WriteString(titleColor.Sprint("Timeline"))
+	output.WriteString("\n\n")
+	for _, row := range rows {
+		line := ""
+		if timeWidth > 0 {
+			line += strings.Repeat(" ", timeWidth-len(row.Time)) + row.Time + "  "
+		}
+		if offsetWidth > 0 {
+			line += strings.Repeat(" ", offsetWidth-len(row.Offset)) + row.Offset + "  "
+		}
+		output.WriteString("  " + line + row.Event + "\n")
+	}
+	if span > 0 {
+		output.WriteString("\n  " + formatDuration(span) + " from first to last event\n")
+	}
+	output.WriteString("\n")
+	return output.String()
+}
+
+// formatTimelineMarkdown renders the timeline as a markdown table, or "" if
+// the model reported none
+func formatTimelineMarkdown(timeline []config.TimelineEvent, opts renderOptions) string {
+	if len(timeline) == 0 {
+		return ""
+	}
+	rows, span := timelineRows(timeline, opts.Location)
+
+	cell := strings.NewReplacer("|", "\\|", "\n", " ")
+	var output strings.Builder
+	if span > 0 {
+		output.WriteString("## Timeline\n\n| Time | Since first | Event |\n|------|-------------|-------|\n")
+	} else {
+		output.WriteString("## Timeline\n\n| Time | Event |\n|------|-------|\n")
+	}
+	for _, row := range rows {
+		output.WriteString("| " + cell.Replace(row.Time) + " | ")
+		if span > 0 {
+			output.WriteString(row.Offset + " | ")
+		}
+		output.WriteString(cell.Replace(row.Event) + " |\n")
+	}
+	if span > 0 {
+		output.WriteString("\n" + formatDuration(span) + " from first to last event.\n")
+	}
+	output.WriteString("\n")
+	return output.String()
+}
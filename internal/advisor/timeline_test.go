@@ -0,0 +1,97 @@
+package advisor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenian/que/internal/config"
+)
+
+const timelineResponse = `{
+	"status": "problem_detected",
+	"severity": "high",
+	"root_cause": "Connection pool exhausted",
+	"evidence": "FATAL: too many clients",
+	"fix": "raise max_connections",
+	"timeline": [
+		{"time": "10:02:11", "event": "Deploy of api v2.3 started"},
+		{"time": "10:04:52.120", "event": "FATAL: too many clients | retrying"},
+		"Pods restarted"
+	]
+}`
+
+func TestFormatResponse_Timeline(t *testing.T) {
+	text, err := formatResponse(timelineResponse, nil, FormatText, renderOptions{})
+	if err != nil {
+		t.Fatalf("formatResponse() error = %v", err)
+	}
+	for _, want := range []string{
+		"Timeline\n\n",
+		"      10:02:11          Deploy of api v2.3 started\n",
+		"  10:04:52.120  +2m41s  FATAL: too many clients | retrying\n",
+		"                        Pods restarted\n",
+		"  2m41s from first to last event\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text output missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Index(text, "Timeline") > strings.Index(text, "Fix") {
+		t.Error("Timeline should come before the fix")
+	}
+
+	markdown, _ := formatResponse(timelineResponse, nil, FormatMarkdown, renderOptions{})
+	if !strings.Contains(markdown, "| Time | Since first | Event |\n|------|-------------|-------|\n| 10:02:11 |  | Deploy of api v2.3 started |\n| 10:04:52.120 | +2m41s |") {
+		t.Errorf("markdown output missing timeline table:\n%s", markdown)
+	}
+	if !strings.Contains(markdown, `FATAL: too many clients \| retrying`) {
+		t.Errorf("markdown output should escape pipes in cells:\n%s", markdown)
+	}
+
+	jsonOut, _ := formatResponse(timelineResponse, nil, FormatJSON, renderOptions{})
+	if !strings.Contains(jsonOut, `"event": "Pods restarted"`) {
+		t.Errorf("JSON output should normalize string events:\n%s", jsonOut)
+	}
+}
+
+func TestFormatResponse_NoTimeline(t *testing.T) {
+	response := `{"status": "problem_detected", "root_cause": "x", "evidence": "y", "fix": "z", "timeline": []}`
+	text, _ := formatResponse(response, nil, FormatText, renderOptions{})
+	if strings.Contains(text, "Timeline") {
+		t.Errorf("text output = %q, want no timeline section for an empty timeline", text)
+	}
+}
+
+func TestTimelineRows(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	timeline := []config.TimelineEvent{
+		{Time: "2024-05-01T10:02:11Z", Event: "error rate rising"},
+		{Time: "2024-05-01T10:06:43.4Z", Event: "crash"},
+	}
+
+	rows, span := timelineRows(timeline, tokyo)
+	if rows[0].Time != "2024-05-01 19:02:11 JST" {
+		t.Errorf("zoned times should be shown in the user's zone, got %q", rows[0].Time)
+	}
+	if rows[0].Offset != "" || rows[1].Offset != "+4m32s" || span != 4*time.Minute+32400*time.Millisecond {
+		t.Errorf("offsets = %q, %q, span = %v", rows[0].Offset, rows[1].Offset, span)
+	}
+
+	if rows, _ := timelineRows(timeline, time.UTC); rows[1].Time != "2024-05-01 10:06:43 UTC" {
+		t.Errorf("--utc should show UTC, got %q", rows[1].Time)
+	}
+
+	// Without a zone the time is shown as written
+	if rows, _ := timelineRows([]config.TimelineEvent{{Time: "2024-05-01 10:02:11,250"}}, tokyo); rows[0].Time != "2024-05-01 10:02:11,250" {
+		t.Errorf("unzoned times should be kept, got %q", rows[0].Time)
+	}
+
+	// Out of order or unparseable times give no durations
+	for _, times := range [][]string{{"10:05:00", "10:01:00"}, {"10:05:00", "shortly after"}} {
+		_, span := timelineRows([]config.TimelineEvent{{Time: times[0]}, {Time: times[1]}}, tokyo)
+		if span != 0 {
+			t.Errorf("timelineRows(%q) span = %v, want 0", times, span)
+		}
+	}
+}
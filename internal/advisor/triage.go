@@ -0,0 +1,49 @@
+package advisor
+
+import (
+	"context"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/logging"
+	"github.com/jenian/que/pkg/llm"
+)
+
+// TriageConfig returns a copy of cfg that queries the smart-routing triage
+// model instead of the selected one
+func TriageConfig(cfg *config.Config) *config.Config {
+	triage := *cfg
+	triage.Model = llm.ResolveTriageModel(cfg.Provider, cfg.TriageModel)
+	return &triage
+}
+
+// AnalyzeWithTriage asks the cheap triage client first and keeps its answer
+// only if it confidently finds nothing wrong. A detected problem, an
+// insufficient_data answer, a response that doesn't parse or a failed triage
+// call all escalate to client, so clean logs (most CI runs) cost one cheap call.
+func AnalyzeWithTriage(ctx context.Context, triage, client llm.Client, cfg *config.Config, payload config.QueryPayload) (*Analysis, error) {
+	if first := Triage(ctx, triage, cfg, payload); first != nil {
+		return first, nil
+	}
+	logging.Debug().Str("model", llm.ResolveModel(cfg.Provider, cfg.Model)).Msg("Escalating to the selected model")
+	return Analyze(ctx, client, cfg, payload)
+}
+
+// Triage asks the triage client and returns its analysis if it confidently
+// finds nothing wrong, or nil if the log has to go to the selected model
+func Triage(ctx context.Context, triage llm.Client, cfg *config.Config, payload config.QueryPayload) *Analysis {
+	triageCfg := TriageConfig(cfg)
+	first, err := Analyze(ctx, triage, triageCfg, payload)
+	if err != nil {
+		if ctx.Err() != nil {
+			// Interrupted, so the escalated query fails right away too
+			return nil
+		}
+		logging.Warn().Err(err).Str("model", triageCfg.Model).Msg("Triage query failed, escalating")
+		return nil
+	}
+	if !first.NoProblem() {
+		return nil
+	}
+	logging.Debug().Str("model", triageCfg.Model).Msg("Triage found no problem, skipping escalation")
+	return first
+}
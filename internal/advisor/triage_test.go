@@ -0,0 +1,83 @@
+package advisor
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// payloadClient answers QueryWithPayload with a fixed response and counts calls
+type payloadClient struct {
+	response string
+	err      error
+	calls    int
+	model    string
+}
+
+func (c *payloadClient) QueryWithPayload(ctx context.Context, cfg *config.Config, payload config.QueryPayload) (string, error) {
+	c.calls++
+	c.model = cfg.Model
+	return c.response, c.err
+}
+
+func (c *payloadClient) QueryWithHistory(ctx context.Context, cfg *config.Config, history []string, question string) (string, error) {
+	return "", nil
+}
+
+func TestAnalyzeWithTriage(t *testing.T) {
+	const (
+		clean    = `{"status": "no_problem", "root_cause": "", "evidence": "", "fix": ""}`
+		problem  = `{"status": "problem_detected", "severity": "high", "root_cause": "OOM", "evidence": "killed", "fix": "raise limit"}`
+		unsure   = `{"status": "insufficient_data", "root_cause": "", "evidence": "timeout", "fix": ""}`
+		detailed = `{"status": "problem_detected", "severity": "high", "root_cause": "OOM in worker", "evidence": "killed", "fix": "raise limit"}`
+	)
+
+	testCases := []struct {
+		name      string
+		triage    *payloadClient
+		escalated bool
+	}{
+		{"clean log stays with triage", &payloadClient{response: clean}, false},
+		{"problem escalates", &payloadClient{response: problem}, true},
+		{"insufficient data escalates", &payloadClient{response: unsure}, true},
+		{"unparseable response escalates", &payloadClient{response: "I think it's fine"}, true},
+		{"failed triage escalates", &payloadClient{err: errors.New("connection reset")}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			selected := &payloadClient{response: detailed}
+			cfg := &config.Config{Provider: "openai", Model: "gpt-4o", UI: config.UIConfig{Quiet: true}}
+
+			analysis, err := AnalyzeWithTriage(context.Background(), tc.triage, selected, cfg, config.QueryPayload{SanitizedLog: "worker killed"})
+			if err != nil {
+				t.Fatalf("AnalyzeWithTriage() error = %v", err)
+			}
+			if tc.triage.calls != 1 || tc.triage.model != "gpt-4o-mini" {
+				t.Errorf("triage calls = %d with model %q, want 1 with gpt-4o-mini", tc.triage.calls, tc.triage.model)
+			}
+			if got := selected.calls == 1; got != tc.escalated {
+				t.Errorf("escalated = %v, want %v", got, tc.escalated)
+			}
+			if tc.escalated && analysis.Raw != detailed {
+				t.Errorf("Raw = %q, want the selected model's answer", analysis.Raw)
+			}
+		})
+	}
+}
+
+func TestTriageConfig(t *testing.T) {
+	cfg := &config.Config{Provider: "claude", Model: "claude-3-opus-20240229"}
+	if got := TriageConfig(cfg).Model; got != "claude-3-5-haiku-20241022" {
+		t.Errorf("TriageConfig().Model = %q, want the provider's triage model", got)
+	}
+	cfg.TriageModel = "claude-3-haiku-20240307"
+	if got := TriageConfig(cfg).Model; got != "claude-3-haiku-20240307" {
+		t.Errorf("TriageConfig().Model = %q, want the configured triage model", got)
+	}
+	if cfg.Model != "claude-3-opus-20240229" {
+		t.Errorf("TriageConfig() changed the original model to %q", cfg.Model)
+	}
+}
@@ -0,0 +1,126 @@
+package advisor
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/ingestor"
+)
+
+// spinnerStyles maps ui.spinner values to briandowns/spinner character sets
+var spinnerStyles = map[string]int{
+	"dots":   14,
+	"line":   9,
+	"arrows": 0,
+}
+
+// defaultSpinnerStyle is used when no style is configured
+const defaultSpinnerStyle = "dots"
+
+// renderOptions controls how an analysis is decorated for display
+type renderOptions struct {
+	Colored        bool              // Use ANSI colors
+	Emoji          bool              // Use emoji in headings and warnings
+	Theme          string            // Severity color theme
+	SeverityColors map[string]string // Per-severity color overrides
+	ScreenReader   bool              // Plain labels, no decoration
+	Location       *time.Location    // Time zone for timestamps (nil means local time)
+}
+
+// renderOptionsFor derives the render options from cfg. Screen-reader mode
+// turns off colors and emoji regardless of the other settings.
+func renderOptionsFor(cfg *config.Config) renderOptions {
+	screenReader := cfg.UI.ScreenReader
+	return renderOptions{
+		Colored:        cfg.OutFile == "" && !screenReader,
+		Emoji:          !cfg.UI.NoEmoji && !screenReader,
+		Theme:          cfg.UI.Theme,
+		SeverityColors: cfg.UI.SeverityColors,
+		ScreenReader:   screenReader,
+		Location:       cfg.UI.Location(),
+	}
+}
+
+// ValidateSpinnerStyle returns an error if style is not a known spinner style
+func ValidateSpinnerStyle(style string) error {
+	if style == "" || style == "none" {
+		return nil
+	}
+	if _, ok := spinnerStyles[style]; ok {
+		return nil
+	}
+	styles := []string{"none"}
+	for name := range spinnerStyles {
+		styles = append(styles, name)
+	}
+	sort.Strings(styles)
+	return fmt.Errorf("invalid spinner style: %s (must be one of %s)", style, strings.Join(styles, ", "))
+}
+
+// startSpinner shows a spinner on stderr in the configured style and returns
+// a function that stops it. With style "none", in quiet mode, in
+// screen-reader mode or with JSON progress nothing is drawn.
+func startSpinner(cfg *config.Config, suffix string) func() {
+	style := cfg.UI.Spinner
+	if style == "none" || cfg.UI.Quiet || cfg.UI.ScreenReader || cfg.UI.Progress == ProgressJSON {
+		return func() {}
+	}
+	charset, ok := spinnerStyles[style]
+	if !ok {
+		charset = spinnerStyles[defaultSpinnerStyle]
+	}
+
+	s := spinner.New(spinner.CharSets[charset], 100*time.Millisecond)
+	s.Suffix = suffix
+	s.Writer = os.Stderr
+	s.Start()
+	return s.Stop
+}
+
+// StartStage shows label as the current pipeline stage (with a spinner) and
+// returns a function that marks it finished, printing how long it took, so
+// users of big inputs can see where time goes. Stages are silent in quiet
+// mode, in CI and when stderr isn't a terminal, unless --progress json asks
+// for them as JSON events.
+func StartStage(cfg *config.Config, label string) func() {
+	if jsonProgress(cfg) {
+		return startJSONStage(label)
+	}
+	if !progressEnabled(cfg) {
+		return func() {}
+	}
+
+	start := time.Now()
+	stopSpinner := startSpinner(cfg, " "+label+"...")
+	return func() {
+		stopSpinner()
+		emoji := !cfg.UI.NoEmoji && !cfg.UI.ScreenReader
+		fmt.Fprintf(os.Stderr, "%s (%s)\n", withEmoji("✓ ", label, emoji), formatElapsed(time.Since(start)))
+	}
+}
+
+// progressEnabled reports whether progress stages should be shown
+func progressEnabled(cfg *config.Config) bool {
+	return !cfg.UI.Quiet && os.Getenv("CI") == "" && ingestor.IsTerminal(os.Stderr)
+}
+
+// formatElapsed renders a stage duration, e.g. "850ms" or "3.2s"
+func formatElapsed(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
+
+// withEmoji prefixes text with emoji unless emoji output is disabled
+func withEmoji(emoji string, text string, enabled bool) string {
+	if !enabled {
+		return text
+	}
+	return emoji + text
+}
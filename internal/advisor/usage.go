@@ -0,0 +1,31 @@
+package advisor
+
+import (
+	"fmt"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// FormatUsage renders token usage for people, e.g.
+// "Tokens: 1234 prompt + 456 completion (~$0.0042)"
+func FormatUsage(usage *config.Usage) string {
+	text := fmt.Sprintf("Tokens: %d prompt", usage.PromptTokens)
+	if usage.CacheReadTokens > 0 {
+		text += fmt.Sprintf(" (%d cached)", usage.CacheReadTokens)
+	}
+	text += fmt.Sprintf(" + %d completion", usage.CompletionTokens)
+	if usage.CostUSD != nil {
+		text += fmt.Sprintf(" (~$%.4f)", *usage.CostUSD)
+	}
+	return text
+}
+
+// reportUsage shows the usage of a query on stderr, so spend can be tracked
+// from CI logs. Nothing is shown in quiet mode or if the provider reported
+// no usage.
+func reportUsage(cfg *config.Config, usage *config.Usage) {
+	if usage == nil || cfg.UI.Quiet {
+		return
+	}
+	Report(cfg, "%s", FormatUsage(usage))
+}
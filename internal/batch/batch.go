@@ -0,0 +1,284 @@
+package batch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ManifestName is the state file in the results directory that records the
+// progress of each input, so an interrupted batch can resume
+const ManifestName = ".que-batch.json"
+
+// File is one input file of a batch
+type File struct {
+	Path string // Path to read the file from
+	Rel  string // Path relative to the batch directory, used in results
+	Hash string // SHA-256 of the contents, hex encoded
+}
+
+// Find returns the regular files under dir whose base name matches glob, in
+// lexical order, with their content hashes
+func Find(dir, glob string) ([]File, error) {
+	if _, err := filepath.Match(glob, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", glob, err)
+	}
+
+	var files []File
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if matched, _ := filepath.Match(glob, d.Name()); !matched {
+			return nil
+		}
+		hash, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, File{Path: path, Rel: filepath.ToSlash(rel), Hash: hash})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", dir, err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Rel < files[j].Rel })
+	return files, nil
+}
+
+// hashFile returns the hex SHA-256 of the file at path
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ResultName returns the name of the result file for rel with the given
+// extension, relative to the results directory. Subdirectories are kept, so
+// "api/app.log" becomes "api/app.log.json" and never collides with the result
+// of another input.
+func ResultName(rel, ext string) string {
+	return rel + ext
+}
+
+// Entry records the progress of one input file
+type Entry struct {
+	File     string `json:"file"`
+	Result   string `json:"result,omitempty"` // Result file, once the analysis is complete
+	Severity string `json:"severity,omitempty"`
+	Category string `json:"category,omitempty"`
+	// Escalated records that the triage model found a problem, so a resumed
+	// run goes straight to the selected model instead of paying for triage again
+	Escalated bool      `json:"escalated,omitempty"`
+	Error     string    `json:"error,omitempty"` // Why the last attempt failed
+	Attempts  int       `json:"attempts,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Manifest is the state file of a batch: it maps the content hashes of input
+// files to their progress. A file whose analysis is complete is skipped, even
+// if it was renamed or copied; partial progress is picked up where it stopped.
+type Manifest struct {
+	Entries map[string]Entry `json:"entries"`
+	// Stopped says why the last run ended before analyzing every file
+	// ("interrupted", "rate limit or quota exhausted"), or is empty
+	Stopped string `json:"stopped,omitempty"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// NewManifest returns a manifest that is kept in memory only, for batches
+// that must not leave a state file behind
+func NewManifest() *Manifest {
+	return &Manifest{Entries: make(map[string]Entry)}
+}
+
+// LoadManifest reads the manifest of the results directory dir, or starts an
+// empty one if there is none yet
+func LoadManifest(dir string) (*Manifest, error) {
+	m := &Manifest{Entries: make(map[string]Entry), path: filepath.Join(dir, ManifestName)}
+	data, err := os.ReadFile(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read batch manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid batch manifest %s: %w", m.path, err)
+	}
+	if m.Entries == nil {
+		m.Entries = make(map[string]Entry)
+	}
+	return m, nil
+}
+
+// Entry returns the recorded progress of the file with this hash
+func (m *Manifest) Entry(hash string) (Entry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.Entries[hash]
+	return entry, ok
+}
+
+// Done reports whether a file with this hash was analyzed and its result is
+// still in the results directory
+func (m *Manifest) Done(hash string) bool {
+	entry, ok := m.Entry(hash)
+	if !ok || entry.Result == "" {
+		return false
+	}
+	if m.path == "" {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(filepath.Dir(m.path), entry.Result))
+	return err == nil
+}
+
+// Record sets the progress of the file with this hash and saves the
+// manifest, so it survives an interrupted or crashed batch
+func (m *Manifest) Record(hash string, entry Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry.UpdatedAt = time.Now().UTC()
+	m.Entries[hash] = entry
+	return m.save()
+}
+
+// Stop records why the batch ended early ("" once it completed) and saves the manifest
+func (m *Manifest) Stop(reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Stopped = reason
+	return m.save()
+}
+
+// save writes the manifest atomically, unless it is kept in memory only;
+// callers hold m.mu
+func (m *Manifest) save() error {
+	if m.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode batch manifest: %w", err)
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to save batch manifest: %w", err)
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		return fmt.Errorf("failed to save batch manifest: %w", err)
+	}
+	return nil
+}
+
+// Limiter spaces requests to stay under a provider's rate limit. It is safe
+// for concurrent use by the workers of a batch.
+type Limiter struct {
+	interval time.Duration
+	mu       sync.Mutex
+	next     time.Time
+}
+
+// NewLimiter returns a limiter allowing perMinute requests a minute, or no
+// limit if perMinute is 0
+func NewLimiter(perMinute int) *Limiter {
+	l := &Limiter{}
+	if perMinute > 0 {
+		l.interval = time.Minute / time.Duration(perMinute)
+	}
+	return l
+}
+
+// Wait blocks until the next request may be sent or ctx is done
+func (l *Limiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause holds back every request for d, after the provider reported that
+// its rate limit was hit
+func (l *Limiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if resume := time.Now().Add(d); resume.After(l.next) {
+		l.next = resume
+	}
+}
+
+// Run calls analyze for each file with workers goroutines and returns the
+// errors by file. done is called after each file, from one goroutine at a time.
+func Run(ctx context.Context, files []File, workers int, analyze func(context.Context, File) error, done func(File, error)) map[string]error {
+	jobs := make(chan File)
+	var (
+		mu     sync.Mutex
+		failed = make(map[string]error)
+		wg     sync.WaitGroup
+	)
+	for i := 0; i < max(workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				err := analyze(ctx, file)
+				mu.Lock()
+				if err != nil {
+					failed[file.Rel] = err
+				}
+				done(file, err)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, file := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- file
+	}
+	close(jobs)
+	wg.Wait()
+	return failed
+}
@@ -0,0 +1,164 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "web.log"), "ERROR timeout")
+	writeFile(t, filepath.Join(dir, "api", "app.log"), "ERROR timeout")
+	writeFile(t, filepath.Join(dir, "notes.txt"), "not a log")
+
+	files, err := Find(dir, "*.log")
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if len(files) != 2 || files[0].Rel != "api/app.log" || files[1].Rel != "web.log" {
+		t.Fatalf("Find() = %+v, want api/app.log and web.log", files)
+	}
+	if files[0].Hash != files[1].Hash || len(files[0].Hash) != 64 {
+		t.Errorf("identical contents should have the same SHA-256, got %q and %q", files[0].Hash, files[1].Hash)
+	}
+
+	if _, err := Find(dir, "["); err == nil {
+		t.Error("Find() with an invalid glob should fail")
+	}
+}
+
+func TestResultName(t *testing.T) {
+	if got := ResultName("api/app.log", ".json"); got != "api/app.log.json" {
+		t.Errorf("ResultName() = %q", got)
+	}
+	if ResultName("api/app.log", ".json") == ResultName("api__app.log", ".json") {
+		t.Error("ResultName() should keep files from different directories apart")
+	}
+}
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	m, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatalf("LoadManifest() error = %v", err)
+	}
+	if m.Done("abc") {
+		t.Fatal("an empty manifest has nothing done")
+	}
+
+	writeFile(t, filepath.Join(dir, "app.log.json"), "{}")
+	if err := m.Record("abc", Entry{File: "app.log", Result: "app.log.json", Severity: "high"}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if err := m.Record("def", Entry{File: "gone.log", Result: "gone.log.json"}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	// A new batch run resumes from the saved manifest
+	resumed, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatalf("LoadManifest() error = %v", err)
+	}
+	if !resumed.Done("abc") || resumed.Entries["abc"].Severity != "high" {
+		t.Errorf("recorded file should be done: %+v", resumed.Entries)
+	}
+	if resumed.Done("def") {
+		t.Error("a file whose result was deleted should be analyzed again")
+	}
+
+	if err := resumed.Stop("interrupted"); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if again, _ := LoadManifest(dir); again.Stopped != "interrupted" {
+		t.Errorf("stop reason = %q, want it saved", again.Stopped)
+	}
+	if err := m.Record("ghi", Entry{File: "half.log", Escalated: true, Error: "status 500"}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if m.Done("ghi") {
+		t.Error("a file with only partial progress is not done")
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(6000) // one request every 10ms
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("3 requests at 6000/min took %s, want at least 20ms", elapsed)
+	}
+
+	l.Pause(50 * time.Millisecond)
+	start = time.Now()
+	l.Wait(context.Background())
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Wait() after Pause(50ms) returned after %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l.Pause(time.Hour)
+	if err := l.Wait(ctx); err == nil {
+		t.Error("Wait() should return when the context is canceled")
+	}
+
+	unlimited := NewLimiter(0)
+	start = time.Now()
+	for i := 0; i < 100; i++ {
+		unlimited.Wait(context.Background())
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("an unlimited limiter took %s for 100 requests", elapsed)
+	}
+}
+
+func TestRun(t *testing.T) {
+	files := []File{{Rel: "a.log"}, {Rel: "b.log"}, {Rel: "c.log"}, {Rel: "d.log"}}
+	var running, peak atomic.Int32
+	var done int
+
+	failed := Run(context.Background(), files, 2, func(ctx context.Context, f File) error {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+		if f.Rel == "c.log" {
+			return errors.New("boom")
+		}
+		return nil
+	}, func(File, error) { done++ })
+
+	if done != 4 {
+		t.Errorf("done called %d times, want 4", done)
+	}
+	if len(failed) != 1 || failed["c.log"] == nil {
+		t.Errorf("failed = %v, want only c.log", failed)
+	}
+	if peak.Load() > 2 {
+		t.Errorf("%d files ran at once with 2 workers", peak.Load())
+	}
+}
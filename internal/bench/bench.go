@@ -0,0 +1,323 @@
+// Package bench scores prompt and schema changes against a corpus of
+// real-world failure logs whose verdict and root-cause category are known, so
+// prompts can change without silently degrading the analyses.
+package bench
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/jenian/que/internal/advisor"
+	"github.com/jenian/que/internal/config"
+)
+
+// CorpusFile lists the cases of a corpus directory, next to their logs
+const CorpusFile = "corpus.json"
+
+//go:embed testdata/corpus
+var corpus embed.FS
+
+// Case is a log of the corpus and what a good analysis says about it
+type Case struct {
+	File   string `json:"file"`   // Log file, relative to the corpus directory
+	Status string `json:"status"` // "problem_detected" or "no_problem"
+	// Category is the root cause's category, for a problem
+	Category string `json:"category,omitempty"`
+	// Keywords are terms the root cause should mention; "a|b" accepts
+	// either, matched case-insensitively
+	Keywords []string `json:"keywords,omitempty"`
+	// Hint is context given to the model along with the log (optional)
+	Hint string `json:"hint,omitempty"`
+	Log  string `json:"-"`
+}
+
+// Corpus returns the built-in corpus
+func Corpus() ([]Case, error) {
+	sub, err := fs.Sub(corpus, "testdata/corpus")
+	if err != nil {
+		return nil, err
+	}
+	return Load(sub)
+}
+
+// LoadDir returns the corpus in dir, laid out like the built-in one
+func LoadDir(dir string) ([]Case, error) {
+	return Load(os.DirFS(dir))
+}
+
+// Load reads the cases listed in fsys's corpus.json and their logs, and
+// checks that every case can be scored
+func Load(fsys fs.FS) ([]Case, error) {
+	data, err := fs.ReadFile(fsys, CorpusFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read corpus: %w", err)
+	}
+	var cases []Case
+	if err := json.Unmarshal(data, &cases); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", CorpusFile, err)
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("%s lists no cases", CorpusFile)
+	}
+	seen := make(map[string]bool)
+	for i := range cases {
+		c := &cases[i]
+		if seen[c.File] {
+			return nil, fmt.Errorf("%s lists %s twice", CorpusFile, c.File)
+		}
+		seen[c.File] = true
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", c.File, err)
+		}
+		log, err := fs.ReadFile(fsys, path.Clean(c.File))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read case: %w", err)
+		}
+		c.Log = string(log)
+	}
+	return cases, nil
+}
+
+// validate checks the expectations of a case
+func (c *Case) validate() error {
+	switch {
+	case c.File == "":
+		return errors.New("case without a file")
+	case c.Status == "no_problem":
+		if c.Category != "" || len(c.Keywords) > 0 {
+			return errors.New("a case without a problem has no category or keywords")
+		}
+	case c.Status == "problem_detected":
+		if !slices.Contains(advisor.Categories(), c.Category) {
+			return fmt.Errorf("invalid category %q (must be one of %s)", c.Category, strings.Join(advisor.Categories(), ", "))
+		}
+	default:
+		return fmt.Errorf("invalid status %q (must be problem_detected or no_problem)", c.Status)
+	}
+	return nil
+}
+
+// Result is how well the analysis of a case matched its expectations
+type Result struct {
+	File      string `json:"file"`
+	Want      string `json:"want"` // Expected category, or "no_problem"
+	Got       string `json:"got"`  // Reported category, or status if there is none
+	RootCause string `json:"root_cause,omitempty"`
+	// Found tells whether the model was right about there being a problem
+	Found bool `json:"found"`
+	// CategoryOK tells whether the category was right, nil when not scored
+	CategoryOK *bool `json:"category_ok,omitempty"`
+	// Keywords is the share of the case's keywords the root cause mentions,
+	// nil when the case has none
+	Keywords *float64 `json:"keywords,omitempty"`
+	// Score averages the checks that apply to the case, from 0 to 1
+	Score float64 `json:"score"`
+	Error string  `json:"error,omitempty"`
+}
+
+// Score checks an analysis of c, or the error analyzing it failed with,
+// which fails every check. categories tells whether the prompt asks for a
+// category; versions before v4 don't, and aren't scored on it.
+func Score(c Case, analysis *advisor.Analysis, err error, categories bool) Result {
+	result := Result{File: c.File, Want: c.Category}
+	if c.Status == "no_problem" {
+		result.Want = c.Status
+	}
+	var status, category string
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		status, category = analysis.Status(), analysis.Category()
+		result.RootCause = analysis.RootCause()
+		result.Got = status
+	}
+
+	if c.Status == "no_problem" {
+		result.Found = status == "no_problem"
+		if result.Found {
+			result.Score = 1
+		}
+		return result
+	}
+
+	// An analysis asking for more data still found the problem
+	result.Found = status == "problem_detected" || status == "insufficient_data"
+	checks, passed := 1.0, 0.0
+	if result.Found {
+		passed++
+	}
+	if categories {
+		if category != "" {
+			result.Got = category
+		}
+		ok := category == c.Category
+		result.CategoryOK = &ok
+		checks++
+		if ok {
+			passed++
+		}
+	}
+	if len(c.Keywords) > 0 {
+		share := keywordShare(result.RootCause, c.Keywords)
+		result.Keywords = &share
+		checks++
+		passed += share
+	}
+	result.Score = passed / checks
+	return result
+}
+
+// keywordShare returns the share of keywords text mentions
+func keywordShare(text string, keywords []string) float64 {
+	text = strings.ToLower(text)
+	var found int
+	for _, keyword := range keywords {
+		for _, alternative := range strings.Split(keyword, "|") {
+			if alternative = strings.TrimSpace(alternative); alternative != "" && strings.Contains(text, strings.ToLower(alternative)) {
+				found++
+				break
+			}
+		}
+	}
+	return float64(found) / float64(len(keywords))
+}
+
+// Report sums up the results of one prompt version over the corpus.
+// Percentages are from 0 to 100.
+type Report struct {
+	PromptVersion string `json:"prompt_version"`
+	Provider      string `json:"provider"`
+	Model         string `json:"model"`
+	Cases         int    `json:"cases"`
+	// Score is the mean score of the cases
+	Score float64 `json:"score"`
+	// Found is the share of cases whose problem, or lack of one, was recognized
+	Found float64 `json:"found"`
+	// Category is the share of problems put in the right category, nil when
+	// the prompt doesn't ask for one
+	Category *float64 `json:"category,omitempty"`
+	// Keywords is the mean share of keywords the root causes mention
+	Keywords float64       `json:"keywords"`
+	Errors   int           `json:"errors"`
+	Usage    *config.Usage `json:"usage,omitempty"`
+	Results  []Result      `json:"results"`
+}
+
+// Summarize sums up the results of a prompt version
+func Summarize(version string, results []Result) Report {
+	report := Report{PromptVersion: version, Cases: len(results), Results: results}
+	var found, categorized, categoryOK, withKeywords int
+	var score, keywords float64
+	for _, result := range results {
+		score += result.Score
+		if result.Error != "" {
+			report.Errors++
+		}
+		if result.Found {
+			found++
+		}
+		if result.CategoryOK != nil {
+			categorized++
+			if *result.CategoryOK {
+				categoryOK++
+			}
+		}
+		if result.Keywords != nil {
+			withKeywords++
+			keywords += *result.Keywords
+		}
+	}
+	if len(results) > 0 {
+		report.Score = 100 * score / float64(len(results))
+		report.Found = 100 * float64(found) / float64(len(results))
+	}
+	if categorized > 0 {
+		share := 100 * float64(categoryOK) / float64(categorized)
+		report.Category = &share
+	}
+	if withKeywords > 0 {
+		report.Keywords = 100 * keywords / float64(withKeywords)
+	}
+	return report
+}
+
+// Compare returns the regressions of current from baseline, a report of the
+// same prompt version from an earlier run: a score more than tolerance
+// points lower, and each case that scores lower than before
+func Compare(baseline, current Report, tolerance float64) []string {
+	var regressions []string
+	if current.Score < baseline.Score-tolerance {
+		regressions = append(regressions, fmt.Sprintf("%s: score %.1f, down from %.1f", current.PromptVersion, current.Score, baseline.Score))
+	}
+	before := make(map[string]Result, len(baseline.Results))
+	for _, result := range baseline.Results {
+		before[result.File] = result
+	}
+	for _, result := range current.Results {
+		old, ok := before[result.File]
+		if !ok || result.Score >= old.Score {
+			continue
+		}
+		regressions = append(regressions, fmt.Sprintf("%s: %s scores %.2f, down from %.2f (%s)", current.PromptVersion, result.File, result.Score, old.Score, result.describe()))
+	}
+	return regressions
+}
+
+// describe tells what an analysis got wrong, for the misses of a report
+func (r Result) describe() string {
+	switch {
+	case r.Error != "":
+		return "failed: " + r.Error
+	case r.Want == "no_problem" && !r.Found:
+		return "reported a problem where there is none"
+	case !r.Found:
+		return "found no problem, got " + r.Got
+	case r.CategoryOK != nil && !*r.CategoryOK:
+		return fmt.Sprintf("want %s, got %s", r.Want, orNone(r.Got))
+	case r.Keywords != nil && *r.Keywords < 1:
+		return fmt.Sprintf("root cause mentions %.0f%% of the keywords: %s", 100**r.Keywords, r.RootCause)
+	default:
+		return "ok"
+	}
+}
+
+// orNone returns s, or "none" if it's empty
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// Format renders reports as a table comparing the prompt versions, followed
+// by the misses of each
+func Format(reports []Report) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-8s %6s %6s %9s %9s %7s\n", "Prompt", "Score", "Found", "Category", "Keywords", "Errors")
+	for _, report := range reports {
+		category := "n/a"
+		if report.Category != nil {
+			category = fmt.Sprintf("%.0f%%", *report.Category)
+		}
+		fmt.Fprintf(&b, "%-8s %6.1f %5.0f%% %9s %8.0f%% %7d\n", report.PromptVersion, report.Score, report.Found, category, report.Keywords, report.Errors)
+	}
+	for _, report := range reports {
+		var misses []string
+		for _, result := range report.Results {
+			if result.Score < 1 {
+				misses = append(misses, fmt.Sprintf("  %s: %s", result.File, result.describe()))
+			}
+		}
+		if len(misses) > 0 {
+			fmt.Fprintf(&b, "\nMisses of %s (%s):\n%s\n", report.PromptVersion, strings.TrimSpace(report.Provider+" "+report.Model), strings.Join(misses, "\n"))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,126 @@
+package bench
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jenian/que/internal/advisor"
+)
+
+func TestCorpus(t *testing.T) {
+	cases, err := Corpus()
+	if err != nil {
+		t.Fatalf("Corpus() error = %v", err)
+	}
+
+	perCategory := make(map[string]int)
+	for _, c := range cases {
+		if strings.TrimSpace(c.Log) == "" {
+			t.Errorf("%s: empty log", c.File)
+		}
+		if c.Status == "no_problem" {
+			perCategory[c.Status]++
+		} else {
+			perCategory[c.Category]++
+		}
+	}
+	// Every category needs a few cases, or one answer swings its score
+	for _, category := range append(advisor.Categories(), "no_problem") {
+		if perCategory[category] < 2 {
+			t.Errorf("the corpus has %d cases of %s, want at least 2", perCategory[category], category)
+		}
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		corpus string
+		want   string
+	}{
+		{"unknown category", `[{"file": "a.log", "status": "problem_detected", "category": "cosmic-rays"}]`, "invalid category"},
+		{"keywords without a problem", `[{"file": "a.log", "status": "no_problem", "keywords": ["timeout"]}]`, "no category or keywords"},
+		{"unknown status", `[{"file": "a.log", "status": "broken", "category": "network"}]`, "invalid status"},
+		{"listed twice", `[{"file": "a.log", "status": "no_problem"}, {"file": "a.log", "status": "no_problem"}]`, "twice"},
+		{"missing log", `[{"file": "b.log", "status": "no_problem"}]`, "failed to read case"},
+		{"empty", `[]`, "no cases"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{
+				CorpusFile: {Data: []byte(tt.corpus)},
+				"a.log":    {Data: []byte("ERROR dial tcp: i/o timeout\n")},
+			}
+			if _, err := Load(fsys); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	problem := Case{File: "db.log", Status: "problem_detected", Category: "network", Keywords: []string{"refused", "5432|postgres"}}
+	healthy := Case{File: "ok.log", Status: "no_problem"}
+	analysis := func(raw string) *advisor.Analysis { return &advisor.Analysis{Raw: raw} }
+
+	tests := []struct {
+		name       string
+		c          Case
+		analysis   *advisor.Analysis
+		err        error
+		categories bool
+		want       float64
+	}{
+		{"all right", problem, analysis(`{"status": "problem_detected", "category": "network", "root_cause": "Postgres refused the connection"}`), nil, true, 1},
+		{"wrong category", problem, analysis(`{"status": "problem_detected", "category": "config", "root_cause": "Postgres refused the connection"}`), nil, true, 2.0 / 3},
+		{"half the keywords", problem, analysis(`{"status": "problem_detected", "category": "network", "root_cause": "The connection was refused"}`), nil, true, 2.5 / 3},
+		{"no category asked for", problem, analysis(`{"status": "problem_detected", "root_cause": "Postgres refused the connection"}`), nil, false, 1},
+		{"missed problem", problem, analysis(`{"status": "no_problem", "category": "", "root_cause": ""}`), nil, true, 0},
+		{"failed", problem, nil, errors.New("rate limited"), true, 0},
+		{"healthy", healthy, analysis(`{"status": "no_problem", "category": "", "root_cause": ""}`), nil, true, 1},
+		{"false alarm", healthy, analysis(`{"status": "problem_detected", "category": "config", "root_cause": "cron ran"}`), nil, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Score(tt.c, tt.analysis, tt.err, tt.categories)
+			if diff := result.Score - tt.want; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("Score() = %v, want %v (%+v)", result.Score, tt.want, result)
+			}
+		})
+	}
+}
+
+func TestSummarizeAndCompare(t *testing.T) {
+	right, wrong := true, false
+	full, half := 1.0, 0.5
+	baseline := Summarize("v6", []Result{
+		{File: "db.log", Want: "network", Got: "network", Found: true, CategoryOK: &right, Keywords: &full, Score: 1},
+		{File: "ok.log", Want: "no_problem", Got: "no_problem", Found: true, Score: 1},
+	})
+	if baseline.Score != 100 || baseline.Found != 100 || baseline.Category == nil || *baseline.Category != 100 || baseline.Keywords != 100 {
+		t.Errorf("Summarize() = %+v, want a perfect report", baseline)
+	}
+
+	current := Summarize("v6", []Result{
+		{File: "db.log", Want: "network", Got: "config", Found: true, CategoryOK: &wrong, Keywords: &half, Score: 0.5},
+		{File: "ok.log", Want: "no_problem", Got: "no_problem", Found: true, Score: 1},
+	})
+	if current.Score != 75 || *current.Category != 0 || current.Keywords != 50 {
+		t.Errorf("Summarize() = %+v, want a score of 75 with the category wrong and half the keywords", current)
+	}
+
+	regressions := Compare(baseline, current, 5)
+	if len(regressions) != 2 || !strings.Contains(regressions[0], "score 75.0, down from 100.0") || !strings.Contains(regressions[1], "db.log") || !strings.Contains(regressions[1], "want network, got config") {
+		t.Errorf("Compare() = %q, want the lower score and the case that got worse", regressions)
+	}
+	if regressions := Compare(current, baseline, 5); len(regressions) != 0 {
+		t.Errorf("Compare() of an improvement = %q, want none", regressions)
+	}
+
+	text := Format([]Report{current})
+	if !strings.Contains(text, "v6") || !strings.Contains(text, "75.0") || !strings.Contains(text, "db.log: want network, got config") || strings.Contains(text, "ok.log") {
+		t.Errorf("Format() should show the scores and only the misses:\n%s", text)
+	}
+}
@@ -2,6 +2,10 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -19,6 +23,82 @@ type QueryPayload struct {
 	RawLog        string
 	SanitizedLog  string
 	SystemContext Context
+	Hint          string // Sanitized user-provided context about the problem (optional)
+	Attachments   []Attachment
+	Findings      []FindingDetail   // Secrets redacted from the log and the rest of the payload (never sent to the LLM)
+	LineMap       LineMap           // SanitizedLog line numbers to RawLog line numbers
+	Previous      *PreviousAnalysis // Earlier analysis to compare the log against (optional)
+	Truncated     bool              // RawLog was cut to its head and tail on ingestion
+	Summarized    bool              // Older lines of SanitizedLog were summarized to fit the context window
+	Sources       []LogSource       // Pod containers the lines of a kubectl logs --prefix log are labeled with (nil for a single source)
+	Interleaved   bool              // Lines of different Sources were put in timestamp order
+	Toolchain     string            // Build tool or package manager that wrote the log, e.g. "npm" (empty if not recognized)
+	Filtered      bool              // SanitizedLog was reduced to the failing tasks and errors of a build (Toolchain)
+}
+
+// LogSource is a container of a pod whose lines are labeled [pod/POD/CONTAINER]
+// in the log, as kubectl logs --prefix writes them
+type LogSource struct {
+	Pod       string
+	Container string
+	Lines     int // Labeled lines from the container
+}
+
+// PreviousAnalysis is an earlier analysis of the same problem. With --previous
+// the model is asked whether the new log shows it resolved, unchanged,
+// regressed or changed.
+type PreviousAnalysis struct {
+	Timestamp time.Time
+	RootCause string
+	Fix       string
+	Severity  string // Empty when the earlier analysis was recorded as text
+	Category  string // Empty when the earlier analysis was recorded as text
+}
+
+// FewShotExample is an example analysis shown to the model before the log
+type FewShotExample struct {
+	Log      string // Example log
+	Response string // JSON the model should answer Log with
+}
+
+// LineMap maps line numbers of a transformed log back to its input: entry i
+// is the 1-based input line that output line i+1 starts on, or 0 for lines que
+// inserted (e.g. omission markers). A nil LineMap means lines are unchanged.
+type LineMap []int
+
+// Original returns the input line for the 1-based output line n, or 0 if n
+// doesn't come from the input
+func (m LineMap) Original(n int) int {
+	if m == nil {
+		return n
+	}
+	if n < 1 || n > len(m) {
+		return 0
+	}
+	return m[n-1]
+}
+
+// Then returns the mapping for applying the transformation of m followed by
+// the one of next, i.e. from next's output lines to m's input lines
+func (m LineMap) Then(next LineMap) LineMap {
+	if m == nil {
+		return next
+	}
+	if next == nil {
+		return m
+	}
+	composed := make(LineMap, len(next))
+	for i, line := range next {
+		composed[i] = m.Original(line)
+	}
+	return composed
+}
+
+// Attachment is an extra file sent alongside the log (e.g. a config file)
+type Attachment struct {
+	Name      string // Label shown to the model, usually the file path
+	Content   string // Sanitized, size-capped file content
+	Truncated bool   // Whether Content was cut to fit the size cap
 }
 
 // Redactor interface allows swapping redaction strategies
@@ -42,6 +122,7 @@ type FindingDetail struct {
 	File        string
 	Tags        []string
 	Fingerprint string
+	Placeholder string // What the secret was replaced with
 }
 
 // EvidenceString can unmarshal from both a string or an array of strings
@@ -68,23 +149,296 @@ func (e *EvidenceString) UnmarshalJSON(data []byte) error {
 
 // LLMResponse represents the structured JSON response from the LLM
 type LLMResponse struct {
-	Status    string        `json:"status"` // "no_problem", "problem_detected", "insufficient_data"
-	RootCause string        `json:"root_cause"`
+	Status    string         `json:"status"`             // "no_problem", "problem_detected", "insufficient_data"
+	Severity  string         `json:"severity,omitempty"` // "critical", "high", "medium", "low", "info" (prompt v2+)
+	Category  string         `json:"category,omitempty"` // "network", "auth", "config", "resource", "dependency", "code-bug" (prompt v4+)
+	RootCause string         `json:"root_cause"`
 	Evidence  EvidenceString `json:"evidence"`
-	Fix       string        `json:"fix"`
+	Fix       string         `json:"fix"`
+	// EvidenceLines are the 1-based input lines the evidence quotes. They are
+	// located by que after parsing, not requested from the model.
+	EvidenceLines []int `json:"evidence_lines,omitempty"`
+	// FixSteps split a Fix holding several commands into ordered steps.
+	// They are parsed by que, not requested from the model.
+	FixSteps []FixStep `json:"fix_steps,omitempty"`
+	// DestructiveCommands are the lines of Fix that delete data or force
+	// changes. They are found by que, not requested from the model.
+	DestructiveCommands []DestructiveCommand `json:"destructive_commands,omitempty"`
+	// FixWarnings flag commands in Fix that won't work on the analyzed
+	// system as written. They are found by que, not requested from the model.
+	FixWarnings []string `json:"fix_warnings,omitempty"`
+	// Timeline lists the key events pulled from the log in order (prompt v3+)
+	Timeline []TimelineEvent `json:"timeline,omitempty"`
+	// Diagnostics are read-only commands the model suggests to gather more
+	// evidence when status is "insufficient_data" (prompt v5+)
+	Diagnostics []DiagnosticCommand `json:"diagnostics,omitempty"`
+	// Missing lists what the user should provide when status is
+	// "insufficient_data" (prompt v6+)
+	Missing []string `json:"missing,omitempty"`
+	// Comparison is "resolved", "unchanged", "regressed" or "changed" when the
+	// log was compared against a previous analysis (--previous)
+	Comparison string `json:"comparison,omitempty"`
+	// Diff compares the analysis field by field with the previous one. It is
+	// computed by que, not requested from the model.
+	Diff *AnalysisDiff `json:"diff,omitempty"`
+	// Metadata records how the analysis was produced. It is added by que.
+	Metadata *RunMetadata `json:"metadata,omitempty"`
+}
+
+// RunMetadata describes how an analysis was produced, so consumers of JSON
+// output can reason about its provenance
+type RunMetadata struct {
+	QueVersion    string `json:"que_version"`
+	PromptVersion string `json:"prompt_version"`
+	PromptDialect string `json:"prompt_dialect"`
+	Provider      string `json:"provider"`
+	Model         string `json:"model"`
+	DurationMS    int64  `json:"duration_ms"` // Time the model took to answer
+	// Token counts are estimated with an approximation of the model's tokenizer
+	EstimatedInputTokens  int  `json:"estimated_input_tokens"`
+	EstimatedOutputTokens int  `json:"estimated_output_tokens"`
+	Redactions            int  `json:"redactions"` // Secrets replaced with placeholders before sending
+	Truncated             bool `json:"truncated"`  // The input was cut to its head and tail
+	Summarized            bool `json:"summarized"` // Older log lines were summarized to fit the context window
+	// Usage is the token usage the provider reported, when it reports one
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// Usage is the token usage a provider reported for a query, as billed
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	// CacheReadTokens and CacheWriteTokens are the prompt tokens read from and
+	// written to the provider's prompt cache, included in PromptTokens
+	CacheReadTokens  int `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int `json:"cache_write_tokens,omitempty"`
+	// CostUSD is estimated from the model's list prices; nil if they are unknown
+	CostUSD *float64 `json:"estimated_cost_usd,omitempty"`
+}
+
+// AnalysisDiff is the structured difference between an analysis and the one
+// it was compared against, so scripts can flag disagreements
+type AnalysisDiff struct {
+	Agreement float64     `json:"agreement"` // Mean similarity of the compared fields, from 0 to 1
+	Differs   []string    `json:"differs"`   // Names of the fields that differ
+	Fields    []FieldDiff `json:"fields"`
+}
+
+// FieldDiff compares one field of two analyses
+type FieldDiff struct {
+	Field      string  `json:"field"`
+	Previous   string  `json:"previous"`
+	Current    string  `json:"current"`
+	Similarity float64 `json:"similarity"` // 1 for the same content, 0 for nothing in common
+}
+
+// TimelineEvent is one timestamped event of an LLMResponse timeline
+type TimelineEvent struct {
+	Time  string `json:"time"`  // Timestamp as written in the log
+	Event string `json:"event"` // What happened
+}
+
+// FixStep is one step of an LLMResponse fix
+type FixStep struct {
+	Description string `json:"description,omitempty"`
+	Command     string `json:"command,omitempty"` // Empty for a step the user carries out by hand
+}
+
+// DestructiveCommand is a fix command flagged as deleting data or forcing changes
+type DestructiveCommand struct {
+	Command string `json:"command"`
+	Reason  string `json:"reason"`
+}
+
+// DiagnosticCommand is a read-only command suggested in an LLMResponse
+type DiagnosticCommand struct {
+	Command string `json:"command"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// UnmarshalJSON also accepts a bare string, which some models return instead
+// of an object; it becomes the event with no separate time
+func (e *TimelineEvent) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*e = TimelineEvent{Event: str}
+		return nil
+	}
+
+	type plain TimelineEvent
+	return json.Unmarshal(data, (*plain)(e))
 }
 
 // Config holds CLI flags and environment variables
 type Config struct {
-	Provider        string // "openai" or "claude"
-	Model           string // Model override (optional)
-	Verbose         bool
-	NoContext       bool
-	DryRun          bool
-	Interactive     bool
-	ChatGPTKey      string
-	ClaudeKey       string
-	DefaultProvider string
+	Provider          string // "openai" or "claude"
+	Model             string // Model override (optional)
+	Verbose           bool
+	NoContext         bool
+	DryRun            bool
+	ShowPrompt        bool // Print the final prompt before querying
+	ShowPromptOnly    bool // Print the final prompt and exit without querying
+	Interactive       bool
+	Tee               bool     // Pass stdin through to stdout and print the analysis to stderr
+	Outputs           []string // --output sinks, e.g. ["terminal", "json-file=analysis.json"]
+	OutputFormat      string   // Format of the sink printing to stdout: "text", "markdown" or "json"
+	OutFile           string   // Write the analysis to this file instead of stdout (optional)
+	Postmortem        string   // Also write a postmortem skeleton to this file (optional)
+	ChatGPTKey        string
+	OpenAIBaseURL     string // OpenAI-compatible API to use instead of api.openai.com (optional)
+	ClaudeKey         string
+	AzureKey          string
+	DefaultProvider   string
+	LogLevel          string // Diagnostic log level (trace, debug, info, warn, error, disabled)
+	LogFile           string // Optional file receiving debug-level diagnostic logs
+	PromptVersion     string // Pinned prompt template version (empty means current)
+	PromptDialect     string // Prompt layout: "auto" (or empty), "plain", "xml", "json" or "compact"
+	FewShot           string // When to include example analyses: "auto" (or empty), "always" or "never"
+	FewShotFile       string // File to read FewShotExamples from (optional)
+	ModelsFile        string // JSON file of model aliases and deprecations extending the built-in list (optional)
+	CACert            string // PEM file of root CAs to trust besides the system's, e.g. a corporate proxy's (optional)
+	Session           string // Named session to record history and context under (optional)
+	SystemPromptFile  string // File to read SystemPrompt from (optional)
+	SystemPrompt      string // Replaces the built-in system prompt for the initial analysis (optional)
+	NoSchema          bool   // Don't ask for the JSON response schema; show the model's answer as-is
+	Investigate       bool   // Let the model request approved read-only commands before the final diagnosis
+	InvestigateRounds int    // Maximum number of command rounds for Investigate
+	Commands          CommandPolicy
+	Azure             AzureConfig
+	Email             EmailConfig
+	Tracing           TracingConfig
+	Notify            []string            // Extra notification sinks (--notify), e.g. ["webhook=https://..."]
+	WebhookSecret     string              // HMAC key for signing generic webhook payloads (optional)
+	Routes            map[string][]string // Severity ("critical", ..., "default") to --output entries
+	RedactionStats    bool                // Print how often each redaction rule fired at the end of the run
+	RedactionTemplate string              // Placeholder replacing each secret, with {type}, {rule} and {n} tokens
+	Retries           int                 // Retries of an API request after a server or network error
+	Timeout           time.Duration       // Time limit of an API request, including its retries (0 for none)
+	MaxTokens         int                 // Most tokens the model may answer with (0 for the client's default)
+	Temperature       *float64            // Sampling temperature (nil for the provider's default)
+	RetryBackoff      time.Duration       // Pause before the first retry, doubling on each one (zero means the default)
+	RateLimitBudget   time.Duration       // Total wait for rate limits (429) per API request before failing
+	HealthCheck       bool                // Ping the provider concurrently with ingestion and fail before querying if it's unusable
+	Paranoid          bool                // Persist nothing: no sessions, diagnostic log file, audit log or batch state
+	SmartRouting      bool                // Ask TriageModel first and only query Model when it finds a problem
+	TriageModel       string              // Cheap first-pass model for SmartRouting (empty means the provider's default)
+	StripOnFilter     bool                // Retry content filter refusals with only the log's error lines, without asking
+	ContextWindows    map[string]int      // Model name prefix to context window in tokens, extending the built-in table
+	PromptDialects    map[string]string   // Model name prefix to prompt dialect, overriding the automatic choice
+	FewShotExamples   []FewShotExample    // Replace the prompt version's built-in examples (optional)
+	UI                UIConfig
+}
+
+// UIConfig controls terminal decorations for terminals and log collectors that can't handle them
+type UIConfig struct {
+	NoHeader bool   // Skip the "[ Que? ]" banner
+	NoEmoji  bool   // Replace emoji with plain text
+	Spinner  string // Spinner style: "dots" (default), "line", "arrows", or "none"
+	// Theme selects severity colors and symbols: "default" or "high-contrast"
+	Theme string
+	// SeverityColors overrides the theme color per severity, e.g. {"high": "bold magenta"}
+	SeverityColors map[string]string
+	// ScreenReader disables colors, emoji and spinners and spells out severities
+	ScreenReader bool
+	// Quiet hides progress stages and spinners
+	Quiet bool
+	// UTC shows timestamps in UTC instead of the local time zone
+	UTC bool
+	// Progress is "auto" (stages and spinners on a terminal) or "json" (JSON
+	// lines on stderr for wrappers); empty means auto
+	Progress string
+}
+
+// Location returns the time zone timestamps are shown in
+func (ui UIConfig) Location() *time.Location {
+	if ui.UTC {
+		return time.UTC
+	}
+	return time.Local
+}
+
+// CommandPolicy restricts which commands agentic modes such as --investigate may run
+type CommandPolicy struct {
+	Allow    []string // Regexps for allowed command lines; empty means the built-in read-only list
+	Deny     []string // Regexps for forbidden command lines, added to the built-in ones
+	AuditLog string   // Where command decisions are recorded (empty means the default state dir)
+}
+
+// AzureConfig locates an Azure OpenAI deployment for the "azure" provider
+type AzureConfig struct {
+	Endpoint   string // Resource endpoint, e.g. https://my-resource.openai.azure.com
+	APIVersion string // REST API version (empty means the client's default)
+	Deployment string // Deployment queried unless --model names another one
+}
+
+// EmailConfig is the mail server and recipients of the "email" sink
+type EmailConfig struct {
+	Host     string   // SMTP server
+	Port     int      // SMTP port (0 means 587; 465 uses implicit TLS)
+	Username string   // SMTP login, without one the server is used unauthenticated
+	From     string   // Sender address (empty means Username, or que@ the host name)
+	To       []string // Recipients unless the sink names one
+	Format   string   // "html" (the default) or "markdown"
+}
+
+// TracingConfig is where the OpenTelemetry spans of long-running modes such
+// as batch are exported to
+type TracingConfig struct {
+	Endpoint string            // OTLP/HTTP traces URL, e.g. http://localhost:4318/v1/traces (empty disables tracing)
+	Headers  map[string]string // Extra request headers, e.g. an API key of the collector
+}
+
+// OTLPTracesURL returns the traces URL of the OTLP/HTTP collector at base,
+// as OTEL_EXPORTER_OTLP_ENDPOINT is interpreted
+func OTLPTracesURL(base string) string {
+	return strings.TrimSuffix(base, "/") + "/v1/traces"
+}
+
+// ParseOTLPHeaders parses headers in the OTEL_EXPORTER_OTLP_HEADERS format:
+// comma-separated key=value pairs with URL-encoded values
+func ParseOTLPHeaders(value string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid OTLP header %q (want key=value)", pair)
+		}
+		decoded, err := url.QueryUnescape(strings.TrimSpace(val))
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTLP header %q: %w", key, err)
+		}
+		headers[key] = decoded
+	}
+	return headers, nil
+}
+
+// DefaultRedactionTemplate is the template for the placeholders that replace
+// secrets: {type} is the kind of secret, e.g. AWS_ACCESS_KEY
+const DefaultRedactionTemplate = "<REDACTED_{type}>"
+
+// DefaultRateLimitBudget is how long an API request may wait for a provider's
+// rate limit to pass unless configured otherwise
+const DefaultRateLimitBudget = time.Minute
+
+// DefaultTimeout is how long an API request may take, including its retries,
+// unless configured otherwise. Long logs and slow local models need minutes.
+const DefaultTimeout = 5 * time.Minute
+
+// DefaultRetries is how many times a failed API request is retried unless configured otherwise
+const DefaultRetries = 2
+
+// ParseTemperature parses a sampling temperature, which providers accept
+// between 0 and 2 (Anthropic up to 1)
+func ParseTemperature(value string) (float64, error) {
+	temperature, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || temperature < 0 || temperature > 2 {
+		return 0, fmt.Errorf("want a number from 0 to 2, got %q", value)
+	}
+	return temperature, nil
 }
 
 // NewConfig creates a new Config with defaults
@@ -92,5 +446,42 @@ func NewConfig() *Config {
 	return &Config{
 		Provider:        "openai",
 		DefaultProvider: "openai",
+		Retries:         DefaultRetries,
+		Timeout:         DefaultTimeout,
+
+		RedactionTemplate: DefaultRedactionTemplate,
+		RateLimitBudget:   DefaultRateLimitBudget,
+	}
+}
+
+// LoadKeys reads the API keys from the environment, where they are kept
+// rather than in the config file
+func (c *Config) LoadKeys() {
+	c.ChatGPTKey = os.Getenv("QUE_CHATGPT_API_KEY")
+	c.ClaudeKey = os.Getenv("QUE_CLAUDE_API_KEY")
+	c.AzureKey = os.Getenv("QUE_AZURE_OPENAI_API_KEY")
+}
+
+// DropKeys forgets the API keys once the LLM clients hold them, so copies of
+// the config (triage, per-file batch settings) don't carry them around.
+// Clients created later, such as by /provider in a conversation, call LoadKeys.
+func (c *Config) DropKeys() {
+	c.ChatGPTKey = ""
+	c.ClaudeKey = ""
+	c.AzureKey = ""
+}
+
+// CommandEnv returns environ without que's credentials (QUE_ variables whose
+// name contains KEY, SECRET, TOKEN or PASSWORD), for commands que runs on the
+// user's behalf: they have no business with the API keys
+func CommandEnv(environ []string) []string {
+	var env []string
+	for _, entry := range environ {
+		name, _, _ := strings.Cut(entry, "=")
+		if strings.HasPrefix(name, "QUE_") && (strings.Contains(name, "KEY") || strings.Contains(name, "SECRET") || strings.Contains(name, "TOKEN") || strings.Contains(name, "PASSWORD")) {
+			continue
+		}
+		env = append(env, entry)
 	}
+	return env
 }
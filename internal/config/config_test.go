@@ -0,0 +1,68 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLineMap(t *testing.T) {
+	// Redaction collapsed input lines 2-3; summarization then dropped output
+	// line 1 in favor of a marker
+	redaction := LineMap{1, 2, 4, 5}
+	summary := LineMap{0, 2, 3, 4}
+
+	composed := redaction.Then(summary)
+	want := []int{0, 2, 4, 5}
+	for i, w := range want {
+		if got := composed.Original(i + 1); got != w {
+			t.Errorf("Original(%d) = %d, want %d", i+1, got, w)
+		}
+	}
+
+	if got := composed.Original(9); got != 0 {
+		t.Errorf("Original(9) = %d, want 0 for lines past the end", got)
+	}
+
+	var identity LineMap
+	if got := identity.Original(7); got != 7 {
+		t.Errorf("nil LineMap Original(7) = %d, want 7", got)
+	}
+	if got := identity.Then(summary); len(got) != len(summary) || got[1] != 2 {
+		t.Errorf("nil.Then(summary) = %v, want %v", got, summary)
+	}
+	if got := redaction.Then(nil); len(got) != len(redaction) {
+		t.Errorf("redaction.Then(nil) = %v, want %v", got, redaction)
+	}
+}
+
+func TestCommandEnv(t *testing.T) {
+	env := CommandEnv([]string{
+		"PATH=/usr/bin",
+		"QUE_CLAUDE_API_KEY=sk-ant-123",
+		"QUE_WEBHOOK_SECRET=s3cret",
+		"QUE_PAGERDUTY_ROUTING_KEY=abc",
+		"QUE_SMTP_PASSWORD=hunter2",
+		"QUE_THEME=dark",
+		"KUBECONFIG=/home/me/.kube/config",
+	})
+	want := []string{"PATH=/usr/bin", "QUE_THEME=dark", "KUBECONFIG=/home/me/.kube/config"}
+	if strings.Join(env, "\n") != strings.Join(want, "\n") {
+		t.Errorf("CommandEnv() = %q, want %q", env, want)
+	}
+}
+
+func TestParseOTLPHeaders(t *testing.T) {
+	headers, err := ParseOTLPHeaders("x-honeycomb-team=abc123, Authorization=Basic%20dXNlcg==,")
+	if err != nil {
+		t.Fatalf("ParseOTLPHeaders() error = %v", err)
+	}
+	want := map[string]string{"x-honeycomb-team": "abc123", "Authorization": "Basic dXNlcg=="}
+	if !reflect.DeepEqual(headers, want) {
+		t.Errorf("ParseOTLPHeaders() = %v, want %v", headers, want)
+	}
+
+	if _, err := ParseOTLPHeaders("no-value"); err == nil {
+		t.Error("ParseOTLPHeaders() should reject a header without a value")
+	}
+}
@@ -0,0 +1,268 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// DefaultConfigPath returns the location of the optional config file.
+// QUE_CONFIG overrides it; otherwise $XDG_CONFIG_HOME/que/config.yaml
+// (falling back to ~/.config/que/config.yaml) is used.
+func DefaultConfigPath() string {
+	if path := os.Getenv("QUE_CONFIG"); path != "" {
+		return path
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "que", "config.yaml")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "que", "config.yaml")
+}
+
+// DefaultStateDir returns the directory que keeps persistent state in:
+// $XDG_STATE_HOME/que, falling back to ~/.local/state/que
+func DefaultStateDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "que")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "state", "que")
+}
+
+// LoadFile applies settings from the YAML config file at path to cfg.
+// A missing file is not an error. Values from the file are overridden by
+// environment variables and CLI flags, which are applied afterwards.
+func LoadFile(cfg *Config, path string) error {
+	if path == "" {
+		return nil
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	// Use a private viper instance so the sanitizer's gitleaks parsing can't clobber it
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	if v.IsSet("default_provider") {
+		cfg.DefaultProvider = v.GetString("default_provider")
+	}
+	if v.IsSet("system_prompt_file") {
+		cfg.SystemPromptFile = v.GetString("system_prompt_file")
+	}
+	if v.IsSet("enforce_schema") {
+		cfg.NoSchema = !v.GetBool("enforce_schema")
+	}
+	if v.IsSet("commands.allow") {
+		cfg.Commands.Allow = v.GetStringSlice("commands.allow")
+	}
+	if v.IsSet("commands.deny") {
+		cfg.Commands.Deny = v.GetStringSlice("commands.deny")
+	}
+	if v.IsSet("commands.audit_log") {
+		cfg.Commands.AuditLog = v.GetString("commands.audit_log")
+	}
+	if v.IsSet("openai.base_url") {
+		cfg.OpenAIBaseURL = v.GetString("openai.base_url")
+	}
+	if v.IsSet("azure.endpoint") {
+		cfg.Azure.Endpoint = v.GetString("azure.endpoint")
+	}
+	if v.IsSet("azure.api_version") {
+		// An unquoted 2024-06-01 is a YAML timestamp, not a string
+		if date, ok := v.Get("azure.api_version").(time.Time); ok {
+			cfg.Azure.APIVersion = date.Format(time.DateOnly)
+		} else {
+			cfg.Azure.APIVersion = v.GetString("azure.api_version")
+		}
+	}
+	if v.IsSet("azure.deployment") {
+		cfg.Azure.Deployment = v.GetString("azure.deployment")
+	}
+	if v.IsSet("email.host") {
+		cfg.Email.Host = v.GetString("email.host")
+	}
+	if v.IsSet("email.port") {
+		port, err := strconv.Atoi(fmt.Sprint(v.Get("email.port")))
+		if err != nil || port <= 0 || port > 65535 {
+			return fmt.Errorf("email.port: want a port number, got %v", v.Get("email.port"))
+		}
+		cfg.Email.Port = port
+	}
+	if v.IsSet("email.username") {
+		cfg.Email.Username = v.GetString("email.username")
+	}
+	if v.IsSet("email.from") {
+		cfg.Email.From = v.GetString("email.from")
+	}
+	if v.IsSet("email.to") {
+		// Accept both YAML lists and "a@example.com,b@example.com" strings
+		cfg.Email.To = nil
+		for _, to := range v.GetStringSlice("email.to") {
+			cfg.Email.To = append(cfg.Email.To, strings.Split(to, ",")...)
+		}
+	}
+	if v.IsSet("email.format") {
+		cfg.Email.Format = v.GetString("email.format")
+	}
+	if v.IsSet("tracing.endpoint") {
+		cfg.Tracing.Endpoint = OTLPTracesURL(v.GetString("tracing.endpoint"))
+	}
+	if v.IsSet("tracing.headers") {
+		cfg.Tracing.Headers = v.GetStringMapString("tracing.headers")
+	}
+	if v.IsSet("webhook.secret") {
+		cfg.WebhookSecret = v.GetString("webhook.secret")
+	}
+	if v.IsSet("smart_routing") {
+		cfg.SmartRouting = v.GetBool("smart_routing")
+	}
+	if v.IsSet("triage_model") {
+		cfg.TriageModel = v.GetString("triage_model")
+	}
+	if v.IsSet("strip_on_filter") {
+		cfg.StripOnFilter = v.GetBool("strip_on_filter")
+	}
+	if v.IsSet("context_windows") {
+		// Read the raw map: model names like "gpt-4.1" contain viper's key delimiter
+		cfg.ContextWindows = make(map[string]int)
+		for model, value := range v.GetStringMap("context_windows") {
+			tokens, err := strconv.Atoi(fmt.Sprint(value))
+			if err != nil || tokens <= 0 {
+				return fmt.Errorf("context_windows.%s: want a positive number of tokens, got %v", model, value)
+			}
+			cfg.ContextWindows[model] = tokens
+		}
+	}
+	if v.IsSet("prompt_dialect") {
+		cfg.PromptDialect = v.GetString("prompt_dialect")
+	}
+	if v.IsSet("prompt_dialects") {
+		// Read the raw map for the same reason as context_windows
+		cfg.PromptDialects = make(map[string]string)
+		for model, value := range v.GetStringMap("prompt_dialects") {
+			cfg.PromptDialects[model] = fmt.Sprint(value)
+		}
+	}
+	if v.IsSet("few_shot") {
+		cfg.FewShot = v.GetString("few_shot")
+	}
+	if v.IsSet("few_shot_file") {
+		cfg.FewShotFile = v.GetString("few_shot_file")
+	}
+	if v.IsSet("models_file") {
+		cfg.ModelsFile = v.GetString("models_file")
+	}
+	if v.IsSet("ca_cert") {
+		cfg.CACert = v.GetString("ca_cert")
+	}
+	if v.IsSet("retries") {
+		retries, err := strconv.Atoi(fmt.Sprint(v.Get("retries")))
+		if err != nil || retries < 0 {
+			return fmt.Errorf("retries: want a number of retries, got %v", v.Get("retries"))
+		}
+		cfg.Retries = retries
+	}
+	if v.IsSet("retry_backoff") {
+		backoff, err := time.ParseDuration(v.GetString("retry_backoff"))
+		if err != nil || backoff <= 0 {
+			return fmt.Errorf("retry_backoff: want a duration such as 2s, got %v", v.Get("retry_backoff"))
+		}
+		cfg.RetryBackoff = backoff
+	}
+	if v.IsSet("timeout") {
+		timeout, err := time.ParseDuration(v.GetString("timeout"))
+		if err != nil || timeout < 0 {
+			return fmt.Errorf("timeout: want a duration such as 5m, got %v", v.Get("timeout"))
+		}
+		cfg.Timeout = timeout
+	}
+	if v.IsSet("max_tokens") {
+		maxTokens, err := strconv.Atoi(fmt.Sprint(v.Get("max_tokens")))
+		if err != nil || maxTokens <= 0 {
+			return fmt.Errorf("max_tokens: want a positive number of tokens, got %v", v.Get("max_tokens"))
+		}
+		cfg.MaxTokens = maxTokens
+	}
+	if v.IsSet("temperature") {
+		temperature, err := ParseTemperature(fmt.Sprint(v.Get("temperature")))
+		if err != nil {
+			return fmt.Errorf("temperature: %w", err)
+		}
+		cfg.Temperature = &temperature
+	}
+	if v.IsSet("rate_limit_budget") {
+		budget, err := time.ParseDuration(v.GetString("rate_limit_budget"))
+		if err != nil || budget < 0 {
+			return fmt.Errorf("rate_limit_budget: want a duration such as 2m, got %v", v.Get("rate_limit_budget"))
+		}
+		cfg.RateLimitBudget = budget
+	}
+	if v.IsSet("health_check") {
+		cfg.HealthCheck = v.GetBool("health_check")
+	}
+	if v.IsSet("redaction_stats") {
+		cfg.RedactionStats = v.GetBool("redaction_stats")
+	}
+	if v.IsSet("redaction_placeholder") {
+		cfg.RedactionTemplate = v.GetString("redaction_placeholder")
+	}
+	if v.IsSet("paranoid") {
+		cfg.Paranoid = v.GetBool("paranoid")
+	}
+	if v.IsSet("routes") {
+		cfg.Routes = make(map[string][]string)
+		for severity, outputs := range v.GetStringMapStringSlice("routes") {
+			// Accept both YAML lists and "slack,json-file" strings
+			for _, output := range outputs {
+				cfg.Routes[severity] = append(cfg.Routes[severity], strings.Split(output, ",")...)
+			}
+		}
+	}
+	if v.IsSet("ui.header") {
+		cfg.UI.NoHeader = !v.GetBool("ui.header")
+	}
+	if v.IsSet("ui.emoji") {
+		cfg.UI.NoEmoji = !v.GetBool("ui.emoji")
+	}
+	if v.IsSet("ui.spinner") {
+		cfg.UI.Spinner = v.GetString("ui.spinner")
+	}
+	if v.IsSet("ui.theme") {
+		cfg.UI.Theme = v.GetString("ui.theme")
+	}
+	if v.IsSet("ui.severity_colors") {
+		cfg.UI.SeverityColors = v.GetStringMapString("ui.severity_colors")
+	}
+	if v.IsSet("ui.screen_reader") {
+		cfg.UI.ScreenReader = v.GetBool("ui.screen_reader")
+	}
+	if v.IsSet("ui.quiet") {
+		cfg.UI.Quiet = v.GetBool("ui.quiet")
+	}
+	if v.IsSet("ui.progress") {
+		cfg.UI.Progress = v.GetString("ui.progress")
+	}
+	if v.IsSet("ui.utc") {
+		cfg.UI.UTC = v.GetBool("ui.utc")
+	}
+
+	return nil
+}
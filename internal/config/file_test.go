@@ -0,0 +1,338 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadFile_MissingFile(t *testing.T) {
+	cfg := NewConfig()
+	if err := LoadFile(cfg, filepath.Join(t.TempDir(), "missing.yaml")); err != nil {
+		t.Errorf("LoadFile() error = %v, want nil for missing file", err)
+	}
+}
+
+func TestLoadFile_UISettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "default_provider: claude\nui:\n  header: false\n  emoji: false\n  spinner: none\n  quiet: true\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg := NewConfig()
+	if err := LoadFile(cfg, path); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	if cfg.DefaultProvider != "claude" {
+		t.Errorf("DefaultProvider = %q, want %q", cfg.DefaultProvider, "claude")
+	}
+	if !cfg.UI.NoHeader {
+		t.Error("UI.NoHeader = false, want true")
+	}
+	if !cfg.UI.Quiet {
+		t.Error("UI.Quiet = false, want true")
+	}
+	if !cfg.UI.NoEmoji {
+		t.Error("UI.NoEmoji = false, want true")
+	}
+	if cfg.UI.Spinner != "none" {
+		t.Errorf("UI.Spinner = %q, want %q", cfg.UI.Spinner, "none")
+	}
+}
+
+func TestLoadFile_InvalidYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("ui: [unterminated"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if err := LoadFile(NewConfig(), path); err == nil {
+		t.Error("LoadFile() should fail for invalid YAML")
+	}
+}
+
+func TestLoadFile_ThemeSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "ui:\n  theme: high-contrast\n  screen_reader: true\n  severity_colors:\n    critical: bold red\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg := NewConfig()
+	if err := LoadFile(cfg, path); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	if cfg.UI.Theme != "high-contrast" {
+		t.Errorf("UI.Theme = %q, want %q", cfg.UI.Theme, "high-contrast")
+	}
+	if !cfg.UI.ScreenReader {
+		t.Error("UI.ScreenReader = false, want true")
+	}
+	if got := cfg.UI.SeverityColors["critical"]; got != "bold red" {
+		t.Errorf("UI.SeverityColors[critical] = %q, want %q", got, "bold red")
+	}
+}
+
+func TestLoadFile_SystemPrompt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "system_prompt_file: /etc/que/sre-prompt.txt\nenforce_schema: false\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg := NewConfig()
+	if err := LoadFile(cfg, path); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	if cfg.SystemPromptFile != "/etc/que/sre-prompt.txt" {
+		t.Errorf("SystemPromptFile = %q, want %q", cfg.SystemPromptFile, "/etc/que/sre-prompt.txt")
+	}
+	if !cfg.NoSchema {
+		t.Error("NoSchema = false, want true")
+	}
+}
+
+func TestLoadFile_SmartRouting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "smart_routing: true\ntriage_model: gpt-4.1-nano\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg := NewConfig()
+	if err := LoadFile(cfg, path); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	if !cfg.SmartRouting {
+		t.Error("SmartRouting = false, want true")
+	}
+	if cfg.TriageModel != "gpt-4.1-nano" {
+		t.Errorf("TriageModel = %q, want %q", cfg.TriageModel, "gpt-4.1-nano")
+	}
+}
+
+func TestLoadFile_Azure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "azure:\n  endpoint: https://corp.openai.azure.com\n  api_version: 2024-10-21\n  deployment: prod-gpt-4.1\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg := NewConfig()
+	if err := LoadFile(cfg, path); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	want := AzureConfig{Endpoint: "https://corp.openai.azure.com", APIVersion: "2024-10-21", Deployment: "prod-gpt-4.1"}
+	if cfg.Azure != want {
+		t.Errorf("Azure = %+v, want %+v", cfg.Azure, want)
+	}
+}
+
+func TestLoadFile_Email(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "email:\n  host: smtp.example.com\n  port: 465\n  username: alerts@example.com\n  to: [oncall@example.com, sre@example.com]\n  format: markdown\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg := NewConfig()
+	if err := LoadFile(cfg, path); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	want := EmailConfig{Host: "smtp.example.com", Port: 465, Username: "alerts@example.com", To: []string{"oncall@example.com", "sre@example.com"}, Format: "markdown"}
+	if !reflect.DeepEqual(cfg.Email, want) {
+		t.Errorf("Email = %+v, want %+v", cfg.Email, want)
+	}
+
+	if err := os.WriteFile(path, []byte("email:\n  port: smtp\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if err := LoadFile(NewConfig(), path); err == nil {
+		t.Error("LoadFile() should reject a port that isn't a number")
+	}
+}
+
+func TestLoadFile_Tracing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "tracing:\n  endpoint: http://collector:4318/\n  headers:\n    x-api-key: secret\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg := NewConfig()
+	if err := LoadFile(cfg, path); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	want := TracingConfig{Endpoint: "http://collector:4318/v1/traces", Headers: map[string]string{"x-api-key": "secret"}}
+	if !reflect.DeepEqual(cfg.Tracing, want) {
+		t.Errorf("Tracing = %+v, want %+v", cfg.Tracing, want)
+	}
+}
+
+func TestLoadFile_Retries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("retries: 0\nretry_backoff: 2s\nrate_limit_budget: 5m\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg := NewConfig()
+	if err := LoadFile(cfg, path); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if cfg.Retries != 0 || cfg.RetryBackoff != 2*time.Second || cfg.RateLimitBudget != 5*time.Minute {
+		t.Errorf("Retries = %d, RetryBackoff = %v, RateLimitBudget = %v, want 0, 2s and 5m", cfg.Retries, cfg.RetryBackoff, cfg.RateLimitBudget)
+	}
+
+	if err := os.WriteFile(path, []byte("retries: -1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if err := LoadFile(NewConfig(), path); err == nil {
+		t.Error("LoadFile() should reject negative retries")
+	}
+}
+
+func TestLoadFile_RequestSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("timeout: 10m\nmax_tokens: 8192\ntemperature: 0\nca_cert: /etc/ssl/corp-root-ca.pem\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg := NewConfig()
+	if err := LoadFile(cfg, path); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if cfg.Timeout != 10*time.Minute || cfg.MaxTokens != 8192 {
+		t.Errorf("Timeout = %v, MaxTokens = %d, want 10m and 8192", cfg.Timeout, cfg.MaxTokens)
+	}
+	if cfg.Temperature == nil || *cfg.Temperature != 0 {
+		t.Errorf("Temperature = %v, want 0", cfg.Temperature)
+	}
+	if cfg.CACert != "/etc/ssl/corp-root-ca.pem" {
+		t.Errorf("CACert = %q, want /etc/ssl/corp-root-ca.pem", cfg.CACert)
+	}
+
+	if err := os.WriteFile(path, []byte("temperature: 3\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if err := LoadFile(NewConfig(), path); err == nil {
+		t.Error("LoadFile() should reject a temperature above 2")
+	}
+}
+
+func TestLoadFile_RedactionPlaceholder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("redaction_placeholder: \"[REDACTED:{type}:{n}]\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg := NewConfig()
+	if cfg.RedactionTemplate != DefaultRedactionTemplate {
+		t.Errorf("RedactionTemplate = %q before loading, want the default", cfg.RedactionTemplate)
+	}
+	if err := LoadFile(cfg, path); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if cfg.RedactionTemplate != "[REDACTED:{type}:{n}]" {
+		t.Errorf("RedactionTemplate = %q, want [REDACTED:{type}:{n}]", cfg.RedactionTemplate)
+	}
+}
+
+func TestLoadFile_ContextWindows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "context_windows:\n  llama3: 8192\n  gpt-4.1-mini: 1047576\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg := NewConfig()
+	if err := LoadFile(cfg, path); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if cfg.ContextWindows["llama3"] != 8192 || cfg.ContextWindows["gpt-4.1-mini"] != 1047576 {
+		t.Errorf("ContextWindows = %v", cfg.ContextWindows)
+	}
+
+	if err := os.WriteFile(path, []byte("context_windows:\n  llama3: big\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if err := LoadFile(NewConfig(), path); err == nil {
+		t.Error("LoadFile() should reject a non-numeric context window")
+	}
+}
+
+func TestLoadFile_PromptDialects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "prompt_dialect: auto\nprompt_dialects:\n  llama3.1: compact\n  gpt-4o: plain\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg := NewConfig()
+	if err := LoadFile(cfg, path); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if cfg.PromptDialect != "auto" {
+		t.Errorf("PromptDialect = %q, want auto", cfg.PromptDialect)
+	}
+	if cfg.PromptDialects["llama3.1"] != "compact" || cfg.PromptDialects["gpt-4o"] != "plain" {
+		t.Errorf("PromptDialects = %v", cfg.PromptDialects)
+	}
+}
+
+func TestLoadFile_CommandPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "commands:\n  allow:\n    - kubectl get .*\n  deny:\n    - .*kube-system.*\n  audit_log: /tmp/audit.log\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg := NewConfig()
+	if err := LoadFile(cfg, path); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	if len(cfg.Commands.Allow) != 1 || cfg.Commands.Allow[0] != "kubectl get .*" {
+		t.Errorf("Commands.Allow = %q", cfg.Commands.Allow)
+	}
+	if len(cfg.Commands.Deny) != 1 || cfg.Commands.Deny[0] != ".*kube-system.*" {
+		t.Errorf("Commands.Deny = %q", cfg.Commands.Deny)
+	}
+	if cfg.Commands.AuditLog != "/tmp/audit.log" {
+		t.Errorf("Commands.AuditLog = %q, want %q", cfg.Commands.AuditLog, "/tmp/audit.log")
+	}
+}
+
+func TestLoadFile_Routes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "routes:\n  critical:\n    - pagerduty\n    - slack\n  high: slack,json-file\n  category:auth: pagerduty\n  default: text\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg := NewConfig()
+	if err := LoadFile(cfg, path); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	want := map[string]string{
+		"critical":      "pagerduty slack",
+		"high":          "slack json-file",
+		"category:auth": "pagerduty",
+		"default":       "text",
+	}
+	for severity, outputs := range want {
+		if got := strings.Join(cfg.Routes[severity], " "); got != outputs {
+			t.Errorf("Routes[%s] = %q, want %q", severity, got, outputs)
+		}
+	}
+}
@@ -1,16 +1,17 @@
 package enricher
 
 import (
-	"os"
-	"os/exec"
-	"path/filepath"
 	"runtime"
-	"strings"
 	"time"
 
 	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/proc"
 )
 
+// probeLimits bound every command run to gather context, so a hung probe
+// can't stall the analysis
+var probeLimits = proc.Limits{Timeout: 2 * time.Second, MaxOutput: 4 * 1024}
+
 // Enrich gathers system context information
 func Enrich() config.Context {
 	ctx := config.Context{
@@ -19,37 +20,7 @@ func Enrich() config.Context {
 		Timestamp: time.Now(),
 	}
 
-	// Get shell from environment variable
-	if shell := os.Getenv("SHELL"); shell != "" {
-		ctx.Shell = filepath.Base(shell)
-	} else {
-		// Try to detect shell from ps command
-		ctx.Shell = detectShell()
-	}
+	ctx.Shell = detectShell()
 
 	return ctx
 }
-
-// detectShell attempts to detect the current shell by checking the parent process
-func detectShell() string {
-	// Try common shell detection methods
-	if shell := os.Getenv("SHELL"); shell != "" {
-		return filepath.Base(shell)
-	}
-
-	// Try to get shell from ps command (Unix-like systems)
-	if runtime.GOOS != "windows" {
-		cmd := exec.Command("ps", "-p", "$$", "-o", "comm=")
-		output, err := cmd.Output()
-		if err == nil {
-			shell := strings.TrimSpace(string(output))
-			if shell != "" {
-				return shell
-			}
-		}
-	}
-
-	// Fallback
-	return "unknown"
-}
-
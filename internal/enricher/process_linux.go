@@ -0,0 +1,34 @@
+//go:build linux
+
+package enricher
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// parentProcess reads the parent and name of pid from /proc/PID/stat
+func parentProcess(pid int) (int, string, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, "", err
+	}
+	// The format is "PID (NAME) STATE PPID ...", and NAME may itself contain
+	// spaces and parentheses, so it runs to the last ")"
+	stat := string(data)
+	open, end := strings.IndexByte(stat, '('), strings.LastIndexByte(stat, ')')
+	if open < 0 || end < open {
+		return 0, "", fmt.Errorf("unexpected /proc/%d/stat format", pid)
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 2 {
+		return 0, "", fmt.Errorf("unexpected /proc/%d/stat format", pid)
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, "", fmt.Errorf("unexpected /proc/%d/stat format: %w", pid, err)
+	}
+	return ppid, stat[open+1 : end], nil
+}
@@ -0,0 +1,21 @@
+//go:build linux
+
+package enricher
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParentProcess(t *testing.T) {
+	ppid, name, err := parentProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("parentProcess() error = %v", err)
+	}
+	if ppid != os.Getppid() {
+		t.Errorf("parentProcess() ppid = %d, want %d", ppid, os.Getppid())
+	}
+	if name == "" {
+		t.Error("parentProcess() should return the process name")
+	}
+}
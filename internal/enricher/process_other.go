@@ -0,0 +1,29 @@
+//go:build !linux && !windows
+
+package enricher
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jenian/que/internal/proc"
+)
+
+// parentProcess asks ps for the parent and name of pid (macOS, BSDs)
+func parentProcess(pid int) (int, string, error) {
+	output, err := proc.Output(context.Background(), probeLimits, "ps", "-o", "ppid=", "-o", "comm=", "-p", strconv.Itoa(pid))
+	if err != nil {
+		return 0, "", err
+	}
+	ppidField, name, found := strings.Cut(strings.TrimSpace(output), " ")
+	if !found {
+		return 0, "", fmt.Errorf("unexpected ps output %q", output)
+	}
+	ppid, err := strconv.Atoi(ppidField)
+	if err != nil {
+		return 0, "", fmt.Errorf("unexpected ps output %q", output)
+	}
+	return ppid, strings.TrimSpace(name), nil
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+package enricher
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// parentProcess looks up the parent and executable name of pid in a
+// snapshot of the running processes
+func parentProcess(pid int) (int, string, error) {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return 0, "", err
+	}
+	defer windows.CloseHandle(snapshot)
+
+	var entry windows.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	for err = windows.Process32First(snapshot, &entry); err == nil; err = windows.Process32Next(snapshot, &entry) {
+		if int(entry.ProcessID) == pid {
+			return int(entry.ParentProcessID), windows.UTF16ToString(entry.ExeFile[:]), nil
+		}
+	}
+	return 0, "", fmt.Errorf("process %d not found", pid)
+}
@@ -0,0 +1,116 @@
+package enricher
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/proc"
+)
+
+// maxTracebackModules caps the packages looked up with pip show
+const maxTracebackModules = 10
+
+// pipLimits bound pip show, which is slower than the other probes and prints
+// whole license texts for some packages
+var pipLimits = proc.Limits{Timeout: 10 * time.Second, MaxOutput: 64 * 1024}
+
+var (
+	// tracebackFrame matches the file of a traceback frame installed as a
+	// package, capturing the top-level module after site-packages
+	tracebackFrame = regexp.MustCompile(`File "[^"]*[/\\](?:site|dist)-packages[/\\]([A-Za-z_][\w]*)`)
+	// missingModule matches the module of an import error, capturing its top level
+	missingModule = regexp.MustCompile(`(?:No module named|cannot import name '\w+' from) '([A-Za-z_]\w*)`)
+)
+
+// pythonContext describes the Python environment a traceback came from: the
+// interpreter on PATH and its version, the active virtualenv or conda
+// environment and the installed versions of the packages in the traceback
+func pythonContext(ctx context.Context, log string) config.Attachment {
+	interpreter := ""
+	for _, name := range []string{"python3", "python"} {
+		if path, err := exec.LookPath(name); err == nil {
+			interpreter = path
+			break
+		}
+	}
+
+	var lines []string
+	if interpreter == "" {
+		lines = append(lines, "Interpreter: no python3 or python on PATH")
+	} else {
+		lines = append(lines, "Interpreter: "+interpreter, "Version: "+toolVersion(ctx, interpreter))
+	}
+	if venv := os.Getenv("VIRTUAL_ENV"); venv != "" {
+		lines = append(lines, "Virtualenv: "+venv)
+	} else {
+		lines = append(lines, "Virtualenv: none active")
+	}
+	if conda := os.Getenv("CONDA_DEFAULT_ENV"); conda != "" {
+		lines = append(lines, fmt.Sprintf("Conda environment: %s (%s)", conda, os.Getenv("CONDA_PREFIX")))
+	}
+
+	modules := tracebackModules(log)
+	if interpreter != "" && len(modules) > 0 {
+		lines = append(lines, "Packages in the traceback (pip show):")
+		lines = append(lines, pipShow(ctx, interpreter, modules)...)
+	}
+	return config.Attachment{Name: "python environment", Content: strings.Join(lines, "\n")}
+}
+
+// tracebackModules returns the installed packages the frames of a traceback
+// are in and the modules its import errors name, in order of appearance
+func tracebackModules(log string) []string {
+	var modules []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(log, "\n") {
+		for _, pattern := range []*regexp.Regexp{tracebackFrame, missingModule} {
+			m := pattern.FindStringSubmatch(line)
+			if m == nil || seen[m[1]] {
+				continue
+			}
+			seen[m[1]] = true
+			modules = append(modules, m[1])
+			if len(modules) == maxTracebackModules {
+				return modules
+			}
+		}
+	}
+	return modules
+}
+
+// pipShow returns the version and location of each of modules as installed
+// for interpreter. Modules pip doesn't know may be missing or installed under
+// another distribution name (yaml is PyYAML), which the model can tell.
+func pipShow(ctx context.Context, interpreter string, modules []string) []string {
+	args := append([]string{interpreter, "-m", "pip", "show"}, modules...)
+	// pip exits non-zero when any package is missing, but still shows the rest
+	output, _ := proc.Output(ctx, pipLimits, args...)
+
+	var lines []string
+	found := make(map[string]bool)
+	for _, block := range strings.Split(output, "\n---") {
+		fields := make(map[string]string)
+		for _, line := range strings.Split(block, "\n") {
+			if key, value, ok := strings.Cut(line, ": "); ok {
+				fields[key] = strings.TrimSpace(value)
+			}
+		}
+		if fields["Name"] == "" {
+			continue
+		}
+		found[strings.ToLower(fields["Name"])] = true
+		lines = append(lines, fmt.Sprintf("- %s %s (%s)", fields["Name"], fields["Version"], fields["Location"]))
+	}
+	for _, module := range modules {
+		if !found[strings.ToLower(module)] && !found[strings.ToLower(strings.ReplaceAll(module, "_", "-"))] {
+			lines = append(lines, fmt.Sprintf("- %s: not found by pip (not installed, or installed under another distribution name)", module))
+		}
+	}
+	return lines
+}
@@ -0,0 +1,25 @@
+package enricher
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTracebackModules(t *testing.T) {
+	log := `Traceback (most recent call last):
+  File "/app/main.py", line 12, in <module>
+    main()
+  File "/app/.venv/lib/python3.12/site-packages/requests/api.py", line 73, in get
+    return request("get", url, params=params, **kwargs)
+  File "/app/.venv/lib/python3.12/site-packages/requests/sessions.py", line 589, in request
+  File "/usr/lib/python3/dist-packages/urllib3/connectionpool.py", line 793, in urlopen
+  File "C:\Python312\Lib\site-packages\charset_normalizer\api.py", line 10, in from_bytes
+  File "/usr/lib/python3.12/json/decoder.py", line 355, in raw_decode
+ImportError: cannot import name 'soft_unicode' from 'markupsafe' (/app/.venv/lib/python3.12/site-packages/markupsafe/__init__.py)
+ModuleNotFoundError: No module named 'yaml.cyaml'`
+
+	want := []string{"requests", "urllib3", "charset_normalizer", "markupsafe", "yaml"}
+	if got := tracebackModules(log); !reflect.DeepEqual(got, want) {
+		t.Errorf("tracebackModules() = %q, want %q", got, want)
+	}
+}
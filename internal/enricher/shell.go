@@ -0,0 +1,57 @@
+package enricher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxShellDepth is how many ancestors detectShell looks at: que is usually a
+// direct child of the shell, or a grandchild when run through a wrapper
+const maxShellDepth = 8
+
+// knownShells are the process names detectShell recognizes as shells
+var knownShells = map[string]bool{
+	"bash": true, "zsh": true, "fish": true, "sh": true, "dash": true, "ksh": true, "mksh": true,
+	"tcsh": true, "csh": true, "nu": true, "xonsh": true, "elvish": true,
+	"pwsh": true, "powershell": true, "cmd": true,
+}
+
+// parentFunc returns the parent process ID and the executable name of pid
+type parentFunc func(pid int) (ppid int, name string, err error)
+
+// detectShell returns the shell que was started from, found by walking up the
+// process tree. $SHELL, the login shell, is only the fallback since users
+// often start another one from it.
+func detectShell() string {
+	if shell := findShell(os.Getppid(), parentProcess); shell != "" {
+		return shell
+	}
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return filepath.Base(shell)
+	}
+	return "unknown"
+}
+
+// findShell returns the first known shell among pid and its ancestors, or ""
+func findShell(pid int, parent parentFunc) string {
+	for depth := 0; depth < maxShellDepth && pid > 1; depth++ {
+		ppid, name, err := parent(pid)
+		if err != nil {
+			return ""
+		}
+		if shell := shellName(name); knownShells[shell] {
+			return shell
+		}
+		pid = ppid
+	}
+	return ""
+}
+
+// shellName normalizes a process name: "-zsh" (a login shell),
+// "/usr/local/bin/fish" and "pwsh.exe" become "zsh", "fish" and "pwsh"
+func shellName(name string) string {
+	name = filepath.Base(strings.TrimSpace(name))
+	name = strings.TrimPrefix(name, "-")
+	return strings.TrimSuffix(strings.ToLower(name), ".exe")
+}
@@ -0,0 +1,51 @@
+package enricher
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFindShell(t *testing.T) {
+	// que (100) <- make (90) <- -zsh (80) <- login (1)
+	tree := map[int]struct {
+		ppid int
+		name string
+	}{
+		100: {90, "make"},
+		90:  {80, "-zsh"},
+		80:  {1, "login"},
+		50:  {40, "sshd"},
+		40:  {1, "systemd"},
+	}
+	parent := func(pid int) (int, string, error) {
+		p, ok := tree[pid]
+		if !ok {
+			return 0, "", errors.New("no such process")
+		}
+		return p.ppid, p.name, nil
+	}
+
+	if got := findShell(100, parent); got != "zsh" {
+		t.Errorf("findShell(100) = %q, want zsh", got)
+	}
+	if got := findShell(50, parent); got != "" {
+		t.Errorf("findShell(50) = %q, want none without a shell ancestor", got)
+	}
+	if got := findShell(7, parent); got != "" {
+		t.Errorf("findShell(7) = %q, want none for a missing process", got)
+	}
+}
+
+func TestShellName(t *testing.T) {
+	for name, want := range map[string]string{
+		"bash":                "bash",
+		"-zsh":                "zsh",
+		"/usr/local/bin/fish": "fish",
+		"pwsh.exe":            "pwsh",
+		"PowerShell.exe":      "powershell",
+	} {
+		if got := shellName(name); got != want {
+			t.Errorf("shellName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
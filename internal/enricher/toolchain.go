@@ -0,0 +1,46 @@
+package enricher
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/ingestor"
+	"github.com/jenian/que/internal/proc"
+)
+
+// Toolchain gathers what the build tool that wrote log (as recognized by
+// ingestor.DetectToolchain) works with in the current directory: versions,
+// lockfiles and configuration. The attachments are not redacted yet. Tools
+// que knows nothing more about add nothing.
+func Toolchain(ctx context.Context, toolchain, log string) []config.Attachment {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+	switch {
+	case ingestor.IsJavaScript(toolchain):
+		return []config.Attachment{javascriptContext(ctx, toolchain, dir)}
+	case toolchain == ingestor.ToolchainPython:
+		return []config.Attachment{pythonContext(ctx, log)}
+	}
+	return nil
+}
+
+// toolVersion returns the output of `tool --version`, or why there is none
+func toolVersion(ctx context.Context, tool string) string {
+	output, err := proc.Output(ctx, probeLimits, tool, "--version")
+	output = strings.TrimSpace(output)
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		return "not installed"
+	case err != nil:
+		return "unknown (" + err.Error() + ")"
+	}
+	// Only the first line: some tools add copyright notices
+	version, _, _ := strings.Cut(output, "\n")
+	return strings.TrimSpace(version)
+}
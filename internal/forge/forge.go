@@ -0,0 +1,202 @@
+// Package forge downloads the logs of failed CI jobs from GitHub Actions and
+// GitLab CI through their REST APIs, and picks out the output of the step
+// that failed, so a run can be analyzed from its URL without copying its log.
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Forges ParseURL recognizes
+const (
+	GitHub = "github"
+	GitLab = "gitlab"
+)
+
+// maxLogSize caps the job log read from the API. The failing step is cut out
+// of it before it is capped again like any input.
+const maxLogSize = 64 << 20
+
+// Run is a workflow run, pipeline or job a URL points to
+type Run struct {
+	Forge   string // GitHub or GitLab
+	API     string // REST API base URL, e.g. https://api.github.com
+	Project string // owner/repo on GitHub, the project path on GitLab
+	RunID   int64  // Workflow run (GitHub) or pipeline (GitLab), 0 if the URL names a job
+	JobID   int64  // Job, 0 to pick the run's first failed job
+	URL     string // The URL as given
+}
+
+// Job is a failed CI job and the output of its failing step
+type Job struct {
+	ID          int64
+	Name        string
+	URL         string   // Web page of the job
+	Status      string   // Conclusion (GitHub) or status (GitLab), e.g. "failure"
+	Step        string   // Step the job failed in, empty if it couldn't be told
+	Log         string   // Output of Step, or the whole log when Step is empty
+	OtherFailed []string // Names of the run's other failed jobs
+}
+
+var (
+	// githubRunPath matches the path of a GitHub Actions run or job page
+	githubRunPath = regexp.MustCompile(`^/([^/]+/[^/]+)/actions/runs/(\d+)(?:/job/(\d+))?(?:/attempts/\d+)?/?$`)
+	// gitlabPath matches the path of a GitLab job or pipeline page
+	gitlabPath = regexp.MustCompile(`^/(.+?)/-/(jobs|pipelines)/(\d+)/?$`)
+)
+
+// ParseURL recognizes the web URL of a GitHub Actions run or job
+// (https://github.com/OWNER/REPO/actions/runs/ID[/job/ID]) or of a GitLab job
+// or pipeline (https://gitlab.com/GROUP/PROJECT/-/jobs/ID), on github.com,
+// gitlab.com or a self-hosted instance
+func ParseURL(raw string) (Run, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return Run{}, fmt.Errorf("invalid CI URL %q", raw)
+	}
+	base := u.Scheme + "://" + u.Host
+	if m := githubRunPath.FindStringSubmatch(u.Path); m != nil {
+		run := Run{Forge: GitHub, API: base + "/api/v3", Project: m[1], URL: raw}
+		if u.Host == "github.com" {
+			run.API = "https://api.github.com"
+		}
+		run.RunID, _ = strconv.ParseInt(m[2], 10, 64)
+		if m[3] != "" {
+			run.JobID, _ = strconv.ParseInt(m[3], 10, 64)
+		}
+		return run, nil
+	}
+	if m := gitlabPath.FindStringSubmatch(u.Path); m != nil {
+		run := Run{Forge: GitLab, API: base + "/api/v4", Project: m[1], URL: raw}
+		id, _ := strconv.ParseInt(m[3], 10, 64)
+		if m[2] == "jobs" {
+			run.JobID = id
+		} else {
+			run.RunID = id
+		}
+		return run, nil
+	}
+	return Run{}, fmt.Errorf("not a GitHub Actions run or job, or GitLab job or pipeline URL: %s", raw)
+}
+
+// Token authenticates with the API of a forge
+type Token struct {
+	Value    string
+	JobToken bool // A GitLab CI_JOB_TOKEN, which is sent in its own header
+}
+
+// tokenEnv names the environment variables a token for forge is read from,
+// in order of preference
+func tokenEnv(forge string) []string {
+	if forge == GitLab {
+		return []string{"GITLAB_TOKEN", "CI_JOB_TOKEN"}
+	}
+	return []string{"GITHUB_TOKEN", "GH_TOKEN"}
+}
+
+// TokenFromEnv returns the token for forge from $GITHUB_TOKEN or $GH_TOKEN
+// (GitHub), or $GITLAB_TOKEN or $CI_JOB_TOKEN (GitLab). It is empty if none
+// is set, which is enough for public projects.
+func TokenFromEnv(forge string) Token {
+	for _, name := range tokenEnv(forge) {
+		if value := os.Getenv(name); value != "" {
+			return Token{Value: value, JobToken: name == "CI_JOB_TOKEN"}
+		}
+	}
+	return Token{}
+}
+
+// FailedJob finds the failed job of run (the one its URL names, or else the
+// first failed job of the run) and downloads the output of its failing step
+func FailedJob(ctx context.Context, client *http.Client, run Run, token Token) (*Job, error) {
+	api := &apiClient{client: client, run: run, token: token}
+	if run.Forge == GitLab {
+		return api.fetchGitLabJob(ctx)
+	}
+	return api.fetchGitHubJob(ctx)
+}
+
+// apiClient makes authenticated requests to the API of a forge
+type apiClient struct {
+	client *http.Client
+	run    Run
+	token  Token
+}
+
+// get requests path below the API base and returns the response body,
+// capped at maxLogSize
+func (c *apiClient) get(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.run.API+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token.Value != "" {
+		switch {
+		case c.run.Forge == GitHub:
+			req.Header.Set("Authorization", "Bearer "+c.token.Value)
+		case c.token.JobToken:
+			req.Header.Set("JOB-TOKEN", c.token.Value)
+		default:
+			req.Header.Set("PRIVATE-TOKEN", c.token.Value)
+		}
+	}
+	if c.run.Forge == GitHub {
+		req.Header.Set("Accept", "application/vnd.github+json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s API request failed: %w", c.run.Forge, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxLogSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s API response: %w", c.run.Forge, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiError struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(body, &apiError)
+		err := fmt.Errorf("%s API returned %s for %s", c.run.Forge, resp.Status, path)
+		if apiError.Message != "" {
+			err = fmt.Errorf("%w: %s", err, apiError.Message)
+		}
+		// Both forges answer 404 rather than 403 for private projects
+		if (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusUnauthorized) && c.token.Value == "" {
+			err = fmt.Errorf("%w (private projects need a token in $%s)", err, tokenEnv(c.run.Forge)[0])
+		}
+		return nil, err
+	}
+	return body, nil
+}
+
+// getJSON requests path and decodes the JSON response into v
+func (c *apiClient) getJSON(ctx context.Context, path string, v any) error {
+	body, err := c.get(ctx, path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("unexpected %s API response for %s: %w", c.run.Forge, path, err)
+	}
+	return nil
+}
+
+// ansiEscape matches the color and line control sequences of CI logs
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// stripANSI removes terminal escape sequences and carriage returns
+func stripANSI(log string) string {
+	log = ansiEscape.ReplaceAllString(log, "")
+	return strings.ReplaceAll(log, "\r", "")
+}
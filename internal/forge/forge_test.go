@@ -0,0 +1,127 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want Run
+	}{
+		{"https://github.com/acme/api/actions/runs/123", Run{Forge: GitHub, API: "https://api.github.com", Project: "acme/api", RunID: 123}},
+		{"https://github.com/acme/api/actions/runs/123/job/456", Run{Forge: GitHub, API: "https://api.github.com", Project: "acme/api", RunID: 123, JobID: 456}},
+		{"https://github.example.com/acme/api/actions/runs/123/attempts/2", Run{Forge: GitHub, API: "https://github.example.com/api/v3", Project: "acme/api", RunID: 123}},
+		{"https://gitlab.com/acme/backend/api/-/jobs/789", Run{Forge: GitLab, API: "https://gitlab.com/api/v4", Project: "acme/backend/api", JobID: 789}},
+		{"https://git.example.com/acme/api/-/pipelines/42/", Run{Forge: GitLab, API: "https://git.example.com/api/v4", Project: "acme/api", RunID: 42}},
+	}
+	for _, tt := range tests {
+		got, err := ParseURL(tt.url)
+		if err != nil {
+			t.Errorf("ParseURL(%q) error = %v", tt.url, err)
+			continue
+		}
+		tt.want.URL = tt.url
+		if got != tt.want {
+			t.Errorf("ParseURL(%q) = %+v, want %+v", tt.url, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"https://github.com/acme/api/pull/1", "not a url", "https://gitlab.com/acme/api/-/merge_requests/3"} {
+		if _, err := ParseURL(bad); err == nil {
+			t.Errorf("ParseURL(%q) should fail", bad)
+		}
+	}
+}
+
+func TestGithubStepLog(t *testing.T) {
+	log := "\ufeff2024-05-01T10:00:00.0000000Z ##[group]Run actions/checkout@v4\n" +
+		"2024-05-01T10:00:01.0000000Z Syncing repository: acme/api\n" +
+		"2024-05-01T10:00:02.0000000Z ##[group]Run npm test\n" +
+		"2024-05-01T10:00:02.1000000Z \x1b[36;1mnpm test\x1b[0m\n" +
+		"2024-05-01T10:00:05.0000000Z FAIL src/app.test.js\n" +
+		"2024-05-01T10:00:05.1000000Z ##[error]Process completed with exit code 1.\n" +
+		"2024-05-01T10:00:06.0000000Z Post job cleanup.\n" +
+		"2024-05-01T10:00:06.1000000Z [command]/usr/bin/git version\n"
+
+	step, header := githubStepLog(log)
+	want := "##[group]Run npm test\nnpm test\nFAIL src/app.test.js\n##[error]Process completed with exit code 1."
+	if step != want {
+		t.Errorf("githubStepLog() = %q, want %q", step, want)
+	}
+	if header != "Run npm test" {
+		t.Errorf("githubStepLog() header = %q, want Run npm test", header)
+	}
+
+	if step, header := githubStepLog("2024-05-01T10:00:00Z all good\n"); step != "all good\n" || header != "" {
+		t.Errorf("githubStepLog() of a log without errors = %q, %q", step, header)
+	}
+}
+
+func TestGitlabStepLog(t *testing.T) {
+	trace := "\x1b[0Ksection_start:1714557600:prepare_executor\r\x1b[0KPreparing the \"docker\" executor\n" +
+		"Using docker image node:20\n" +
+		"\x1b[0Ksection_end:1714557601:prepare_executor\r\x1b[0K\n" +
+		"\x1b[0Ksection_start:1714557602:step_script\r\x1b[0KExecuting \"step_script\" stage of the job script\n" +
+		"\x1b[32;1m$ npm test\x1b[0;m\n" +
+		"FAIL src/app.test.js\n" +
+		"\x1b[0Ksection_end:1714557605:step_script\r\x1b[0K\n" +
+		"\x1b[0Ksection_start:1714557606:after_script\r\x1b[0KRunning after_script\n" +
+		"$ echo done\n" +
+		"\x1b[0Ksection_end:1714557607:after_script\r\x1b[0K\n" +
+		"\x1b[31;1mERROR: Job failed: exit code 1\n\x1b[0;m\n"
+
+	step, name := gitlabStepLog(trace)
+	want := "Executing \"step_script\" stage of the job script\n$ npm test\nFAIL src/app.test.js\n\nERROR: Job failed: exit code 1"
+	if step != want {
+		t.Errorf("gitlabStepLog() = %q, want %q", step, want)
+	}
+	if name != "step_script" {
+		t.Errorf("gitlabStepLog() name = %q, want step_script", name)
+	}
+}
+
+func TestFailedJob_GitHub(t *testing.T) {
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/repos/acme/api/actions/runs/123/jobs":
+			fmt.Fprint(w, `{"jobs": [
+				{"id": 1, "name": "lint", "conclusion": "success"},
+				{"id": 2, "name": "test", "html_url": "https://github.com/acme/api/actions/runs/123/job/2", "conclusion": "failure",
+				 "steps": [{"name": "Set up job", "conclusion": "success"}, {"name": "Run tests", "conclusion": "failure"}]},
+				{"id": 3, "name": "e2e", "conclusion": "failure"}]}`)
+		case "/repos/acme/api/actions/jobs/2/logs":
+			fmt.Fprint(w, "2024-05-01T10:00:00Z ##[group]Run npm test\n2024-05-01T10:00:05Z ##[error]Process completed with exit code 1.\n")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	run := Run{Forge: GitHub, API: server.URL, Project: "acme/api", RunID: 123}
+	job, err := FailedJob(context.Background(), server.Client(), run, Token{Value: "ghp_test"})
+	if err != nil {
+		t.Fatalf("FailedJob() error = %v", err)
+	}
+	if job.ID != 2 || job.Step != "Run tests" || strings.Join(job.OtherFailed, ",") != "e2e" {
+		t.Errorf("FailedJob() = %+v, want job 2 failing in Run tests, with e2e also failed", job)
+	}
+	if !strings.HasPrefix(job.Log, "##[group]Run npm test") {
+		t.Errorf("Log = %q, want the failing step's output", job.Log)
+	}
+	if auth != "Bearer ghp_test" {
+		t.Errorf("Authorization = %q, want the token", auth)
+	}
+
+	run.RunID = 999
+	if _, err := FailedJob(context.Background(), server.Client(), run, Token{}); err == nil || !strings.Contains(err.Error(), "$GITHUB_TOKEN") {
+		t.Errorf("FailedJob() of a missing run without a token should suggest one, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// githubJob is a job of the GitHub Actions API
+type githubJob struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	HTMLURL    string `json:"html_url"`
+	Conclusion string `json:"conclusion"`
+	Steps      []struct {
+		Name       string `json:"name"`
+		Conclusion string `json:"conclusion"`
+	} `json:"steps"`
+}
+
+// failed reports whether the job failed rather than succeeded, was skipped
+// or cancelled
+func (j githubJob) failed() bool {
+	return j.Conclusion == "failure" || j.Conclusion == "timed_out"
+}
+
+// fetchGitHubJob fetches the job the URL names, or the first failed job of the
+// run, and the output of its failing step
+func (c *apiClient) fetchGitHubJob(ctx context.Context) (*Job, error) {
+	var job githubJob
+	var others []string
+	if c.run.JobID != 0 {
+		if err := c.getJSON(ctx, fmt.Sprintf("/repos/%s/actions/jobs/%d", c.run.Project, c.run.JobID), &job); err != nil {
+			return nil, err
+		}
+	} else {
+		var list struct {
+			Jobs []githubJob `json:"jobs"`
+		}
+		if err := c.getJSON(ctx, fmt.Sprintf("/repos/%s/actions/runs/%d/jobs?filter=latest&per_page=100", c.run.Project, c.run.RunID), &list); err != nil {
+			return nil, err
+		}
+		var failed []githubJob
+		for _, candidate := range list.Jobs {
+			if candidate.failed() {
+				failed = append(failed, candidate)
+			}
+		}
+		if len(failed) == 0 {
+			return nil, fmt.Errorf("run %d has no failed jobs", c.run.RunID)
+		}
+		job = failed[0]
+		for _, other := range failed[1:] {
+			others = append(others, other.Name)
+		}
+	}
+
+	log, err := c.get(ctx, fmt.Sprintf("/repos/%s/actions/jobs/%d/logs", c.run.Project, job.ID))
+	if err != nil {
+		return nil, err
+	}
+	result := &Job{ID: job.ID, Name: job.Name, URL: job.HTMLURL, Status: job.Conclusion, OtherFailed: others}
+	var header string
+	result.Log, header = githubStepLog(string(log))
+	for _, step := range job.Steps {
+		if step.Conclusion == "failure" {
+			result.Step = step.Name
+			break
+		}
+	}
+	if result.Step == "" {
+		result.Step = header
+	}
+	return result, nil
+}
+
+var (
+	// githubTimestamp matches the timestamp GitHub puts before every log line
+	githubTimestamp = regexp.MustCompile(`(?m)^\x{FEFF}?\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(?:\.\d+)?Z ?`)
+	// githubStepStart matches the first line of a step's output, which
+	// echoes the command or action it runs
+	githubStepStart = regexp.MustCompile(`^##\[group\]Run |^Post job cleanup\.`)
+)
+
+// githubStepLog returns the output of the step of a GitHub Actions job log
+// that reported the first error (##[error]), from the line echoing its command
+// to the next step, and that line as the step's header. Without an error,
+// it returns the whole log and no header. The timestamps on every line are
+// dropped: they would take a good part of the token budget.
+func githubStepLog(log string) (string, string) {
+	log = stripANSI(githubTimestamp.ReplaceAllString(log, ""))
+	lines := strings.Split(strings.TrimRight(log, "\n"), "\n")
+	failed := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "##[error]") {
+			failed = i
+			break
+		}
+	}
+	if failed < 0 {
+		return log, ""
+	}
+	start := 0
+	for i := failed; i >= 0; i-- {
+		if githubStepStart.MatchString(lines[i]) {
+			start = i
+			break
+		}
+	}
+	end := len(lines)
+	for i := failed + 1; i < len(lines); i++ {
+		if githubStepStart.MatchString(lines[i]) {
+			end = i
+			break
+		}
+	}
+	return strings.Join(lines[start:end], "\n"), strings.TrimPrefix(lines[start], "##[group]")
+}
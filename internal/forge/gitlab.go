@@ -0,0 +1,120 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// gitlabJob is a job of the GitLab API
+type gitlabJob struct {
+	ID            int64  `json:"id"`
+	Name          string `json:"name"`
+	Stage         string `json:"stage"`
+	Status        string `json:"status"`
+	FailureReason string `json:"failure_reason"`
+	WebURL        string `json:"web_url"`
+}
+
+// fetchGitLabJob fetches the job the URL names, or the first failed job of the
+// pipeline, and the output of its failing section
+func (c *apiClient) fetchGitLabJob(ctx context.Context) (*Job, error) {
+	project := url.PathEscape(c.run.Project)
+	var job gitlabJob
+	var others []string
+	if c.run.JobID != 0 {
+		if err := c.getJSON(ctx, fmt.Sprintf("/projects/%s/jobs/%d", project, c.run.JobID), &job); err != nil {
+			return nil, err
+		}
+	} else {
+		var failed []gitlabJob
+		if err := c.getJSON(ctx, fmt.Sprintf("/projects/%s/pipelines/%d/jobs?scope%%5B%%5D=failed&per_page=100", project, c.run.RunID), &failed); err != nil {
+			return nil, err
+		}
+		if len(failed) == 0 {
+			return nil, fmt.Errorf("pipeline %d has no failed jobs", c.run.RunID)
+		}
+		// The API lists the most recent job first; the first to fail is more
+		// likely the cause of the others
+		job = failed[len(failed)-1]
+		for _, other := range failed[:len(failed)-1] {
+			others = append(others, other.Name)
+		}
+	}
+
+	trace, err := c.get(ctx, fmt.Sprintf("/projects/%s/jobs/%d/trace", project, job.ID))
+	if err != nil {
+		return nil, err
+	}
+	status := job.Status
+	if job.FailureReason != "" {
+		status += " (" + job.FailureReason + ")"
+	}
+	name := job.Name
+	if job.Stage != "" {
+		name += " (stage " + job.Stage + ")"
+	}
+	result := &Job{ID: job.ID, Name: name, URL: job.WebURL, Status: status, OtherFailed: others}
+	result.Log, result.Step = gitlabStepLog(string(trace))
+	return result, nil
+}
+
+// gitlabSection matches the markers GitLab wraps the sections of a job log
+// in (get_sources, step_script, ...), capturing whether the section starts or
+// ends and its name
+var gitlabSection = regexp.MustCompile(`(?:\x1b\[0K)?section_(start|end):\d+:([A-Za-z0-9_.-]+)(?:\[[^\]]*\])?\r?(?:\x1b\[0K)?`)
+
+// gitlabAfterFailure are sections GitLab runs after a job failed, which are
+// never where it failed
+var gitlabAfterFailure = map[string]bool{"after_script": true, "cleanup_file_variables": true, "upload_artifacts_on_failure": true}
+
+// gitlabStepLog returns the section of a GitLab job trace the job failed in,
+// the last one started before "ERROR: Job failed", followed by that error
+// line, and the section's name. A trace without sections or without the
+// error line is returned whole, with no name.
+func gitlabStepLog(trace string) (string, string) {
+	lines := strings.Split(strings.TrimRight(trace, "\n"), "\n")
+	type section struct {
+		name       string
+		start, end int
+	}
+	var sections []section
+	open := make(map[string]int)
+	failedAt := -1
+	for i, line := range lines {
+		for _, m := range gitlabSection.FindAllStringSubmatch(line, -1) {
+			if m[1] == "start" {
+				open[m[2]] = len(sections)
+				sections = append(sections, section{name: m[2], start: i, end: len(lines)})
+			} else if j, ok := open[m[2]]; ok {
+				sections[j].end = i + 1
+				delete(open, m[2])
+			}
+		}
+		if strings.Contains(line, "ERROR: Job failed") {
+			failedAt = i
+		}
+	}
+
+	clean := func(lines []string) string {
+		var out []string
+		for _, line := range lines {
+			out = append(out, stripANSI(gitlabSection.ReplaceAllString(line, "")))
+		}
+		return strings.Join(out, "\n")
+	}
+	if failedAt < 0 {
+		return clean(lines), ""
+	}
+	for i := len(sections) - 1; i >= 0; i-- {
+		s := sections[i]
+		if s.start >= failedAt || gitlabAfterFailure[s.name] {
+			continue
+		}
+		failing := lines[s.start:min(s.end, failedAt)]
+		return clean(append(failing[:len(failing):len(failing)], lines[failedAt])), s.name
+	}
+	return clean(lines), ""
+}
@@ -0,0 +1,65 @@
+// Package httpclient builds the HTTP clients que uses to reach the network
+// (LLM providers, webhook and notification sinks), so that network settings
+// are applied in one place.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// rootCAs are the certificate authorities clients trust, nil for the system's
+var rootCAs *x509.CertPool
+
+// SetCACert makes clients trust the PEM certificates in the file at path on
+// top of the system's, e.g. the root CA of a TLS-intercepting corporate
+// proxy. It is meant to be called once at startup, before any client is built.
+func SetCACert(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		// Without a system pool (e.g. on old Windows) only the given CAs are trusted
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("invalid CA certificate %s: no PEM certificates found", path)
+	}
+	rootCAs = pool
+	return nil
+}
+
+// New returns an HTTP client with the given timeout (0 for none) that honors
+// the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables and trusts
+// the CAs added with SetCACert. Each client
+// gets its own transport, so callers may wrap it without affecting others.
+func New(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: newTransport(),
+	}
+}
+
+// newTransport returns a copy of the default transport with que's network settings
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if rootCAs != nil {
+		// Covers the provider and an HTTPS proxy alike, which may both present the corporate CA
+		transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12}
+	}
+	return transport
+}
+
+// TLSConfig returns the TLS settings for connecting to serverName over
+// another protocol than HTTP, such as SMTP, trusting the CAs added with
+// SetCACert
+func TLSConfig(serverName string) *tls.Config {
+	return &tls.Config{ServerName: serverName, RootCAs: rootCAs, MinVersion: tls.VersionTLS12}
+}
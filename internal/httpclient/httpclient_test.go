@@ -0,0 +1,74 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	client := New(5 * time.Second)
+	if client.Timeout != 5*time.Second {
+		t.Errorf("Timeout = %v, want 5s", client.Timeout)
+	}
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("Transport is %T, want *http.Transport", client.Transport)
+	}
+	if transport == http.DefaultTransport {
+		t.Error("New shares http.DefaultTransport, want a copy")
+	}
+	if transport.Proxy == nil {
+		t.Error("Transport ignores the proxy environment variables")
+	}
+	if other := New(0); other.Transport == client.Transport {
+		t.Error("clients share a transport")
+	}
+}
+
+func TestSetCACert(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	t.Cleanup(func() { rootCAs = nil })
+
+	if _, err := New(5 * time.Second).Get(server.URL); err == nil {
+		t.Fatal("request to a server with an untrusted certificate succeeded")
+	}
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(path, certificate, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetCACert(path); err != nil {
+		t.Fatalf("SetCACert() error = %v", err)
+	}
+	resp, err := New(5 * time.Second).Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with the CA added failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestSetCACert_Invalid(t *testing.T) {
+	t.Cleanup(func() { rootCAs = nil })
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetCACert(path); err == nil || !strings.Contains(err.Error(), "no PEM certificates") {
+		t.Errorf("SetCACert() error = %v, want no PEM certificates", err)
+	}
+	if err := SetCACert(filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Error("SetCACert() of a missing file succeeded")
+	}
+	if rootCAs != nil {
+		t.Error("failed SetCACert() changed the trusted CAs")
+	}
+}
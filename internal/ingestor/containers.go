@@ -0,0 +1,112 @@
+package ingestor
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// kubectlPrefix matches the label kubectl logs --prefix puts before each
+// line, capturing the pod and container names and the timestamp that
+// --timestamps writes after the label
+var kubectlPrefix = regexp.MustCompile(`^\[pod/([^/\]\s]+)/([^/\]\s]+)\] (?:(\d{4}-\d\d-\d\dT\S+) )?`)
+
+// KubectlSources returns the pod containers kubectl logs --prefix labeled the
+// lines of log with, in order of first appearance, or nil unless there are at
+// least two: a single container has no topology to explain
+func KubectlSources(log string) []config.LogSource {
+	var sources []config.LogSource
+	index := make(map[[2]string]int)
+	for _, line := range strings.Split(log, "\n") {
+		m := kubectlPrefix.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		key := [2]string{m[1], m[2]}
+		i, ok := index[key]
+		if !ok {
+			i = len(sources)
+			index[key] = i
+			sources = append(sources, config.LogSource{Pod: m[1], Container: m[2]})
+		}
+		sources[i].Lines++
+	}
+	if len(sources) < 2 {
+		return nil
+	}
+	return sources
+}
+
+// InterleaveByTimestamp puts the lines of kubectl logs --prefix --timestamps
+// output in timestamp order. kubectl writes the lines of one container after
+// the other, which keeps a failure in one container far from its cause in
+// another. Unlabeled lines move with the labeled line before them. It
+// returns the reordered log, a LineMap from its lines to those of log (nil
+// if the lines were already in order) and whether the result is in timestamp
+// order, which it can't be unless every labeled line has a timestamp.
+func InterleaveByTimestamp(log string) (string, config.LineMap, bool) {
+	return interleave(log, kubectlPrefix)
+}
+
+// InterleaveComposeLogs is InterleaveByTimestamp for docker compose logs
+// --timestamps output, whose lines are labeled "CONTAINER  | TIMESTAMP "
+func InterleaveComposeLogs(log string) (string, config.LineMap, bool) {
+	return interleave(log, composePrefix)
+}
+
+// composePrefix matches the container label docker compose logs puts before
+// each line and the timestamp that --timestamps writes after it
+var composePrefix = regexp.MustCompile(`^(\S+)\s+\| (?:(\d{4}-\d\d-\d\dT\S+) )?`)
+
+// interleave sorts the lines of log matching prefix, whose last group is the
+// line's timestamp, as described for InterleaveByTimestamp
+func interleave(log string, prefix *regexp.Regexp) (string, config.LineMap, bool) {
+	type block struct {
+		time  time.Time
+		lines []string
+		first int // Index of the block's first line in log
+	}
+
+	trailing := strings.HasSuffix(log, "\n")
+	var blocks []block
+	for i, line := range strings.Split(strings.TrimSuffix(log, "\n"), "\n") {
+		m := prefix.FindStringSubmatch(line)
+		if m == nil {
+			// Lines before the first labeled one keep the zero time and stay first
+			if len(blocks) == 0 {
+				blocks = append(blocks, block{first: i})
+			}
+			last := &blocks[len(blocks)-1]
+			last.lines = append(last.lines, line)
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, m[len(m)-1])
+		if err != nil {
+			return log, nil, false
+		}
+		blocks = append(blocks, block{time: t, lines: []string{line}, first: i})
+	}
+
+	before := func(a, b int) bool { return blocks[a].time.Before(blocks[b].time) }
+	if sort.SliceIsSorted(blocks, before) {
+		return log, nil, true
+	}
+	sort.SliceStable(blocks, before)
+
+	var lines []string
+	var lineMap config.LineMap
+	for _, b := range blocks {
+		lines = append(lines, b.lines...)
+		for j := range b.lines {
+			lineMap = append(lineMap, b.first+j+1)
+		}
+	}
+	interleaved := strings.Join(lines, "\n")
+	if trailing {
+		interleaved += "\n"
+	}
+	return interleaved, lineMap, true
+}
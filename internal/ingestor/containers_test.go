@@ -0,0 +1,88 @@
+package ingestor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+func TestKubectlSources(t *testing.T) {
+	log := "[pod/web-1/app] ERROR upstream connect error\n" +
+		"[pod/web-1/istio-proxy] WARN cluster not ready\n" +
+		"[pod/web-1/app] ERROR retrying\n" +
+		"unlabeled line\n" +
+		"[pod/db-0/postgres] FATAL too many connections\n"
+
+	want := []config.LogSource{
+		{Pod: "web-1", Container: "app", Lines: 2},
+		{Pod: "web-1", Container: "istio-proxy", Lines: 1},
+		{Pod: "db-0", Container: "postgres", Lines: 1},
+	}
+	if got := KubectlSources(log); !reflect.DeepEqual(got, want) {
+		t.Errorf("KubectlSources() = %+v, want %+v", got, want)
+	}
+
+	if got := KubectlSources("[pod/web-1/app] ERROR a\n[pod/web-1/app] ERROR b\n"); got != nil {
+		t.Errorf("KubectlSources() of a single container = %+v, want nil", got)
+	}
+	if got := KubectlSources("[pod] not a label\nERROR plain log\n"); got != nil {
+		t.Errorf("KubectlSources() of an unlabeled log = %+v, want nil", got)
+	}
+}
+
+func TestInterleaveByTimestamp(t *testing.T) {
+	log := "[pod/web-1/app] 2024-05-01T10:00:02Z ERROR upstream connect error\n" +
+		"  at Client.send\n" +
+		"[pod/web-1/app] 2024-05-01T10:00:04Z ERROR retrying\n" +
+		"[pod/db-0/postgres] 2024-05-01T10:00:01.5Z FATAL too many connections\n" +
+		"[pod/db-0/postgres] 2024-05-01T10:00:03Z LOG connection closed\n"
+
+	got, lineMap, ok := InterleaveByTimestamp(log)
+	if !ok {
+		t.Fatal("InterleaveByTimestamp() ok = false, want true")
+	}
+	want := "[pod/db-0/postgres] 2024-05-01T10:00:01.5Z FATAL too many connections\n" +
+		"[pod/web-1/app] 2024-05-01T10:00:02Z ERROR upstream connect error\n" +
+		"  at Client.send\n" +
+		"[pod/db-0/postgres] 2024-05-01T10:00:03Z LOG connection closed\n" +
+		"[pod/web-1/app] 2024-05-01T10:00:04Z ERROR retrying\n"
+	if got != want {
+		t.Errorf("InterleaveByTimestamp() =\n%s\nwant\n%s", got, want)
+	}
+	if wantMap := (config.LineMap{4, 1, 2, 5, 3}); !reflect.DeepEqual(lineMap, wantMap) {
+		t.Errorf("LineMap = %v, want %v", lineMap, wantMap)
+	}
+}
+
+func TestInterleaveByTimestamp_Unchanged(t *testing.T) {
+	ordered := "[pod/web-1/app] 2024-05-01T10:00:01Z a\n[pod/db-0/postgres] 2024-05-01T10:00:02Z b"
+	if got, lineMap, ok := InterleaveByTimestamp(ordered); got != ordered || lineMap != nil || !ok {
+		t.Errorf("InterleaveByTimestamp() of an ordered log = %q, %v, %v, want it unchanged, nil, true", got, lineMap, ok)
+	}
+
+	untimed := "[pod/web-1/app] ERROR b\n[pod/db-0/postgres] 2024-05-01T10:00:01Z a"
+	if got, lineMap, ok := InterleaveByTimestamp(untimed); got != untimed || lineMap != nil || ok {
+		t.Errorf("InterleaveByTimestamp() without timestamps = %q, %v, %v, want it unchanged, nil, false", got, lineMap, ok)
+	}
+}
+
+func TestInterleaveComposeLogs(t *testing.T) {
+	log := "web-1  | 2024-05-01T10:00:02.000000000Z Error: connect ECONNREFUSED 172.18.0.2:5432\n" +
+		"db-1   | 2024-05-01T10:00:01.000000000Z database system is starting up\n" +
+		"db-1   | 2024-05-01T10:00:03.000000000Z database system is ready to accept connections\n"
+
+	got, lineMap, ok := InterleaveComposeLogs(log)
+	if !ok {
+		t.Fatal("InterleaveComposeLogs() ok = false, want true")
+	}
+	want := "db-1   | 2024-05-01T10:00:01.000000000Z database system is starting up\n" +
+		"web-1  | 2024-05-01T10:00:02.000000000Z Error: connect ECONNREFUSED 172.18.0.2:5432\n" +
+		"db-1   | 2024-05-01T10:00:03.000000000Z database system is ready to accept connections\n"
+	if got != want {
+		t.Errorf("InterleaveComposeLogs() =\n%s\nwant\n%s", got, want)
+	}
+	if wantMap := (config.LineMap{2, 1, 3}); !reflect.DeepEqual(lineMap, wantMap) {
+		t.Errorf("LineMap = %v, want %v", lineMap, wantMap)
+	}
+}
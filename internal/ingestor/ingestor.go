@@ -3,28 +3,69 @@ package ingestor
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"os"
+	"strings"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/textutil"
 )
 
 const (
-	// MaxInputSize is the maximum size of input before truncation (100KB)
+	// MaxInputSize is the default maximum size of input before truncation (100KB)
 	MaxInputSize = 100 * 1024
 	// TruncateHeadSize is the size of the head to keep when truncating (50KB)
 	TruncateHeadSize = 50 * 1024
 	// TruncateTailSize is the size of the tail to keep when truncating (50KB)
 	TruncateTailSize = 50 * 1024
+	// MaxAttachmentSize is the maximum size of a single --context-file attachment (16KB)
+	MaxAttachmentSize = 16 * 1024
 )
 
 // Ingest reads from stdin and returns the content, with intelligent truncation
-// if the input exceeds MaxInputSize. When truncating, it preserves the head
+// if the input exceeds limit bytes. When truncating, it preserves the head
 // and tail of the input while maintaining line boundaries.
-func Ingest() (string, error) {
-	return IngestFromReader(os.Stdin)
+func Ingest(limit int) (string, error) {
+	return IngestFromReaderLimit(os.Stdin, limit)
+}
+
+// IngestTee reads from stdin like Ingest while copying every byte to w as it
+// arrives, so que can sit in the middle of a pipeline without swallowing it.
+// w always receives the full, untruncated input.
+func IngestTee(w io.Writer, limit int) (string, error) {
+	return IngestTeeFromReader(os.Stdin, w, limit)
 }
 
-// IngestFromReader reads from the provided reader and returns the content
+// IngestTeeFromReader is like IngestFromReaderLimit but copies the input to w as it is read
+func IngestTeeFromReader(r io.Reader, w io.Writer, limit int) (string, error) {
+	return IngestFromReaderLimit(io.TeeReader(r, w), limit)
+}
+
+// StdinIsTerminal reports whether stdin is an interactive terminal rather than
+// a pipe or file, in which case Ingest would block waiting for the user.
+func StdinIsTerminal() bool {
+	return IsTerminal(os.Stdin)
+}
+
+// IsTerminal reports whether the given file is a character device (a TTY)
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// IngestFromReader reads from the provided reader and returns the content,
+// truncated to MaxInputSize
 func IngestFromReader(r io.Reader) (string, error) {
+	return IngestFromReaderLimit(r, MaxInputSize)
+}
+
+// IngestFromReaderLimit reads from the provided reader and returns the content,
+// keeping the first and last limit/2 bytes if it is larger than limit
+func IngestFromReaderLimit(r io.Reader, limit int) (string, error) {
 	reader := bufio.NewReader(r)
 	var buffer bytes.Buffer
 	
@@ -35,15 +76,17 @@ func IngestFromReader(r io.Reader) (string, error) {
 	}
 	
 	content := buffer.Bytes()
+	// The returned string is a copy, so wipe the raw input from the read buffer
+	defer clear(content)
 	
 	// If content is within limits, return as-is
-	if len(content) <= MaxInputSize {
+	if len(content) <= limit {
 		return string(content), nil
 	}
 	
 	// Truncate: keep head + tail
-	head := content[:TruncateHeadSize]
-	tail := content[len(content)-TruncateTailSize:]
+	head := content[:limit/2]
+	tail := content[len(content)-(limit-limit/2):]
 	
 	// Find the last newline in the head to preserve line boundaries
 	headLastNewline := bytes.LastIndexByte(head, '\n')
@@ -65,9 +108,39 @@ func IngestFromReader(r io.Reader) (string, error) {
 	
 	// Combine head and tail with truncation indicator
 	truncated := bytes.NewBuffer(head[:headLastNewline])
-	truncated.WriteString("\n... [TRUNCATED: input exceeded 100KB, showing first 50KB and last 50KB] ...\n")
+	fmt.Fprintf(truncated, "\n"+truncationMarker+" input exceeded %dKB, showing first %dKB and last %dKB] ...\n", limit/1024, len(head)/1024, len(tail)/1024)
 	truncated.Write(tail[tailFirstNewline:])
 	
 	return truncated.String(), nil
 }
 
+
+// truncationMarker starts the line that replaces the middle of truncated input
+const truncationMarker = "... [TRUNCATED:"
+
+// Truncated reports whether content was cut to its head and tail on ingestion
+func Truncated(content string) bool {
+	return strings.Contains(content, "\n"+truncationMarker)
+}
+
+// ReadAttachment reads a file to be sent alongside the log, capping its size at
+// MaxAttachmentSize. The content is not sanitized; callers must redact it.
+func ReadAttachment(path string) (config.Attachment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config.Attachment{}, err
+	}
+
+	content := string(data)
+	clear(data)
+	truncated := len(content) > MaxAttachmentSize
+	if truncated {
+		content = textutil.Truncate(content, MaxAttachmentSize)
+	}
+
+	return config.Attachment{
+		Name:      path,
+		Content:   content,
+		Truncated: truncated,
+	}, nil
+}
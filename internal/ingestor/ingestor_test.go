@@ -1,6 +1,8 @@
 package ingestor
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -54,6 +56,28 @@ func TestIngestFromReader_LargeInput(t *testing.T) {
 	}
 }
 
+func TestIngestFromReaderLimit(t *testing.T) {
+	input := strings.Repeat("x", 1023) + "\n" + strings.Repeat("y", 1023) + "\n" + strings.Repeat("z", 1023) + "\n"
+
+	result, err := IngestFromReaderLimit(strings.NewReader(input), 2048)
+	if err != nil {
+		t.Fatalf("IngestFromReaderLimit() error = %v, want nil", err)
+	}
+	if !strings.Contains(result, "[TRUNCATED: input exceeded 2KB, showing first 1KB and last 1KB]") {
+		t.Errorf("IngestFromReaderLimit() should report the limit it applied, got %q", result)
+	}
+	if strings.Contains(result, "y") {
+		t.Error("IngestFromReaderLimit() should drop the middle of the input")
+	}
+	if !Truncated(result) {
+		t.Error("Truncated() should detect the truncated input")
+	}
+
+	if result, _ := IngestFromReaderLimit(strings.NewReader(input), len(input)); result != input || Truncated(result) {
+		t.Error("IngestFromReaderLimit() should keep input that fits the limit")
+	}
+}
+
 func TestIngestFromReader_EmptyInput(t *testing.T) {
 	reader := strings.NewReader("")
 	
@@ -67,3 +91,61 @@ func TestIngestFromReader_EmptyInput(t *testing.T) {
 	}
 }
 
+
+func TestIsTerminal_Pipe(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe() error = %v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if IsTerminal(r) {
+		t.Error("IsTerminal() = true for a pipe, want false")
+	}
+}
+
+func TestReadAttachment_SizeCap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "docker-compose.yml")
+	content := strings.Repeat("services:\n  web:\n    image: nginx\n", MaxAttachmentSize/10)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	attachment, err := ReadAttachment(path)
+	if err != nil {
+		t.Fatalf("ReadAttachment() error = %v", err)
+	}
+	if attachment.Name != path {
+		t.Errorf("Name = %q, want %q", attachment.Name, path)
+	}
+	if !attachment.Truncated {
+		t.Error("Truncated = false, want true for oversized file")
+	}
+	if len(attachment.Content) > MaxAttachmentSize+len("... [truncated]") {
+		t.Errorf("Content length = %d, exceeds cap", len(attachment.Content))
+	}
+}
+
+func TestReadAttachment_MissingFile(t *testing.T) {
+	if _, err := ReadAttachment(filepath.Join(t.TempDir(), "missing.yml")); err == nil {
+		t.Error("ReadAttachment() should fail for a missing file")
+	}
+}
+
+func TestIngestTeeFromReader_PassesThroughFullInput(t *testing.T) {
+	input := strings.Repeat("line of pipeline output\n", MaxInputSize/10)
+	var passthrough strings.Builder
+
+	result, err := IngestTeeFromReader(strings.NewReader(input), &passthrough, MaxInputSize)
+	if err != nil {
+		t.Fatalf("IngestTeeFromReader() error = %v, want nil", err)
+	}
+
+	if passthrough.String() != input {
+		t.Error("IngestTeeFromReader() should copy the full input unmodified")
+	}
+	if !strings.Contains(result, "[TRUNCATED") {
+		t.Error("IngestTeeFromReader() should still truncate the analyzed copy")
+	}
+}
@@ -0,0 +1,56 @@
+package ingestor
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Toolchains DetectToolchain recognizes
+const (
+	ToolchainNPM        = "npm"
+	ToolchainYarn       = "yarn"
+	ToolchainPNPM       = "pnpm"
+	ToolchainPython     = "python" // A Python program that died with a traceback
+	ToolchainGradle     = "gradle"
+	ToolchainXcodebuild = "xcodebuild"
+)
+
+// Toolchains lists the toolchains DetectToolchain recognizes, e.g. for
+// validating a flag that names one
+var Toolchains = []string{ToolchainNPM, ToolchainYarn, ToolchainPNPM, ToolchainPython, ToolchainGradle, ToolchainXcodebuild}
+
+// toolchainMarkers are lines only one tool writes. Mobile builds are often
+// started through a package manager (yarn android), whose output then wraps
+// the build's, so they are checked first. Yarn and pnpm run npm scripts and
+// echo npm's messages, so they are checked before npm, and a traceback of a
+// script a package manager ran belongs to the install.
+var toolchainMarkers = []struct {
+	toolchain string
+	pattern   *regexp.Regexp
+}{
+	{ToolchainGradle, regexp.MustCompile(`^> Task :|^FAILURE: Build (?:failed|completed) with|^BUILD (?:FAILED|SUCCESSFUL) in \d`)},
+	{ToolchainXcodebuild, regexp.MustCompile(`^\*\* [A-Z ]+ (?:FAILED|SUCCEEDED) \*\*|^=== BUILD TARGET |^xcodebuild: error:|\(in target '[^']+' from project '[^']+'\)`)},
+	{ToolchainPNPM, regexp.MustCompile(`ERR_PNPM_|^Progress: resolved \d+, reused \d+|^Scope: all \d+ workspace projects`)},
+	{ToolchainYarn, regexp.MustCompile(`^(?:➤ )?YN\d{4}:|^yarn (?:install|add|run|upgrade) v\d|^error An unexpected error occurred:|^info Visit https://yarnpkg\.com`)},
+	{ToolchainNPM, regexp.MustCompile(`^npm (?:ERR!|error|WARN|warn) `)},
+	{ToolchainPython, regexp.MustCompile(`Traceback \(most recent call last\):`)},
+}
+
+// DetectToolchain returns the build tool or package manager that wrote log,
+// one of the Toolchain constants, or "" if it isn't recognized
+func DetectToolchain(log string) string {
+	lines := strings.Split(log, "\n")
+	for _, marker := range toolchainMarkers {
+		for _, line := range lines {
+			if marker.pattern.MatchString(line) {
+				return marker.toolchain
+			}
+		}
+	}
+	return ""
+}
+
+// IsJavaScript reports whether toolchain is a JavaScript package manager
+func IsJavaScript(toolchain string) bool {
+	return toolchain == ToolchainNPM || toolchain == ToolchainYarn || toolchain == ToolchainPNPM
+}
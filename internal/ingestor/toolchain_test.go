@@ -0,0 +1,28 @@
+package ingestor
+
+import "testing"
+
+func TestDetectToolchain(t *testing.T) {
+	tests := []struct {
+		name string
+		log  string
+		want string
+	}{
+		{"npm 10", "npm error code ERESOLVE\nnpm error ERESOLVE unable to resolve dependency tree", ToolchainNPM},
+		{"npm 8", "npm ERR! code E404\nnpm ERR! 404 Not Found - GET https://registry.npmjs.org/left-padd", ToolchainNPM},
+		{"yarn classic", "yarn install v1.22.19\n[1/4] Resolving packages...\nerror Couldn't find package \"left-padd\" on the \"npm\" registry.", ToolchainYarn},
+		{"yarn berry", "➤ YN0000: ┌ Resolution step\n➤ YN0001: │ Error: left-padd@npm:^1.0.0: Response Code: 404", ToolchainYarn},
+		{"pnpm running npm scripts", "npm WARN config production Use `--omit=dev` instead.\n ERR_PNPM_FETCH_404  GET https://registry.npmjs.org/left-padd: Not Found - 404", ToolchainPNPM},
+		{"python", "Traceback (most recent call last):\n  File \"/app/main.py\", line 3, in <module>\n    import yaml\nModuleNotFoundError: No module named 'yaml'", ToolchainPython},
+		{"gradle via yarn", "yarn run v1.22.19\n> Task :app:compileDebugKotlin FAILED\ne: file:///app/src/main/MainActivity.kt:10:5 Unresolved reference: foo", ToolchainGradle},
+		{"xcodebuild", "CompileSwift normal arm64 /app/App/ContentView.swift (in target 'App' from project 'App')\n** BUILD FAILED **", ToolchainXcodebuild},
+		{"unrelated", "ERROR: connection refused\nnpm is not mentioned at line start here: npm ERR!", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectToolchain(tt.log); got != tt.want {
+				t.Errorf("DetectToolchain() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
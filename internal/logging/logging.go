@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// DefaultLevel is used when neither --log-level nor QUE_LOG_LEVEL is set
+const DefaultLevel = "warn"
+
+// Logger is the process-wide diagnostic logger. It is silent until Init is called.
+var Logger = zerolog.Nop()
+
+// Init configures Logger to write human-readable entries at or above level to
+// stderr. If logFile is non-empty, every entry down to debug level is also
+// appended to it as JSON so it can be attached to bug reports.
+// The returned close function must be called before the process exits.
+func Init(level string, logFile string) (func() error, error) {
+	return InitWithWriter(os.Stderr, level, logFile)
+}
+
+// InitWithWriter is like Init but writes console output to w (useful for testing)
+func InitWithWriter(w io.Writer, level string, logFile string) (func() error, error) {
+	if level == "" {
+		level = DefaultLevel
+	}
+	lvl, err := zerolog.ParseLevel(strings.ToLower(level))
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q (must be one of trace, debug, info, warn, error, disabled)", level)
+	}
+
+	console := zerolog.ConsoleWriter{
+		Out:          w,
+		PartsExclude: []string{zerolog.TimestampFieldName},
+	}
+	writers := []io.Writer{&zerolog.FilteredLevelWriter{
+		Writer: zerolog.LevelWriterAdapter{Writer: console},
+		Level:  lvl,
+	}}
+
+	closeFn := func() error { return nil }
+	loggerLevel := lvl
+	if logFile != "" {
+		f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		writers = append(writers, f)
+		closeFn = f.Close
+		loggerLevel = zerolog.DebugLevel
+		if lvl < loggerLevel {
+			loggerLevel = lvl
+		}
+	}
+
+	Logger = zerolog.New(zerolog.MultiLevelWriter(writers...)).
+		Level(loggerLevel).
+		With().Timestamp().Logger()
+
+	return closeFn, nil
+}
+
+// Debug starts a new message with debug level
+func Debug() *zerolog.Event {
+	return Logger.Debug()
+}
+
+// Info starts a new message with info level
+func Info() *zerolog.Event {
+	return Logger.Info()
+}
+
+// Warn starts a new message with warn level
+func Warn() *zerolog.Event {
+	return Logger.Warn()
+}
+
+// Error starts a new message with error level
+func Error() *zerolog.Event {
+	return Logger.Error()
+}
@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInitWithWriter_FiltersByLevel(t *testing.T) {
+	var buf bytes.Buffer
+	closeFn, err := InitWithWriter(&buf, "warn", "")
+	if err != nil {
+		t.Fatalf("InitWithWriter() error = %v", err)
+	}
+	defer closeFn()
+
+	Debug().Msg("debug message")
+	Warn().Msg("warn message")
+
+	if strings.Contains(buf.String(), "debug message") {
+		t.Error("Debug message should be filtered at warn level")
+	}
+	if !strings.Contains(buf.String(), "warn message") {
+		t.Errorf("Warn message should be written, got: %q", buf.String())
+	}
+}
+
+func TestInitWithWriter_LogFileCapturesDebug(t *testing.T) {
+	var buf bytes.Buffer
+	logFile := filepath.Join(t.TempDir(), "que.log")
+
+	closeFn, err := InitWithWriter(&buf, "error", logFile)
+	if err != nil {
+		t.Fatalf("InitWithWriter() error = %v", err)
+	}
+
+	Debug().Str("provider", "openai").Msg("selected provider")
+	if err := closeFn(); err != nil {
+		t.Fatalf("close error = %v", err)
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("Console should not receive debug output at error level, got: %q", buf.String())
+	}
+
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if !strings.Contains(string(data), `"provider":"openai"`) {
+		t.Errorf("Log file should contain debug entry, got: %q", string(data))
+	}
+}
+
+func TestInitWithWriter_InvalidLevel(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := InitWithWriter(&buf, "loud", ""); err == nil {
+		t.Error("InitWithWriter() should fail for an unknown level")
+	}
+}
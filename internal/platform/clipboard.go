@@ -0,0 +1,66 @@
+// Package platform wraps the desktop integrations that differ between
+// operating systems, so features built on them work the same on Linux, macOS,
+// Windows and WSL.
+package platform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// ErrNoClipboard is returned by Copy when no clipboard tool is available,
+// e.g. on a server without a display
+var ErrNoClipboard = errors.New("no clipboard tool found")
+
+// clipboardTimeout bounds how long a clipboard tool may take
+const clipboardTimeout = 5 * time.Second
+
+// Copy puts text on the system clipboard with the first tool for this
+// platform (see clipboardCommands) that is installed and works: one that
+// fails, such as PowerShell blocked by policy, falls back to the next
+func Copy(text string) error {
+	var errs []error
+	for _, args := range clipboardCommands(os.Getenv) {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		err := runWithInput(args, text)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return ErrNoClipboard
+	}
+	return errors.Join(errs...)
+}
+
+// runWithInput runs args with text on stdin
+func runWithInput(args []string, text string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), clipboardTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = config.CommandEnv(os.Environ())
+	cmd.Stdin = strings.NewReader(text)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %w %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// windowsClipboard are the Windows clipboard tools, also reachable from WSL.
+// PowerShell is preferred since clip.exe garbles non-ASCII text.
+var windowsClipboard = [][]string{
+	{"powershell.exe", "-NoProfile", "-NonInteractive", "-Command",
+		"[Console]::InputEncoding = [Text.Encoding]::UTF8; Set-Clipboard -Value ([Console]::In.ReadToEnd())"},
+	{"clip.exe"},
+}
@@ -0,0 +1,6 @@
+package platform
+
+// clipboardCommands returns the clipboard tools to try, in order
+func clipboardCommands(getenv func(string) string) [][]string {
+	return [][]string{{"pbcopy"}}
+}
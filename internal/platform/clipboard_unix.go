@@ -0,0 +1,38 @@
+//go:build !windows && !darwin
+
+package platform
+
+import (
+	"os"
+	"strings"
+)
+
+// clipboardCommands returns the clipboard tools to try, in order: the
+// Windows host's under WSL, otherwise the tools of the running display server
+func clipboardCommands(getenv func(string) string) [][]string {
+	var commands [][]string
+	if isWSL(getenv) {
+		commands = append(commands, windowsClipboard...)
+	}
+	if getenv("WAYLAND_DISPLAY") != "" {
+		commands = append(commands, []string{"wl-copy"})
+	}
+	if getenv("DISPLAY") != "" {
+		commands = append(commands,
+			[]string{"xclip", "-selection", "clipboard"},
+			[]string{"xsel", "--clipboard", "--input"})
+	}
+	return commands
+}
+
+// osReleasePath holds the kernel release, which names Microsoft under WSL
+var osReleasePath = "/proc/sys/kernel/osrelease"
+
+// isWSL reports whether que runs under the Windows Subsystem for Linux
+func isWSL(getenv func(string) string) bool {
+	if getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+	release, err := os.ReadFile(osReleasePath)
+	return err == nil && strings.Contains(strings.ToLower(string(release)), "microsoft")
+}
@@ -0,0 +1,116 @@
+//go:build !windows && !darwin
+
+package platform
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeEnv returns a getenv reading from vars
+func fakeEnv(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func TestClipboardCommands(t *testing.T) {
+	original := osReleasePath
+	osReleasePath = filepath.Join(t.TempDir(), "osrelease")
+	defer func() { osReleasePath = original }()
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string
+	}{
+		{"headless", nil, nil},
+		{"wayland", map[string]string{"WAYLAND_DISPLAY": "wayland-0"}, []string{"wl-copy"}},
+		{"x11", map[string]string{"DISPLAY": ":0"}, []string{"xclip", "xsel"}},
+		{"wsl", map[string]string{"WSL_DISTRO_NAME": "Ubuntu"}, []string{"powershell.exe", "clip.exe"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, args := range clipboardCommands(fakeEnv(tt.env)) {
+				got = append(got, args[0])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("clipboardCommands() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsWSL_KernelRelease(t *testing.T) {
+	original := osReleasePath
+	osReleasePath = filepath.Join(t.TempDir(), "osrelease")
+	defer func() { osReleasePath = original }()
+
+	if err := os.WriteFile(osReleasePath, []byte("5.15.153.1-microsoft-standard-WSL2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !isWSL(fakeEnv(nil)) {
+		t.Error("isWSL() = false for a WSL kernel")
+	}
+	if err := os.WriteFile(osReleasePath, []byte("6.8.0-45-generic\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if isWSL(fakeEnv(nil)) {
+		t.Error("isWSL() = true for a plain Linux kernel")
+	}
+}
+
+func TestCopy(t *testing.T) {
+	// A fake xclip records what it was given
+	dir := t.TempDir()
+	out := filepath.Join(dir, "clipboard")
+	script := "#!/bin/sh\ncat > " + out + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "xclip"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("DISPLAY", ":0")
+	t.Setenv("WAYLAND_DISPLAY", "")
+	t.Setenv("WSL_DISTRO_NAME", "")
+	original := osReleasePath
+	osReleasePath = filepath.Join(dir, "osrelease")
+	defer func() { osReleasePath = original }()
+
+	if err := Copy("kubectl rollout undo deploy/payments"); err != nil {
+		t.Fatalf("Copy() error = %v", err)
+	}
+	got, _ := os.ReadFile(out)
+	if string(got) != "kubectl rollout undo deploy/payments" {
+		t.Errorf("clipboard = %q, want the copied text", got)
+	}
+
+	// A broken tool falls back to the next one
+	broken := []byte("#!/bin/sh\necho 'cannot open display' >&2\nexit 1\n")
+	if err := os.WriteFile(filepath.Join(dir, "xclip"), broken, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "xsel"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Copy("systemctl restart nginx"); err != nil {
+		t.Fatalf("Copy() with a broken xclip error = %v", err)
+	}
+	if got, _ := os.ReadFile(out); string(got) != "systemctl restart nginx" {
+		t.Errorf("clipboard = %q, want the text copied by xsel", got)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "xsel"), broken, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Copy("text"); err == nil || !strings.Contains(err.Error(), "xclip failed") || !strings.Contains(err.Error(), "xsel failed") {
+		t.Errorf("Copy() with only broken tools = %v, want the errors of both", err)
+	}
+
+	t.Setenv("DISPLAY", "")
+	if err := Copy("text"); err != ErrNoClipboard {
+		t.Errorf("Copy() without a display = %v, want ErrNoClipboard", err)
+	}
+}
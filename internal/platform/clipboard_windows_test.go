@@ -0,0 +1,10 @@
+package platform
+
+import "testing"
+
+func TestClipboardCommands(t *testing.T) {
+	commands := clipboardCommands(func(string) string { return "" })
+	if len(commands) != 2 || commands[0][0] != "powershell.exe" || commands[1][0] != "clip.exe" {
+		t.Errorf("clipboardCommands() = %q, want PowerShell then clip.exe", commands)
+	}
+}
@@ -0,0 +1,153 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultAllow lists the read-only commands agentic modes may run unless the
+// config replaces it. Patterns are matched against the whole command line.
+var DefaultAllow = []string{
+	`kubectl (get|describe|logs|top|events|version|explain|api-resources)( .*)?`,
+	`systemctl (status|show|is-active|is-enabled|is-failed|list-units|list-unit-files|cat)( .*)?`,
+	`journalctl( .*)?`,
+	`docker (ps|logs|inspect|version|info|images)( .*)?`,
+	`(cat|head|tail|ls|df|du|free|uptime|uname|ps|id|whoami|ss|netstat|dig|nslookup|host|lsof|stat|file|which)( .*)?`,
+	// These also change the system with some arguments, so only the ones
+	// that show it are allowed
+	`hostname( -[AdiIs]+| --(fqdn|long|short|domain|ip-address|all-ip-addresses))?`,
+	`ip (-(4|6|br|brief|s|stats|d|details|j|json|p|pretty|o|oneline|c|color) )*(addr|address|link|route|neigh|rule)( (show|list|get)( .*)?)?`,
+	`date( (\+\S+|-u|--utc|-R|-I\w*|--iso-8601(=\w+)?|--rfc-3339=\w+|-d \S+|--date=\S+))*`,
+}
+
+// DefaultDeny is always enforced, in addition to any configured deny patterns.
+// It blocks reads of secrets and commands that would never return.
+var DefaultDeny = []string{
+	`kubectl .*\bsecrets?\b.*`,
+	`.*\s(-\w*[fFw]\w*|--(follow|watch)(-only)?(=\S*)?)(\s.*)?`,
+	`.*/etc/(shadow|gshadow|sudoers)\b.*`,
+	`.*\.ssh/.*`,
+}
+
+// Decisions recorded in the audit log
+const (
+	DecisionBlocked  = "blocked"  // Rejected by the policy before the user was asked
+	DecisionDeclined = "declined" // Allowed by the policy but declined by the user
+	DecisionRan      = "ran"      // Approved and executed
+)
+
+// Policy decides which commands agentic modes may ever execute.
+// A command runs only if it matches an allow pattern and no deny pattern.
+type Policy struct {
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+// New compiles a policy. An empty allow list uses DefaultAllow; deny patterns
+// are added to DefaultDeny, which can't be removed.
+func New(allow, deny []string) (*Policy, error) {
+	if len(allow) == 0 {
+		allow = DefaultAllow
+	}
+
+	p := &Policy{}
+	var err error
+	if p.allow, err = compile(allow); err != nil {
+		return nil, err
+	}
+	if p.deny, err = compile(append(append([]string{}, DefaultDeny...), deny...)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Check reports whether args may run, and if not, why
+func (p *Policy) Check(args []string) (bool, string) {
+	line := strings.Join(args, " ")
+	for _, re := range p.deny {
+		if re.MatchString(line) {
+			return false, fmt.Sprintf("matches deny pattern %q", unanchor(re))
+		}
+	}
+	for _, re := range p.allow {
+		if re.MatchString(line) {
+			return true, ""
+		}
+	}
+	return false, "not in the allowlist"
+}
+
+// compile anchors and compiles patterns so they must match the whole command line
+func compile(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid command pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// unanchor returns the pattern as the user wrote it
+func unanchor(re *regexp.Regexp) string {
+	return strings.TrimSuffix(strings.TrimPrefix(re.String(), "^(?:"), ")$")
+}
+
+// AuditEntry is one line of the audit log
+type AuditEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Command   string    `json:"command"`
+	Reason    string    `json:"reason,omitempty"` // Why the model proposed it
+	Decision  string    `json:"decision"`
+	Detail    string    `json:"detail,omitempty"` // Policy reason or execution error
+}
+
+// AuditLog appends every command decision as a JSON line
+type AuditLog struct {
+	path string
+}
+
+// DefaultAuditPath returns the audit log location inside stateDir
+func DefaultAuditPath(stateDir string) string {
+	if stateDir == "" {
+		return ""
+	}
+	return filepath.Join(stateDir, "audit.log")
+}
+
+// NewAuditLog returns an audit log writing to path
+func NewAuditLog(path string) *AuditLog {
+	return &AuditLog{path: path}
+}
+
+// Record appends entry to the audit log
+func (a *AuditLog) Record(entry AuditEntry) error {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(a.path), 0700); err != nil {
+		return fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
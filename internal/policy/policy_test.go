@@ -0,0 +1,114 @@
+package policy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPolicy_DefaultRules(t *testing.T) {
+	p, err := New(nil, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		command string
+		allowed bool
+	}{
+		{"kubectl describe pod web-1", true},
+		{"kubectl logs web-1 --tail 100", true},
+		{"systemctl status nginx", true},
+		{"cat /etc/nginx/nginx.conf", true},
+		{"kubectl delete pod web-1", false},
+		{"kubectl get secret db-creds -o yaml", false},
+		{"kubectl logs web-1 -f", false},
+		{"systemctl restart nginx", false},
+		{"cat /etc/shadow", false},
+		{"rm -rf /tmp/cache", false},
+		{"hostname", true},
+		{"hostname --fqdn", true},
+		{"hostname -I", true},
+		{"hostname evil", false},
+		{"ip addr", true},
+		{"ip -br addr show dev eth0", true},
+		{"ip route get 10.0.0.1", true},
+		{"ip link set eth0 down", false},
+		{"ip route flush all", false},
+		{"ip -batch cmds.txt", false},
+		{"date", true},
+		{"date -u +%s", true},
+		{"date -s 2020-01-01", false},
+		{"date --set=2020-01-01", false},
+		{"journalctl -u nginx --since today", true},
+		{"journalctl -fu nginx", false},
+		{"tail -F /var/log/syslog", false},
+		{"kubectl logs web-1 --follow=true", false},
+		{"kubectl get pods --watch-only", false},
+		{"ps aux", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			allowed, reason := p.Check(strings.Fields(tt.command))
+			if allowed != tt.allowed {
+				t.Errorf("Check(%q) = %v (%s), want %v", tt.command, allowed, reason, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestPolicy_Configured(t *testing.T) {
+	p, err := New([]string{`helm (status|history) .*`}, []string{`.*kube-system.*`})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if allowed, _ := p.Check([]string{"helm", "status", "web"}); !allowed {
+		t.Error("Configured allow pattern should be allowed")
+	}
+	if allowed, _ := p.Check([]string{"kubectl", "get", "pods"}); allowed {
+		t.Error("A configured allowlist replaces the defaults")
+	}
+	if allowed, _ := p.Check([]string{"helm", "status", "kube-system"}); allowed {
+		t.Error("Configured deny pattern should win over allow")
+	}
+	if allowed, _ := p.Check([]string{"helm", "status", "web", "--watch"}); allowed {
+		t.Error("Default deny patterns should always apply")
+	}
+}
+
+func TestNew_InvalidPattern(t *testing.T) {
+	if _, err := New([]string{"kubectl ("}, nil); err == nil {
+		t.Error("New() should reject invalid patterns")
+	}
+}
+
+func TestAuditLog_Record(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "que", "audit.log")
+	audit := NewAuditLog(path)
+
+	for _, decision := range []string{DecisionBlocked, DecisionRan} {
+		if err := audit.Record(AuditEntry{Command: "kubectl get pods", Decision: decision}); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Audit log not written: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 audit entries, got %d", len(lines))
+	}
+	var entry AuditEntry
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("Audit entry is not valid JSON: %v", err)
+	}
+	if entry.Decision != DecisionRan || entry.Timestamp.IsZero() {
+		t.Errorf("Unexpected audit entry: %+v", entry)
+	}
+}
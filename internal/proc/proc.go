@@ -0,0 +1,83 @@
+// Package proc runs the commands que starts on its own (environment probes,
+// investigation commands) with a time limit and a cap on their output, so a
+// hung or chatty command can't stall or flood an analysis.
+package proc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/textutil"
+)
+
+// waitDelay is how long Output waits for a killed command's children to
+// close its output before giving up on them
+const waitDelay = time.Second
+
+// Limits bounds a command
+type Limits struct {
+	Timeout   time.Duration // Kill the command after this long (0 for no limit)
+	MaxOutput int           // Keep at most this many bytes of output (0 for no limit)
+}
+
+// Output runs args without a shell and returns its combined stdout and
+// stderr. Output beyond MaxOutput is dropped and marked with
+// textutil.TruncationMarker. The command doesn't inherit que's credentials.
+func Output(ctx context.Context, limits Limits, args ...string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("no command to run")
+	}
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+
+	output := &cappedBuffer{limit: limits.MaxOutput}
+	command := exec.CommandContext(ctx, args[0], args[1:]...)
+	command.Env = config.CommandEnv(os.Environ())
+	command.Stdout = output
+	command.Stderr = output
+	command.WaitDelay = waitDelay
+
+	err := command.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("%s timed out after %s", args[0], limits.Timeout)
+	}
+	return output.String(), err
+}
+
+// cappedBuffer keeps the first limit bytes written to it and discards the
+// rest, still reporting them as written so the command isn't stopped by a
+// broken pipe
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// Write implements io.Writer
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.limit <= 0 {
+		return b.buf.Write(p)
+	}
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:max(room, 0)])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// String returns what was kept, marked if anything was dropped
+func (b *cappedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + textutil.TruncationMarker
+	}
+	return b.buf.String()
+}
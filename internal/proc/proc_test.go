@@ -0,0 +1,52 @@
+package proc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenian/que/internal/textutil"
+)
+
+func TestOutput(t *testing.T) {
+	output, err := Output(context.Background(), Limits{Timeout: 5 * time.Second}, "echo", "hello")
+	if err != nil {
+		t.Fatalf("Output() error = %v", err)
+	}
+	if output != "hello\n" {
+		t.Errorf("Output() = %q, want hello", output)
+	}
+}
+
+func TestOutput_Timeout(t *testing.T) {
+	start := time.Now()
+	_, err := Output(context.Background(), Limits{Timeout: 100 * time.Millisecond}, "sleep", "10")
+	if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Errorf("Output() error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Output() returned after %s, want right after the timeout", elapsed)
+	}
+}
+
+func TestOutput_MaxOutput(t *testing.T) {
+	output, err := Output(context.Background(), Limits{MaxOutput: 10}, "printf", "%s", strings.Repeat("x", 100))
+	if err != nil {
+		t.Fatalf("Output() error = %v", err)
+	}
+	if output != strings.Repeat("x", 10)+textutil.TruncationMarker {
+		t.Errorf("Output() = %q, want 10 bytes and the truncation marker", output)
+	}
+}
+
+func TestOutput_NoCredentials(t *testing.T) {
+	t.Setenv("QUE_CLAUDE_API_KEY", "sk-secret")
+	output, err := Output(context.Background(), Limits{}, "env")
+	if err != nil {
+		t.Fatalf("Output() error = %v", err)
+	}
+	if strings.Contains(output, "sk-secret") {
+		t.Error("the command inherited que's API key")
+	}
+}
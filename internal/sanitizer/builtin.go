@@ -0,0 +1,114 @@
+package sanitizer
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/zricethezav/gitleaks/v8/report"
+)
+
+// builtinRules find secrets the default gitleaks ruleset misses, or only
+// finds with generic rules that don't say what the secret is: cloud session
+// tokens and the Kubernetes credentials kubectl prints in its debug output
+// (--v=8 and up). Their findings take precedence over overlapping gitleaks
+// findings (see withoutOverlaps).
+var builtinRules = []Rule{
+	{
+		// Temporary credentials from STS; the prefixes are the base64 of the token header
+		ID:          "aws-session-token",
+		Description: "AWS session token",
+		Regex:       regexp.MustCompile(`(?:IQoJb3JpZ2luX2Vj|FwoGZXIvYXdz)(?:[A-Za-z0-9/+=]|%2[BFbf]|%3[Dd]){40,}`),
+	},
+	{
+		ID:          "aws-session-token",
+		Description: "AWS session token",
+		Regex:       regexp.MustCompile(`(?i)(?:aws_session_token|sessiontoken|security[-_]token)["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{100,})`),
+		SecretGroup: 1,
+	},
+	{
+		ID:          "gcp-oauth-token",
+		Description: "GCP OAuth access token",
+		Regex:       regexp.MustCompile(`\bya29\.[0-9A-Za-z._-]{20,}`),
+	},
+	{
+		ID:          "gcp-oauth-refresh-token",
+		Description: "GCP OAuth refresh token",
+		Regex:       regexp.MustCompile(`\b1//0[0-9A-Za-z_-]{40,}`),
+	},
+	{
+		// Every bearer token client-go logs, whatever its format
+		ID:          "kubectl-bearer-token",
+		Description: "Kubernetes bearer token in kubectl debug output",
+		Regex:       regexp.MustCompile(`round_trippers\.go:\d+\].*?[Aa]uthorization:\s*[Bb]earer\s+([^\s"'<>]+)`),
+		SecretGroup: 1,
+	},
+	{
+		ID:          "kubectl-token-flag",
+		Description: "Kubernetes bearer token passed to kubectl",
+		Regex:       regexp.MustCompile(`\bkubectl\b.*?--token[= ]["']?([^\s"']{8,})`),
+		SecretGroup: 1,
+	},
+	{
+		ID:          "kubernetes-bootstrap-token",
+		Description: "Kubernetes bootstrap token",
+		Regex:       regexp.MustCompile(`(?i:bearer\s+|token["']?\s*[:=]\s*["']?|--token[= ])([a-z0-9]{6}\.[a-z0-9]{16})\b`),
+		SecretGroup: 1,
+	},
+	{
+		ID:          "kubernetes-openshift-token",
+		Description: "OpenShift OAuth token",
+		Regex:       regexp.MustCompile(`\bsha256~[A-Za-z0-9_-]{43}`),
+	},
+	{
+		ID:          "kubeconfig-rancher-token",
+		Description: "Rancher kubeconfig token",
+		Regex:       regexp.MustCompile(`\b(?:kubeconfig-u(?:ser)?|token)-[a-z0-9]{5,}:[a-z0-9]{40,}`),
+	},
+	{
+		// The base64 of a PEM private key, so the private key rule can't see it
+		ID:          "kubeconfig-client-key",
+		Description: "Kubeconfig client private key",
+		Regex:       regexp.MustCompile(`client-key-data:\s*["']?([A-Za-z0-9+/=]{16,})`),
+		SecretGroup: 1,
+	},
+}
+
+// builtinFindings returns the findings of the built-in rules in input,
+// private keys included
+func builtinFindings(input string) []report.Finding {
+	return append(privateKeyFindings(input), matchRules(builtinRules, input)...)
+}
+
+// withoutOverlaps drops the findings whose secret contains or is part of
+// the secret of a preferred finding. Generic rules often match a key name
+// along with a secret a built-in rule finds on its own; keeping both would
+// make the result depend on which is replaced first.
+func withoutOverlaps(findings, preferred []report.Finding) []report.Finding {
+	if len(preferred) == 0 {
+		return findings
+	}
+	var kept []report.Finding
+	for _, finding := range findings {
+		secret := findingSecret(finding)
+		overlaps := false
+		for _, p := range preferred {
+			other := findingSecret(p)
+			if secret != "" && (strings.Contains(secret, other) || strings.Contains(other, secret)) {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			kept = append(kept, finding)
+		}
+	}
+	return kept
+}
+
+// findingSecret returns the text a finding redacts
+func findingSecret(finding report.Finding) string {
+	if finding.Match != "" {
+		return finding.Match
+	}
+	return finding.Secret
+}
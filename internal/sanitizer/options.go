@@ -0,0 +1,75 @@
+package sanitizer
+
+import (
+	"regexp"
+
+	"github.com/jenian/que/internal/logging"
+)
+
+// Rule is an extra detection rule added with WithRules, for secrets the
+// gitleaks ruleset doesn't know about (e.g. internal token formats)
+type Rule struct {
+	ID          string         // Rule identifier reported in findings, e.g. "acme-session-token"
+	Description string         // Human-readable description reported in findings
+	Regex       *regexp.Regexp // Pattern matching the secret
+	SecretGroup int            // Capture group holding the secret; 0 redacts the whole match
+}
+
+// Option configures a redactor created by NewRedactor
+type Option func(*redactor)
+
+// WithDetector replaces the default gitleaks detector (e.g. with a mock in tests)
+func WithDetector(detector Detector) Option {
+	return func(r *redactor) {
+		r.detector = detector
+	}
+}
+
+// WithRules adds detection rules on top of the detector's own
+func WithRules(rules ...Rule) Option {
+	return func(r *redactor) {
+		r.rules = append(r.rules, rules...)
+	}
+}
+
+// WithAllowlist keeps secrets matching any of the patterns unredacted,
+// whichever rule found them (e.g. well-known example keys)
+func WithAllowlist(patterns ...*regexp.Regexp) Option {
+	return func(r *redactor) {
+		r.allowlist = append(r.allowlist, patterns...)
+	}
+}
+
+// WithPlaceholderTemplate replaces the built-in placeholders such as
+// <REDACTED_GITHUB_TOKEN> with template, in which {type} stands for the kind
+// of secret (e.g. GITHUB_TOKEN), {rule} for the ID of the rule that found it
+// and {n} numbers the distinct secrets of an input in order of appearance,
+// e.g. "[REDACTED:{type}:{n}]". An invalid template is reported and the
+// built-in placeholders are kept, as with a broken custom ruleset.
+func WithPlaceholderTemplate(template string) Option {
+	return func(r *redactor) {
+		if template == "" {
+			return
+		}
+		if err := ValidatePlaceholderTemplate(template); err != nil {
+			logging.Warn().Err(err).Msg("Ignoring redaction placeholder")
+			return
+		}
+		r.template = template
+	}
+}
+
+// placeholder returns what the nth distinct secret, found by ruleID, is replaced with
+func (r *redactor) placeholder(ruleID, description string, n int) string {
+	return getRedactionPlaceholder(r.template, ruleID, description, n)
+}
+
+// allowed reports whether secret matches the allowlist
+func (r *redactor) allowed(secret string) bool {
+	for _, pattern := range r.allowlist {
+		if pattern.MatchString(secret) {
+			return true
+		}
+	}
+	return false
+}
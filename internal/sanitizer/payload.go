@@ -0,0 +1,49 @@
+package sanitizer
+
+import "github.com/jenian/que/internal/config"
+
+// RedactPayload redacts every part of payload that is sent to the model
+// besides the log: the system context, the hint, the attachments and the
+// previous analysis. The log is redacted by the caller first, since its line
+// numbers have to be mapped back to the input. RedactPayload is the last step
+// before a payload leaves the machine, so it runs even on parts that were
+// redacted earlier; placeholders never match a rule, so that is harmless.
+func RedactPayload(redactor config.Redactor, payload *config.QueryPayload) []config.FindingDetail {
+	findings := RedactContext(redactor, &payload.SystemContext)
+	redact := func(s *string) {
+		var found []config.FindingDetail
+		*s, _, found = redactor.RedactWithDetails(*s, true)
+		findings = append(findings, found...)
+	}
+
+	redact(&payload.Hint)
+	// Attachments may be shared with a session, so they are replaced rather than edited
+	attachments := make([]config.Attachment, len(payload.Attachments))
+	for i, attachment := range payload.Attachments {
+		redact(&attachment.Name)
+		redact(&attachment.Content)
+		attachments[i] = attachment
+	}
+	if payload.Attachments != nil {
+		payload.Attachments = attachments
+	}
+	if payload.Previous != nil {
+		previous := *payload.Previous
+		redact(&previous.RootCause)
+		redact(&previous.Fix)
+		payload.Previous = &previous
+	}
+	return findings
+}
+
+// RedactContext redacts the system context, which is read from the
+// environment and may carry anything the user put there
+func RedactContext(redactor config.Redactor, ctx *config.Context) []config.FindingDetail {
+	var findings []config.FindingDetail
+	for _, field := range []*string{&ctx.OS, &ctx.Arch, &ctx.Shell} {
+		var found []config.FindingDetail
+		*field, _, found = redactor.RedactWithDetails(*field, true)
+		findings = append(findings, found...)
+	}
+	return findings
+}
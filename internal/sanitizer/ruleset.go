@@ -0,0 +1,216 @@
+package sanitizer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/jenian/que/internal/logging"
+	"github.com/spf13/viper"
+	gitleaksconfig "github.com/zricethezav/gitleaks/v8/config"
+	"github.com/zricethezav/gitleaks/v8/detect"
+)
+
+// CustomConfigPath is the gitleaks config merged into the default ruleset when present
+const CustomConfigPath = ".gitleaks-custom.toml"
+
+// LoadRuleset returns the default gitleaks ruleset extended with the config at
+// customPath, if that file exists. Custom rules with the ID of a default rule
+// override its fields and add to its keywords and allowlists; other rules are
+// added. Allowlists (including stopwords) are added to the default ones, and
+// [extend] disabledRules removes default rules. Any error in the custom config
+// is returned rather than silently ignored.
+//
+// Without a custom config the compiled default ruleset is shared, so only the
+// first call pays for compiling it.
+func LoadRuleset(customPath string) (gitleaksconfig.Config, error) {
+	if customPath == "" {
+		return defaultRuleset()
+	}
+	custom, err := readCustomConfig(customPath)
+	if err != nil {
+		return gitleaksconfig.Config{}, fmt.Errorf("%s: %w", customPath, err)
+	}
+	if custom == nil {
+		return defaultRuleset()
+	}
+
+	// Merging happens before translation, so the defaults are parsed afresh
+	base, err := readViperConfig(strings.NewReader(gitleaksconfig.DefaultConfig))
+	if err != nil {
+		return gitleaksconfig.Config{}, fmt.Errorf("failed to load default gitleaks config: %w", err)
+	}
+	if err := mergeViperConfigs(&base, custom); err != nil {
+		return gitleaksconfig.Config{}, fmt.Errorf("%s: %w", customPath, err)
+	}
+	cfg, err := translate(&base)
+	if err != nil {
+		return gitleaksconfig.Config{}, fmt.Errorf("%s: %w", customPath, err)
+	}
+	return cfg, nil
+}
+
+// defaultRuleset compiles the built-in gitleaks rules once per process.
+// Compiling their regexes is most of the cost of creating a redactor.
+var defaultRuleset = sync.OnceValues(func() (gitleaksconfig.Config, error) {
+	vc, err := readViperConfig(strings.NewReader(gitleaksconfig.DefaultConfig))
+	if err != nil {
+		return gitleaksconfig.Config{}, fmt.Errorf("failed to load default gitleaks config: %w", err)
+	}
+	return translate(&vc)
+})
+
+// Preload starts compiling the default ruleset in the background, so it is
+// ready by the time input has been read. Redactors created before it finishes
+// wait for it instead of compiling the rules again.
+func Preload() {
+	go defaultRuleset()
+}
+
+// WithRuleset uses a gitleaks detector for cfg, e.g. a ruleset from LoadRuleset
+func WithRuleset(cfg gitleaksconfig.Config) Option {
+	return WithDetector(detect.NewDetector(cfg))
+}
+
+// defaultDetector builds the detector used when no other was configured. A
+// broken custom config is reported and skipped rather than disabling redaction.
+func defaultDetector() Detector {
+	cfg, err := LoadRuleset(CustomConfigPath)
+	if err != nil {
+		logging.Warn().Err(err).Msg("Ignoring custom gitleaks config")
+		if cfg, err = LoadRuleset(""); err != nil {
+			// Fallback to empty config if we can't load default
+			cfg = gitleaksconfig.Config{}
+		}
+	}
+	return detect.NewDetector(cfg)
+}
+
+// readCustomConfig parses the gitleaks config at path, or returns nil if it doesn't exist
+func readCustomConfig(path string) (*gitleaksconfig.ViperConfig, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	vc, err := readViperConfig(f)
+	if err != nil {
+		return nil, err
+	}
+	return &vc, nil
+}
+
+// readViperConfig parses a gitleaks TOML config. A private viper instance keeps
+// this independent of the global one (and of que's own config file).
+func readViperConfig(r io.Reader) (gitleaksconfig.ViperConfig, error) {
+	v := viper.New()
+	v.SetConfigType("toml")
+	if err := v.ReadConfig(r); err != nil {
+		return gitleaksconfig.ViperConfig{}, err
+	}
+
+	var vc gitleaksconfig.ViperConfig
+	if err := v.Unmarshal(&vc); err != nil {
+		return gitleaksconfig.ViperConfig{}, err
+	}
+	return vc, nil
+}
+
+// mergeViperConfigs merges custom into base before translation, so rules that
+// only add allowlists to a default rule are validated together with it.
+// gitleaks' own [extend] relies on global state, hence merging here.
+func mergeViperConfigs(base, custom *gitleaksconfig.ViperConfig) error {
+	if custom.Extend.Path != "" || custom.Extend.URL != "" {
+		return errors.New("[extend] path and url are not supported; the config always extends the default ruleset")
+	}
+
+	normalizeAllowlists(base)
+	normalizeAllowlists(custom)
+
+	for _, id := range custom.Extend.DisabledRules {
+		found := false
+		for i := range base.Rules {
+			if base.Rules[i].ID == id {
+				base.Rules = append(base.Rules[:i], base.Rules[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			logging.Warn().Str("rule", id).Msg("Disabled gitleaks rule doesn't exist")
+		}
+	}
+
+	for _, rule := range custom.Rules {
+		if rule.ID == "" {
+			return errors.New("[[rules]] entry without an id")
+		}
+
+		i := 0
+		for i < len(base.Rules) && base.Rules[i].ID != rule.ID {
+			i++
+		}
+		if i == len(base.Rules) {
+			base.Rules = append(base.Rules, rule)
+			continue
+		}
+
+		existing := &base.Rules[i]
+		if rule.Description != "" {
+			existing.Description = rule.Description
+		}
+		if rule.Regex != "" {
+			existing.Regex = rule.Regex
+		}
+		if rule.Path != "" {
+			existing.Path = rule.Path
+		}
+		if rule.SecretGroup != 0 {
+			existing.SecretGroup = rule.SecretGroup
+		}
+		if rule.Entropy != 0 {
+			existing.Entropy = rule.Entropy
+		}
+		existing.Keywords = append(existing.Keywords, rule.Keywords...)
+		existing.Tags = append(existing.Tags, rule.Tags...)
+		existing.Allowlists = append(existing.Allowlists, rule.Allowlists...)
+		existing.Required = append(existing.Required, rule.Required...)
+		existing.SkipReport = existing.SkipReport || rule.SkipReport
+	}
+
+	base.Allowlists = append(base.Allowlists, custom.Allowlists...)
+	base.Extend = gitleaksconfig.Extend{}
+	return nil
+}
+
+// normalizeAllowlists moves the deprecated single [allowlist] tables into the
+// [[allowlists]] lists, which gitleaks refuses to see used together
+func normalizeAllowlists(vc *gitleaksconfig.ViperConfig) {
+	if vc.AllowList != nil {
+		vc.Allowlists = append(vc.Allowlists, vc.AllowList)
+		vc.AllowList = nil
+	}
+	for i := range vc.Rules {
+		if vc.Rules[i].AllowList != nil {
+			vc.Rules[i].Allowlists = append(vc.Rules[i].Allowlists, vc.Rules[i].AllowList)
+			vc.Rules[i].AllowList = nil
+		}
+	}
+}
+
+// translate compiles vc, turning gitleaks' panics on invalid regexes into errors
+func translate(vc *gitleaksconfig.ViperConfig) (cfg gitleaksconfig.Config, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid gitleaks config: %v", r)
+		}
+	}()
+	return vc.Translate()
+}
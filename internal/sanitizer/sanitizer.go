@@ -1,17 +1,24 @@
 package sanitizer
 
 import (
-	"os"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/jenian/que/internal/config"
 	"github.com/rs/zerolog"
-	"github.com/spf13/viper"
-	gitleaksconfig "github.com/zricethezav/gitleaks/v8/config"
-	"github.com/zricethezav/gitleaks/v8/detect"
+	gitleakslogging "github.com/zricethezav/gitleaks/v8/logging"
 	"github.com/zricethezav/gitleaks/v8/report"
 )
 
+func init() {
+	// Silence gitleaks' own logger without touching the global zerolog level,
+	// which would also mute que's diagnostic logger
+	gitleakslogging.Logger = zerolog.Nop()
+}
+
 // Detector is an interface for secret detection
 type Detector interface {
 	DetectString(content string) []report.Finding
@@ -19,76 +26,34 @@ type Detector interface {
 
 // redactor implements the Redactor interface using gitleaks for detection
 type redactor struct {
-	detector Detector
+	detector  Detector
+	rules     []Rule           // Extra rules applied on top of the detector
+	allowlist []*regexp.Regexp // Secrets matching any of these are left alone
+	template  string           // Placeholder template with {type}, {rule} and {n} tokens (empty means the default)
 }
 
-// NewRedactor creates a new redactor with gitleaks detector and custom rules
-func NewRedactor() config.Redactor {
-	return NewRedactorWithDetector(nil)
-}
-
-// NewRedactorWithDetector creates a new redactor with the provided detector.
-// If detector is nil, it creates a default gitleaks detector.
-func NewRedactorWithDetector(detector Detector) config.Redactor {
-	// Disable gitleaks logging
-	zerolog.SetGlobalLevel(zerolog.Disabled)
-
-	// If detector is provided, use it
-	if detector != nil {
-		return &redactor{detector: detector}
-	}
-
-	// Otherwise, create default gitleaks detector
-	cfg, err := loadDefaultConfig()
-	if err != nil {
-		// Fallback to empty config if we can't load default
-		defaultDetector := detect.NewDetector(gitleaksconfig.Config{})
-		return &redactor{detector: defaultDetector}
+// NewRedactor creates a new redactor with gitleaks detector and custom rules.
+// Options add rules, allowlist known-safe values or change the placeholders,
+// so library users can configure redaction without TOML files.
+//
+// Redactors share no mutable state: they may be created and used from several
+// goroutines at once, and a single redactor may redact concurrently.
+func NewRedactor(opts ...Option) config.Redactor {
+	r := &redactor{}
+	for _, opt := range opts {
+		opt(r)
 	}
 
-	defaultDetector := detect.NewDetector(cfg)
-	return &redactor{
-		detector: defaultDetector,
+	if r.detector == nil {
+		r.detector = defaultDetector()
 	}
+	return r
 }
 
-// loadDefaultConfig loads the default gitleaks configuration and merges custom rules
-func loadDefaultConfig() (gitleaksconfig.Config, error) {
-	// Use the same approach as NewDetectorDefaultConfig
-	// Reset viper to avoid state issues
-	viper.Reset()
-	viper.SetConfigType("toml")
-
-	// Load default config
-	err := viper.ReadConfig(strings.NewReader(gitleaksconfig.DefaultConfig))
-	if err != nil {
-		return gitleaksconfig.Config{}, err
-	}
-
-	// Try to load custom rules from TOML file
-	customConfigPath := ".gitleaks-custom.toml"
-	if _, err := os.Stat(customConfigPath); err == nil {
-		// Custom config file exists, merge it
-		viper.SetConfigFile(customConfigPath)
-		err = viper.MergeInConfig()
-		if err != nil {
-			// If merge fails, continue with default config only
-			// This is not a fatal error
-		}
-	}
-
-	var vc gitleaksconfig.ViperConfig
-	err = viper.Unmarshal(&vc)
-	if err != nil {
-		return gitleaksconfig.Config{}, err
-	}
-
-	cfg, err := vc.Translate()
-	if err != nil {
-		return gitleaksconfig.Config{}, err
-	}
-
-	return cfg, nil
+// NewRedactorWithDetector creates a new redactor with the provided detector.
+// If detector is nil, it creates a default gitleaks detector.
+func NewRedactorWithDetector(detector Detector) config.Redactor {
+	return NewRedactor(WithDetector(detector))
 }
 
 // Redact uses gitleaks to detect secrets and redacts them from the input
@@ -109,7 +74,14 @@ func (r *redactor) RedactWithDetails(input string, verbose bool) (string, int, [
 	var details []config.FindingDetail
 
 	// Use gitleaks to detect secrets
-	findings := r.detector.DetectString(input)
+	builtinFound := builtinFindings(input)
+	findings := withoutOverlaps(r.detector.DetectString(input), builtinFound)
+	// Findings from index detected on come from the built-in rules, and
+	// from index builtin on from the extra rules
+	detected := len(findings)
+	findings = append(findings, builtinFound...)
+	builtin := len(findings)
+	findings = append(findings, matchRules(r.rules, input)...)
 
 	// Track redactions to avoid double-redacting
 	redacted := make(map[string]bool)
@@ -117,9 +89,10 @@ func (r *redactor) RedactWithDetails(input string, verbose bool) (string, int, [
 	// Process gitleaks findings
 	if len(findings) > 0 {
 		// First, collect all findings for verbose output and determine unique secrets to redact
-		uniqueSecrets := make(map[string]string) // secret -> placeholder
+		uniqueSecrets := make(map[string]report.Finding) // secret -> first finding of it
+		var order []string
 
-		for _, finding := range findings {
+		for i, finding := range findings {
 			// Use the Match field which contains the matched text
 			secret := finding.Match
 			if secret == "" {
@@ -127,10 +100,17 @@ func (r *redactor) RedactWithDetails(input string, verbose bool) (string, int, [
 				secret = finding.Secret
 			}
 
-			if secret == "" {
+			if secret == "" || r.allowed(secret) || r.allowed(finding.Secret) {
 				continue
 			}
 
+			source := "gitleaks"
+			if i >= builtin {
+				source = "custom"
+			} else if i >= detected {
+				source = "builtin"
+			}
+
 			// Always add to details for verbose output (even if same secret appears multiple times)
 			if verbose {
 				details = append(details, config.FindingDetail{
@@ -138,7 +118,7 @@ func (r *redactor) RedactWithDetails(input string, verbose bool) (string, int, [
 					Description: finding.Description,
 					Match:       finding.Match,
 					Secret:      finding.Secret,
-					Source:      "gitleaks",
+					Source:      source,
 					StartLine:   finding.StartLine,
 					EndLine:     finding.EndLine,
 					StartColumn: finding.StartColumn,
@@ -150,15 +130,34 @@ func (r *redactor) RedactWithDetails(input string, verbose bool) (string, int, [
 				})
 			}
 
-			// Track unique secrets and their placeholders (only need to redact once per unique secret)
+			// Only need to redact once per unique secret
 			if _, exists := uniqueSecrets[secret]; !exists {
-				placeholder := getRedactionPlaceholder(finding.RuleID, finding.Description)
-				uniqueSecrets[secret] = placeholder
+				uniqueSecrets[secret] = finding
+				order = append(order, secret)
+			}
+		}
+
+		// Number secrets by where they first appear, so {n} doesn't depend
+		// on the order the rules ran in
+		sort.SliceStable(order, func(i, j int) bool {
+			return strings.Index(input, order[i]) < strings.Index(input, order[j])
+		})
+		placeholders := make(map[string]string, len(order)) // secret -> placeholder
+		for i, secret := range order {
+			finding := uniqueSecrets[secret]
+			placeholders[secret] = r.placeholder(finding.RuleID, finding.Description, i+1)
+		}
+		for i := range details {
+			secret := details[i].Match
+			if secret == "" {
+				secret = details[i].Secret
 			}
+			details[i].Placeholder = placeholders[secret]
+			details[i].File = r.redactPath(details[i].File, order, placeholders)
 		}
 
 		// Now redact all unique secrets
-		for secret, placeholder := range uniqueSecrets {
+		for secret, placeholder := range placeholders {
 			if !redacted[secret] {
 				count := strings.Count(result, secret)
 				if count > 0 {
@@ -173,51 +172,200 @@ func (r *redactor) RedactWithDetails(input string, verbose bool) (string, int, [
 	return result, totalRedactions, details
 }
 
-// getRedactionPlaceholder returns an appropriate redaction placeholder based on the rule
-func getRedactionPlaceholder(ruleID, description string) string {
-	// Map common rule IDs to specific placeholders
+// redactPath redacts the file path of a finding: the secrets of the same
+// input (order) become the same placeholders, and secrets only the path
+// holds, such as the signature of a presigned URL, are detected in it
+func (r *redactor) redactPath(path string, order []string, placeholders map[string]string) string {
+	if path == "" {
+		return ""
+	}
+	for _, secret := range order {
+		path = strings.ReplaceAll(path, secret, placeholders[secret])
+	}
+	path, _ = r.Redact(path)
+	return path
+}
+
+// matchRules matches rules against input
+func matchRules(rules []Rule, input string) []report.Finding {
+	var findings []report.Finding
+	for _, rule := range rules {
+		for _, loc := range rule.Regex.FindAllStringSubmatchIndex(input, -1) {
+			start, end := loc[0], loc[1]
+			if g := rule.SecretGroup; g > 0 && 2*g+1 < len(loc) && loc[2*g] >= 0 {
+				start, end = loc[2*g], loc[2*g+1]
+			}
+			if start == end {
+				continue
+			}
+
+			// Only the secret is replaced, so it is also the match
+			findings = append(findings, newFinding(input, start, end, rule.ID, rule.Description))
+		}
+	}
+	return findings
+}
+
+// placeholderToken matches the {tokens} of a placeholder template
+var placeholderToken = regexp.MustCompile(`\{[^{}]*\}`)
+
+// ValidatePlaceholderTemplate checks that template is a usable placeholder
+// template: not blank, and with no tokens other than {type}, {rule} and {n}
+func ValidatePlaceholderTemplate(template string) error {
+	if strings.TrimSpace(template) == "" {
+		return fmt.Errorf("placeholder template is empty")
+	}
+	for _, token := range placeholderToken.FindAllString(template, -1) {
+		if token != "{type}" && token != "{rule}" && token != "{n}" {
+			return fmt.Errorf("unknown token %s in placeholder template %q (use {type}, {rule} and {n})", token, template)
+		}
+	}
+	return nil
+}
+
+// getRedactionPlaceholder returns the placeholder for the nth distinct secret
+// of an input, found by ruleID: template with {type} replaced by the kind of
+// secret, {rule} by ruleID and {n} by n. An empty template means
+// config.DefaultRedactionTemplate.
+func getRedactionPlaceholder(template, ruleID, description string, n int) string {
+	if template == "" {
+		template = config.DefaultRedactionTemplate
+	}
+	return strings.NewReplacer("{type}", secretType(ruleID, description), "{rule}", ruleID, "{n}", strconv.Itoa(n)).Replace(template)
+}
+
+// secretType names the kind of secret a rule finds, e.g. AWS_ACCESS_KEY
+func secretType(ruleID, description string) string {
+	// Map common rule IDs to specific types
 	ruleIDLower := strings.ToLower(ruleID)
 	descLower := strings.ToLower(description)
 
 	// Check rule ID first
 	if strings.Contains(ruleIDLower, "aws") {
+		if strings.Contains(ruleIDLower, "session") {
+			return "AWS_SESSION_TOKEN"
+		}
 		if strings.Contains(ruleIDLower, "access") || strings.Contains(descLower, "access key") {
-			return "<REDACTED_AWS_ACCESS_KEY>"
+			return "AWS_ACCESS_KEY"
 		}
 		if strings.Contains(ruleIDLower, "secret") || strings.Contains(descLower, "secret") {
-			return "<REDACTED_AWS_SECRET_KEY>"
+			return "AWS_SECRET_KEY"
 		}
-		return "<REDACTED_AWS_CREDENTIAL>"
+		return "AWS_CREDENTIAL"
 	}
 
 	if strings.Contains(ruleIDLower, "github") || strings.Contains(descLower, "github") {
-		return "<REDACTED_GITHUB_TOKEN>"
+		return "GITHUB_TOKEN"
 	}
 
 	if strings.Contains(ruleIDLower, "private") || strings.Contains(descLower, "private key") {
-		return "<REDACTED_PRIVATE_KEY>"
+		return "PRIVATE_KEY"
+	}
+
+	if strings.Contains(ruleIDLower, "gcp") && strings.Contains(ruleIDLower, "oauth") {
+		return "GCP_OAUTH_TOKEN"
+	}
+
+	if strings.Contains(ruleIDLower, "kube") {
+		return "KUBERNETES_TOKEN"
 	}
 
 	if strings.Contains(ruleIDLower, "api") || strings.Contains(descLower, "api key") {
-		return "<REDACTED_API_KEY>"
+		return "API_KEY"
 	}
 
 	if strings.Contains(ruleIDLower, "bearer") || strings.Contains(descLower, "bearer") {
-		return "<REDACTED_BEARER_TOKEN>"
+		return "BEARER_TOKEN"
 	}
 
 	if strings.Contains(ruleIDLower, "token") || strings.Contains(descLower, "token") {
-		return "<REDACTED_TOKEN>"
+		return "TOKEN"
 	}
 
 	if strings.Contains(ruleIDLower, "password") || strings.Contains(descLower, "password") {
-		return "<REDACTED_PASSWORD>"
+		return "PASSWORD"
 	}
 
 	if strings.Contains(ruleIDLower, "db-connection") || strings.Contains(descLower, "database connection") {
-		return "<REDACTED_DB_CONNECTION_STRING>"
+		return "DB_CONNECTION_STRING"
 	}
 
-	// Generic placeholder for unknown secret types
-	return "<REDACTED_SECRET>"
+	// Generic type for unknown secrets
+	return "SECRET"
+}
+
+// RuleCount is how many times one detection rule fired
+type RuleCount struct {
+	RuleID string
+	Count  int
+}
+
+// CountByRule tallies findings per rule, most frequent first (ties by rule ID)
+func CountByRule(findings []config.FindingDetail) []RuleCount {
+	counts := make(map[string]int)
+	for _, finding := range findings {
+		counts[finding.RuleID]++
+	}
+
+	result := make([]RuleCount, 0, len(counts))
+	for ruleID, count := range counts {
+		result = append(result, RuleCount{RuleID: ruleID, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].RuleID < result[j].RuleID
+	})
+	return result
+}
+
+// MapLines returns the line mapping from the redacted version of input back to
+// input. Line numbers only shift when a secret spanning several lines (e.g. a
+// private key) collapses into a single-line placeholder; otherwise it's nil.
+func MapLines(input string, findings []config.FindingDetail) config.LineMap {
+	var secrets []string
+	for _, finding := range findings {
+		secret := finding.Match
+		if secret == "" {
+			secret = finding.Secret
+		}
+		if strings.Contains(secret, "\n") {
+			secrets = append(secrets, secret)
+		}
+	}
+	if len(secrets) == 0 {
+		return nil
+	}
+
+	// Byte offsets of the newlines that disappear with a redacted secret
+	swallowed := make(map[int]bool)
+	for _, secret := range secrets {
+		for offset := 0; ; {
+			i := strings.Index(input[offset:], secret)
+			if i < 0 {
+				break
+			}
+			start := offset + i
+			for j := 0; j < len(secret); j++ {
+				if secret[j] == '\n' {
+					swallowed[start+j] = true
+				}
+			}
+			offset = start + len(secret)
+		}
+	}
+
+	lineMap := config.LineMap{1}
+	line := 1
+	for i := 0; i < len(input); i++ {
+		if input[i] != '\n' {
+			continue
+		}
+		line++
+		if !swallowed[i] {
+			lineMap = append(lineMap, line)
+		}
+	}
+	return lineMap
 }
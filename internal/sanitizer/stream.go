@@ -0,0 +1,244 @@
+package sanitizer
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jenian/que/internal/config"
+)
+
+const (
+	// DefaultStreamWindow is the number of lines of look-ahead and look-behind
+	// used to catch secrets spanning several lines (e.g. private keys)
+	DefaultStreamWindow = 32
+	// DefaultStreamMaxDelay is the longest a line is held back before it is written
+	DefaultStreamMaxDelay = 500 * time.Millisecond
+	// minSegmentLength skips tiny fragments of multi-line secrets (e.g. "==")
+	// that would otherwise be replaced all over unrelated lines
+	minSegmentLength = 4
+)
+
+// StreamOptions controls the latency/accuracy trade-off of RedactStream
+type StreamOptions struct {
+	Window   int           // Lines of context on each side of a line when detecting secrets
+	MaxDelay time.Duration // Upper bound on how long a line may be buffered
+}
+
+// RedactStream copies r to w line by line, redacting secrets as it goes, and
+// returns the number of redactions. Unlike Redact it never buffers the whole
+// input: lines are written once Window newer lines have been seen (so secrets
+// spanning lines are still detected) or MaxDelay after they were read,
+// whichever comes first.
+func RedactStream(r io.Reader, w io.Writer, redactor config.Redactor, opts StreamOptions) (int, error) {
+	if opts.Window < 0 {
+		opts.Window = 0
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = DefaultStreamMaxDelay
+	}
+
+	// done stops the reader when a write fails and RedactStream returns
+	// before the input ends, so it doesn't block forever sending a line
+	lines := make(chan string)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		reader := bufio.NewReader(r)
+		for {
+			line, err := reader.ReadString('\n')
+			if len(line) > 0 {
+				select {
+				case lines <- strings.TrimSuffix(line, "\n"):
+				case <-done:
+					return
+				}
+			}
+			if err != nil {
+				if err != io.EOF {
+					readErr <- err
+				}
+				close(lines)
+				return
+			}
+		}
+	}()
+
+	s := &lineStream{
+		redactor:    redactor,
+		placeholder: placeholderFunc(redactor),
+		numbers:     make(map[[sha256.Size]byte]int),
+		window:      opts.Window,
+		out:         bufio.NewWriter(w),
+	}
+
+	var deadline <-chan time.Time
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				if err := s.flush(len(s.pending)); err != nil {
+					return s.count, err
+				}
+				select {
+				case err := <-readErr:
+					return s.count, err
+				default:
+					return s.count, nil
+				}
+			}
+
+			s.pending = append(s.pending, line)
+			if deadline == nil {
+				deadline = time.After(opts.MaxDelay)
+			}
+			// Detect in batches: once twice the window is pending, write all
+			// but the newest Window lines, which stay as look-ahead
+			if len(s.pending) >= 2*opts.Window {
+				if err := s.flush(len(s.pending) - opts.Window); err != nil {
+					return s.count, err
+				}
+			}
+			if len(s.pending) == 0 {
+				deadline = nil
+			}
+
+		case <-deadline:
+			deadline = nil
+			if err := s.flush(len(s.pending)); err != nil {
+				return s.count, err
+			}
+		}
+	}
+}
+
+// lineStream holds the sliding window of RedactStream
+type lineStream struct {
+	redactor    config.Redactor
+	placeholder func(ruleID, description string, n int) string
+	numbers     map[[sha256.Size]byte]int // Secret's hash (not the secret) to its {n}, kept across windows
+	window      int
+	out         *bufio.Writer
+	context     []string // Last written lines (raw), used as look-behind
+	pending     []string // Lines read but not yet written (raw)
+	key         *keyBody // Private key being written, if any, kept across windows
+	count       int
+}
+
+// placeholderFunc returns how cr names secrets, so streamed output
+// matches what the same redactor would produce on the whole input
+func placeholderFunc(cr config.Redactor) func(ruleID, description string, n int) string {
+	if r, ok := cr.(*redactor); ok {
+		return r.placeholder
+	}
+	return func(ruleID, description string, n int) string {
+		return getRedactionPlaceholder("", ruleID, description, n)
+	}
+}
+
+// placeholderFor returns the placeholder of a finding's secret, numbering
+// secrets in the order they are first written
+func (s *lineStream) placeholderFor(finding config.FindingDetail) string {
+	secret := finding.Match
+	if secret == "" {
+		secret = finding.Secret
+	}
+	sum := sha256.Sum256([]byte(secret))
+	n, ok := s.numbers[sum]
+	if !ok {
+		n = len(s.numbers) + 1
+		s.numbers[sum] = n
+	}
+	return s.placeholder(finding.RuleID, finding.Description, n)
+}
+
+// flush redacts the window and writes the oldest n pending lines
+func (s *lineStream) flush(n int) error {
+	if n <= 0 {
+		return nil
+	}
+
+	window := append(append([]string{}, s.context...), s.pending...)
+	_, _, findings := s.redactor.RedactWithDetails(strings.Join(window, "\n"), true)
+
+	for _, line := range s.pending[:n] {
+		redacted, keyCount, write := s.redactKey(line, findings)
+		if !write {
+			continue
+		}
+		redacted, count := redactLine(redacted, findings, s.placeholderFor)
+		s.count += keyCount + count
+		if _, err := s.out.WriteString(redacted + "\n"); err != nil {
+			return err
+		}
+	}
+
+	s.context = append(s.context, s.pending[:n]...)
+	if len(s.context) > s.window {
+		s.context = s.context[len(s.context)-s.window:]
+	}
+	s.pending = s.pending[n:]
+
+	return s.out.Flush()
+}
+
+// redactKey collapses a private key spanning lines to one placeholder on
+// its BEGIN line and drops its other lines, as Redact does on the whole
+// input. The key is followed from line to line, so keys longer than the
+// window are redacted too. It returns what is left of line to redact
+// normally, the redactions made, and whether there is a line to write.
+func (s *lineStream) redactKey(line string, findings []config.FindingDetail) (string, int, bool) {
+	if s.key != nil {
+		if loc := keyEnd.FindStringIndex(line); loc != nil {
+			s.key = nil
+			rest := line[loc[1]:]
+			return rest, 0, strings.TrimSpace(rest) != ""
+		}
+		if s.key.next(line) {
+			// Blank lines are kept, as they are when a truncated key ends
+			return line, 0, s.key.blank
+		}
+		s.key = nil
+	}
+
+	loc := keyBegin.FindStringIndex(line)
+	if loc == nil || strings.TrimSpace(line[loc[1]:]) != "" {
+		return line, 0, true
+	}
+	// Only keys the window holds a finding for, so a BEGIN line with no
+	// key after it is left alone
+	begin := strings.TrimRight(line[loc[0]:], "\r")
+	for _, finding := range findings {
+		if strings.HasPrefix(finding.Match, begin+"\n") || strings.HasPrefix(finding.Match, begin+"\r\n") {
+			s.key = &keyBody{prefix: line[:loc[0]]}
+			return line[:loc[0]] + s.placeholderFor(finding), 1, true
+		}
+	}
+	return line, 0, true
+}
+
+// redactLine replaces every line-sized piece of the findings' secrets in line.
+// Multi-line secrets are split so each of their lines is redacted where it appears.
+func redactLine(line string, findings []config.FindingDetail, placeholderFor func(finding config.FindingDetail) string) (string, int) {
+	total := 0
+	for _, finding := range findings {
+		secret := finding.Match
+		if secret == "" {
+			secret = finding.Secret
+		}
+		for _, segment := range strings.Split(secret, "\n") {
+			segment = strings.TrimSuffix(segment, "\r")
+			if len(segment) < minSegmentLength {
+				continue
+			}
+			if count := strings.Count(line, segment); count > 0 {
+				line = strings.ReplaceAll(line, segment, placeholderFor(finding))
+				total += count
+			}
+		}
+	}
+	return line, total
+}
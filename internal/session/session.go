@@ -0,0 +1,225 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/textutil"
+	"github.com/jenian/que/pkg/llm"
+)
+
+// validName restricts session names to safe file names
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Session is a named investigation whose history, conversation and attached
+// context accumulate across runs and terminals
+type Session struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Conversation is a flat array: [user1, assistant1, user2, assistant2, ...]
+	Conversation []string `json:"conversation"`
+
+	// Attachments are the (already redacted) context files added so far
+	Attachments []config.Attachment `json:"attachments,omitempty"`
+
+	// Runs records each analysis performed in this session
+	Runs []Run `json:"runs,omitempty"`
+
+	path string
+}
+
+// Run is one analysis recorded in a session
+type Run struct {
+	Timestamp     time.Time `json:"timestamp"`
+	Provider      string    `json:"provider"`
+	Model         string    `json:"model"`
+	PromptVersion string    `json:"prompt_version,omitempty"` // Prompt template that produced the analysis, e.g. v6
+	Hint          string    `json:"hint,omitempty"`
+	Category      string    `json:"category,omitempty"` // Problem category reported by the model, for filtering runs
+	Response      string    `json:"response"`
+}
+
+// DefaultDir returns the directory sessions are stored in.
+// QUE_SESSION_DIR overrides it; otherwise $XDG_STATE_HOME/que/sessions
+// (falling back to ~/.local/state/que/sessions) is used.
+func DefaultDir() string {
+	if dir := os.Getenv("QUE_SESSION_DIR"); dir != "" {
+		return dir
+	}
+	stateDir := config.DefaultStateDir()
+	if stateDir == "" {
+		return ""
+	}
+	return filepath.Join(stateDir, "sessions")
+}
+
+// ValidateName returns an error if name can't be used as a session name
+func ValidateName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid session name: %q (use letters, digits, '.', '_' or '-')", name)
+	}
+	return nil
+}
+
+// Open loads the named session from dir, or starts a new one if it doesn't exist yet
+func Open(dir, name string) (*Session, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("could not determine session directory")
+	}
+
+	path := filepath.Join(dir, name+".json")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		now := time.Now()
+		return &Session{Name: name, CreatedAt: now, UpdatedAt: now, path: path}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session %s: %w", name, err)
+	}
+
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse session %s: %w", name, err)
+	}
+	s.path = path
+	return &s, nil
+}
+
+// List returns the sessions stored in dir, sorted by name. A missing
+// directory holds no sessions.
+func List(dir string) ([]*Session, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("could not determine session directory")
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session directory: %w", err)
+	}
+
+	var sessions []*Session
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() || ValidateName(name) != nil {
+			continue
+		}
+		s, err := Open(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+// AddAttachment adds a context file to the session, replacing an earlier
+// version with the same name
+func (s *Session) AddAttachment(attachment config.Attachment) {
+	for i, existing := range s.Attachments {
+		if existing.Name == attachment.Name {
+			s.Attachments[i] = attachment
+			return
+		}
+	}
+	s.Attachments = append(s.Attachments, attachment)
+}
+
+// earlierLogLimit is how many bytes of the log messages of earlier runs the
+// conversation keeps: only the current run's log is kept whole
+const earlierLogLimit = 2000
+
+// RecordRun appends an analysis to the session history and conversation.
+// The logs of earlier runs are cut to their start, so each run adds one
+// full log to the session and to the follow-up questions that resume it.
+func (s *Session) RecordRun(run Run, userMessage string) {
+	if run.Timestamp.IsZero() {
+		run.Timestamp = time.Now()
+	}
+	for i := 0; i < len(s.Conversation); i += 2 {
+		if strings.HasPrefix(s.Conversation[i], llm.LogMessageHeader) {
+			s.Conversation[i] = textutil.Truncate(s.Conversation[i], earlierLogLimit)
+		}
+	}
+	s.Runs = append(s.Runs, run)
+	s.Conversation = append(s.Conversation, userMessage, run.Response)
+}
+
+// ParseRunRef splits a run reference of the form NAME or NAME:N into the
+// session name and the 1-based run number, which is 0 (the latest run) when
+// not given
+func ParseRunRef(ref string) (string, int, error) {
+	name, number, found := strings.Cut(ref, ":")
+	if err := ValidateName(name); err != nil {
+		return "", 0, err
+	}
+	if !found {
+		return name, 0, nil
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 1 {
+		return "", 0, fmt.Errorf("invalid run number in %q (runs are numbered from 1)", ref)
+	}
+	return name, n, nil
+}
+
+// RunAt returns the n-th run of the session (1-based), or the latest one if n is 0
+func (s *Session) RunAt(n int) (Run, error) {
+	if len(s.Runs) == 0 {
+		return Run{}, fmt.Errorf("session %s has no recorded runs", s.Name)
+	}
+	if n == 0 {
+		return s.Runs[len(s.Runs)-1], nil
+	}
+	if n > len(s.Runs) {
+		return Run{}, fmt.Errorf("session %s has %d runs, not %d", s.Name, len(s.Runs), n)
+	}
+	return s.Runs[n-1], nil
+}
+
+// Save writes the session to disk. The file is replaced atomically so a
+// session resumed concurrently from another terminal never sees a partial write.
+func (s *Session) Save() error {
+	s.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode session %s: %w", s.Name, err)
+	}
+
+	// Sessions contain log excerpts, so keep them private to the user
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), s.Name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save session %s: %w", s.Name, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save session %s: %w", s.Name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save session %s: %w", s.Name, err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to save session %s: %w", s.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/textutil"
+	"github.com/jenian/que/pkg/llm"
+)
+
+func TestOpen_NewSession(t *testing.T) {
+	s, err := Open(t.TempDir(), "payments-outage")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if s.Name != "payments-outage" {
+		t.Errorf("Name = %q, want %q", s.Name, "payments-outage")
+	}
+	if len(s.Conversation) != 0 || len(s.Runs) != 0 {
+		t.Error("New session should be empty")
+	}
+}
+
+func TestSession_SaveAndResume(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := Open(dir, "payments-outage")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	s.AddAttachment(config.Attachment{Name: "compose.yml", Content: "v1"})
+	s.AddAttachment(config.Attachment{Name: "compose.yml", Content: "v2"})
+	s.RecordRun(Run{Provider: "openai", Model: "gpt-4o", Response: "analysis"}, "analyze this")
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "payments-outage.json"))
+	if err != nil {
+		t.Fatalf("Session file not written: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("Session file mode = %o, want 600", perm)
+	}
+
+	resumed, err := Open(dir, "payments-outage")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if len(resumed.Attachments) != 1 || resumed.Attachments[0].Content != "v2" {
+		t.Errorf("Attachments = %+v, want one updated attachment", resumed.Attachments)
+	}
+	if len(resumed.Runs) != 1 {
+		t.Errorf("Runs = %d, want 1", len(resumed.Runs))
+	}
+	want := []string{"analyze this", "analysis"}
+	if len(resumed.Conversation) != 2 || resumed.Conversation[0] != want[0] || resumed.Conversation[1] != want[1] {
+		t.Errorf("Conversation = %q, want %q", resumed.Conversation, want)
+	}
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	if sessions, err := List(filepath.Join(dir, "missing")); err != nil || len(sessions) != 0 {
+		t.Fatalf("List() of a missing directory = %v, %v, want no sessions", sessions, err)
+	}
+
+	for _, name := range []string{"payments-outage", "api-errors"} {
+		s, err := Open(dir, name)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		s.RecordRun(Run{Provider: "openai", Model: "gpt-4o", PromptVersion: "v6", Response: "analysis"}, "analyze this")
+		if err := s.Save(); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a session"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := List(dir)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].Name != "api-errors" || sessions[1].Name != "payments-outage" {
+		t.Fatalf("List() = %+v, want api-errors and payments-outage", sessions)
+	}
+	if got := sessions[0].Runs[0].PromptVersion; got != "v6" {
+		t.Errorf("PromptVersion = %q, want it kept across save and load", got)
+	}
+}
+
+func TestSession_RecordRunCutsEarlierLogs(t *testing.T) {
+	s, err := Open(t.TempDir(), "payments-outage")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	log := llm.LogMessageHeader + "\n" + strings.Repeat("ERROR connection refused by db:5432\n", 500)
+	s.RecordRun(Run{Response: "analysis 1"}, log)
+	s.Conversation = append(s.Conversation, "what now?", "restart it")
+	s.RecordRun(Run{Response: "analysis 2"}, log)
+	s.RecordRun(Run{Response: "analysis 3"}, log)
+
+	for _, i := range []int{0, 4} {
+		if got := s.Conversation[i]; len(got) > earlierLogLimit+len(textutil.TruncationMarker) || !strings.HasPrefix(got, llm.LogMessageHeader) {
+			t.Errorf("earlier log %d has %d bytes, want its start only", i, len(got))
+		}
+	}
+	if s.Conversation[2] != "what now?" || s.Conversation[6] != log {
+		t.Error("RecordRun should keep follow-up questions and the current run's whole log")
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"payments-outage", false},
+		{"incident_42.db", false},
+		{"", true},
+		{"../etc/passwd", true},
+		{"has space", true},
+		{".hidden", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateName(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseRunRef(t *testing.T) {
+	tests := []struct {
+		ref     string
+		name    string
+		number  int
+		wantErr bool
+	}{
+		{"payments-outage", "payments-outage", 0, false},
+		{"payments-outage:2", "payments-outage", 2, false},
+		{"payments-outage:0", "", 0, true},
+		{"payments-outage:last", "", 0, true},
+		{"../etc:1", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			name, number, err := ParseRunRef(tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRunRef(%q) error = %v, wantErr %v", tt.ref, err, tt.wantErr)
+			}
+			if name != tt.name || number != tt.number {
+				t.Errorf("ParseRunRef(%q) = %q, %d, want %q, %d", tt.ref, name, number, tt.name, tt.number)
+			}
+		})
+	}
+}
+
+func TestSession_RunAt(t *testing.T) {
+	s := &Session{Name: "payments-outage"}
+	if _, err := s.RunAt(0); err == nil {
+		t.Error("RunAt(0) on a session without runs should fail")
+	}
+
+	s.RecordRun(Run{Response: "first"}, "analyze this")
+	s.RecordRun(Run{Response: "second"}, "analyze this again")
+
+	for n, want := range map[int]string{0: "second", 1: "first", 2: "second"} {
+		run, err := s.RunAt(n)
+		if err != nil || run.Response != want {
+			t.Errorf("RunAt(%d) = %q, %v, want %q", n, run.Response, err, want)
+		}
+	}
+	if _, err := s.RunAt(3); err == nil {
+		t.Error("RunAt(3) should fail for a session with 2 runs")
+	}
+}
@@ -0,0 +1,129 @@
+package summarizer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jenian/que/internal/ingestor"
+)
+
+// maxErrorContext caps the indented lines kept after an xcodebuild error:
+// the offending source line and caret, or the symbols a link failed on
+const maxErrorContext = 10
+
+var (
+	// gradleTask matches the header Gradle prints for each task it ran
+	gradleTask = regexp.MustCompile(`^> Task :\S+`)
+	// gradleFailure matches the start of Gradle's failure summary
+	gradleFailure = regexp.MustCompile(`^(?:FAILURE: Build (?:failed|completed) with|\* What went wrong:)`)
+	// gradleInternalFrame matches stack frames of Gradle and the JVM in the
+	// --stacktrace output of the failure summary
+	gradleInternalFrame = regexp.MustCompile(`^\s+at (?:org\.gradle\.|java\.|jdk\.|sun\.|groovy\.|org\.codehaus\.groovy\.|kotlin\.)`)
+	// gradleError matches compiler and dependency resolution errors printed
+	// outside of a failed task's output
+	gradleError = regexp.MustCompile(`^e: |^\S+:\d+: error:|^ERROR:|^\s*> Could not (?:resolve|find|download)|^BUILD FAILED in `)
+
+	// xcodeError matches compiler, linker and xcodebuild errors
+	xcodeError = regexp.MustCompile(`: (?:fatal )?error: |^(?:xcodebuild: )?error: |^ld: |^clang: error: |^Undefined symbols for architecture |^Testing failed:`)
+	// xcodeResult matches the result line of an xcodebuild action
+	xcodeResult = regexp.MustCompile(`^\*\* [A-Z ]+ FAILED \*\*`)
+	// xcodeFailedListEnd matches the end of xcodebuild's list of failed build
+	// commands, "(3 failures)"
+	xcodeFailedListEnd = regexp.MustCompile(`^\(\d+ failures?\)`)
+)
+
+// FilterBuild reduces the output of a mobile build (toolchain is
+// ingestor.ToolchainGradle or ingestor.ToolchainXcodebuild) to its failing
+// tasks or targets and their errors. Gradle and xcodebuild print every
+// compiler invocation, download and up-to-date task, which would take the
+// whole token budget of most models long before the failure. The log is
+// returned unchanged, with a zero Report, for other toolchains and when no
+// failure is recognized, since filtering would then only drop evidence.
+func FilterBuild(toolchain, log string) (string, Report) {
+	lines := strings.Split(log, "\n")
+	var keep []bool
+	var report Report
+	switch toolchain {
+	case ingestor.ToolchainGradle:
+		keep = filterGradle(lines, &report)
+	case ingestor.ToolchainXcodebuild:
+		keep = filterXcodebuild(lines, &report)
+	default:
+		return log, Report{}
+	}
+	if report.RelevantKept == 0 {
+		return log, Report{}
+	}
+	filtered := collapse(lines, keep, filteredMarker, &report)
+	if report.LinesOmitted == 0 {
+		return log, Report{}
+	}
+	return filtered, report
+}
+
+// filterGradle keeps the output of failed tasks, error lines and the
+// failure summary without Gradle's own stack frames
+func filterGradle(lines []string, report *Report) []bool {
+	keep := make([]bool, len(lines))
+	inFailedTask, inSummary := false, false
+	for i, line := range lines {
+		switch {
+		case gradleFailure.MatchString(line):
+			inSummary = true
+			keep[i] = true
+			report.RelevantKept++
+		case inSummary:
+			keep[i] = !gradleInternalFrame.MatchString(line)
+		case gradleTask.MatchString(line):
+			// The plain console prints a task's output after its header,
+			// which ends in FAILED when the task failed
+			inFailedTask = strings.HasSuffix(strings.TrimSpace(line), " FAILED")
+			keep[i] = inFailedTask
+			if inFailedTask {
+				report.RelevantKept++
+			}
+		case inFailedTask:
+			keep[i] = true
+		case gradleError.MatchString(line):
+			keep[i] = true
+			report.RelevantKept++
+		}
+	}
+	return keep
+}
+
+// filterXcodebuild keeps errors with the indented lines explaining them,
+// the list of failed build commands (naming their targets) and the result
+func filterXcodebuild(lines []string, report *Report) []bool {
+	keep := make([]bool, len(lines))
+	indented, inFailedList := 0, false
+	for i, line := range lines {
+		switch {
+		case xcodeError.MatchString(line):
+			keep[i] = true
+			indented = maxErrorContext
+			report.RelevantKept++
+		case indented > 0 && strings.TrimSpace(line) != "" && (line[0] == ' ' || line[0] == '\t'):
+			keep[i] = true
+			indented--
+		case strings.HasPrefix(line, "The following build commands failed:"):
+			inFailedList = true
+			keep[i] = true
+			report.RelevantKept++
+		case inFailedList:
+			keep[i] = true
+			inFailedList = !xcodeFailedListEnd.MatchString(line)
+		case xcodeResult.MatchString(line):
+			keep[i] = true
+		default:
+			indented = 0
+		}
+	}
+	return keep
+}
+
+// filteredMarker returns the placeholder line FilterBuild inserts for a run of dropped lines
+func filteredMarker(n int) string {
+	return fmt.Sprintf("... [FILTERED: %d lines of build output unrelated to the failure left out] ...", n)
+}
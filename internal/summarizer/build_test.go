@@ -0,0 +1,97 @@
+package summarizer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/ingestor"
+)
+
+func TestFilterBuild_Gradle(t *testing.T) {
+	var lines []string
+	for i := 0; i < 200; i++ {
+		lines = append(lines, fmt.Sprintf("> Task :lib%d:preBuild UP-TO-DATE", i))
+	}
+	lines = append(lines,
+		"> Task :app:compileDebugKotlin FAILED",
+		"e: file:///app/src/main/java/com/example/MainActivity.kt:10:5 Unresolved reference: foo",
+		"> Task :app:lintDebug",
+		"Lint found no errors",
+		"",
+		"FAILURE: Build failed with an exception.",
+		"* What went wrong:",
+		"Execution failed for task ':app:compileDebugKotlin'.",
+		"    at org.gradle.internal.execution.steps.ExecuteStep.execute(ExecuteStep.java:66)",
+		"BUILD FAILED in 42s",
+	)
+	log := strings.Join(lines, "\n")
+
+	filtered, report := FilterBuild(ingestor.ToolchainGradle, log)
+	for _, want := range []string{
+		"... [FILTERED: 200 lines of build output unrelated to the failure left out] ...\n> Task :app:compileDebugKotlin FAILED\ne: file:///",
+		"FAILURE: Build failed with an exception.\n* What went wrong:\nExecution failed for task ':app:compileDebugKotlin'.\n... [FILTERED: 1 lines",
+		"BUILD FAILED in 42s",
+	} {
+		if !strings.Contains(filtered, want) {
+			t.Errorf("Filtered log should contain %q, got:\n%s", want, filtered)
+		}
+	}
+	for _, unwanted := range []string{"UP-TO-DATE", "lintDebug", "org.gradle.internal"} {
+		if strings.Contains(filtered, unwanted) {
+			t.Errorf("Filtered log should not contain %q, got:\n%s", unwanted, filtered)
+		}
+	}
+	if report.LinesOmitted != 204 {
+		t.Errorf("LinesOmitted = %d, want 204", report.LinesOmitted)
+	}
+	// The failed task's header is line 201 of the input and line 2 of the output
+	if got := report.LineMap.Original(2); got != 201 {
+		t.Errorf("LineMap.Original(2) = %d, want 201", got)
+	}
+}
+
+func TestFilterBuild_Xcodebuild(t *testing.T) {
+	log := strings.Join([]string{
+		"CompileSwift normal arm64 /app/App/Model.swift (in target 'App' from project 'App')",
+		"    cd /app",
+		"    /Applications/Xcode.app/Contents/Developer/Toolchains/XcodeDefault.xctoolchain/usr/bin/swift-frontend -frontend -c ...",
+		"/app/App/ContentView.swift:12:9: error: cannot find 'fetchItems' in scope",
+		"        fetchItems()",
+		"        ^~~~~~~~~~",
+		"CompileSwift normal arm64 /app/App/Other.swift (in target 'App' from project 'App')",
+		"    cd /app",
+		"** BUILD FAILED **",
+		"",
+		"The following build commands failed:",
+		"\tCompileSwift normal arm64 /app/App/ContentView.swift (in target 'App' from project 'App')",
+		"(1 failure)",
+	}, "\n")
+
+	filtered, _ := FilterBuild(ingestor.ToolchainXcodebuild, log)
+	want := strings.Join([]string{
+		"... [FILTERED: 3 lines of build output unrelated to the failure left out] ...",
+		"/app/App/ContentView.swift:12:9: error: cannot find 'fetchItems' in scope",
+		"        fetchItems()",
+		"        ^~~~~~~~~~",
+		"... [FILTERED: 2 lines of build output unrelated to the failure left out] ...",
+		"** BUILD FAILED **",
+		"... [FILTERED: 1 lines of build output unrelated to the failure left out] ...",
+		"The following build commands failed:",
+		"\tCompileSwift normal arm64 /app/App/ContentView.swift (in target 'App' from project 'App')",
+		"(1 failure)",
+	}, "\n")
+	if filtered != want {
+		t.Errorf("FilterBuild() =\n%s\nwant:\n%s", filtered, want)
+	}
+}
+
+func TestFilterBuild_Unchanged(t *testing.T) {
+	log := "> Task :app:preBuild UP-TO-DATE\n> Task :app:assembleDebug\nBUILD SUCCESSFUL in 3s"
+	if filtered, report := FilterBuild(ingestor.ToolchainGradle, log); filtered != log || report.LineMap != nil {
+		t.Errorf("FilterBuild() should leave a build without failures alone, got:\n%s", filtered)
+	}
+	if filtered, _ := FilterBuild(ingestor.ToolchainNPM, "npm error code E404"); filtered != "npm error code E404" {
+		t.Errorf("FilterBuild() should leave other toolchains alone, got %q", filtered)
+	}
+}
@@ -0,0 +1,183 @@
+package summarizer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/textutil"
+	"github.com/jenian/que/pkg/llm"
+)
+
+// relevantLineRegex matches lines that likely describe a failure and should survive summarization
+var relevantLineRegex = regexp.MustCompile(`(?i)(error|exception|fatal|panic|fail|traceback|critical|denied|refused|timed? ?out|warn)`)
+
+// stackLineRegex matches lines that continue a stack trace or multi-line
+// error after a relevant line: indented frames, "Caused by:" chains and Go
+// goroutine headers
+var stackLineRegex = regexp.MustCompile(`^(\s+\S|Caused by:|goroutine \d+ \[)`)
+
+// Report describes what Summarize removed so it can be shown to the user
+type Report struct {
+	Summarized      bool
+	OriginalTokens  int
+	FinalTokens     int
+	LinesOmitted    int
+	RelevantKept    int
+	RelevantOmitted int
+	LineMap         config.LineMap // Output lines to input lines (nil when nothing was summarized)
+}
+
+// String returns a one-line human readable description of the summarization
+func (r Report) String() string {
+	if !r.Summarized {
+		return "log fits the model context window"
+	}
+	msg := fmt.Sprintf("summarized log from ~%d to ~%d tokens: omitted %d older lines, kept %d error/warning lines",
+		r.OriginalTokens, r.FinalTokens, r.LinesOmitted, r.RelevantKept)
+	if r.RelevantOmitted > 0 {
+		msg += fmt.Sprintf(" (%d older error/warning lines also omitted)", r.RelevantOmitted)
+	}
+	return msg
+}
+
+// Summarize shrinks log to fit within maxTokens, counted as model's tokenizer
+// would. The most recent half of the budget is spent on the tail of the log
+// verbatim, since it usually contains the failure. Older lines are reduced to
+// the ones matching error keywords (newest first), and each run of dropped
+// lines is replaced with a marker so the model knows content was omitted.
+func Summarize(log string, maxTokens int, model string) (string, Report) {
+	report := Report{OriginalTokens: llm.CountTokens(model, log)}
+	if report.OriginalTokens <= maxTokens {
+		report.FinalTokens = report.OriginalTokens
+		return log, report
+	}
+	report.Summarized = true
+
+	lines := strings.Split(log, "\n")
+	keep := make([]bool, len(lines))
+
+	// Keep the tail verbatim up to half of the budget
+	tailBudget := maxTokens / 2
+	used := 0
+	tailStart := len(lines)
+	for i := len(lines) - 1; i >= 0; i-- {
+		cost := llm.CountTokens(model, lines[i]) + 1
+		if used+cost > tailBudget {
+			break
+		}
+		used += cost
+		keep[i] = true
+		tailStart = i
+	}
+	// A last line too long for the tail budget on its own, such as a huge
+	// JSON error, is cut to fit rather than leaving only omission markers
+	if i := tailStart - 1; i >= 0 && strings.TrimSpace(strings.Join(lines[tailStart:], "")) == "" {
+		if line := fitLine(lines[i], tailBudget-used, model); line != "" {
+			lines[i] = line
+			used += llm.CountTokens(model, line) + 1
+			keep[i] = true
+			tailStart = i
+		}
+	}
+
+	// Fill the remaining budget with relevant older lines, newest first
+	markerCost := llm.CountTokens(model, omittedMarker(0)) + 1
+	for i := tailStart - 1; i >= 0; i-- {
+		if !relevantLineRegex.MatchString(lines[i]) {
+			continue
+		}
+		cost := llm.CountTokens(model, lines[i]) + 1 + markerCost
+		if used+cost > maxTokens {
+			report.RelevantOmitted++
+			continue
+		}
+		used += cost
+		keep[i] = true
+		report.RelevantKept++
+	}
+
+	result := collapse(lines, keep, omittedMarker, &report)
+	report.FinalTokens = llm.CountTokens(model, result)
+	return result, report
+}
+
+// fitLine cuts line to at most budget tokens, counting its line break,
+// keeping its start. It returns "" if not even the truncation marker fits.
+func fitLine(line string, budget int, model string) string {
+	cost := llm.CountTokens(model, line) + 1
+	limit := len(line) * budget / max(cost, 1)
+	for limit > 0 {
+		cut := textutil.Truncate(line, limit)
+		if llm.CountTokens(model, cut)+1 <= budget {
+			return cut
+		}
+		limit = limit * 9 / 10
+	}
+	return ""
+}
+
+// Strip reduces log to its error lines and the stack traces following
+// them, for a retry after the provider's content filter refused the whole
+// log. Logs often carry user-generated text (request bodies, chat messages)
+// that trips filters, and the failure rarely needs it. Report.RelevantKept
+// counts the error lines kept; nothing is kept if the log has none.
+func Strip(log string) (string, Report) {
+	var report Report
+	lines := strings.Split(log, "\n")
+	keep := make([]bool, len(lines))
+	inTrace := false
+	for i, line := range lines {
+		switch {
+		case relevantLineRegex.MatchString(line):
+			keep[i] = true
+			inTrace = true
+			report.RelevantKept++
+		case inTrace && stackLineRegex.MatchString(line):
+			keep[i] = true
+		default:
+			inTrace = false
+		}
+	}
+	if report.RelevantKept == 0 {
+		return "", report
+	}
+	return collapse(lines, keep, strippedMarker, &report), report
+}
+
+// collapse joins the kept lines, replacing each run of dropped lines with
+// its marker, and records the line map and omitted lines in report
+func collapse(lines []string, keep []bool, marker func(n int) string, report *Report) string {
+	var out []string
+	omitted := 0
+	for i, line := range lines {
+		if keep[i] {
+			if omitted > 0 {
+				out = append(out, marker(omitted))
+				report.LineMap = append(report.LineMap, 0)
+				omitted = 0
+			}
+			out = append(out, line)
+			report.LineMap = append(report.LineMap, i+1)
+			continue
+		}
+		omitted++
+		report.LinesOmitted++
+	}
+	if omitted > 0 {
+		out = append(out, marker(omitted))
+		report.LineMap = append(report.LineMap, 0)
+	}
+	return strings.Join(out, "\n")
+}
+
+// omittedMarker returns the placeholder line inserted for a run of dropped lines
+func omittedMarker(n int) string {
+	return fmt.Sprintf("... [SUMMARIZED: %d lines without errors omitted to fit the model context window] ...", n)
+}
+
+// strippedMarker returns the placeholder line Strip inserts for a run of dropped lines
+func strippedMarker(n int) string {
+	return fmt.Sprintf("... [STRIPPED: %d lines without errors left out after a content filter refusal] ...", n)
+}
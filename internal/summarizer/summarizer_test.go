@@ -0,0 +1,146 @@
+package summarizer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/textutil"
+)
+
+func TestSummarize_FitsBudget(t *testing.T) {
+	log := "INFO starting\nERROR something broke"
+
+	result, report := Summarize(log, 1000, "gpt-4o")
+	if result != log {
+		t.Errorf("Summarize() changed a log that fits the budget: %q", result)
+	}
+	if report.Summarized {
+		t.Error("Report.Summarized = true, want false")
+	}
+}
+
+func TestSummarize_KeepsTailAndOlderErrors(t *testing.T) {
+	var lines []string
+	for i := 0; i < 500; i++ {
+		lines = append(lines, fmt.Sprintf("2024-01-15 10:00:%03d INFO request handled id=%d", i, i))
+		if i == 100 {
+			lines = append(lines, "2024-01-15 10:01:40 ERROR connection refused to db:5432")
+		}
+	}
+	lines = append(lines, "2024-01-15 10:09:00 FATAL shutting down")
+	log := strings.Join(lines, "\n")
+
+	result, report := Summarize(log, 1000, "gpt-4o")
+
+	if !report.Summarized {
+		t.Fatal("Report.Summarized = false, want true")
+	}
+	if report.FinalTokens > 1000 {
+		t.Errorf("FinalTokens = %d, want <= 1000", report.FinalTokens)
+	}
+	if !strings.Contains(result, "connection refused") {
+		t.Error("Summarized log should keep the older error line")
+	}
+	if !strings.HasSuffix(result, "FATAL shutting down") {
+		t.Error("Summarized log should keep the tail verbatim")
+	}
+	if !strings.Contains(result, "[SUMMARIZED:") {
+		t.Error("Summarized log should contain an omission marker")
+	}
+	if strings.Contains(result, "id=50\n") {
+		t.Error("Summarized log should drop older non-error lines")
+	}
+	if report.RelevantKept != 1 {
+		t.Errorf("RelevantKept = %d, want 1", report.RelevantKept)
+	}
+}
+
+func TestSummarize_LongLastLine(t *testing.T) {
+	var lines []string
+	for i := 0; i < 50; i++ {
+		lines = append(lines, fmt.Sprintf("2024-01-15 10:00:%03d INFO request handled id=%d", i, i))
+	}
+	var fields []string
+	for i := 0; i < 2000; i++ {
+		fields = append(fields, fmt.Sprintf(`"field%d": "value %d"`, i, i))
+	}
+	last := `ERROR request failed: {` + strings.Join(fields, ", ") + `}`
+	log := strings.Join(lines, "\n") + "\n" + last + "\n"
+
+	result, report := Summarize(log, 1000, "gpt-4o")
+
+	if report.FinalTokens > 1000 {
+		t.Errorf("FinalTokens = %d, want <= 1000", report.FinalTokens)
+	}
+	if !strings.Contains(result, "ERROR request failed: {\"field0\"") || !strings.Contains(result, textutil.TruncationMarker) {
+		t.Errorf("Summarized log should keep the start of the last line, cut to fit:\n%.300s", result)
+	}
+	if n := report.LineMap[len(report.LineMap)-2]; n != len(lines)+1 {
+		t.Errorf("LineMap maps the cut line to %d, want %d", n, len(lines)+1)
+	}
+}
+
+func TestSummarize_LineMap(t *testing.T) {
+	var lines []string
+	for i := 0; i < 500; i++ {
+		lines = append(lines, fmt.Sprintf("2024-01-15 10:00:%03d INFO request handled id=%d", i, i))
+	}
+	lines[100] = "2024-01-15 10:01:40 ERROR connection refused to db:5432"
+	log := strings.Join(lines, "\n")
+
+	result, report := Summarize(log, 1000, "gpt-4o")
+
+	out := strings.Split(result, "\n")
+	if len(report.LineMap) != len(out) {
+		t.Fatalf("len(LineMap) = %d, want one entry per output line (%d)", len(report.LineMap), len(out))
+	}
+	for i, line := range out {
+		original := report.LineMap.Original(i + 1)
+		if strings.HasPrefix(line, "... [SUMMARIZED:") {
+			if original != 0 {
+				t.Errorf("Marker line %d maps to input line %d, want 0", i+1, original)
+			}
+			continue
+		}
+		if lines[original-1] != line {
+			t.Errorf("Output line %d maps to input line %d (%q), want %q", i+1, original, lines[original-1], line)
+		}
+	}
+}
+
+func TestStrip(t *testing.T) {
+	lines := []string{
+		"2024-01-15 10:00:00 INFO user message: some text the filter dislikes",
+		"2024-01-15 10:00:01 ERROR failed to render message",
+		"    at render (app.js:10)",
+		"    at handle (app.js:42)",
+		"2024-01-15 10:00:02 INFO request body: more user text",
+		"2024-01-15 10:00:03 INFO shutting down",
+	}
+	log := strings.Join(lines, "\n")
+
+	result, report := Strip(log)
+
+	want := strings.Join([]string{
+		"... [STRIPPED: 1 lines without errors left out after a content filter refusal] ...",
+		lines[1], lines[2], lines[3],
+		"... [STRIPPED: 2 lines without errors left out after a content filter refusal] ...",
+	}, "\n")
+	if result != want {
+		t.Errorf("Strip() =\n%s\nwant\n%s", result, want)
+	}
+	if report.RelevantKept != 1 || report.LinesOmitted != 3 {
+		t.Errorf("RelevantKept = %d, LinesOmitted = %d, want 1 and 3", report.RelevantKept, report.LinesOmitted)
+	}
+	if got := report.LineMap.Original(2); got != 2 {
+		t.Errorf("LineMap.Original(2) = %d, want 2", got)
+	}
+}
+
+func TestStrip_NoErrors(t *testing.T) {
+	result, report := Strip("INFO started\nINFO request handled")
+	if result != "" || report.RelevantKept != 0 {
+		t.Errorf("Strip() = %q, RelevantKept = %d, want nothing kept", result, report.RelevantKept)
+	}
+}
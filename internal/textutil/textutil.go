@@ -0,0 +1,35 @@
+package textutil
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// TruncationMarker is appended to text that was shortened by Truncate
+const TruncationMarker = "... [truncated]"
+
+// Truncate shortens s to at most limit bytes (excluding the marker) without
+// splitting a UTF-8 rune. When a line break exists in the second half of the
+// allowed window, the cut is moved back to it so that previews end on a whole
+// line instead of in the middle of a JSON object or stack frame.
+func Truncate(s string, limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+	if len(s) <= limit {
+		return s
+	}
+
+	cut := limit
+	// Step back to the start of a rune so multi-byte characters stay intact
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+
+	// Prefer ending on a line boundary if that doesn't discard too much
+	if nl := strings.LastIndexByte(s[:cut], '\n'); nl >= limit/2 {
+		cut = nl + 1
+	}
+
+	return s[:cut] + TruncationMarker
+}
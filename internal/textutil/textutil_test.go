@@ -0,0 +1,52 @@
+package textutil
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate_ShortInput(t *testing.T) {
+	input := "short log line"
+	if got := Truncate(input, 100); got != input {
+		t.Errorf("Truncate() = %q, want %q", got, input)
+	}
+}
+
+func TestTruncate_RuneBoundary(t *testing.T) {
+	// Each "é" is two bytes, so a limit of 5 falls in the middle of a rune
+	input := strings.Repeat("é", 10)
+
+	got := Truncate(input, 5)
+	if !strings.HasSuffix(got, TruncationMarker) {
+		t.Fatalf("Truncate() = %q, want truncation marker", got)
+	}
+
+	preview := strings.TrimSuffix(got, TruncationMarker)
+	if !utf8.ValidString(preview) {
+		t.Errorf("Truncate() produced invalid UTF-8: %q", preview)
+	}
+	if preview != "éé" {
+		t.Errorf("Truncate() preview = %q, want %q", preview, "éé")
+	}
+}
+
+func TestTruncate_LineBoundary(t *testing.T) {
+	input := "first line of the log\nsecond line\n{\"status\": \"error\", \"message\": \"boom\"}"
+
+	got := Truncate(input, 40)
+	want := "first line of the log\nsecond line\n" + TruncationMarker
+	if got != want {
+		t.Errorf("Truncate() = %q, want %q", got, want)
+	}
+}
+
+func TestTruncate_NoUsefulLineBoundary(t *testing.T) {
+	input := "a\n" + strings.Repeat("b", 100)
+
+	got := Truncate(input, 20)
+	want := "a\n" + strings.Repeat("b", 18) + TruncationMarker
+	if got != want {
+		t.Errorf("Truncate() = %q, want %q", got, want)
+	}
+}
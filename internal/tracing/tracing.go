@@ -0,0 +1,259 @@
+// Package tracing records OpenTelemetry spans for the pipeline stages of
+// long-running modes and exports them to an OTLP/HTTP collector as JSON, so
+// que can be observed like any other service without pulling in the SDK.
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/httpclient"
+	"github.com/jenian/que/internal/logging"
+)
+
+// ServiceName is the service.name resource attribute of que's spans
+const ServiceName = "que"
+
+// scopeName is the instrumentation scope the spans are reported under
+const scopeName = "github.com/jenian/que"
+
+// exportTimeout bounds how long an export request may take
+const exportTimeout = 10 * time.Second
+
+// batchSize is how many finished spans are buffered before they are exported
+const batchSize = 128
+
+// Span kinds, as numbered by OTLP
+const (
+	Internal = 1 // A stage of que's own pipeline
+	Client   = 3 // A request to another service, e.g. an LLM provider
+)
+
+// Tracer buffers finished spans and exports them to an OTLP/HTTP collector.
+// A nil *Tracer records nothing, so callers needn't check whether tracing is
+// enabled.
+type Tracer struct {
+	endpoint string
+	headers  map[string]string
+	version  string
+	client   *http.Client
+
+	mu    sync.Mutex
+	spans []*Span // Finished spans waiting to be exported
+	err   error   // First export failure, reported by Flush
+}
+
+// New returns a tracer exporting to cfg.Endpoint, or nil when no endpoint is
+// configured. version is reported as the service.version resource attribute.
+func New(cfg config.TracingConfig, version string) *Tracer {
+	if cfg.Endpoint == "" {
+		return nil
+	}
+	return &Tracer{
+		endpoint: cfg.Endpoint,
+		headers:  cfg.Headers,
+		version:  version,
+		client:   httpclient.New(exportTimeout),
+	}
+}
+
+// Span is one timed operation. Set attributes on it while it runs and call
+// End once it is over. Methods of a nil *Span do nothing.
+type Span struct {
+	tracer  *Tracer
+	name    string
+	kind    int
+	traceID [16]byte
+	spanID  [8]byte
+	parent  []byte // Parent span ID, nil for a root span
+	start   time.Time
+	end     time.Time
+	attrs   map[string]any
+	err     error
+}
+
+// spanKey is the context key of the current span
+type spanKey struct{}
+
+// Start starts a span named name, a child of the span in ctx if there is
+// one, and returns a context carrying it for the spans of nested stages
+func (t *Tracer) Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	span := &Span{tracer: t, name: name, kind: kind, start: time.Now(), attrs: make(map[string]any)}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok && parent != nil {
+		span.traceID = parent.traceID
+		span.parent = parent.spanID[:]
+	} else {
+		rand.Read(span.traceID[:])
+	}
+	rand.Read(span.spanID[:])
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SetAttr records an attribute of the span. Values may be strings, integers,
+// floats or booleans; anything else is recorded as its string form.
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.attrs[key] = value
+}
+
+// End ends the span, marking it failed if err isn't nil, and queues it for
+// export. Only the first call counts.
+func (s *Span) End(err error) {
+	if s == nil || !s.end.IsZero() {
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+	s.tracer.add(s)
+}
+
+// add queues a finished span, exporting the queue once it is full
+func (t *Tracer) add(span *Span) {
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	var full []*Span
+	if len(t.spans) >= batchSize {
+		full, t.spans = t.spans, nil
+	}
+	t.mu.Unlock()
+	if full != nil {
+		t.export(context.Background(), full)
+	}
+}
+
+// Flush exports the spans still queued and returns the first error any
+// export of the tracer failed with, as failed exports only log a debug
+// message so they don't interrupt the work being traced
+func (t *Tracer) Flush(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	t.mu.Unlock()
+	if len(spans) > 0 {
+		t.export(ctx, spans)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// export sends spans to the collector, recording a failure for Flush
+func (t *Tracer) export(ctx context.Context, spans []*Span) {
+	if err := t.send(ctx, spans); err != nil {
+		logging.Debug().Err(err).Int("spans", len(spans)).Msg("Failed to export spans")
+		t.mu.Lock()
+		if t.err == nil {
+			t.err = err
+		}
+		t.mu.Unlock()
+	}
+}
+
+// send posts spans to the collector as an OTLP ExportTraceServiceRequest
+func (t *Tracer) send(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(t.request(spans))
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid OTLP endpoint: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export spans to %s: %w", t.endpoint, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to export spans to %s: %s", t.endpoint, resp.Status)
+	}
+	return nil
+}
+
+// request builds the OTLP/JSON request exporting spans. IDs are hex, not
+// base64 as elsewhere in protobuf JSON, and 64-bit integers are strings.
+func (t *Tracer) request(spans []*Span) map[string]any {
+	encoded := make([]map[string]any, 0, len(spans))
+	for _, s := range spans {
+		span := map[string]any{
+			"traceId":           hex.EncodeToString(s.traceID[:]),
+			"spanId":            hex.EncodeToString(s.spanID[:]),
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        attributes(s.attrs),
+		}
+		if s.parent != nil {
+			span["parentSpanId"] = hex.EncodeToString(s.parent)
+		}
+		if s.err != nil {
+			span["status"] = map[string]any{"code": 2, "message": s.err.Error()}
+		}
+		encoded = append(encoded, span)
+	}
+	return map[string]any{
+		"resourceSpans": []map[string]any{{
+			"resource": map[string]any{
+				"attributes": attributes(map[string]any{"service.name": ServiceName, "service.version": t.version}),
+			},
+			"scopeSpans": []map[string]any{{
+				"scope": map[string]any{"name": scopeName, "version": t.version},
+				"spans": encoded,
+			}},
+		}},
+	}
+}
+
+// attributes encodes attrs as OTLP key-value pairs, sorted by key
+func attributes(attrs map[string]any) []map[string]any {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	list := make([]map[string]any, 0, len(attrs))
+	for _, key := range keys {
+		var encoded map[string]any
+		switch v := attrs[key].(type) {
+		case string:
+			encoded = map[string]any{"stringValue": v}
+		case bool:
+			encoded = map[string]any{"boolValue": v}
+		case int:
+			encoded = map[string]any{"intValue": strconv.Itoa(v)}
+		case int64:
+			encoded = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			encoded = map[string]any{"doubleValue": v}
+		default:
+			encoded = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		list = append(list, map[string]any{"key": key, "value": encoded})
+	}
+	return list
+}
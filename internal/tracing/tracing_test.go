@@ -0,0 +1,130 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// exported mirrors the parts of an OTLP/JSON export request the tests check
+type exported struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []attribute `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Spans []struct {
+				TraceID      string      `json:"traceId"`
+				SpanID       string      `json:"spanId"`
+				ParentSpanID string      `json:"parentSpanId"`
+				Name         string      `json:"name"`
+				Kind         int         `json:"kind"`
+				Attributes   []attribute `json:"attributes"`
+				Status       *struct {
+					Code    int    `json:"code"`
+					Message string `json:"message"`
+				} `json:"status"`
+			} `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+type attribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func TestTracer_Export(t *testing.T) {
+	var body []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+	}))
+	defer server.Close()
+
+	tracer := New(config.TracingConfig{Endpoint: server.URL + "/v1/traces", Headers: map[string]string{"X-Api-Key": "secret"}}, "v1.2.3")
+	ctx, root := tracer.Start(context.Background(), "batch.file", Internal)
+	root.SetAttr("que.file", "app.log")
+	_, call := tracer.Start(ctx, "llm", Client)
+	call.SetAttr("gen_ai.usage.input_tokens", 1200)
+	call.End(errors.New("rate limited"))
+	root.End(nil)
+	if body != nil {
+		t.Fatal("spans should be buffered until the batch is full or flushed")
+	}
+	if err := tracer.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	if header.Get("Content-Type") != "application/json" || header.Get("X-Api-Key") != "secret" {
+		t.Errorf("request headers = %v, want JSON with the configured header", header)
+	}
+	var request exported
+	if err := json.Unmarshal(body, &request); err != nil || len(request.ResourceSpans) != 1 || len(request.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("invalid export request: %v\n%s", err, body)
+	}
+	resource := request.ResourceSpans[0].Resource.Attributes
+	if len(resource) != 2 || resource[0].Key != "service.name" || resource[0].Value["stringValue"] != ServiceName || resource[1].Value["stringValue"] != "v1.2.3" {
+		t.Errorf("resource attributes = %+v, want the service name and version", resource)
+	}
+
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	child, parent := spans[0], spans[1]
+	if child.Name != "llm" || child.Kind != Client || parent.Name != "batch.file" || parent.Kind != Internal {
+		t.Errorf("spans = %s (%d) and %s (%d), want llm (client) and batch.file (internal)", child.Name, child.Kind, parent.Name, parent.Kind)
+	}
+	if len(parent.TraceID) != 32 || len(parent.SpanID) != 16 || parent.ParentSpanID != "" {
+		t.Errorf("root span IDs = %q/%q, parent %q", parent.TraceID, parent.SpanID, parent.ParentSpanID)
+	}
+	if child.TraceID != parent.TraceID || child.ParentSpanID != parent.SpanID {
+		t.Errorf("child span should belong to the root span's trace and name it as its parent")
+	}
+	if child.Status == nil || child.Status.Code != 2 || child.Status.Message != "rate limited" || parent.Status != nil {
+		t.Errorf("only the failed span should have an error status, got %+v and %+v", child.Status, parent.Status)
+	}
+	if len(child.Attributes) != 1 || child.Attributes[0].Value["intValue"] != "1200" {
+		t.Errorf("child attributes = %+v, want the token count as an OTLP integer", child.Attributes)
+	}
+}
+
+func TestTracer_ExportFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	tracer := New(config.TracingConfig{Endpoint: server.URL}, "dev")
+	_, span := tracer.Start(context.Background(), "ingest", Internal)
+	span.End(nil)
+	if err := tracer.Flush(context.Background()); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Flush() error = %v, want the collector's status", err)
+	}
+}
+
+func TestTracer_Disabled(t *testing.T) {
+	tracer := New(config.TracingConfig{}, "dev")
+	if tracer != nil {
+		t.Fatal("New() without an endpoint should disable tracing")
+	}
+	ctx := context.Background()
+	got, span := tracer.Start(ctx, "ingest", Internal)
+	span.SetAttr("que.input.bytes", 10)
+	span.End(nil)
+	if got != ctx || span != nil {
+		t.Error("a disabled tracer should return the context unchanged and no span")
+	}
+	if err := tracer.Flush(ctx); err != nil {
+		t.Errorf("Flush() error = %v", err)
+	}
+}
@@ -1,3 +1,5 @@
+//go:build !noclaude
+
 package llm
 
 import (
@@ -7,21 +9,37 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
-	"time"
 
 	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/httpclient"
 )
 
-const (
-	anthropicAPIURL = "https://api.anthropic.com/v1/messages"
+// The API URLs are variables so tests can point them at a local server
+var (
+	anthropicAPIURL    = "https://api.anthropic.com/v1/messages"
+	anthropicModelsURL = "https://api.anthropic.com/v1/models/"
 )
 
+func init() {
+	Register(Provider{
+		Name:         "claude",
+		DisplayName:  "Claude",
+		DefaultModel: DefaultAnthropicModel,
+		TriageModel:  DefaultAnthropicTriageModel,
+		Dialect:      DialectXML,
+		EnvVars:      []string{"QUE_CLAUDE_API_KEY"},
+		New:          NewAnthropicClientFromConfig,
+	})
+}
+
 // AnthropicClient handles interactions with Anthropic API
 type AnthropicClient struct {
-	apiKey string
-	model  string
-	client *http.Client
+	apiKey  string
+	model   string
+	client  *http.Client
+	options requestOptions
 }
 
 // NewAnthropicClient creates a new Anthropic client
@@ -30,7 +48,7 @@ func NewAnthropicClient(apiKey string, modelOverride string) (*AnthropicClient,
 		return nil, fmt.Errorf("anthropic API key is required")
 	}
 
-	model := "claude-3-5-sonnet-20241022"
+	model := DefaultAnthropicModel
 	if modelOverride != "" {
 		model = modelOverride
 	}
@@ -38,31 +56,95 @@ func NewAnthropicClient(apiKey string, modelOverride string) (*AnthropicClient,
 	return &AnthropicClient{
 		apiKey: apiKey,
 		model:  model,
-		client: &http.Client{
-			Timeout: 60 * time.Second,
-		},
+		client: newRequestIDClient("anthropic", httpclient.New(config.DefaultTimeout)),
 	}, nil
 }
 
 // anthropicRequest represents the request body for Anthropic API
 type anthropicRequest struct {
-	Model     string    `json:"model"`
-	MaxTokens int       `json:"max_tokens"`
-	Messages  []message `json:"messages"`
+	Model       string               `json:"model"`
+	MaxTokens   int                  `json:"max_tokens"`
+	Temperature *float64             `json:"temperature,omitempty"`
+	Messages    []message            `json:"messages"`
+	Tools       []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice  *anthropicToolChoice `json:"tool_choice,omitempty"`
+}
+
+// anthropicTool is a tool the model may call. que only offers one, whose
+// input is the analysis, to get it back schema-enforced.
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// anthropicToolChoice forces the model to call the named tool
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
 }
 
 type message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// Cache ends the prompt prefix Anthropic caches, so later requests
+	// starting with the same messages read it from the cache instead
+	Cache bool `json:"-"`
+}
+
+// anthropicTextBlock is a text content block, the form a message takes to
+// carry a cache breakpoint
+type anthropicTextBlock struct {
+	Type         string                 `json:"type"`
+	Text         string                 `json:"text"`
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+// anthropicCacheControl marks the end of a cached prompt prefix
+type anthropicCacheControl struct {
+	Type string `json:"type"`
+}
+
+// MarshalJSON sends the content as a plain string, or as a text block with
+// a cache breakpoint when the message is cached
+func (m message) MarshalJSON() ([]byte, error) {
+	if !m.Cache {
+		type plain message
+		return json.Marshal(plain(m))
+	}
+	return json.Marshal(struct {
+		Role    string               `json:"role"`
+		Content []anthropicTextBlock `json:"content"`
+	}{
+		Role:    m.Role,
+		Content: []anthropicTextBlock{{Type: "text", Text: m.Content, CacheControl: &anthropicCacheControl{Type: "ephemeral"}}},
+	})
 }
 
 // anthropicResponse represents the response from Anthropic API
 type anthropicResponse struct {
 	Content []struct {
-		Type string `json:"type"`
-		Text string `json:"text"`
+		Type  string          `json:"type"`
+		Text  string          `json:"text"`
+		Input json.RawMessage `json:"input"` // Tool arguments of a tool_use block
 	} `json:"content"`
-	Error *anthropicError `json:"error,omitempty"`
+	StopReason string          `json:"stop_reason"`
+	Usage      anthropicUsage  `json:"usage"`
+	Error      *anthropicError `json:"error,omitempty"`
+}
+
+// anthropicUsage is the token usage of a response. InputTokens leaves out
+// the prompt tokens read from or written to the prompt cache.
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// usage returns the usage of a response from model, priced
+func (u anthropicUsage) usage(model string) *config.Usage {
+	return newCachedUsage(model, u.InputTokens+u.CacheCreationInputTokens+u.CacheReadInputTokens, u.OutputTokens, u.CacheReadInputTokens, u.CacheCreationInputTokens)
 }
 
 type anthropicError struct {
@@ -72,9 +154,18 @@ type anthropicError struct {
 
 // Query sends a query to Anthropic and returns the response
 func (c *AnthropicClient) Query(ctx context.Context, systemPrompt string, userPrompt string) (string, error) {
+	response, _, err := c.query(ctx, systemPrompt, userPrompt, nil)
+	return response, err
+}
+
+// query sends a query to Anthropic and returns the response and its usage.
+// With a schema the model is made to answer by calling a tool taking it as
+// input, and the response is the tool's arguments.
+func (c *AnthropicClient) query(ctx context.Context, systemPrompt string, userPrompt string, schema json.RawMessage) (string, *config.Usage, error) {
 	reqBody := anthropicRequest{
-		Model:     c.model,
-		MaxTokens: 4096,
+		Model:       c.model,
+		MaxTokens:   c.options.maxTokensOr(defaultMaxTokens),
+		Temperature: c.options.temperature,
 		Messages: []message{
 			{
 				Role:    "user",
@@ -82,88 +173,62 @@ func (c *AnthropicClient) Query(ctx context.Context, systemPrompt string, userPr
 			},
 		},
 	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", anthropicAPIURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", c.apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		var apiErr anthropicResponse
-		if err := json.Unmarshal(body, &apiErr); err == nil && apiErr.Error != nil {
-			return "", fmt.Errorf("anthropic API error: %s - %s", apiErr.Error.Type, apiErr.Error.Message)
-		}
-		return "", fmt.Errorf("anthropic API error: status %d, body: %s", resp.StatusCode, string(body))
-	}
-
-	var apiResp anthropicResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	if len(apiResp.Content) == 0 {
-		return "", fmt.Errorf("no content in response")
+	if schema != nil {
+		reqBody.Tools = []anthropicTool{{Name: responseSchemaName, Description: responseSchemaDescription, InputSchema: schema}}
+		reqBody.ToolChoice = &anthropicToolChoice{Type: "tool", Name: responseSchemaName}
 	}
 
-	return apiResp.Content[0].Text, nil
+	return c.send(withRequestID(ctx), reqBody)
 }
 
 // QueryWithPayload implements the Client interface
-func (c *AnthropicClient) QueryWithPayload(cfg *config.Config, payload config.QueryPayload) (string, error) {
-	// Format system prompt
-	systemPrompt := "You are a CLI debugging assistant. You must respond with valid JSON only. The response must contain exactly four fields: status, root_cause, evidence, and fix. Do not include markdown, code blocks, or any text outside the JSON."
+func (c *AnthropicClient) QueryWithPayload(ctx context.Context, cfg *config.Config, payload config.QueryPayload) (string, error) {
+	response, _, err := c.QueryWithPayloadUsage(ctx, cfg, payload)
+	return response, err
+}
 
-	// Format user prompt with context
-	userPrompt := formatPrompt(payload)
+// QueryWithPayloadUsage implements the UsageReporter interface
+func (c *AnthropicClient) QueryWithPayloadUsage(ctx context.Context, cfg *config.Config, payload config.QueryPayload) (string, *config.Usage, error) {
+	// Format system and user prompts from the pinned prompt version
+	systemPrompt, userPrompt := BuildPrompts(cfg, payload)
 
 	// Show full prompt in verbose mode (Anthropic combines system + user in user message)
 	if cfg.Verbose {
-		fmt.Fprintf(os.Stderr, "\n=== LLM Prompt ===\n")
+		fmt.Fprintf(os.Stderr, "\n=== LLM Prompt (%s) ===\n", cfg.PromptVersion)
 		fmt.Fprintf(os.Stderr, "System Prompt:\n%s\n\n", systemPrompt)
 		fmt.Fprintf(os.Stderr, "User Prompt:\n%s\n\n", userPrompt)
 		fmt.Fprintf(os.Stderr, "=== End Prompt ===\n\n")
 	}
 
-	ctx := context.Background()
-	response, err := c.Query(ctx, systemPrompt, userPrompt)
+	response, usage, err := c.query(ctx, systemPrompt, userPrompt, ResponseSchema(cfg, payload))
 
 	// Show raw response in verbose mode
 	if cfg.Verbose && err == nil {
 		fmt.Fprintf(os.Stderr, "=== LLM Raw Response ===\n%s\n=== End Response ===\n\n", response)
 	}
 
-	return response, err
+	return response, usage, err
 }
 
 // QueryWithHistory implements the Client interface
-func (c *AnthropicClient) QueryWithHistory(cfg *config.Config, conversationHistory []string, userQuestion string) (string, error) {
+func (c *AnthropicClient) QueryWithHistory(ctx context.Context, cfg *config.Config, conversationHistory []string, userQuestion string) (string, error) {
+	response, _, err := c.QueryWithHistoryUsage(ctx, cfg, conversationHistory, userQuestion)
+	return response, err
+}
+
+// QueryWithHistoryUsage implements the UsageReporter interface
+func (c *AnthropicClient) QueryWithHistoryUsage(ctx context.Context, cfg *config.Config, conversationHistory []string, userQuestion string) (string, *config.Usage, error) {
 	// Build conversation messages
 	// Anthropic uses a different format - system prompt is included in first user message
-	systemPrompt := "You are a CLI debugging assistant. Provide concise, helpful answers. Keep responses brief since we're in a terminal."
+	systemPrompt := promptTemplateFor(cfg.PromptVersion).FollowUpSystem
 
 	var messages []message
 
-	// Add conversation history
+	// Add conversation history. The message holding the current log is by
+	// far the largest part of the conversation and the same for every
+	// question, so the prompt up to it is cached for the questions that
+	// follow; without a log, the opening message is.
+	cached := max(LatestLogMessage(conversationHistory), 0)
 	firstMessage := true
 	for i, msg := range conversationHistory {
 		if i%2 == 0 {
@@ -171,12 +236,13 @@ func (c *AnthropicClient) QueryWithHistory(cfg *config.Config, conversationHisto
 			content := msg
 			if firstMessage {
 				content = systemPrompt + "\n\n" + msg
-				firstMessage = false
 			}
 			messages = append(messages, message{
 				Role:    "user",
 				Content: content,
+				Cache:   i == cached,
 			})
+			firstMessage = false
 		} else {
 			// Assistant message
 			messages = append(messages, message{
@@ -196,19 +262,33 @@ func (c *AnthropicClient) QueryWithHistory(cfg *config.Config, conversationHisto
 	})
 
 	reqBody := anthropicRequest{
-		Model:     c.model,
-		MaxTokens: 2048, // Shorter for follow-ups
-		Messages:  messages,
+		Model:       c.model,
+		MaxTokens:   c.options.maxTokensOr(defaultFollowUpMaxTokens),
+		Temperature: c.options.temperature,
+		Messages:    messages,
 	}
 
+	return c.send(withRequestID(ctx), reqBody)
+}
+
+// send posts a messages request to the Anthropic API and returns the
+// arguments of the tool call, or the first text block without one, and the
+// usage of the request. Errors carry the request IDs.
+func (c *AnthropicClient) send(ctx context.Context, reqBody anthropicRequest) (string, *config.Usage, error) {
+	response, usage, err := c.post(ctx, reqBody)
+	return response, usage, tagRequestIDs(ctx, err)
+}
+
+// post is send without the request IDs on its errors
+func (c *AnthropicClient) post(ctx context.Context, reqBody anthropicRequest) (string, *config.Usage, error) {
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return "", nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(context.Background(), "POST", anthropicAPIURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", anthropicAPIURL, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -217,36 +297,79 @@ func (c *AnthropicClient) QueryWithHistory(cfg *config.Config, conversationHisto
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		return "", nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return "", nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		var apiErr anthropicResponse
-		if err := json.Unmarshal(body, &apiErr); err == nil && apiErr.Error != nil {
-			return "", fmt.Errorf("anthropic API error: %s - %s", apiErr.Error.Type, apiErr.Error.Message)
-		}
-		return "", fmt.Errorf("anthropic API error: status %d, body: %s", resp.StatusCode, string(body))
+		return "", nil, anthropicResponseError(resp.StatusCode, body)
 	}
 
 	var apiResp anthropicResponse
 	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+		return "", nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	usage := apiResp.Usage.usage(c.model)
+
+	if apiResp.StopReason == "refusal" {
+		return "", usage, newAPIError("anthropic", resp.StatusCode, "refusal", "the model declined to respond due to its content policy")
 	}
 
 	if len(apiResp.Content) == 0 {
-		return "", fmt.Errorf("no content in response")
+		return "", usage, fmt.Errorf("no content in response")
+	}
+
+	for _, block := range apiResp.Content {
+		if block.Type == "tool_use" {
+			return string(block.Input), usage, nil
+		}
+	}
+	return apiResp.Content[0].Text, usage, nil
+}
+
+// HealthCheck implements HealthChecker by looking up the model
+func (c *AnthropicClient) HealthCheck(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", anthropicModelsURL+url.PathEscape(c.model), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("x-api-key", c.apiKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach anthropic API: %w", err)
 	}
+	defer resp.Body.Close()
 
-	return apiResp.Content[0].Text, nil
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return anthropicResponseError(resp.StatusCode, body)
+	}
+	return nil
+}
+
+// anthropicResponseError decodes the error body of a failed Anthropic API call
+func anthropicResponseError(statusCode int, body []byte) error {
+	var apiErr anthropicResponse
+	if err := json.Unmarshal(body, &apiErr); err == nil && apiErr.Error != nil {
+		return newAPIError("anthropic", statusCode, apiErr.Error.Type, apiErr.Error.Message)
+	}
+	return newAPIError("anthropic", statusCode, "", "body: "+string(body))
 }
 
 // NewAnthropicClientFromConfig creates a new Anthropic client from config
 func NewAnthropicClientFromConfig(cfg *config.Config) (Client, error) {
-	return NewAnthropicClient(cfg.ClaudeKey, cfg.Model)
+	client, err := NewAnthropicClient(cfg.ClaudeKey, cfg.Model)
+	if err != nil {
+		return nil, err
+	}
+	client.client.Timeout = cfg.Timeout
+	client.options = newRequestOptions(cfg)
+	return client, nil
 }
@@ -0,0 +1,273 @@
+//go:build !noclaude
+
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenian/que/internal/config"
+)
+
+func TestAnthropicClient_HealthCheck(t *testing.T) {
+	testCases := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr error
+	}{
+		{"ok", 200, `{"id": "claude-sonnet-4-5", "type": "model"}`, nil},
+		{"bad key", 401, `{"type": "error", "error": {"type": "authentication_error", "message": "invalid x-api-key"}}`, ErrAuth},
+		{"unknown model", 404, `{"type": "error", "error": {"type": "not_found_error", "message": "model: claude-9"}}`, ErrModelNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("x-api-key") != "test-key" {
+					t.Errorf("x-api-key = %q, want test-key", r.Header.Get("x-api-key"))
+				}
+				if r.URL.Path != "/v1/models/claude-test" {
+					t.Errorf("path = %q, want /v1/models/claude-test", r.URL.Path)
+				}
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			original := anthropicModelsURL
+			anthropicModelsURL = server.URL + "/v1/models/"
+			defer func() { anthropicModelsURL = original }()
+
+			client, _ := NewAnthropicClient("test-key", "claude-test")
+			err := client.HealthCheck(context.Background())
+			if tc.wantErr == nil && err != nil {
+				t.Errorf("HealthCheck() = %v, want nil", err)
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Errorf("HealthCheck() = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestAnthropicClient_Usage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"content": [{"type": "text", "text": "ok"}], "stop_reason": "end_turn", "usage": {"input_tokens": 1200, "output_tokens": 300}}`))
+	}))
+	defer server.Close()
+
+	original := anthropicAPIURL
+	anthropicAPIURL = server.URL
+	defer func() { anthropicAPIURL = original }()
+
+	client, _ := NewAnthropicClient("test-key", "claude-3-5-sonnet-20241022")
+	cfg := &config.Config{Provider: "claude"}
+	response, usage, err := QueryWithPayload(context.Background(), client, cfg, config.QueryPayload{SanitizedLog: "ERROR boom"})
+	if err != nil {
+		t.Fatalf("QueryWithPayload() error = %v", err)
+	}
+	if response != "ok" {
+		t.Errorf("QueryWithPayload() = %q, want ok", response)
+	}
+	if usage == nil || usage.PromptTokens != 1200 || usage.CompletionTokens != 300 {
+		t.Fatalf("usage = %+v, want 1200 prompt and 300 completion tokens", usage)
+	}
+	// $3 per million input tokens and $15 per million output tokens
+	if usage.CostUSD == nil || *usage.CostUSD != 0.0081 {
+		t.Errorf("CostUSD = %v, want 0.0081", usage.CostUSD)
+	}
+}
+
+func TestAnthropicClient_ToolUse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		if len(req.Tools) != 1 || req.ToolChoice == nil || req.ToolChoice.Name != req.Tools[0].Name {
+			t.Errorf("tools = %+v, tool_choice = %+v, want the analysis tool forced", req.Tools, req.ToolChoice)
+		}
+		w.Write([]byte(`{"content": [{"type": "tool_use", "id": "toolu_1", "name": "log_analysis", "input": {"status": "no_problem"}}], "stop_reason": "tool_use", "usage": {"input_tokens": 10, "output_tokens": 5}}`))
+	}))
+	defer server.Close()
+
+	original := anthropicAPIURL
+	anthropicAPIURL = server.URL
+	defer func() { anthropicAPIURL = original }()
+
+	client, _ := NewAnthropicClient("test-key", "claude-test")
+	response, err := client.QueryWithPayload(context.Background(), &config.Config{Provider: "claude"}, config.QueryPayload{SanitizedLog: "INFO ok"})
+	if err != nil {
+		t.Fatalf("QueryWithPayload() error = %v", err)
+	}
+	if response != `{"status": "no_problem"}` {
+		t.Errorf("QueryWithPayload() = %q, want the tool input", response)
+	}
+}
+
+func TestAnthropicClient_RequestSettings(t *testing.T) {
+	var req anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Write([]byte(`{"content": [{"type": "text", "text": "ok"}], "stop_reason": "end_turn"}`))
+	}))
+	defer server.Close()
+
+	original := anthropicAPIURL
+	anthropicAPIURL = server.URL
+	defer func() { anthropicAPIURL = original }()
+
+	temperature := 0.2
+	cfg := &config.Config{Provider: "claude", ClaudeKey: "test-key", Timeout: 10 * time.Minute, MaxTokens: 8192, Temperature: &temperature}
+	client, err := NewAnthropicClientFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewAnthropicClientFromConfig() error = %v", err)
+	}
+	if timeout := client.(*AnthropicClient).client.Timeout; timeout != 10*time.Minute {
+		t.Errorf("Timeout = %v, want 10m", timeout)
+	}
+	if _, err := client.QueryWithHistory(context.Background(), cfg, nil, "why?"); err != nil {
+		t.Fatalf("QueryWithHistory() error = %v", err)
+	}
+	if req.MaxTokens != 8192 || req.Temperature == nil || *req.Temperature != 0.2 {
+		t.Errorf("max_tokens = %d, temperature = %v, want 8192 and 0.2", req.MaxTokens, req.Temperature)
+	}
+}
+
+func TestAnthropicClient_PromptCache(t *testing.T) {
+	var req struct {
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Write([]byte(`{"content": [{"type": "text", "text": "because"}], "stop_reason": "end_turn",
+			"usage": {"input_tokens": 100, "output_tokens": 200, "cache_read_input_tokens": 10000}}`))
+	}))
+	defer server.Close()
+
+	original := anthropicAPIURL
+	anthropicAPIURL = server.URL
+	defer func() { anthropicAPIURL = original }()
+
+	client, _ := NewAnthropicClient("test-key", "claude-3-5-sonnet-20241022")
+	cfg := &config.Config{Provider: "claude"}
+	_, usage, err := client.QueryWithHistoryUsage(context.Background(), cfg, []string{"Here is the log", "The disk is full"}, "why?")
+	if err != nil {
+		t.Fatalf("QueryWithHistoryUsage() error = %v", err)
+	}
+	if len(req.Messages) != 3 {
+		t.Fatalf("sent %d messages, want 3", len(req.Messages))
+	}
+	var blocks []anthropicTextBlock
+	if err := json.Unmarshal(req.Messages[0].Content, &blocks); err != nil || len(blocks) != 1 {
+		t.Fatalf("first message = %s, want one text block", req.Messages[0].Content)
+	}
+	if blocks[0].CacheControl == nil || blocks[0].CacheControl.Type != "ephemeral" || !strings.HasSuffix(blocks[0].Text, "Here is the log") {
+		t.Errorf("first message = %+v, want the log with a cache breakpoint", blocks[0])
+	}
+	for _, later := range req.Messages[1:] {
+		var text string
+		if err := json.Unmarshal(later.Content, &text); err != nil {
+			t.Errorf("later message = %s, want plain text", later.Content)
+		}
+	}
+
+	if usage.PromptTokens != 10100 || usage.CacheReadTokens != 10000 {
+		t.Errorf("usage = %+v, want 10100 prompt tokens, 10000 of them cached", usage)
+	}
+	// $3 per million input tokens, a tenth of that when cached, and $15 per million output tokens
+	if usage.CostUSD == nil || *usage.CostUSD < 0.00629 || *usage.CostUSD > 0.00631 {
+		t.Errorf("CostUSD = %v, want 0.0063", usage.CostUSD)
+	}
+
+	// In a session resumed for another run, the current run's log is cached
+	history := []string{LogMessageHeader + "\nold log", "The disk is full", "and now?", "Clean it up", LogMessageHeader + "\nnew log", "Still full"}
+	if _, err := client.QueryWithHistory(context.Background(), cfg, history, "why?"); err != nil {
+		t.Fatalf("QueryWithHistory() error = %v", err)
+	}
+	for i, msg := range req.Messages {
+		cached := bytes.Contains(msg.Content, []byte(`"cache_control"`))
+		if cached != (i == 4) {
+			t.Errorf("message %d cached = %v, want only the latest log (4) cached", i, cached)
+		}
+	}
+
+	// A question without a conversation has no log to cache
+	if _, err := client.QueryWithHistory(context.Background(), cfg, nil, "what is OOMKilled?"); err != nil {
+		t.Fatalf("QueryWithHistory() error = %v", err)
+	}
+	var text string
+	if err := json.Unmarshal(req.Messages[0].Content, &text); err != nil {
+		t.Errorf("lone question = %s, want plain text", req.Messages[0].Content)
+	}
+}
+
+func TestAnthropicClient_ErrorRequestIDs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("request-id", "req_0123")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"type": "error", "error": {"type": "invalid_request_error", "message": "prompt is too long"}}`))
+	}))
+	defer server.Close()
+
+	original := anthropicAPIURL
+	anthropicAPIURL = server.URL
+	defer func() { anthropicAPIURL = original }()
+
+	client, _ := NewAnthropicClient("test-key", "claude-test")
+	_, err := client.QueryWithHistory(context.Background(), &config.Config{Provider: "claude"}, nil, "why?")
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("QueryWithHistory() error = %v, want an APIError", err)
+	}
+	if apiErr.RequestID != "req_0123" || !strings.HasPrefix(apiErr.ClientRequestID, "que-") {
+		t.Errorf("RequestID = %q, ClientRequestID = %q, want req_0123 and a que- ID", apiErr.RequestID, apiErr.ClientRequestID)
+	}
+	if !strings.Contains(err.Error(), "request ID req_0123") {
+		t.Errorf("Error() = %q, want the request ID in it", err.Error())
+	}
+}
+
+func TestAnthropicClient_Canceled(t *testing.T) {
+	received := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server notices the client going away once the body is read
+		io.Copy(io.Discard, r.Body)
+		close(received)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	original := anthropicAPIURL
+	anthropicAPIURL = server.URL
+	defer func() { anthropicAPIURL = original }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-received
+		cancel()
+	}()
+
+	client, _ := NewAnthropicClient("test-key", "claude-test")
+	start := time.Now()
+	_, err := client.QueryWithPayload(ctx, &config.Config{Provider: "claude"}, config.QueryPayload{SanitizedLog: "ERROR boom"})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("QueryWithPayload() error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("canceled request took %v to return", elapsed)
+	}
+}
@@ -0,0 +1,89 @@
+//go:build !noopenai && !minimal
+
+package llm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/httpclient"
+	"github.com/sashabaranov/go-openai"
+)
+
+// DefaultAzureAPIVersion is the Azure OpenAI REST API version used when none is configured
+const DefaultAzureAPIVersion = "2024-06-01"
+
+func init() {
+	Register(Provider{
+		Name:        "azure",
+		DisplayName: "Azure OpenAI",
+		// Models are deployments named by the user; SetDefaultModel fills in the configured one
+		Dialect: DialectJSON,
+		EnvVars: []string{"QUE_AZURE_OPENAI_API_KEY"},
+		New:     NewAzureOpenAIClientFromConfig,
+	})
+}
+
+// AzureOpenAIClient queries an Azure OpenAI resource. It speaks the OpenAI
+// API, so everything but the endpoint layout and health check is shared.
+type AzureOpenAIClient struct {
+	*OpenAIClient
+}
+
+// NewAzureOpenAIClient creates a client for the Azure OpenAI resource at
+// endpoint (e.g. https://my-resource.openai.azure.com). Requests authenticate
+// with the api-key header and go to the deployment named deployment.
+func NewAzureOpenAIClient(apiKey, endpoint, apiVersion, deployment string) (*AzureOpenAIClient, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("Azure OpenAI API key is required")
+	}
+	if endpoint == "" {
+		return nil, fmt.Errorf("Azure OpenAI endpoint is required (set QUE_AZURE_OPENAI_ENDPOINT or azure.endpoint)")
+	}
+	if deployment == "" {
+		return nil, fmt.Errorf("Azure OpenAI deployment is required (set QUE_AZURE_OPENAI_DEPLOYMENT, azure.deployment or --model)")
+	}
+	if apiVersion == "" {
+		apiVersion = DefaultAzureAPIVersion
+	}
+
+	clientConfig := openai.DefaultAzureConfig(apiKey, endpoint)
+	clientConfig.APIVersion = apiVersion
+	// The model is the deployment name already; the SDK's default mapper strips dots from it
+	clientConfig.AzureModelMapperFunc = func(model string) string { return model }
+	httpClient := newRequestIDClient("Azure OpenAI", httpclient.New(config.DefaultTimeout))
+	clientConfig.HTTPClient = httpClient
+
+	return &AzureOpenAIClient{
+		OpenAIClient: &OpenAIClient{
+			client: openai.NewClientWithConfig(clientConfig),
+			http:   httpClient,
+			model:  deployment,
+		},
+	}, nil
+}
+
+// HealthCheck implements HealthChecker by listing the resource's models, which
+// checks the endpoint and key; Azure has no lookup by deployment name
+func (c *AzureOpenAIClient) HealthCheck(ctx context.Context) error {
+	if _, err := c.client.ListModels(ctx); err != nil {
+		return wrapOpenAIError(err)
+	}
+	return nil
+}
+
+// NewAzureOpenAIClientFromConfig creates a new Azure OpenAI client from config;
+// --model selects another deployment of the same resource
+func NewAzureOpenAIClientFromConfig(cfg *config.Config) (Client, error) {
+	deployment := cfg.Azure.Deployment
+	if cfg.Model != "" {
+		deployment = cfg.Model
+	}
+	client, err := NewAzureOpenAIClient(cfg.AzureKey, cfg.Azure.Endpoint, cfg.Azure.APIVersion, deployment)
+	if err != nil {
+		return nil, err
+	}
+	client.configure(cfg)
+	return client, nil
+}
@@ -0,0 +1,86 @@
+//go:build !noopenai && !minimal
+
+package llm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+func TestAzureOpenAIClient_Query(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("api-key") != "test-key" {
+			t.Errorf("api-key = %q, want test-key", r.Header.Get("api-key"))
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("Authorization = %q, want no bearer token", r.Header.Get("Authorization"))
+		}
+		if r.URL.Path != "/openai/deployments/prod-gpt-4.1/chat/completions" {
+			t.Errorf("path = %q, want the deployment's chat completions", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("api-version"); got != "2024-10-21" {
+			t.Errorf("api-version = %q, want 2024-10-21", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "ok"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		Provider: "azure",
+		AzureKey: "test-key",
+		Azure:    config.AzureConfig{Endpoint: server.URL, APIVersion: "2024-10-21", Deployment: "prod-gpt-4.1"},
+	}
+	client, err := NewAzureOpenAIClientFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewAzureOpenAIClientFromConfig() error = %v", err)
+	}
+	got, err := client.(*AzureOpenAIClient).Query(context.Background(), "system", "user")
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if got != "ok" {
+		t.Errorf("Query() = %q, want ok", got)
+	}
+}
+
+func TestNewAzureOpenAIClient_Required(t *testing.T) {
+	testCases := []struct {
+		name       string
+		key        string
+		endpoint   string
+		deployment string
+		want       string
+	}{
+		{"no key", "", "https://x.openai.azure.com", "gpt", "API key"},
+		{"no endpoint", "key", "", "gpt", "QUE_AZURE_OPENAI_ENDPOINT"},
+		{"no deployment", "key", "https://x.openai.azure.com", "", "QUE_AZURE_OPENAI_DEPLOYMENT"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewAzureOpenAIClient(tc.key, tc.endpoint, "", tc.deployment)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("NewAzureOpenAIClient() = %v, want an error mentioning %s", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestSetDefaultModel(t *testing.T) {
+	original := providers["azure"]
+	defer func() { providers["azure"] = original }()
+
+	SetDefaultModel("azure", "prod-gpt-4.1")
+	if got := ResolveModel("azure", ""); got != "prod-gpt-4.1" {
+		t.Errorf("ResolveModel() = %q, want the configured deployment", got)
+	}
+	if got := ResolveModel("azure", "staging"); got != "staging" {
+		t.Errorf("ResolveModel() = %q, want the --model override", got)
+	}
+}
@@ -0,0 +1,128 @@
+package llm
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// embeddedCatalog is the built-in model catalog, which a models_file extends
+//
+//go:embed models.json
+var embeddedCatalog []byte
+
+// ModelCatalog lists model aliases, deprecated models and the model name
+// prefixes each provider knows, in the form of models.json
+type ModelCatalog struct {
+	// Aliases maps, per provider, a short name to the model ID it stands for
+	// (e.g. "claude-sonnet" to the latest dated Sonnet)
+	Aliases map[string]map[string]string `json:"aliases"`
+	// Deprecated maps model name prefixes to what replaces them
+	Deprecated map[string]Deprecation `json:"deprecated"`
+	// Known lists, per provider, the prefixes of the models it serves
+	Known map[string][]string `json:"known"`
+}
+
+// Deprecation describes a deprecated model
+type Deprecation struct {
+	Replacement string `json:"replacement,omitempty"` // Model or alias to use instead
+	Retired     string `json:"retired,omitempty"`     // Date the provider shuts the model down, as YYYY-MM-DD
+}
+
+// catalog is the model catalog in use
+var catalog = mustParseCatalog(embeddedCatalog)
+
+// mustParseCatalog parses the embedded catalog, which is known to be valid
+func mustParseCatalog(data []byte) ModelCatalog {
+	var c ModelCatalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		panic(fmt.Sprintf("invalid embedded models.json: %v", err))
+	}
+	return c
+}
+
+// LoadModelCatalog merges the catalog in the JSON file at path into the
+// built-in one: its aliases and deprecations replace built-in entries of the
+// same name, and its known prefixes are added. It is meant to be called once
+// at startup with the config file's models_file.
+func LoadModelCatalog(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read models file: %w", err)
+	}
+	var override ModelCatalog
+	if err := json.Unmarshal(data, &override); err != nil {
+		return fmt.Errorf("invalid models file %s: %w", path, err)
+	}
+	for _, date := range override.Deprecated {
+		if _, err := time.Parse(time.DateOnly, date.Retired); date.Retired != "" && err != nil {
+			return fmt.Errorf("invalid models file %s: retired date %q isn't YYYY-MM-DD", path, date.Retired)
+		}
+	}
+
+	for provider, aliases := range override.Aliases {
+		if catalog.Aliases[provider] == nil {
+			catalog.Aliases[provider] = make(map[string]string)
+		}
+		for alias, model := range aliases {
+			catalog.Aliases[provider][alias] = model
+		}
+	}
+	for prefix, deprecation := range override.Deprecated {
+		catalog.Deprecated[prefix] = deprecation
+	}
+	for provider, prefixes := range override.Known {
+		catalog.Known[provider] = append(catalog.Known[provider], prefixes...)
+	}
+	return nil
+}
+
+// ResolveAlias returns the model ID model stands for with cfg's provider, or
+// model itself if it isn't an alias. Aliases only apply to the provider's
+// own API, not to an OpenAI-compatible endpoint with models of its own.
+func ResolveAlias(cfg *config.Config, model string) string {
+	if cfg.Provider == "openai" && cfg.OpenAIBaseURL != "" {
+		return model
+	}
+	if id, ok := catalog.Aliases[cfg.Provider][model]; ok {
+		return id
+	}
+	return model
+}
+
+// ModelWarning returns a warning about model for cfg's provider if it is
+// deprecated, or isn't one of the provider's models (usually a typo), or ""
+func ModelWarning(cfg *config.Config, model string) string {
+	if prefix := longestPrefix(model, catalog.Deprecated); prefix != "" {
+		deprecation := catalog.Deprecated[prefix]
+		warning := fmt.Sprintf("model %s is deprecated", model)
+		if retired, err := time.Parse(time.DateOnly, deprecation.Retired); err == nil {
+			if time.Now().Before(retired) {
+				warning += fmt.Sprintf(" and will be retired on %s", deprecation.Retired)
+			} else {
+				warning += fmt.Sprintf(" and was retired on %s", deprecation.Retired)
+			}
+		}
+		if deprecation.Replacement != "" {
+			warning += fmt.Sprintf("; use %s instead", deprecation.Replacement)
+		}
+		return warning
+	}
+
+	// Providers without a list, and OpenAI-compatible endpoints, serve models que can't know
+	known, ok := catalog.Known[cfg.Provider]
+	if !ok || (cfg.Provider == "openai" && cfg.OpenAIBaseURL != "") {
+		return ""
+	}
+	for _, prefix := range known {
+		if strings.HasPrefix(model, prefix) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("model %s isn't a known %s model; check the --model value", model, cfg.Provider)
+}
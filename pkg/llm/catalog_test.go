@@ -0,0 +1,83 @@
+package llm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+func TestResolveAlias(t *testing.T) {
+	testCases := []struct {
+		name  string
+		cfg   config.Config
+		model string
+		want  string
+	}{
+		{"claude alias", config.Config{Provider: "claude"}, "claude-sonnet", "claude-sonnet-4-5-20250929"},
+		{"pinned openai model", config.Config{Provider: "openai"}, "gpt-4o", "gpt-4o-2024-08-06"},
+		{"dated id", config.Config{Provider: "claude"}, "claude-opus-4-20250514", "claude-opus-4-20250514"},
+		{"other provider's alias", config.Config{Provider: "openai"}, "claude-sonnet", "claude-sonnet"},
+		{"compatible endpoint", config.Config{Provider: "openai", OpenAIBaseURL: "http://localhost:8000/v1"}, "gpt-4o", "gpt-4o"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ResolveAlias(&tc.cfg, tc.model); got != tc.want {
+				t.Errorf("ResolveAlias(%q) = %q, want %q", tc.model, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestModelWarning(t *testing.T) {
+	testCases := []struct {
+		name  string
+		cfg   config.Config
+		model string
+		want  string
+	}{
+		{"current", config.Config{Provider: "claude"}, "claude-sonnet-4-5-20250929", ""},
+		{"retired", config.Config{Provider: "claude"}, "claude-2.1", "model claude-2.1 is deprecated and was retired on 2025-07-21; use claude-sonnet instead"},
+		{"unknown", config.Config{Provider: "openai"}, "gtp-4o", "model gtp-4o isn't a known openai model"},
+		{"compatible endpoint", config.Config{Provider: "openai", OpenAIBaseURL: "http://localhost:8000/v1"}, "llama3-8b", ""},
+		{"azure deployment", config.Config{Provider: "azure"}, "prod-gpt-4o", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ModelWarning(&tc.cfg, tc.model)
+			if (tc.want == "" && got != "") || !strings.HasPrefix(got, tc.want) {
+				t.Errorf("ModelWarning(%q) = %q, want %q", tc.model, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadModelCatalog(t *testing.T) {
+	t.Cleanup(func() { catalog = mustParseCatalog(embeddedCatalog) })
+
+	path := filepath.Join(t.TempDir(), "models.json")
+	os.WriteFile(path, []byte(`{"aliases": {"claude": {"claude-fast": "claude-haiku-4-5-20251001"}}, "deprecated": {"gpt-4-turbo": {"replacement": "gpt-4.1", "retired": "2099-01-01"}}}`), 0o644)
+	if err := LoadModelCatalog(path); err != nil {
+		t.Fatalf("LoadModelCatalog() error = %v", err)
+	}
+
+	if got := ResolveAlias(&config.Config{Provider: "claude"}, "claude-fast"); got != "claude-haiku-4-5-20251001" {
+		t.Errorf("ResolveAlias(claude-fast) = %q, want the added alias", got)
+	}
+	if got := ResolveAlias(&config.Config{Provider: "claude"}, "claude-sonnet"); got != "claude-sonnet-4-5-20250929" {
+		t.Errorf("ResolveAlias(claude-sonnet) = %q, want the built-in alias kept", got)
+	}
+	want := "model gpt-4-turbo is deprecated and will be retired on 2099-01-01; use gpt-4.1 instead"
+	if got := ModelWarning(&config.Config{Provider: "openai"}, "gpt-4-turbo"); got != want {
+		t.Errorf("ModelWarning(gpt-4-turbo) = %q, want %q", got, want)
+	}
+
+	os.WriteFile(path, []byte(`{"deprecated": {"gpt-4o": {"retired": "soon"}}}`), 0o644)
+	if err := LoadModelCatalog(path); err == nil {
+		t.Error("LoadModelCatalog() should reject a retired date that isn't YYYY-MM-DD")
+	}
+}
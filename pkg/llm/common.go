@@ -2,16 +2,51 @@ package llm
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/jenian/que/internal/config"
 )
 
+// BuildPrompts returns the system and user prompts that would be sent for the
+// initial analysis of payload, exactly as the provider clients build them.
+// A custom system prompt replaces the template's, and with schema enforcement
+// off the JSON response instructions are left out of the user prompt. The
+// user prompt is laid out in the dialect resolved for the model.
+func BuildPrompts(cfg *config.Config, payload config.QueryPayload) (string, string) {
+	tmpl := promptTemplateFor(cfg.PromptVersion)
+	if cfg.SystemPrompt != "" {
+		tmpl.System = cfg.SystemPrompt
+	}
+	dialect := PromptDialect(cfg)
+	if dialect == DialectCompact && tmpl.Compact != nil {
+		tmpl.Instructions = tmpl.Compact
+	}
+	tmpl.Examples = fewShotExamples(cfg, tmpl, dialect)
+	if cfg.NoSchema {
+		tmpl.Instructions = nil
+		tmpl.Compare = ""
+	}
+	if dialect == DialectXML {
+		return tmpl.System, formatXMLPrompt(tmpl, payload)
+	}
+	return tmpl.System, formatPrompt(tmpl, payload)
+}
+
 // formatPrompt formats the payload into a user-friendly prompt for the LLM
-func formatPrompt(payload config.QueryPayload) string {
+func formatPrompt(tmpl PromptTemplate, payload config.QueryPayload) string {
 	var parts []string
 
+	// Add example analyses first, so they can't be mistaken for the log
+	if len(tmpl.Examples) > 0 {
+		parts = append(parts, "Example Analyses (of other logs, showing only the response format):")
+		for i, example := range tmpl.Examples {
+			parts = append(parts, fmt.Sprintf("Example %d log:\n%s\nExample %d response:\n%s", i+1, example.Log, i+1, example.Response))
+		}
+	}
+
 	// Add system context if available
 	if payload.SystemContext.OS != "" {
 		ctx := payload.SystemContext
@@ -20,17 +55,223 @@ func formatPrompt(payload config.QueryPayload) string {
 		parts = append(parts, contextInfo)
 	}
 
+	// Add user-provided context the log itself may not contain
+	if payload.Hint != "" {
+		parts = append(parts, "User-Provided Context:\n"+payload.Hint)
+	}
+
+	// Add the analysis this log is compared against
+	if payload.Previous != nil {
+		parts = append(parts, formatPrevious(*payload.Previous))
+	}
+
+	// Say what wrote the log and where its failures usually are
+	if guidance := toolchainGuidance(payload.Toolchain, payload.Filtered); guidance != "" {
+		parts = append(parts, "Log Type:\n"+guidance)
+	}
+
+	// Explain which containers the log's lines come from
+	if len(payload.Sources) > 0 {
+		parts = append(parts, "Log Sources:\n"+formatSources(payload.Sources, payload.Interleaved))
+	}
+
 	// Add the sanitized log
 	parts = append(parts, "Log/Error Data:")
 	parts = append(parts, payload.SanitizedLog)
 
-	// Add instruction
-	parts = append(parts, "\nAnalyze the above log data and return a strict JSON response with exactly four fields:")
-	parts = append(parts, "1. \"status\": One of: \"no_problem\" (if no errors/issues detected), \"insufficient_data\" (if problem detected but not enough info for a clear solution), or \"problem_detected\" (if problem found with clear solution)")
-	parts = append(parts, "2. \"root_cause\": A concise description of the root cause (empty string if status is \"no_problem\")")
-	parts = append(parts, "3. \"evidence\": The relevant log lines that indicate the problem (include actual log lines, or empty string if status is \"no_problem\")")
-	parts = append(parts, "4. \"fix\": A concise, executable CLI fix or code patch (empty string if status is \"no_problem\" or \"insufficient_data\")")
-	parts = append(parts, "\nReturn ONLY valid JSON, no markdown, no code blocks, no explanations. The JSON must be parseable.")
+	// Add attached files after the log so the model reads the failure first
+	for _, attachment := range payload.Attachments {
+		parts = append(parts, formatAttachment(attachment))
+	}
+
+	// Explain the placeholders so they aren't mistaken for broken values
+	if summary := RedactionSummary(strings.Join(parts, "\n")); summary != "" {
+		parts = append(parts, summary)
+	}
+
+	// Add versioned instructions describing the response schema
+	parts = append(parts, tmpl.Instructions...)
+	if payload.Previous != nil && tmpl.Compare != "" {
+		parts = append(parts, tmpl.Compare)
+	}
+
+	return strings.Join(parts, "\n\n")
+}
+
+// formatXMLPrompt formats the payload like formatPrompt, with each section
+// wrapped in a tag instead of under a title
+func formatXMLPrompt(tmpl PromptTemplate, payload config.QueryPayload) string {
+	var parts []string
+	tag := func(name, attributes, body string) {
+		parts = append(parts, fmt.Sprintf("<%s%s>\n%s\n</%s>", name, attributes, body, name))
+	}
+
+	if len(tmpl.Examples) > 0 {
+		var examples []string
+		for _, example := range tmpl.Examples {
+			examples = append(examples, fmt.Sprintf("<example>\n<log>\n%s\n</log>\n<response>\n%s\n</response>\n</example>", example.Log, example.Response))
+		}
+		tag("examples", "", "These analyze other logs and only show the response format.\n"+strings.Join(examples, "\n"))
+	}
+
+	if payload.SystemContext.OS != "" {
+		ctx := payload.SystemContext
+		tag("system_environment", "", fmt.Sprintf("- OS: %s\n- Architecture: %s\n- Shell: %s\n- Timestamp: %s",
+			ctx.OS, ctx.Arch, ctx.Shell, ctx.Timestamp.Format(time.RFC3339)))
+	}
+	if payload.Hint != "" {
+		tag("user_context", "", payload.Hint)
+	}
+	if payload.Previous != nil {
+		previous := *payload.Previous
+		body := "Root cause: " + previous.RootCause
+		if previous.Fix != "" {
+			body += "\nSuggested fix: " + previous.Fix
+		}
+		attributes := ""
+		if !previous.Timestamp.IsZero() {
+			attributes = fmt.Sprintf(" timestamp=%q", previous.Timestamp.Format(time.RFC3339))
+		}
+		tag("previous_analysis", attributes, body)
+	}
+	if guidance := toolchainGuidance(payload.Toolchain, payload.Filtered); guidance != "" {
+		tag("log_type", fmt.Sprintf(" tool=%q", payload.Toolchain), guidance)
+	}
+	if len(payload.Sources) > 0 {
+		tag("log_sources", "", formatSources(payload.Sources, payload.Interleaved))
+	}
+	tag("log", "", payload.SanitizedLog)
+	for _, attachment := range payload.Attachments {
+		attributes := fmt.Sprintf(" name=%q", attachment.Name)
+		if attachment.Truncated {
+			attributes += ` truncated="true"`
+		}
+		tag("attachment", attributes, attachment.Content)
+	}
+	if summary := RedactionSummary(strings.Join(parts, "\n")); summary != "" {
+		tag("redactions", "", strings.TrimPrefix(summary, "Redacted Values:\n"))
+	}
+
+	instructions := tmpl.Instructions
+	if payload.Previous != nil && tmpl.Compare != "" {
+		instructions = append(instructions[:len(instructions):len(instructions)], tmpl.Compare)
+	}
+	if len(instructions) > 0 {
+		tag("instructions", "", strings.TrimSpace(strings.Join(instructions, "\n")))
+	}
 
 	return strings.Join(parts, "\n\n")
 }
+
+// redactionPlaceholder matches the placeholders the sanitizer puts in place
+// of secrets, e.g. <REDACTED_DB_CONNECTION_STRING>
+var redactionPlaceholder = placeholderPattern(config.DefaultRedactionTemplate)
+
+// SetRedactionTemplate makes RedactionSummary recognize the placeholders the
+// sanitizer writes with template, e.g. [REDACTED:{type}:{n}]. It is meant to
+// be called once at startup; an empty template restores the default.
+func SetRedactionTemplate(template string) {
+	if template == "" {
+		template = config.DefaultRedactionTemplate
+	}
+	redactionPlaceholder = placeholderPattern(template)
+}
+
+// RedactionPlaceholderPattern returns the regexp matching the placeholders the
+// sanitizer puts in place of secrets, following SetRedactionTemplate
+func RedactionPlaceholderPattern() *regexp.Regexp {
+	return redactionPlaceholder
+}
+
+// placeholderPattern compiles a placeholder template into a regexp matching
+// the placeholders it produces
+func placeholderPattern(template string) *regexp.Regexp {
+	pattern := regexp.QuoteMeta(template)
+	pattern = strings.ReplaceAll(pattern, `\{type\}`, `[A-Z0-9_]+`)
+	pattern = strings.ReplaceAll(pattern, `\{rule\}`, `[A-Za-z0-9_.-]+`)
+	pattern = strings.ReplaceAll(pattern, `\{n\}`, `[0-9]+`)
+	return regexp.MustCompile(pattern)
+}
+
+// redactionNote follows the list of placeholders in RedactionSummary
+const redactionNote = "These placeholders stand for secrets that were removed before the data was sent. They are not the actual values: do not report them as malformed, missing or invalid configuration."
+
+// RedactionSummary returns a prompt section telling the model which
+// placeholders in text replaced secrets, and how often, or "" if there are none
+func RedactionSummary(text string) string {
+	counts := make(map[string]int)
+	for _, placeholder := range redactionPlaceholder.FindAllString(text, -1) {
+		counts[placeholder]++
+	}
+	if len(counts) == 0 {
+		return ""
+	}
+
+	placeholders := make([]string, 0, len(counts))
+	for placeholder := range counts {
+		placeholders = append(placeholders, placeholder)
+	}
+	sort.Strings(placeholders)
+
+	lines := []string{"Redacted Values:"}
+	for _, placeholder := range placeholders {
+		noun := "values"
+		if counts[placeholder] == 1 {
+			noun = "value"
+		}
+		lines = append(lines, fmt.Sprintf("- %d %s replaced with %s", counts[placeholder], noun, placeholder))
+	}
+	lines = append(lines, redactionNote)
+	return strings.Join(lines, "\n")
+}
+
+// formatSources describes the pods and containers a kubectl log interleaves,
+// so the model can follow a failure from one container to another
+func formatSources(sources []config.LogSource, interleaved bool) string {
+	var pods []string
+	containers := make(map[string][]string)
+	for _, source := range sources {
+		if _, ok := containers[source.Pod]; !ok {
+			pods = append(pods, source.Pod)
+		}
+		noun := "lines"
+		if source.Lines == 1 {
+			noun = "line"
+		}
+		containers[source.Pod] = append(containers[source.Pod], fmt.Sprintf("%s (%d %s)", source.Container, source.Lines, noun))
+	}
+
+	lines := []string{fmt.Sprintf("The log combines %d containers of %d pods. Each line starts with [pod/POD/CONTAINER], naming the container that wrote it:", len(sources), len(pods))}
+	for _, pod := range pods {
+		lines = append(lines, fmt.Sprintf("- pod %s: %s", pod, strings.Join(containers[pod], ", ")))
+	}
+	if interleaved {
+		lines = append(lines, "The lines of all containers are in timestamp order.")
+	} else {
+		lines = append(lines, "The lines of each container may be grouped together rather than in time order.")
+	}
+	lines = append(lines, "A failure in one container may be caused by another, e.g. a sidecar, a dependency in another pod or an init container: relate them by time and by the requests, hosts and ports they share.")
+	return strings.Join(lines, "\n")
+}
+
+// formatPrevious renders an earlier analysis as a prompt section
+func formatPrevious(previous config.PreviousAnalysis) string {
+	section := "Previous Analysis"
+	if !previous.Timestamp.IsZero() {
+		section += " (" + previous.Timestamp.Format(time.RFC3339) + ")"
+	}
+	section += ":\nRoot cause: " + previous.RootCause
+	if previous.Fix != "" {
+		section += "\nSuggested fix: " + previous.Fix
+	}
+	return section
+}
+
+// formatAttachment renders an attached file as a labeled prompt section
+func formatAttachment(attachment config.Attachment) string {
+	label := fmt.Sprintf("Attached File: %s", attachment.Name)
+	if attachment.Truncated {
+		label += " (truncated)"
+	}
+	return fmt.Sprintf("%s\n--- BEGIN %s ---\n%s\n--- END %s ---", label, attachment.Name, attachment.Content, attachment.Name)
+}
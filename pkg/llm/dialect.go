@@ -0,0 +1,80 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// Prompt dialects: the same prompt content, laid out the way a family of
+// models follows it best
+const (
+	// DialectAuto picks the dialect from the model and provider
+	DialectAuto = "auto"
+	// DialectPlain is the original layout of titled sections
+	DialectPlain = "plain"
+	// DialectXML wraps every section in tags, which Claude models follow closely
+	DialectXML = "xml"
+	// DialectJSON is the plain layout with the provider's structured output
+	// turned on where it has one (OpenAI)
+	DialectJSON = "json"
+	// DialectCompact is the plain layout with shorter response instructions,
+	// for small and local models
+	DialectCompact = "compact"
+)
+
+// dialects lists the names accepted by ValidateDialect
+var dialects = []string{DialectAuto, DialectPlain, DialectXML, DialectJSON, DialectCompact}
+
+// promptDialects maps model name prefixes to dialects, overriding the
+// automatic choice. It is filled from the config file's prompt_dialects.
+var promptDialects = map[string]string{}
+
+// ValidateDialect returns an error if name isn't a known prompt dialect
+func ValidateDialect(name string) error {
+	for _, d := range dialects {
+		if name == d {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown prompt dialect: %s (available: %s)", name, strings.Join(dialects, ", "))
+}
+
+// SetPromptDialects sets the dialect for model name prefixes, e.g.
+// {"llama3": "compact"}. It is meant to be called once at startup with the
+// config file's prompt_dialects.
+func SetPromptDialects(byModel map[string]string) error {
+	for prefix, dialect := range byModel {
+		if err := ValidateDialect(dialect); err != nil {
+			return fmt.Errorf("prompt_dialects.%s: %w", prefix, err)
+		}
+		promptDialects[prefix] = dialect
+	}
+	return nil
+}
+
+// ResolveDialect returns the dialect to prompt model of provider in. An
+// override other than "auto" wins; otherwise the prompt_dialects entry for
+// the model is used, then compact for models with a small context window
+// (including unknown ones, which are usually local), then the provider's own.
+func ResolveDialect(provider, model, override string) string {
+	if override != "" && override != DialectAuto {
+		return override
+	}
+	if prefix := longestPrefix(model, promptDialects); prefix != "" && promptDialects[prefix] != DialectAuto {
+		return promptDialects[prefix]
+	}
+	if model != "" && ContextWindow(model) <= defaultContextWindow {
+		return DialectCompact
+	}
+	if p, ok := providers[provider]; ok && p.Dialect != "" {
+		return p.Dialect
+	}
+	return DialectPlain
+}
+
+// PromptDialect returns the dialect of the prompts built for cfg
+func PromptDialect(cfg *config.Config) string {
+	return ResolveDialect(cfg.Provider, ResolveModel(cfg.Provider, cfg.Model), cfg.PromptDialect)
+}
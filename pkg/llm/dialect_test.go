@@ -0,0 +1,97 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// withDialectProviders stands in for the built-in providers, so the tests
+// don't depend on the build tags that leave them out
+func withDialectProviders(t *testing.T) {
+	original := providers
+	providers = map[string]Provider{}
+	t.Cleanup(func() { providers = original })
+	newClient := func(cfg *config.Config) (Client, error) { return plainClient{}, nil }
+	Register(Provider{Name: "claude", DefaultModel: DefaultAnthropicModel, Dialect: DialectXML, New: newClient})
+	Register(Provider{Name: "openai", DefaultModel: DefaultOpenAIModel, Dialect: DialectJSON, New: newClient})
+}
+
+func TestResolveDialect(t *testing.T) {
+	withDialectProviders(t)
+	t.Cleanup(func() { delete(promptDialects, "gpt-4o-mini") })
+	if err := SetPromptDialects(map[string]string{"gpt-4o-mini": DialectPlain}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		provider, model, override string
+		want                      string
+	}{
+		{"claude", DefaultAnthropicModel, "", DialectXML},
+		{"openai", DefaultOpenAIModel, "", DialectJSON},
+		{"openai", DefaultOpenAIModel, DialectAuto, DialectJSON},
+		{"openai", "llama3:8b", "", DialectCompact},                       // unknown models are assumed small
+		{"openai", "gpt-4o-mini", "", DialectPlain},                       // prompt_dialects beats the provider
+		{"claude", DefaultAnthropicModel, DialectCompact, DialectCompact}, // the override beats everything
+		{"", "", "", DialectPlain},
+	}
+	for _, tt := range tests {
+		if got := ResolveDialect(tt.provider, tt.model, tt.override); got != tt.want {
+			t.Errorf("ResolveDialect(%q, %q, %q) = %q, want %q", tt.provider, tt.model, tt.override, got, tt.want)
+		}
+	}
+
+	if err := SetPromptDialects(map[string]string{"llama3": "yaml"}); err == nil {
+		t.Error("SetPromptDialects should reject an unknown dialect")
+	}
+}
+
+func TestBuildPrompts_XMLDialect(t *testing.T) {
+	withDialectProviders(t)
+	cfg := &config.Config{Provider: "claude"}
+	payload := config.QueryPayload{
+		SanitizedLog: "ERROR dial <REDACTED_DB_CONNECTION_STRING>",
+		Hint:         "after the upgrade",
+		Attachments:  []config.Attachment{{Name: "app.yaml", Content: "port: 80", Truncated: true}},
+		Previous:     &config.PreviousAnalysis{RootCause: "pool exhausted"},
+	}
+
+	_, user := BuildPrompts(cfg, payload)
+	for _, want := range []string{
+		"<user_context>\nafter the upgrade\n</user_context>",
+		"<previous_analysis>\nRoot cause: pool exhausted\n</previous_analysis>",
+		"<log>\nERROR dial <REDACTED_DB_CONNECTION_STRING>\n</log>",
+		"<attachment name=\"app.yaml\" truncated=\"true\">\nport: 80\n</attachment>",
+		"<redactions>\n- 1 value replaced with <REDACTED_DB_CONNECTION_STRING>",
+		"<instructions>\nAnalyze the above log data",
+		comparePrompt + "\n</instructions>",
+	} {
+		if !strings.Contains(user, want) {
+			t.Errorf("XML prompt should contain %q, got:\n%s", want, user)
+		}
+	}
+	if strings.Contains(user, "Log/Error Data:") {
+		t.Error("XML prompt should not use the plain section titles")
+	}
+}
+
+func TestBuildPrompts_CompactDialect(t *testing.T) {
+	tmpl := promptTemplateFor(CurrentPromptVersion)
+	payload := config.QueryPayload{SanitizedLog: "ERROR boom"}
+
+	_, user := BuildPrompts(&config.Config{Provider: "openai", PromptDialect: DialectCompact}, payload)
+	if !strings.Contains(user, strings.Join(tmpl.Compact, "\n\n")) {
+		t.Errorf("Compact prompt should use the compact instructions, got:\n%s", user)
+	}
+	if strings.Contains(user, tmpl.Instructions[1]) {
+		t.Error("Compact prompt should leave out the full instructions")
+	}
+
+	// Older versions have no compact instructions and keep their own
+	_, user = BuildPrompts(&config.Config{Provider: "openai", PromptDialect: DialectCompact, PromptVersion: "v1"}, payload)
+	if !strings.Contains(user, promptTemplateFor("v1").Instructions[1]) {
+		t.Error("v1 compact prompt should keep the v1 instructions")
+	}
+}
@@ -0,0 +1,135 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Sentinel errors describing the failure classes callers may want to react to.
+// Provider errors wrap one of these (via APIError) so they can be matched with errors.Is.
+var (
+	// ErrRateLimited indicates the provider rejected the request due to rate or quota limits
+	ErrRateLimited = errors.New("rate limited by provider")
+	// ErrQuotaExceeded indicates the account's quota or credit is used up.
+	// It wraps ErrRateLimited, so callers stopping on rate limits stop on it
+	// too, but unlike a rate limit it doesn't pass by waiting.
+	ErrQuotaExceeded = fmt.Errorf("quota exhausted: %w", ErrRateLimited)
+	// ErrAuth indicates the API key is missing, invalid, or lacks permission
+	ErrAuth = errors.New("authentication with provider failed")
+	// ErrContextTooLarge indicates the prompt exceeds the model's context window
+	ErrContextTooLarge = errors.New("prompt exceeds the model context window")
+	// ErrContentFiltered indicates the provider refused the request due to its content policy
+	ErrContentFiltered = errors.New("request blocked by provider content filter")
+	// ErrModelNotFound indicates the selected model doesn't exist or isn't available to the key
+	ErrModelNotFound = errors.New("model not found")
+)
+
+// APIError describes a failed call to an LLM provider
+type APIError struct {
+	Provider   string // Provider display name, e.g. "OpenAI" or "anthropic"
+	StatusCode int    // HTTP status code, 0 if unknown
+	Type       string // Provider-specific error type or code
+	Message    string // Provider-supplied error message
+	Kind       error  // One of the sentinel errors above, nil if unclassified
+	// Categories are the content filter categories the provider flagged
+	// (e.g. "violence"), for content filter errors of providers that say
+	Categories []string
+	// RequestID is the provider's ID of the failed request (x-request-id),
+	// which its support asks for; empty if the provider sent none
+	RequestID string
+	// ClientRequestID is que's ID of the call, sent as X-Client-Request-Id
+	ClientRequestID string
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	var msg string
+	switch {
+	case e.Type != "" && e.Message != "":
+		msg = fmt.Sprintf("%s API error: %s - %s", e.Provider, e.Type, e.Message)
+	case e.Message != "":
+		msg = fmt.Sprintf("%s API error: status %d, %s", e.Provider, e.StatusCode, e.Message)
+	default:
+		msg = fmt.Sprintf("%s API error: status %d", e.Provider, e.StatusCode)
+	}
+
+	var ids []string
+	if e.RequestID != "" {
+		ids = append(ids, "request ID "+e.RequestID)
+	}
+	if e.ClientRequestID != "" {
+		ids = append(ids, "client request ID "+e.ClientRequestID)
+	}
+	if len(ids) > 0 {
+		msg += " (" + strings.Join(ids, ", ") + ")"
+	}
+	return msg
+}
+
+// Unwrap exposes the failure class so errors.Is(err, ErrRateLimited) works
+func (e *APIError) Unwrap() error {
+	return e.Kind
+}
+
+// newAPIError builds an APIError and classifies it into one of the sentinel errors
+func newAPIError(provider string, statusCode int, errType, message string) *APIError {
+	return &APIError{
+		Provider:   provider,
+		StatusCode: statusCode,
+		Type:       errType,
+		Message:    message,
+		Kind:       classifyError(statusCode, errType, message),
+	}
+}
+
+// ContentFilterCategories returns the content filter categories err's
+// provider flagged, if err is a content filter error that names them
+func ContentFilterCategories(err error) []string {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !errors.Is(err, ErrContentFiltered) {
+		return nil
+	}
+	return apiErr.Categories
+}
+
+// classifyError maps provider status codes, error types and messages to a sentinel error
+func classifyError(statusCode int, errType, message string) error {
+	typeLower := strings.ToLower(errType)
+	msgLower := strings.ToLower(message)
+
+	// Content filtering is checked first since some providers report it as a 400
+	if typeLower == "refusal" || strings.Contains(typeLower, "content_filter") || strings.Contains(typeLower, "content_policy") ||
+		strings.Contains(typeLower, "responsibleaipolicyviolation") || strings.Contains(msgLower, "content management policy") ||
+		strings.Contains(msgLower, "content filter") || strings.Contains(msgLower, "content filtering") {
+		return ErrContentFiltered
+	}
+
+	if strings.Contains(typeLower, "context_length") || strings.Contains(msgLower, "context length") ||
+		strings.Contains(msgLower, "context window") || strings.Contains(msgLower, "prompt is too long") ||
+		strings.Contains(msgLower, "maximum context") || statusCode == http.StatusRequestEntityTooLarge {
+		return ErrContextTooLarge
+	}
+
+	if strings.Contains(typeLower, "insufficient_quota") {
+		return ErrQuotaExceeded
+	}
+
+	if statusCode == http.StatusTooManyRequests || strings.Contains(typeLower, "rate_limit") {
+		return ErrRateLimited
+	}
+
+	if strings.Contains(typeLower, "model_not_found") ||
+		(statusCode == http.StatusNotFound && (strings.Contains(typeLower, "not_found") || strings.Contains(msgLower, "model"))) {
+		return ErrModelNotFound
+	}
+
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden ||
+		strings.Contains(typeLower, "authentication") || strings.Contains(typeLower, "permission") ||
+		strings.Contains(typeLower, "invalid_api_key") {
+		return ErrAuth
+	}
+
+	return nil
+}
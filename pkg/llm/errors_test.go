@@ -0,0 +1,58 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	testCases := []struct {
+		name       string
+		statusCode int
+		errType    string
+		message    string
+		want       error
+	}{
+		{"rate limit status", 429, "", "slow down", ErrRateLimited},
+		{"rate limit type", 0, "rate_limit_error", "", ErrRateLimited},
+		{"openai quota", 429, "insufficient_quota", "You exceeded your current quota, please check your plan and billing details", ErrQuotaExceeded},
+		{"unauthorized", 401, "authentication_error", "invalid x-api-key", ErrAuth},
+		{"openai invalid key", 0, "invalid_api_key", "Incorrect API key provided", ErrAuth},
+		{"anthropic prompt too long", 400, "invalid_request_error", "prompt is too long: 250000 tokens > 200000 maximum", ErrContextTooLarge},
+		{"openai context length", 400, "context_length_exceeded", "This model's maximum context length is 128000 tokens", ErrContextTooLarge},
+		{"content filter", 400, "content_filter", "The response was filtered", ErrContentFiltered},
+		{"azure content filter", 400, "ResponsibleAIPolicyViolation", "The response was filtered due to the prompt triggering Azure OpenAI's content management policy", ErrContentFiltered},
+		{"openai unknown model", 404, "model_not_found", "The model `gpt-9` does not exist", ErrModelNotFound},
+		{"anthropic unknown model", 404, "not_found_error", "model: claude-9", ErrModelNotFound},
+		{"unclassified", 500, "api_error", "internal error", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := classifyError(tc.statusCode, tc.errType, tc.message)
+			if got != tc.want {
+				t.Errorf("classifyError() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAPIError_Unwrap(t *testing.T) {
+	err := fmt.Errorf("failed to get advice: %w", newAPIError("anthropic", 429, "rate_limit_error", "Number of requests exceeded"))
+
+	if !errors.Is(err, ErrRateLimited) {
+		t.Error("errors.Is(err, ErrRateLimited) = false, want true")
+	}
+	if errors.Is(err, ErrAuth) {
+		t.Error("errors.Is(err, ErrAuth) = true, want false")
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatal("errors.As(err, *APIError) = false, want true")
+	}
+	if apiErr.StatusCode != 429 {
+		t.Errorf("StatusCode = %d, want 429", apiErr.StatusCode)
+	}
+}
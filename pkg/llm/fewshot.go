@@ -0,0 +1,109 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// Few-shot modes: when example analyses are included in the prompt
+const (
+	// FewShotAuto includes them in the compact dialect, where small models
+	// need them to follow the response schema
+	FewShotAuto = "auto"
+	// FewShotAlways includes them in every dialect
+	FewShotAlways = "always"
+	// FewShotNever leaves them out
+	FewShotNever = "never"
+)
+
+// ValidateFewShot returns an error if mode isn't a known few-shot mode
+func ValidateFewShot(mode string) error {
+	switch mode {
+	case FewShotAuto, FewShotAlways, FewShotNever:
+		return nil
+	}
+	return fmt.Errorf("unknown few-shot mode: %s (available: %s, %s, %s)", mode, FewShotAuto, FewShotAlways, FewShotNever)
+}
+
+// v6Examples are the built-in example analyses of prompt v6: one problem and
+// one clean log, so small models see both ends of the schema
+var v6Examples = []config.FewShotExample{
+	{
+		Log: "2024-05-01T10:02:11Z INFO starting api on :8080\n" +
+			"2024-05-01T10:02:12Z ERROR dial tcp 10.0.0.5:5432: connect: connection refused\n" +
+			"2024-05-01T10:02:12Z FATAL cannot connect to database, exiting",
+		Response: `{"status":"problem_detected","severity":"critical","category":"dependency",` +
+			`"root_cause":"The API cannot reach PostgreSQL at 10.0.0.5:5432 and exits at startup.",` +
+			`"evidence":"2024-05-01T10:02:12Z ERROR dial tcp 10.0.0.5:5432: connect: connection refused",` +
+			`"fix":"pg_isready -h 10.0.0.5 -p 5432 && sudo systemctl start postgresql",` +
+			`"timeline":[{"time":"2024-05-01T10:02:11Z","event":"API starts"},{"time":"2024-05-01T10:02:12Z","event":"Database connection refused, API exits"}],` +
+			`"diagnostics":[],"missing":[]}`,
+	},
+	{
+		Log: "[12:00:01] GET /health 200 2ms\n[12:00:31] GET /health 200 3ms",
+		Response: `{"status":"no_problem","severity":"info","category":"","root_cause":"","evidence":"","fix":"",` +
+			`"timeline":[],"diagnostics":[],"missing":[]}`,
+	},
+}
+
+// fewShotFile is one example of a few_shot_file
+type fewShotFile struct {
+	Log      string          `json:"log"`
+	Response json.RawMessage `json:"response"`
+}
+
+// LoadExamples reads example analyses from a JSON file holding an array of
+// {"log": "...", "response": {...}} objects, the response being the JSON the
+// model should answer that log with
+func LoadExamples(path string) ([]config.FewShotExample, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read few-shot file: %w", err)
+	}
+	var entries []fewShotFile
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid few-shot file %s: %w", path, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("few-shot file %s has no examples", path)
+	}
+
+	examples := make([]config.FewShotExample, 0, len(entries))
+	for i, entry := range entries {
+		if entry.Log == "" || len(entry.Response) == 0 {
+			return nil, fmt.Errorf("few-shot file %s: example %d needs a log and a response", path, i+1)
+		}
+		// Examples are shown compacted, the way the model should answer
+		var response bytes.Buffer
+		if err := json.Compact(&response, entry.Response); err != nil {
+			return nil, fmt.Errorf("few-shot file %s: example %d: %w", path, i+1, err)
+		}
+		examples = append(examples, config.FewShotExample{Log: entry.Log, Response: response.String()})
+	}
+	return examples, nil
+}
+
+// fewShotExamples returns the examples to include in a prompt in dialect for
+// cfg, or nil. Examples from a file replace the template's.
+func fewShotExamples(cfg *config.Config, tmpl PromptTemplate, dialect string) []config.FewShotExample {
+	if cfg.NoSchema {
+		return nil
+	}
+	switch cfg.FewShot {
+	case FewShotNever:
+		return nil
+	case FewShotAlways:
+	default:
+		if dialect != DialectCompact {
+			return nil
+		}
+	}
+	if cfg.FewShotExamples != nil {
+		return cfg.FewShotExamples
+	}
+	return tmpl.Examples
+}
@@ -0,0 +1,74 @@
+package llm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+func TestBuildPrompts_FewShot(t *testing.T) {
+	payload := config.QueryPayload{SanitizedLog: "ERROR boom"}
+	builtIn := v6Examples[0].Response
+	custom := []config.FewShotExample{{Log: "OOMKilled", Response: `{"status":"problem_detected"}`}}
+
+	tests := []struct {
+		name string
+		cfg  config.Config
+		want string // Example response expected in the prompt, or "" for none
+	}{
+		{"compact includes them", config.Config{Provider: "openai", PromptDialect: DialectCompact}, builtIn},
+		{"plain leaves them out", config.Config{Provider: "openai", PromptDialect: DialectPlain}, ""},
+		{"always includes them", config.Config{Provider: "claude", FewShot: FewShotAlways}, builtIn},
+		{"never leaves them out", config.Config{Provider: "openai", PromptDialect: DialectCompact, FewShot: FewShotNever}, ""},
+		{"no schema leaves them out", config.Config{Provider: "openai", PromptDialect: DialectCompact, NoSchema: true}, ""},
+		{"older versions have none", config.Config{Provider: "openai", PromptDialect: DialectCompact, PromptVersion: "v5"}, ""},
+		{"a file replaces them", config.Config{Provider: "openai", PromptDialect: DialectCompact, FewShotExamples: custom}, custom[0].Response},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, user := BuildPrompts(&tt.cfg, payload)
+			if tt.want == "" {
+				if strings.Contains(user, "Example") || strings.Contains(user, "<examples>") {
+					t.Errorf("Prompt should have no examples, got:\n%s", user)
+				}
+				return
+			}
+			if !strings.Contains(user, tt.want) {
+				t.Errorf("Prompt should contain example response %s, got:\n%s", tt.want, user)
+			}
+			if strings.Index(user, tt.want) > strings.Index(user, "ERROR boom") {
+				t.Error("Examples should come before the log")
+			}
+		})
+	}
+}
+
+func TestLoadExamples(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "examples.json")
+	content := `[{"log": "panic: nil map", "response": {"status": "problem_detected",
+		"category": "code-bug"}}]`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	examples, err := LoadExamples(path)
+	if err != nil {
+		t.Fatalf("LoadExamples() error = %v", err)
+	}
+	want := config.FewShotExample{Log: "panic: nil map", Response: `{"status":"problem_detected","category":"code-bug"}`}
+	if len(examples) != 1 || examples[0] != want {
+		t.Errorf("LoadExamples() = %+v, want [%+v]", examples, want)
+	}
+
+	for _, invalid := range []string{`[]`, `[{"log": "x"}]`, `{"log": "x"}`} {
+		if err := os.WriteFile(path, []byte(invalid), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadExamples(path); err == nil {
+			t.Errorf("LoadExamples(%s) should fail", invalid)
+		}
+	}
+}
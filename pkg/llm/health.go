@@ -0,0 +1,41 @@
+package llm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// HealthCheckTimeout bounds how long StartHealthCheck waits for the provider
+const HealthCheckTimeout = 10 * time.Second
+
+// HealthChecker is implemented by clients that can verify their credentials
+// and model without running a (billed) completion
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// StartHealthCheck pings client's provider in the background, so a bad key,
+// unknown model or unreachable endpoint is found while input is still being
+// read. The returned function waits for the result; clients that don't
+// implement HealthChecker always pass.
+func StartHealthCheck(client Client) func() error {
+	checker, ok := client.(HealthChecker)
+	if !ok {
+		return func() error { return nil }
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), HealthCheckTimeout)
+		defer cancel()
+		result <- checker.HealthCheck(ctx)
+	}()
+
+	var once sync.Once
+	var err error
+	return func() error {
+		once.Do(func() { err = <-result })
+		return err
+	}
+}
@@ -0,0 +1,57 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// checkOnlyClient is a Client whose health check result is fixed
+type checkOnlyClient struct {
+	err error
+}
+
+func (c *checkOnlyClient) QueryWithPayload(ctx context.Context, cfg *config.Config, payload config.QueryPayload) (string, error) {
+	return "", nil
+}
+
+func (c *checkOnlyClient) QueryWithHistory(ctx context.Context, cfg *config.Config, history []string, question string) (string, error) {
+	return "", nil
+}
+
+func (c *checkOnlyClient) HealthCheck(ctx context.Context) error {
+	return c.err
+}
+
+// plainClient is a Client without a health check
+type plainClient struct{}
+
+func (c plainClient) QueryWithPayload(ctx context.Context, cfg *config.Config, payload config.QueryPayload) (string, error) {
+	return "", nil
+}
+
+func (c plainClient) QueryWithHistory(ctx context.Context, cfg *config.Config, history []string, question string) (string, error) {
+	return "", nil
+}
+
+func TestStartHealthCheck(t *testing.T) {
+	failure := newAPIError("anthropic", 401, "authentication_error", "invalid x-api-key")
+
+	wait := StartHealthCheck(&checkOnlyClient{err: failure})
+	if err := wait(); !errors.Is(err, ErrAuth) {
+		t.Errorf("wait() = %v, want ErrAuth", err)
+	}
+	// Waiting again returns the same result instead of blocking
+	if err := wait(); !errors.Is(err, ErrAuth) {
+		t.Errorf("second wait() = %v, want ErrAuth", err)
+	}
+
+	if err := StartHealthCheck(&checkOnlyClient{})(); err != nil {
+		t.Errorf("wait() = %v, want nil for a healthy provider", err)
+	}
+	if err := StartHealthCheck(plainClient{})(); err != nil {
+		t.Errorf("wait() = %v, want nil for a client without a health check", err)
+	}
+}
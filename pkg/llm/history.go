@@ -0,0 +1,41 @@
+package llm
+
+import (
+	"strings"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// LogMessageHeader starts the user message of a conversation that holds the
+// log of an analysis, so the log of the current run can be told apart from
+// follow-up questions and from the logs of earlier runs of a session
+const LogMessageHeader = "Please analyze the following log data:"
+
+// LatestLogMessage returns the index in conversationHistory of the user
+// message holding the most recent log, or -1 if there is none
+func LatestLogMessage(conversationHistory []string) int {
+	for i := len(conversationHistory) - 1; i >= 0; i-- {
+		if i%2 == 0 && strings.HasPrefix(conversationHistory[i], LogMessageHeader) {
+			return i
+		}
+	}
+	return -1
+}
+
+// FitHistory drops the oldest exchanges of conversationHistory until it fits
+// the log budget of cfg's model. The latest log message and what follows it
+// are always kept, so a follow-up never loses the log it is about.
+func FitHistory(cfg *config.Config, conversationHistory []string) []string {
+	model := ResolveModel(cfg.Provider, cfg.Model)
+	budget := LogBudget(cfg, config.QueryPayload{})
+	total := 0
+	for _, msg := range conversationHistory {
+		total += CountTokens(model, msg)
+	}
+
+	start := 0
+	for latest := LatestLogMessage(conversationHistory); start+2 <= latest && total > budget; start += 2 {
+		total -= CountTokens(model, conversationHistory[start]) + CountTokens(model, conversationHistory[start+1])
+	}
+	return conversationHistory[start:]
+}
@@ -0,0 +1,46 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+func TestFitHistory(t *testing.T) {
+	t.Cleanup(func() { delete(contextWindows, "tiny-test") })
+	SetContextWindows(map[string]int{"tiny-test": 8192})
+	cfg := &config.Config{Provider: "openai", Model: "tiny-test"}
+
+	// Logs of earlier runs taking 60% of the budget each: only one fits
+	line := "ERROR disk full on /var\n"
+	oldLog := LogMessageHeader + "\n" + strings.Repeat(line, LogBudget(cfg, config.QueryPayload{})*6/10/CountTokens("tiny-test", line))
+	history := []string{
+		oldLog, "The disk is full",
+		"what fills it?", "The logs",
+		oldLog, "Still full",
+		LogMessageHeader + "\nERROR disk full on /data", "Another disk",
+		"which one?", "/data",
+	}
+	if got := LatestLogMessage(history); got != 6 {
+		t.Errorf("LatestLogMessage() = %d, want 6", got)
+	}
+	if got := LatestLogMessage([]string{"hello", "hi"}); got != -1 {
+		t.Errorf("LatestLogMessage() without a log = %d, want -1", got)
+	}
+
+	// The oldest exchanges go first, until the rest fits
+	if fitted := FitHistory(cfg, history); len(fitted) != len(history)-2 || fitted[0] != history[2] {
+		t.Errorf("FitHistory() kept %d messages, want all but the first run", len(fitted))
+	}
+
+	// The latest log and what follows are kept even if they don't fit
+	history[6] = oldLog + oldLog
+	if fitted := FitHistory(cfg, history); len(fitted) != 4 || fitted[0] != history[6] {
+		t.Errorf("FitHistory() kept %d messages, want the latest log and what follows", len(fitted))
+	}
+
+	if fitted := FitHistory(&config.Config{Provider: "claude"}, history); len(fitted) != len(history) {
+		t.Errorf("FitHistory() dropped %d messages that fit the context window", len(history)-len(fitted))
+	}
+}
@@ -1,6 +1,7 @@
 package llm
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/jenian/que/internal/config"
@@ -10,23 +11,23 @@ import (
 type Client interface {
 	// QueryWithPayload queries the LLM with a structured payload for initial analysis
 	// Returns a JSON response with root_cause, evidence, and fix fields
-	QueryWithPayload(cfg *config.Config, payload config.QueryPayload) (string, error)
+	// Canceling ctx aborts the request in flight
+	QueryWithPayload(ctx context.Context, cfg *config.Config, payload config.QueryPayload) (string, error)
 
 	// QueryWithHistory queries the LLM with conversation history for interactive mode
 	// conversationHistory is a flat array: [user1, assistant1, user2, assistant2, ...]
 	// Returns a plain text response (not JSON)
-	QueryWithHistory(cfg *config.Config, conversationHistory []string, userQuestion string) (string, error)
+	QueryWithHistory(ctx context.Context, cfg *config.Config, conversationHistory []string, userQuestion string) (string, error)
 }
 
-// NewClient creates a new LLM client based on the provider specified in config
+// NewClient creates a new LLM client based on the provider specified in
+// config. A provider that isn't compiled in is looked for as a plugin
+// executable named que-provider-NAME on PATH.
 func NewClient(cfg *config.Config) (Client, error) {
-	switch cfg.Provider {
-	case "openai":
-		return NewOpenAIClientFromConfig(cfg)
-	case "claude":
-		return NewAnthropicClientFromConfig(cfg)
-	default:
+	p, ok := LookupProvider(cfg.Provider)
+	if !ok {
 		return nil, fmt.Errorf("unsupported provider: %s", cfg.Provider)
 	}
+	return p.New(cfg)
 }
 
@@ -0,0 +1,151 @@
+package llm
+
+import "strings"
+
+const (
+	// DefaultOpenAIModel is used when no model override is given for the openai provider
+	DefaultOpenAIModel = "gpt-4o"
+	// DefaultAnthropicModel is used when no model override is given for the claude provider
+	DefaultAnthropicModel = "claude-3-5-sonnet-20241022"
+	// DefaultOpenAITriageModel is the cheap first-pass model for --smart-routing with openai
+	DefaultOpenAITriageModel = "gpt-4o-mini"
+	// DefaultAnthropicTriageModel is the cheap first-pass model for --smart-routing with claude
+	DefaultAnthropicTriageModel = "claude-3-5-haiku-20241022"
+
+	// defaultContextWindow is assumed for models missing from contextWindows
+	defaultContextWindow = 8192
+	// reservedOutputTokens is kept free for the model's answer
+	reservedOutputTokens = 4096
+	// reservedPromptTokens covers instructions and system context around the log
+	reservedPromptTokens = 1024
+	// bytesPerToken is the common four-characters-per-token heuristic shared
+	// by OpenAI and Anthropic tokenizers
+	bytesPerToken = 4
+)
+
+// contextWindows maps model name prefixes to their context window size in tokens.
+// Longer prefixes are matched first so "gpt-4o" wins over "gpt-4".
+var contextWindows = map[string]int{
+	"gpt-4o":        128000,
+	"gpt-4-turbo":   128000,
+	"gpt-4.1":       1047576,
+	"gpt-4-32k":     32768,
+	"gpt-4":         8192,
+	"gpt-3.5-turbo": 16385,
+	"o1":            200000,
+	"o3":            200000,
+	"o4-mini":       200000,
+	"claude-":       200000,
+}
+
+// modelPricing maps model name prefixes to USD prices per million input and output tokens
+var modelPricing = map[string][2]float64{
+	"gpt-4o-mini":       {0.15, 0.60},
+	"gpt-4o":            {2.50, 10.00},
+	"gpt-4-turbo":       {10.00, 30.00},
+	"gpt-4":             {30.00, 60.00},
+	"gpt-3.5-turbo":     {0.50, 1.50},
+	"claude-3-5-sonnet": {3.00, 15.00},
+	"claude-3-5-haiku":  {0.80, 4.00},
+	"claude-3-opus":     {15.00, 75.00},
+	"claude-3-haiku":    {0.25, 1.25},
+}
+
+// SetContextWindows adds model name prefixes and their context window sizes
+// in tokens to the built-in table, replacing built-in entries for the same
+// prefix. It is meant to be called once at startup with the config file's
+// context_windows.
+func SetContextWindows(windows map[string]int) {
+	for prefix, tokens := range windows {
+		contextWindows[prefix] = tokens
+	}
+}
+
+// ResolveModel returns the model that will be used for provider when model is empty
+func ResolveModel(provider, model string) string {
+	if model != "" {
+		return model
+	}
+	// The built-in defaults hold even in builds that leave the provider out
+	switch provider {
+	case "openai":
+		return DefaultOpenAIModel
+	case "claude":
+		return DefaultAnthropicModel
+	}
+	if p, ok := providers[provider]; ok {
+		return p.DefaultModel
+	}
+	return ""
+}
+
+// ResolveTriageModel returns the first-pass model for smart routing with
+// provider when model is empty
+func ResolveTriageModel(provider, model string) string {
+	if model != "" {
+		return model
+	}
+	switch provider {
+	case "openai":
+		return DefaultOpenAITriageModel
+	case "claude":
+		return DefaultAnthropicTriageModel
+	}
+	if p, ok := providers[provider]; ok {
+		return p.TriageModel
+	}
+	return ""
+}
+
+// ContextWindow returns the context window size in tokens for the given model
+func ContextWindow(model string) int {
+	best := longestPrefix(model, contextWindows)
+	if best == "" {
+		return defaultContextWindow
+	}
+	return contextWindows[best]
+}
+
+// EstimateCost returns the estimated USD cost of a request to model.
+// The second return value is false if the model's pricing is unknown.
+func EstimateCost(model string, inputTokens, outputTokens int) (float64, bool) {
+	best := longestPrefix(model, modelPricing)
+	if best == "" {
+		return 0, false
+	}
+	price := modelPricing[best]
+	return (float64(inputTokens)*price[0] + float64(outputTokens)*price[1]) / 1_000_000, true
+}
+
+// longestPrefix returns the longest key in table that is a prefix of model, or ""
+func longestPrefix[V any](model string, table map[string]V) string {
+	best := ""
+	for prefix := range table {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	return best
+}
+
+// LogTokenBudget returns how many tokens of log data fit in a single prompt for model
+func LogTokenBudget(model string) int {
+	budget := ContextWindow(model) - reservedOutputTokens - reservedPromptTokens
+	if budget < reservedPromptTokens {
+		return reservedPromptTokens
+	}
+	return budget
+}
+
+// LogByteBudget returns how many bytes of log data to read for model: as much
+// as its log token budget could hold, so that counting tokens (CountTokens)
+// rather than a byte limit decides how much of the log is analyzed
+func LogByteBudget(model string) int {
+	return LogTokenBudget(model) * maxBytesPerToken
+}
+
+// EstimateTokens approximates the token count of s using the common
+// four-characters-per-token heuristic shared by OpenAI and Anthropic tokenizers
+func EstimateTokens(s string) int {
+	return (len(s) + bytesPerToken - 1) / bytesPerToken
+}
@@ -0,0 +1,55 @@
+package llm
+
+import "testing"
+
+func TestContextWindow(t *testing.T) {
+	testCases := []struct {
+		model string
+		want  int
+	}{
+		{"gpt-4o", 128000},
+		{"gpt-4o-2024-08-06", 128000},
+		{"gpt-4", 8192},
+		{"claude-3-5-sonnet-20241022", 200000},
+		{"some-local-model", defaultContextWindow},
+	}
+
+	for _, tc := range testCases {
+		if got := ContextWindow(tc.model); got != tc.want {
+			t.Errorf("ContextWindow(%q) = %d, want %d", tc.model, got, tc.want)
+		}
+	}
+}
+
+func TestSetContextWindows(t *testing.T) {
+	saved := contextWindows["gpt-4"]
+	t.Cleanup(func() {
+		delete(contextWindows, "llama3")
+		contextWindows["gpt-4"] = saved
+	})
+
+	SetContextWindows(map[string]int{"llama3": 32768, "gpt-4": 16384})
+	if got := ContextWindow("llama3:70b"); got != 32768 {
+		t.Errorf("ContextWindow(llama3:70b) = %d, want 32768", got)
+	}
+	if got := ContextWindow("gpt-4"); got != 16384 {
+		t.Errorf("ContextWindow(gpt-4) = %d, want the override 16384", got)
+	}
+	if got := LogByteBudget("llama3"); got != LogTokenBudget("llama3")*maxBytesPerToken {
+		t.Errorf("LogByteBudget(llama3) = %d", got)
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	cost, ok := EstimateCost("gpt-4o-mini", 1_000_000, 0)
+	if !ok {
+		t.Fatal("EstimateCost() should know gpt-4o-mini pricing")
+	}
+	if cost != 0.15 {
+		t.Errorf("EstimateCost() = %v, want 0.15 (gpt-4o-mini must not match gpt-4o)", cost)
+	}
+
+	if _, ok := EstimateCost("some-local-model", 1000, 1000); ok {
+		t.Error("EstimateCost() should report unknown pricing for unknown models")
+	}
+}
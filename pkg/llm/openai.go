@@ -1,103 +1,264 @@
+//go:build !noopenai && !minimal
+
 package llm
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
 
 	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/httpclient"
+	"github.com/jenian/que/internal/logging"
 	"github.com/sashabaranov/go-openai"
 )
 
+func init() {
+	Register(Provider{
+		Name:         "openai",
+		DisplayName:  "OpenAI",
+		DefaultModel: DefaultOpenAIModel,
+		TriageModel:  DefaultOpenAITriageModel,
+		Dialect:      DialectJSON,
+		EnvVars:      []string{"QUE_CHATGPT_API_KEY"},
+		New:          NewOpenAIClientFromConfig,
+	})
+}
+
 // OpenAIClient handles interactions with OpenAI API
 type OpenAIClient struct {
-	client *openai.Client
-	model  string
+	client  *openai.Client
+	http    *http.Client // The client's HTTP client, whose timeout the config sets
+	model   string
+	options requestOptions
 }
 
 // NewOpenAIClient creates a new OpenAI client
 func NewOpenAIClient(apiKey string, modelOverride string) (*OpenAIClient, error) {
+	return NewOpenAIClientWithBaseURL(apiKey, "", modelOverride)
+}
+
+// NewOpenAIClientWithBaseURL creates an OpenAI client for the OpenAI-compatible
+// API at baseURL (e.g. a vLLM server or LiteLLM gateway), or for api.openai.com
+// if baseURL is empty
+func NewOpenAIClientWithBaseURL(apiKey string, baseURL string, modelOverride string) (*OpenAIClient, error) {
 	if apiKey == "" {
 		return nil, fmt.Errorf("OpenAI API key is required")
 	}
 
-	client := openai.NewClient(apiKey)
+	clientConfig := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		parsed, err := url.Parse(baseURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid OpenAI base URL %q: want http(s)://host[:port]/path", baseURL)
+		}
+		clientConfig.BaseURL = strings.TrimRight(baseURL, "/")
+	}
+	httpClient := newRequestIDClient("OpenAI", httpclient.New(config.DefaultTimeout))
+	clientConfig.HTTPClient = httpClient
+	client := openai.NewClientWithConfig(clientConfig)
 	
-	model := "gpt-4o"
+	model := DefaultOpenAIModel
 	if modelOverride != "" {
 		model = modelOverride
 	}
 
 	return &OpenAIClient{
 		client: client,
+		http:   httpClient,
 		model:  model,
 	}, nil
 }
 
 // Query sends a query to OpenAI and returns the response
 func (c *OpenAIClient) Query(ctx context.Context, systemPrompt string, userPrompt string) (string, error) {
-	resp, err := c.client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model: c.model,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleSystem,
-					Content: systemPrompt,
-				},
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: userPrompt,
-				},
+	response, _, err := c.query(ctx, systemPrompt, userPrompt, nil)
+	return response, err
+}
+
+// query sends a query to OpenAI and returns the response and its usage. With
+// a schema the response is structured output following it; models and
+// endpoints that reject json_schema are asked for JSON mode instead.
+func (c *OpenAIClient) query(ctx context.Context, systemPrompt string, userPrompt string, schema json.RawMessage) (string, *config.Usage, error) {
+	request := openai.ChatCompletionRequest{
+		Model: c.model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: systemPrompt,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: userPrompt,
 			},
 		},
-	)
+	}
+	c.applyOptions(&request)
+	if schema != nil {
+		request.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:        responseSchemaName,
+				Description: responseSchemaDescription,
+				Schema:      schema,
+				Strict:      true,
+			},
+		}
+	}
+	call := withRequestID(ctx)
+	resp, err := c.client.CreateChatCompletion(call, request)
+	if schema != nil && unsupportedResponseFormat(err) {
+		logging.Debug().Err(err).Str("model", c.model).Msg("Structured output not supported, falling back to JSON mode")
+		request.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+		call = withRequestID(ctx)
+		resp, err = c.client.CreateChatCompletion(call, request)
+	}
+	response, usage, err := c.response(resp, err)
+	return response, usage, tagRequestIDs(call, err)
+}
+
+// applyOptions sets the configured token limit and temperature on request
+func (c *OpenAIClient) applyOptions(request *openai.ChatCompletionRequest) {
+	if c.options.maxTokens > 0 {
+		// Reasoning models reject max_tokens, which other OpenAI-compatible servers still expect
+		if isReasoningModel(c.model) {
+			request.MaxCompletionTokens = c.options.maxTokens
+		} else {
+			request.MaxTokens = c.options.maxTokens
+		}
+	}
+	if c.options.temperature != nil {
+		request.Temperature = float32(*c.options.temperature)
+		// The SDK omits a zero temperature, which would leave the provider's default
+		if request.Temperature == 0 {
+			request.Temperature = math.SmallestNonzeroFloat32
+		}
+	}
+}
+
+// isReasoningModel reports whether model is one of OpenAI's o-series models
+func isReasoningModel(model string) bool {
+	return strings.HasPrefix(model, "o1") || strings.HasPrefix(model, "o3") || strings.HasPrefix(model, "o4")
+}
+
+// configure applies cfg's request timeout and generation settings
+func (c *OpenAIClient) configure(cfg *config.Config) {
+	c.http.Timeout = cfg.Timeout
+	c.options = newRequestOptions(cfg)
+}
+
+// unsupportedResponseFormat reports whether err is the 400 an older model,
+// Azure API version or OpenAI-compatible server returns for json_schema
+func unsupportedResponseFormat(err error) bool {
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatusCode != http.StatusBadRequest {
+		return false
+	}
+	message := strings.ToLower(apiErr.Message)
+	return strings.Contains(message, "response_format") || strings.Contains(message, "json_schema")
+}
 
+// response returns the answer and usage of a chat completion
+func (c *OpenAIClient) response(resp openai.ChatCompletionResponse, err error) (string, *config.Usage, error) {
 	if err != nil {
-		return "", fmt.Errorf("OpenAI API error: %w", err)
+		return "", nil, wrapOpenAIError(err)
 	}
 
+	usage := NewUsage(c.model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+
 	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no response from OpenAI")
+		return "", usage, fmt.Errorf("no response from OpenAI")
+	}
+
+	choice := resp.Choices[0]
+	if choice.FinishReason == openai.FinishReasonContentFilter {
+		apiErr := newAPIError("OpenAI", 0, "content_filter", "the response was blocked by the content filter")
+		apiErr.Categories = filteredCategories(choice.ContentFilterResults)
+		return "", usage, apiErr
+	}
+	if choice.Message.Refusal != "" {
+		return "", usage, newAPIError("OpenAI", 0, "refusal", choice.Message.Refusal)
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	return choice.Message.Content, usage, nil
+}
+
+// filteredCategories returns the categories of Azure content filter results
+// that were filtered
+func filteredCategories(results openai.ContentFilterResults) []string {
+	var categories []string
+	for _, category := range []struct {
+		name     string
+		filtered bool
+	}{
+		{"hate", results.Hate.Filtered},
+		{"self_harm", results.SelfHarm.Filtered},
+		{"sexual", results.Sexual.Filtered},
+		{"violence", results.Violence.Filtered},
+		{"jailbreak", results.JailBreak.Filtered},
+		{"profanity", results.Profanity.Filtered},
+	} {
+		if category.filtered {
+			categories = append(categories, category.name)
+		}
+	}
+	return categories
 }
 
 // QueryWithPayload implements the Client interface
-func (c *OpenAIClient) QueryWithPayload(cfg *config.Config, payload config.QueryPayload) (string, error) {
-	// Format system prompt
-	systemPrompt := "You are a CLI debugging assistant. You must respond with valid JSON only. The response must contain exactly four fields: status, root_cause, evidence, and fix. Do not include markdown, code blocks, or any text outside the JSON."
-	
-	// Format user prompt with context
-	userPrompt := formatPrompt(payload)
+func (c *OpenAIClient) QueryWithPayload(ctx context.Context, cfg *config.Config, payload config.QueryPayload) (string, error) {
+	response, _, err := c.QueryWithPayloadUsage(ctx, cfg, payload)
+	return response, err
+}
+
+// QueryWithPayloadUsage implements the UsageReporter interface
+func (c *OpenAIClient) QueryWithPayloadUsage(ctx context.Context, cfg *config.Config, payload config.QueryPayload) (string, *config.Usage, error) {
+	// Format system and user prompts from the pinned prompt version
+	systemPrompt, userPrompt := BuildPrompts(cfg, payload)
 
 	// Show full prompt in verbose mode
 	if cfg.Verbose {
-		fmt.Fprintf(os.Stderr, "\n=== LLM Prompt ===\n")
+		fmt.Fprintf(os.Stderr, "\n=== LLM Prompt (%s) ===\n", cfg.PromptVersion)
 		fmt.Fprintf(os.Stderr, "System Prompt:\n%s\n\n", systemPrompt)
 		fmt.Fprintf(os.Stderr, "User Prompt:\n%s\n\n", userPrompt)
 		fmt.Fprintf(os.Stderr, "=== End Prompt ===\n\n")
 	}
 
-	ctx := context.Background()
-	response, err := c.Query(ctx, systemPrompt, userPrompt)
+	// Structured output guarantees an answer following the schema, but small
+	// and local models prompted in other dialects often don't support it
+	var schema json.RawMessage
+	if PromptDialect(cfg) == DialectJSON {
+		schema = ResponseSchema(cfg, payload)
+	}
+	response, usage, err := c.query(ctx, systemPrompt, userPrompt, schema)
 	
 	// Show raw response in verbose mode
 	if cfg.Verbose && err == nil {
 		fmt.Fprintf(os.Stderr, "=== LLM Raw Response ===\n%s\n=== End Response ===\n\n", response)
 	}
 
-	return response, err
+	return response, usage, err
 }
 
 // QueryWithHistory implements the Client interface
-func (c *OpenAIClient) QueryWithHistory(cfg *config.Config, conversationHistory []string, userQuestion string) (string, error) {
+func (c *OpenAIClient) QueryWithHistory(ctx context.Context, cfg *config.Config, conversationHistory []string, userQuestion string) (string, error) {
+	response, _, err := c.QueryWithHistoryUsage(ctx, cfg, conversationHistory, userQuestion)
+	return response, err
+}
+
+// QueryWithHistoryUsage implements the UsageReporter interface
+func (c *OpenAIClient) QueryWithHistoryUsage(ctx context.Context, cfg *config.Config, conversationHistory []string, userQuestion string) (string, *config.Usage, error) {
 	// Build conversation messages
 	messages := []openai.ChatCompletionMessage{
 		{
 			Role:    openai.ChatMessageRoleSystem,
-			Content: "You are a CLI debugging assistant. Provide concise, helpful answers. Keep responses brief since we're in a terminal.",
+			Content: promptTemplateFor(cfg.PromptVersion).FollowUpSystem,
 		},
 	}
 
@@ -124,28 +285,56 @@ func (c *OpenAIClient) QueryWithHistory(cfg *config.Config, conversationHistory
 		Content: userQuestion,
 	})
 
-	ctx := context.Background()
-	resp, err := c.client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model:    c.model,
-			Messages: messages,
-		},
-	)
+	request := openai.ChatCompletionRequest{
+		Model:    c.model,
+		Messages: messages,
+	}
+	c.applyOptions(&request)
+	call := withRequestID(ctx)
+	resp, err := c.client.CreateChatCompletion(call, request)
+	response, usage, err := c.response(resp, err)
+	return response, usage, tagRequestIDs(call, err)
+}
 
-	if err != nil {
-		return "", fmt.Errorf("OpenAI API error: %w", err)
+// HealthCheck implements HealthChecker by looking up the model
+func (c *OpenAIClient) HealthCheck(ctx context.Context) error {
+	if _, err := c.client.GetModel(ctx, c.model); err != nil {
+		return wrapOpenAIError(err)
 	}
+	return nil
+}
 
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no response from OpenAI")
+// wrapOpenAIError converts SDK errors into APIError so callers can classify them
+func wrapOpenAIError(err error) error {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		errType := apiErr.Type
+		if code, ok := apiErr.Code.(string); ok && code != "" {
+			errType = code
+		}
+		wrapped := newAPIError("OpenAI", apiErr.HTTPStatusCode, errType, apiErr.Message)
+		// Azure says which categories of its content filter tripped
+		if apiErr.InnerError != nil {
+			wrapped.Categories = filteredCategories(apiErr.InnerError.ContentFilterResults)
+		}
+		return wrapped
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return newAPIError("OpenAI", reqErr.HTTPStatusCode, "", fmt.Sprint(reqErr.Err))
+	}
+
+	return fmt.Errorf("OpenAI API error: %w", err)
 }
 
 // NewOpenAIClientFromConfig creates a new OpenAI client from config
 func NewOpenAIClientFromConfig(cfg *config.Config) (Client, error) {
-	return NewOpenAIClient(cfg.ChatGPTKey, cfg.Model)
+	client, err := NewOpenAIClientWithBaseURL(cfg.ChatGPTKey, cfg.OpenAIBaseURL, cfg.Model)
+	if err != nil {
+		return nil, err
+	}
+	client.configure(cfg)
+	return client, nil
 }
 
@@ -0,0 +1,161 @@
+//go:build !noopenai && !minimal
+
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+func TestOpenAIClient_BaseURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("Authorization = %q, want Bearer test-key", r.Header.Get("Authorization"))
+		}
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("path = %q, want /v1/chat/completions", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "ok"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Provider: "openai", ChatGPTKey: "test-key", OpenAIBaseURL: server.URL + "/v1/", Model: "llama3-8b"}
+	client, err := NewOpenAIClientFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewOpenAIClientFromConfig() error = %v", err)
+	}
+	got, err := client.(*OpenAIClient).Query(context.Background(), "system", "user")
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if got != "ok" {
+		t.Errorf("Query() = %q, want ok", got)
+	}
+}
+
+func TestNewOpenAIClientWithBaseURL_Invalid(t *testing.T) {
+	for _, baseURL := range []string{"localhost:8000/v1", "ftp://gateway/v1", "http://"} {
+		if _, err := NewOpenAIClientWithBaseURL("key", baseURL, ""); err == nil {
+			t.Errorf("NewOpenAIClientWithBaseURL(%q) should fail", baseURL)
+		}
+	}
+}
+
+func TestOpenAIClient_Usage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "ok"}, "finish_reason": "stop"}], "usage": {"prompt_tokens": 1000, "completion_tokens": 200, "total_tokens": 1200}}`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Provider: "openai", ChatGPTKey: "test-key", OpenAIBaseURL: server.URL + "/v1/", Model: "llama3-8b"}
+	client, err := NewOpenAIClientFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewOpenAIClientFromConfig() error = %v", err)
+	}
+	_, usage, err := QueryWithHistory(context.Background(), client, cfg, nil, "why?")
+	if err != nil {
+		t.Fatalf("QueryWithHistory() error = %v", err)
+	}
+	if usage == nil || usage.PromptTokens != 1000 || usage.CompletionTokens != 200 {
+		t.Fatalf("usage = %+v, want 1000 prompt and 200 completion tokens", usage)
+	}
+	// A self-hosted model has no list price
+	if usage.CostUSD != nil {
+		t.Errorf("CostUSD = %v, want none for an unpriced model", *usage.CostUSD)
+	}
+}
+
+func TestOpenAIClient_ContentFilter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": {"message": "The response was filtered due to the prompt triggering Azure OpenAI's content management policy.", "type": null, "param": "prompt", "code": "content_filter", "status": 400,
+			"innererror": {"code": "ResponsibleAIPolicyViolation", "content_filter_result": {"hate": {"filtered": false, "severity": "safe"}, "violence": {"filtered": true, "severity": "medium"}}}}}`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Provider: "openai", ChatGPTKey: "test-key", OpenAIBaseURL: server.URL + "/v1/", Model: "gpt-4o"}
+	client, err := NewOpenAIClientFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewOpenAIClientFromConfig() error = %v", err)
+	}
+	_, err = client.(*OpenAIClient).Query(context.Background(), "system", "user")
+	if !errors.Is(err, ErrContentFiltered) {
+		t.Fatalf("Query() error = %v, want ErrContentFiltered", err)
+	}
+	if got := ContentFilterCategories(err); len(got) != 1 || got[0] != "violence" {
+		t.Errorf("ContentFilterCategories() = %v, want [violence]", got)
+	}
+}
+
+func TestOpenAIClient_StructuredOutputFallback(t *testing.T) {
+	var formats []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResponseFormat struct {
+				Type string `json:"type"`
+			} `json:"response_format"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		formats = append(formats, req.ResponseFormat.Type)
+		w.Header().Set("Content-Type", "application/json")
+		if req.ResponseFormat.Type == "json_schema" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": {"message": "Invalid parameter: 'response_format' of type 'json_schema' is not supported with this model.", "type": "invalid_request_error", "param": "response_format", "code": null}}`))
+			return
+		}
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "{\"status\": \"no_problem\"}"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Provider: "openai", ChatGPTKey: "test-key", OpenAIBaseURL: server.URL + "/v1/", Model: "gpt-4-turbo"}
+	client, err := NewOpenAIClientFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewOpenAIClientFromConfig() error = %v", err)
+	}
+	got, err := client.QueryWithPayload(context.Background(), cfg, config.QueryPayload{SanitizedLog: "INFO ok"})
+	if err != nil {
+		t.Fatalf("QueryWithPayload() error = %v", err)
+	}
+	if got != `{"status": "no_problem"}` {
+		t.Errorf("QueryWithPayload() = %q", got)
+	}
+	if len(formats) != 2 || formats[0] != "json_schema" || formats[1] != "json_object" {
+		t.Errorf("response formats = %v, want json_schema then json_object", formats)
+	}
+}
+
+func TestOpenAIClient_RequestSettings(t *testing.T) {
+	var req map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "ok"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	temperature := 0.0
+	cfg := &config.Config{Provider: "openai", ChatGPTKey: "test-key", OpenAIBaseURL: server.URL + "/v1/", Model: "llama3-8b", MaxTokens: 1024, Temperature: &temperature}
+	client, err := NewOpenAIClientFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewOpenAIClientFromConfig() error = %v", err)
+	}
+	if _, err := client.QueryWithHistory(context.Background(), cfg, nil, "why?"); err != nil {
+		t.Fatalf("QueryWithHistory() error = %v", err)
+	}
+	if req["max_tokens"] != 1024.0 {
+		t.Errorf("max_tokens = %v, want 1024", req["max_tokens"])
+	}
+	// A zero temperature must be sent rather than left out
+	if _, ok := req["temperature"]; !ok {
+		t.Error("temperature 0 wasn't sent")
+	}
+}
@@ -0,0 +1,29 @@
+package llm
+
+import "github.com/jenian/que/internal/config"
+
+const (
+	// defaultMaxTokens limits answers to the initial analysis unless configured otherwise
+	defaultMaxTokens = 4096
+	// defaultFollowUpMaxTokens keeps answers to follow-up questions short in a terminal
+	defaultFollowUpMaxTokens = 2048
+)
+
+// requestOptions are the generation settings a client sends with each request
+type requestOptions struct {
+	maxTokens   int      // Most tokens to answer with, 0 for the default
+	temperature *float64 // Sampling temperature, nil for the provider's default
+}
+
+// newRequestOptions returns the generation settings configured in cfg
+func newRequestOptions(cfg *config.Config) requestOptions {
+	return requestOptions{maxTokens: cfg.MaxTokens, temperature: cfg.Temperature}
+}
+
+// maxTokensOr returns the configured token limit, or fallback without one
+func (o requestOptions) maxTokensOr(fallback int) int {
+	if o.maxTokens > 0 {
+		return o.maxTokens
+	}
+	return fallback
+}
@@ -0,0 +1,242 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// PluginPrefix starts the name of a provider plugin's executable: the
+// provider "acme" is served by que-provider-acme on PATH
+const PluginPrefix = "que-provider-"
+
+// PluginProtocol is the version of the plugin protocol que speaks, sent with
+// every request
+const PluginProtocol = 1
+
+// maxPluginOutput caps what is read from a plugin's stdout
+const maxPluginOutput = 4 << 20
+
+// pluginName matches the provider names a plugin may be looked up by, so
+// --provider can't name a path
+var pluginName = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+
+// PluginRequest is what que writes to a plugin's stdin, one request per run.
+// For an "analyze" request, System and Prompt are the prompts of the
+// analysis and Schema, when set, is the JSON schema the answer must follow.
+// For a "chat" request, History holds the conversation so far (user and
+// assistant turns alternating) and Question the follow-up question.
+type PluginRequest struct {
+	Protocol    int             `json:"protocol"`
+	Type        string          `json:"type"` // "analyze" or "chat"
+	Model       string          `json:"model,omitempty"`
+	System      string          `json:"system"`
+	Prompt      string          `json:"prompt,omitempty"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+	History     []string        `json:"history,omitempty"`
+	Question    string          `json:"question,omitempty"`
+	MaxTokens   int             `json:"max_tokens"`
+	Temperature *float64        `json:"temperature,omitempty"`
+}
+
+// PluginResponse is what a plugin writes to its stdout: the answer, or an
+// error to show the user. Usage is optional.
+type PluginResponse struct {
+	Content string `json:"content"`
+	Error   string `json:"error,omitempty"`
+	Usage   *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage,omitempty"`
+}
+
+// lookupPlugin returns a provider for the plugin executable named after
+// name on PATH, if there is one
+func lookupPlugin(name string) (Provider, bool) {
+	if !pluginName.MatchString(name) {
+		return Provider{}, false
+	}
+	path, err := exec.LookPath(PluginPrefix + name)
+	if err != nil {
+		return Provider{}, false
+	}
+	return pluginProvider(name, path), true
+}
+
+// pluginProvider describes the plugin at path as the provider name
+func pluginProvider(name, path string) Provider {
+	return Provider{
+		Name:        name,
+		DisplayName: name,
+		Plugin:      path,
+		New: func(cfg *config.Config) (Client, error) {
+			return &PluginClient{path: path, model: cfg.Model, timeout: cfg.Timeout, options: newRequestOptions(cfg)}, nil
+		},
+	}
+}
+
+// Plugins returns the provider plugins on PATH, sorted by name. A plugin
+// named like a compiled-in provider is left out, as the provider wins.
+func Plugins() []Provider {
+	found := make(map[string]Provider)
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		matches, _ := filepath.Glob(filepath.Join(dir, PluginPrefix+"*"))
+		for _, path := range matches {
+			name := strings.TrimPrefix(filepath.Base(path), PluginPrefix)
+			if _, builtin := providers[name]; builtin {
+				continue
+			}
+			if _, seen := found[name]; seen {
+				continue
+			}
+			// Only the first match on PATH is run, as with LookPath
+			if p, ok := lookupPlugin(name); ok {
+				found[name] = p
+			}
+		}
+	}
+	list := make([]Provider, 0, len(found))
+	for _, p := range found {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// PluginClient queries an LLM backend through a plugin executable. Each
+// query runs the plugin once, writes a PluginRequest to its stdin and reads
+// a PluginResponse from its stdout; its stderr is passed through so it can
+// report progress and diagnostics.
+type PluginClient struct {
+	path    string
+	model   string // Empty to let the plugin pick its default
+	timeout time.Duration
+	options requestOptions
+}
+
+// QueryWithPayload implements the Client interface
+func (c *PluginClient) QueryWithPayload(ctx context.Context, cfg *config.Config, payload config.QueryPayload) (string, error) {
+	response, _, err := c.QueryWithPayloadUsage(ctx, cfg, payload)
+	return response, err
+}
+
+// QueryWithPayloadUsage implements the UsageReporter interface
+func (c *PluginClient) QueryWithPayloadUsage(ctx context.Context, cfg *config.Config, payload config.QueryPayload) (string, *config.Usage, error) {
+	systemPrompt, userPrompt := BuildPrompts(cfg, payload)
+	if cfg.Verbose {
+		fmt.Fprintf(os.Stderr, "\n=== LLM Prompt (%s) ===\n", cfg.PromptVersion)
+		fmt.Fprintf(os.Stderr, "System Prompt:\n%s\n\n", systemPrompt)
+		fmt.Fprintf(os.Stderr, "User Prompt:\n%s\n\n", userPrompt)
+		fmt.Fprintf(os.Stderr, "=== End Prompt ===\n\n")
+	}
+
+	response, usage, err := c.run(ctx, PluginRequest{
+		Type:      "analyze",
+		System:    systemPrompt,
+		Prompt:    userPrompt,
+		Schema:    ResponseSchema(cfg, payload),
+		MaxTokens: c.options.maxTokensOr(defaultMaxTokens),
+	})
+	if cfg.Verbose && err == nil {
+		fmt.Fprintf(os.Stderr, "=== LLM Raw Response ===\n%s\n=== End Response ===\n\n", response)
+	}
+	return response, usage, err
+}
+
+// QueryWithHistory implements the Client interface
+func (c *PluginClient) QueryWithHistory(ctx context.Context, cfg *config.Config, conversationHistory []string, userQuestion string) (string, error) {
+	response, _, err := c.QueryWithHistoryUsage(ctx, cfg, conversationHistory, userQuestion)
+	return response, err
+}
+
+// QueryWithHistoryUsage implements the UsageReporter interface
+func (c *PluginClient) QueryWithHistoryUsage(ctx context.Context, cfg *config.Config, conversationHistory []string, userQuestion string) (string, *config.Usage, error) {
+	return c.run(ctx, PluginRequest{
+		Type:      "chat",
+		System:    promptTemplateFor(cfg.PromptVersion).FollowUpSystem,
+		History:   conversationHistory,
+		Question:  userQuestion,
+		MaxTokens: c.options.maxTokensOr(defaultFollowUpMaxTokens),
+	})
+}
+
+// run runs the plugin with req and returns its answer and usage. The plugin
+// doesn't inherit que's own credentials; it reads its own from the
+// environment or its configuration.
+func (c *PluginClient) run(ctx context.Context, req PluginRequest) (string, *config.Usage, error) {
+	req.Protocol = PluginProtocol
+	req.Model = c.model
+	req.Temperature = c.options.temperature
+	input, err := json.Marshal(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode plugin request: %w", err)
+	}
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	var stdout bytes.Buffer
+	command := exec.CommandContext(ctx, c.path)
+	command.Env = config.CommandEnv(os.Environ())
+	command.Stdin = bytes.NewReader(input)
+	command.Stdout = &limitedWriter{w: &stdout, n: maxPluginOutput}
+	command.Stderr = os.Stderr
+	command.WaitDelay = time.Second
+	runErr := command.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", nil, fmt.Errorf("provider plugin %s timed out after %s", c.path, c.timeout)
+	}
+	if ctx.Err() != nil {
+		return "", nil, ctx.Err()
+	}
+
+	var resp PluginResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		if runErr != nil {
+			return "", nil, fmt.Errorf("provider plugin %s failed: %w", c.path, runErr)
+		}
+		return "", nil, fmt.Errorf("provider plugin %s answered with invalid JSON: %w", c.path, err)
+	}
+	if resp.Error != "" {
+		return "", nil, fmt.Errorf("provider plugin %s: %s", c.path, resp.Error)
+	}
+	if runErr != nil {
+		return "", nil, fmt.Errorf("provider plugin %s failed: %w", c.path, runErr)
+	}
+	if resp.Content == "" {
+		return "", nil, fmt.Errorf("provider plugin %s returned an empty answer", c.path)
+	}
+	var usage *config.Usage
+	if resp.Usage != nil {
+		usage = NewUsage(c.model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+	}
+	return resp.Content, usage, nil
+}
+
+// limitedWriter writes the first n bytes written to it to w and discards the
+// rest, so a runaway plugin can't exhaust memory
+type limitedWriter struct {
+	w *bytes.Buffer
+	n int
+}
+
+// Write implements io.Writer
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if room := l.n - l.w.Len(); room < len(p) {
+		l.w.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return l.w.Write(p)
+}
@@ -0,0 +1,111 @@
+package llm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// writePlugin installs a shell script as the provider plugin name in a
+// directory put on PATH
+func writePlugin(t *testing.T, name, script string) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, PluginPrefix+name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func TestPluginProvider(t *testing.T) {
+	dir := writePlugin(t, "echo", `read request
+case "$request" in
+  *'"type":"analyze"'*) printf '{"content": "{\\"root_cause\\": \\"disk full\\"}", "usage": {"prompt_tokens": 120, "completion_tokens": 8}}' ;;
+  *'"question":"why?"'*) printf '{"content": "because"}' ;;
+  *) printf '{"error": "unexpected request"}' ;;
+esac
+`)
+	t.Setenv("QUE_CLAUDE_API_KEY", "sk-secret")
+
+	if err := ValidateProvider("echo"); err != nil {
+		t.Fatalf("ValidateProvider() = %v, want the plugin found", err)
+	}
+	p, ok := LookupProvider("echo")
+	if !ok || p.Plugin != filepath.Join(dir, PluginPrefix+"echo") {
+		t.Fatalf("LookupProvider() = %+v, %v, want the plugin", p, ok)
+	}
+	if plugins := Plugins(); len(plugins) != 1 || plugins[0].Name != "echo" {
+		t.Errorf("Plugins() = %+v, want the echo plugin", plugins)
+	}
+
+	cfg := &config.Config{Provider: "echo"}
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	response, usage, err := QueryWithPayload(context.Background(), client, cfg, config.QueryPayload{SanitizedLog: "write failed"})
+	if err != nil {
+		t.Fatalf("QueryWithPayload() error = %v", err)
+	}
+	if response != `{"root_cause": "disk full"}` {
+		t.Errorf("QueryWithPayload() = %q", response)
+	}
+	if usage == nil || usage.PromptTokens != 120 || usage.CompletionTokens != 8 {
+		t.Errorf("usage = %+v, want the plugin's", usage)
+	}
+
+	answer, usage, err := QueryWithHistory(context.Background(), client, cfg, []string{"log", "analysis"}, "why?")
+	if err != nil || answer != "because" || usage != nil {
+		t.Errorf("QueryWithHistory() = %q, %+v, %v, want the answer without usage", answer, usage, err)
+	}
+}
+
+func TestPluginClient_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"reported", `printf '{"error": "quota exceeded"}'`, "quota exceeded"},
+		{"crashed", `echo boom >&2; exit 3`, "exit status 3"},
+		{"garbage", `echo not json`, "invalid JSON"},
+		{"empty", `printf '{"content": ""}'`, "empty answer"},
+		{"credentials", `env | grep -q sk-secret && printf '{"error": "saw the key"}' || printf '{"content": "ok"}'`, ""},
+	}
+	t.Setenv("QUE_OPENAI_API_KEY", "sk-secret")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writePlugin(t, tt.name, tt.script)
+			cfg := &config.Config{Provider: tt.name}
+			client, err := NewClient(cfg)
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			_, err = client.QueryWithHistory(context.Background(), cfg, nil, "hello")
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("QueryWithHistory() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("QueryWithHistory() error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupPlugin_RejectsPaths(t *testing.T) {
+	writePlugin(t, "ok", `printf '{"content": "hi"}'`)
+	for _, name := range []string{"../ok", "/tmp/ok", "", "Ok"} {
+		if _, ok := LookupProvider(name); ok {
+			t.Errorf("LookupProvider(%q) found a plugin", name)
+		}
+	}
+}
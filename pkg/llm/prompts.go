@@ -0,0 +1,216 @@
+package llm
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// CurrentPromptVersion is the prompt template used unless another version is pinned
+const CurrentPromptVersion = "v6"
+
+// PromptTemplate is a versioned set of prompts used to talk to the model.
+// Any change to the wording that can affect analysis quality must be added as a
+// new version rather than edited in place, so results can be traced back to the
+// prompt that produced them.
+type PromptTemplate struct {
+	Version string
+	// System is the system prompt for the initial analysis
+	System string
+	// Instructions are appended after the log data and describe the response schema
+	Instructions []string
+	// Fields are the response fields Instructions ask for, in order. They
+	// make up the schema enforced by providers with structured output.
+	Fields []string
+	// FollowUpSystem is the system prompt for interactive follow-up questions
+	FollowUpSystem string
+	// Investigate asks the model which read-only commands would help confirm
+	// its diagnosis (--investigate)
+	Investigate string
+	// Compare asks the model to compare the log with a previous analysis
+	// (--previous) in an extra response field
+	Compare string
+	// Compact replaces Instructions in the compact dialect for small and
+	// local models. Versions without it use Instructions in every dialect.
+	Compact []string
+	// Examples are example analyses shown before the log, in the compact
+	// dialect by default, to help small models follow the schema
+	Examples []config.FewShotExample
+}
+
+// investigatePrompt is shared by all versions, since it was introduced after them
+const investigatePrompt = `Before giving a final diagnosis, decide whether running read-only commands on the affected host would make it more certain.
+Respond with JSON only, in this form:
+{"done": false, "commands": [{"command": "kubectl describe pod web-1", "reason": "check recent events"}]}
+Rules:
+- Only propose commands that read state (describe, status, get, cat, ls, logs). Never propose commands that modify anything.
+- Commands run without a shell: no pipes, redirects, globs or environment variables.
+- Propose at most 3 commands per round.
+- If you are already confident, or no command would help, respond with {"done": true, "commands": []}.`
+
+// comparePrompt is shared by all versions, since it was introduced after them
+const comparePrompt = `This log was captured after the previous analysis above. In addition to the fields above, include a "comparison" field: "resolved" if the previously analyzed problem no longer appears, "unchanged" if it still appears the same way, "regressed" if it has become worse, or "changed" if a different problem appears instead.`
+
+var promptTemplates = map[string]PromptTemplate{
+	"v1": {
+		Version: "v1",
+		System:  "You are a CLI debugging assistant. You must respond with valid JSON only. The response must contain exactly four fields: status, root_cause, evidence, and fix. Do not include markdown, code blocks, or any text outside the JSON.",
+		Instructions: []string{
+			"\nAnalyze the above log data and return a strict JSON response with exactly four fields:",
+			"1. \"status\": One of: \"no_problem\" (if no errors/issues detected), \"insufficient_data\" (if problem detected but not enough info for a clear solution), or \"problem_detected\" (if problem found with clear solution)",
+			"2. \"root_cause\": A concise description of the root cause (empty string if status is \"no_problem\")",
+			"3. \"evidence\": The relevant log lines that indicate the problem (include actual log lines, or empty string if status is \"no_problem\")",
+			"4. \"fix\": A concise, executable CLI fix or code patch (empty string if status is \"no_problem\" or \"insufficient_data\")",
+			"\nReturn ONLY valid JSON, no markdown, no code blocks, no explanations. The JSON must be parseable.",
+		},
+		Fields:         []string{"status", "root_cause", "evidence", "fix"},
+		FollowUpSystem: "You are a CLI debugging assistant. Provide concise, helpful answers. Keep responses brief since we're in a terminal.",
+		Investigate:    investigatePrompt,
+		Compare:        comparePrompt,
+	},
+	// v2 adds the severity field
+	"v2": {
+		Version: "v2",
+		System:  "You are a CLI debugging assistant. You must respond with valid JSON only. The response must contain exactly five fields: status, severity, root_cause, evidence, and fix. Do not include markdown, code blocks, or any text outside the JSON.",
+		Instructions: []string{
+			"\nAnalyze the above log data and return a strict JSON response with exactly five fields:",
+			"1. \"status\": One of: \"no_problem\" (if no errors/issues detected), \"insufficient_data\" (if problem detected but not enough info for a clear solution), or \"problem_detected\" (if problem found with clear solution)",
+			"2. \"severity\": One of: \"critical\" (outage or data loss), \"high\" (major feature broken), \"medium\" (degraded but working), \"low\" (minor issue), or \"info\" (no action needed); use \"info\" if status is \"no_problem\"",
+			"3. \"root_cause\": A concise description of the root cause (empty string if status is \"no_problem\")",
+			"4. \"evidence\": The relevant log lines that indicate the problem (include actual log lines, or empty string if status is \"no_problem\")",
+			"5. \"fix\": A concise, executable CLI fix or code patch (empty string if status is \"no_problem\" or \"insufficient_data\")",
+			"\nReturn ONLY valid JSON, no markdown, no code blocks, no explanations. The JSON must be parseable.",
+		},
+		Fields:         []string{"status", "severity", "root_cause", "evidence", "fix"},
+		FollowUpSystem: "You are a CLI debugging assistant. Provide concise, helpful answers. Keep responses brief since we're in a terminal.",
+		Investigate:    investigatePrompt,
+		Compare:        comparePrompt,
+	},
+	// v3 adds the timeline field
+	"v3": {
+		Version: "v3",
+		System:  "You are a CLI debugging assistant. You must respond with valid JSON only. The response must contain exactly six fields: status, severity, root_cause, evidence, fix, and timeline. Do not include markdown, code blocks, or any text outside the JSON.",
+		Instructions: []string{
+			"\nAnalyze the above log data and return a strict JSON response with exactly six fields:",
+			"1. \"status\": One of: \"no_problem\" (if no errors/issues detected), \"insufficient_data\" (if problem detected but not enough info for a clear solution), or \"problem_detected\" (if problem found with clear solution)",
+			"2. \"severity\": One of: \"critical\" (outage or data loss), \"high\" (major feature broken), \"medium\" (degraded but working), \"low\" (minor issue), or \"info\" (no action needed); use \"info\" if status is \"no_problem\"",
+			"3. \"root_cause\": A concise description of the root cause (empty string if status is \"no_problem\")",
+			"4. \"evidence\": The relevant log lines that indicate the problem (include actual log lines, or empty string if status is \"no_problem\")",
+			"5. \"fix\": A concise, executable CLI fix or code patch (empty string if status is \"no_problem\" or \"insufficient_data\")",
+			"6. \"timeline\": The key events leading to the problem in chronological order, at most 10, as an array of objects like {\"time\": \"2024-05-01T10:02:11Z\", \"event\": \"Connection pool exhausted\"}, with each time copied exactly as it appears in the log (empty array if status is \"no_problem\" or the log has no timestamps)",
+			"\nReturn ONLY valid JSON, no markdown, no code blocks, no explanations. The JSON must be parseable.",
+		},
+		Fields:         []string{"status", "severity", "root_cause", "evidence", "fix", "timeline"},
+		FollowUpSystem: "You are a CLI debugging assistant. Provide concise, helpful answers. Keep responses brief since we're in a terminal.",
+		Investigate:    investigatePrompt,
+		Compare:        comparePrompt,
+	},
+	// v4 adds the category field
+	"v4": {
+		Version: "v4",
+		System:  "You are a CLI debugging assistant. You must respond with valid JSON only. The response must contain exactly seven fields: status, severity, category, root_cause, evidence, fix, and timeline. Do not include markdown, code blocks, or any text outside the JSON.",
+		Instructions: []string{
+			"\nAnalyze the above log data and return a strict JSON response with exactly seven fields:",
+			"1. \"status\": One of: \"no_problem\" (if no errors/issues detected), \"insufficient_data\" (if problem detected but not enough info for a clear solution), or \"problem_detected\" (if problem found with clear solution)",
+			"2. \"severity\": One of: \"critical\" (outage or data loss), \"high\" (major feature broken), \"medium\" (degraded but working), \"low\" (minor issue), or \"info\" (no action needed); use \"info\" if status is \"no_problem\"",
+			"3. \"category\": One of: \"network\" (connectivity, DNS, TLS, timeouts), \"auth\" (credentials, permissions), \"config\" (wrong or missing settings), \"resource\" (memory, disk, CPU, quotas, limits), \"dependency\" (a service, package or version the system relies on), or \"code-bug\" (a defect in the application code); empty string if status is \"no_problem\"",
+			"4. \"root_cause\": A concise description of the root cause (empty string if status is \"no_problem\")",
+			"5. \"evidence\": The relevant log lines that indicate the problem (include actual log lines, or empty string if status is \"no_problem\")",
+			"6. \"fix\": A concise, executable CLI fix or code patch (empty string if status is \"no_problem\" or \"insufficient_data\")",
+			"7. \"timeline\": The key events leading to the problem in chronological order, at most 10, as an array of objects like {\"time\": \"2024-05-01T10:02:11Z\", \"event\": \"Connection pool exhausted\"}, with each time copied exactly as it appears in the log (empty array if status is \"no_problem\" or the log has no timestamps)",
+			"\nReturn ONLY valid JSON, no markdown, no code blocks, no explanations. The JSON must be parseable.",
+		},
+		Fields:         []string{"status", "severity", "category", "root_cause", "evidence", "fix", "timeline"},
+		FollowUpSystem: "You are a CLI debugging assistant. Provide concise, helpful answers. Keep responses brief since we're in a terminal.",
+		Investigate:    investigatePrompt,
+		Compare:        comparePrompt,
+	},
+	// v5 adds the diagnostics field
+	"v5": {
+		Version: "v5",
+		System:  "You are a CLI debugging assistant. You must respond with valid JSON only. The response must contain exactly eight fields: status, severity, category, root_cause, evidence, fix, timeline, and diagnostics. Do not include markdown, code blocks, or any text outside the JSON.",
+		Instructions: []string{
+			"\nAnalyze the above log data and return a strict JSON response with exactly eight fields:",
+			"1. \"status\": One of: \"no_problem\" (if no errors/issues detected), \"insufficient_data\" (if problem detected but not enough info for a clear solution), or \"problem_detected\" (if problem found with clear solution)",
+			"2. \"severity\": One of: \"critical\" (outage or data loss), \"high\" (major feature broken), \"medium\" (degraded but working), \"low\" (minor issue), or \"info\" (no action needed); use \"info\" if status is \"no_problem\"",
+			"3. \"category\": One of: \"network\" (connectivity, DNS, TLS, timeouts), \"auth\" (credentials, permissions), \"config\" (wrong or missing settings), \"resource\" (memory, disk, CPU, quotas, limits), \"dependency\" (a service, package or version the system relies on), or \"code-bug\" (a defect in the application code); empty string if status is \"no_problem\"",
+			"4. \"root_cause\": A concise description of the root cause (empty string if status is \"no_problem\")",
+			"5. \"evidence\": The relevant log lines that indicate the problem (include actual log lines, or empty string if status is \"no_problem\")",
+			"6. \"fix\": A concise, executable CLI fix or code patch (empty string if status is \"no_problem\" or \"insufficient_data\")",
+			"7. \"timeline\": The key events leading to the problem in chronological order, at most 10, as an array of objects like {\"time\": \"2024-05-01T10:02:11Z\", \"event\": \"Connection pool exhausted\"}, with each time copied exactly as it appears in the log (empty array if status is \"no_problem\" or the log has no timestamps)",
+			"8. \"diagnostics\": If status is \"insufficient_data\", up to 3 read-only commands that would gather the missing evidence, as an array of objects like {\"command\": \"kubectl describe pod web-1\", \"reason\": \"check recent events\"}; commands must only read state and run without a shell (no pipes, redirects, globs or environment variables). Empty array otherwise",
+			"\nReturn ONLY valid JSON, no markdown, no code blocks, no explanations. The JSON must be parseable.",
+		},
+		Fields:         []string{"status", "severity", "category", "root_cause", "evidence", "fix", "timeline", "diagnostics"},
+		FollowUpSystem: "You are a CLI debugging assistant. Provide concise, helpful answers. Keep responses brief since we're in a terminal.",
+		Investigate:    investigatePrompt,
+		Compare:        comparePrompt,
+	},
+	// v6 adds the missing field
+	"v6": {
+		Version: "v6",
+		System:  "You are a CLI debugging assistant. You must respond with valid JSON only. The response must contain exactly nine fields: status, severity, category, root_cause, evidence, fix, timeline, diagnostics, and missing. Do not include markdown, code blocks, or any text outside the JSON.",
+		Instructions: []string{
+			"\nAnalyze the above log data and return a strict JSON response with exactly nine fields:",
+			"1. \"status\": One of: \"no_problem\" (if no errors/issues detected), \"insufficient_data\" (if problem detected but not enough info for a clear solution), or \"problem_detected\" (if problem found with clear solution)",
+			"2. \"severity\": One of: \"critical\" (outage or data loss), \"high\" (major feature broken), \"medium\" (degraded but working), \"low\" (minor issue), or \"info\" (no action needed); use \"info\" if status is \"no_problem\"",
+			"3. \"category\": One of: \"network\" (connectivity, DNS, TLS, timeouts), \"auth\" (credentials, permissions), \"config\" (wrong or missing settings), \"resource\" (memory, disk, CPU, quotas, limits), \"dependency\" (a service, package or version the system relies on), or \"code-bug\" (a defect in the application code); empty string if status is \"no_problem\"",
+			"4. \"root_cause\": A concise description of the root cause (empty string if status is \"no_problem\")",
+			"5. \"evidence\": The relevant log lines that indicate the problem (include actual log lines, or empty string if status is \"no_problem\")",
+			"6. \"fix\": A concise, executable CLI fix or code patch (empty string if status is \"no_problem\" or \"insufficient_data\")",
+			"7. \"timeline\": The key events leading to the problem in chronological order, at most 10, as an array of objects like {\"time\": \"2024-05-01T10:02:11Z\", \"event\": \"Connection pool exhausted\"}, with each time copied exactly as it appears in the log (empty array if status is \"no_problem\" or the log has no timestamps)",
+			"8. \"diagnostics\": If status is \"insufficient_data\", up to 3 read-only commands that would gather the missing evidence, as an array of objects like {\"command\": \"kubectl describe pod web-1\", \"reason\": \"check recent events\"}; commands must only read state and run without a shell (no pipes, redirects, globs or environment variables). Empty array otherwise",
+			"9. \"missing\": If status is \"insufficient_data\", the specific logs, files or details the user should provide for a clear solution, each as a short request like \"the nginx error log (/var/log/nginx/error.log)\". Empty array otherwise",
+			"\nReturn ONLY valid JSON, no markdown, no code blocks, no explanations. The JSON must be parseable.",
+		},
+		Fields:         []string{"status", "severity", "category", "root_cause", "evidence", "fix", "timeline", "diagnostics", "missing"},
+		FollowUpSystem: "You are a CLI debugging assistant. Provide concise, helpful answers. Keep responses brief since we're in a terminal.",
+		Investigate:    investigatePrompt,
+		Compare:        comparePrompt,
+		Compact: []string{
+			"Reply with one JSON object and nothing else. Fields:",
+			"status: \"no_problem\", \"problem_detected\" or \"insufficient_data\"",
+			"severity: \"critical\", \"high\", \"medium\", \"low\" or \"info\"",
+			"category: \"network\", \"auth\", \"config\", \"resource\", \"dependency\", \"code-bug\" or \"\"",
+			"root_cause: one sentence",
+			"evidence: the log lines showing the problem",
+			"fix: a CLI command or code change, or \"\"",
+			"timeline: [{\"time\": \"as in the log\", \"event\": \"what happened\"}], at most 10",
+			"diagnostics: [{\"command\": \"read-only command\", \"reason\": \"why\"}], only if insufficient_data",
+			"missing: [\"what the user should provide\"], only if insufficient_data",
+		},
+		Examples: v6Examples,
+	},
+}
+
+// GetPromptTemplate returns the template for version, or the current one if version is empty
+func GetPromptTemplate(version string) (PromptTemplate, error) {
+	if version == "" {
+		version = CurrentPromptVersion
+	}
+	tmpl, ok := promptTemplates[version]
+	if !ok {
+		return PromptTemplate{}, fmt.Errorf("unknown prompt version: %s (available: %v)", version, PromptVersions())
+	}
+	return tmpl, nil
+}
+
+// PromptVersions returns all known prompt versions in sorted order
+func PromptVersions() []string {
+	versions := make([]string, 0, len(promptTemplates))
+	for v := range promptTemplates {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// promptTemplateFor returns the template for version, falling back to the current one if unknown
+func promptTemplateFor(version string) PromptTemplate {
+	tmpl, err := GetPromptTemplate(version)
+	if err != nil {
+		return promptTemplates[CurrentPromptVersion]
+	}
+	return tmpl
+}
@@ -0,0 +1,214 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+func TestGetPromptTemplate(t *testing.T) {
+	tmpl, err := GetPromptTemplate("")
+	if err != nil {
+		t.Fatalf("GetPromptTemplate(\"\") error = %v", err)
+	}
+	if tmpl.Version != CurrentPromptVersion {
+		t.Errorf("Version = %s, want %s", tmpl.Version, CurrentPromptVersion)
+	}
+
+	if _, err := GetPromptTemplate("v999"); err == nil {
+		t.Error("GetPromptTemplate(\"v999\") should fail for an unknown version")
+	}
+}
+
+func TestFormatPrompt_UsesTemplateInstructions(t *testing.T) {
+	tmpl := promptTemplateFor(CurrentPromptVersion)
+	prompt := formatPrompt(tmpl, config.QueryPayload{SanitizedLog: "ERROR boom"})
+
+	if !strings.Contains(prompt, "ERROR boom") {
+		t.Error("Prompt should contain the sanitized log")
+	}
+	for _, instruction := range tmpl.Instructions {
+		if !strings.Contains(prompt, instruction) {
+			t.Errorf("Prompt should contain instruction %q", instruction)
+		}
+	}
+}
+
+func TestFormatPrompt_IncludesHint(t *testing.T) {
+	tmpl := promptTemplateFor(CurrentPromptVersion)
+	payload := config.QueryPayload{
+		SanitizedLog: "ERROR connection refused",
+		Hint:         "this started after upgrading postgres to 16",
+	}
+
+	prompt := formatPrompt(tmpl, payload)
+	if !strings.Contains(prompt, "User-Provided Context:\nthis started after upgrading postgres to 16") {
+		t.Errorf("Prompt should contain the hint section, got:\n%s", prompt)
+	}
+	if strings.Index(prompt, "User-Provided Context") > strings.Index(prompt, "Log/Error Data") {
+		t.Error("Hint should appear before the log data")
+	}
+}
+
+func TestBuildPrompts_CustomSystemPrompt(t *testing.T) {
+	payload := config.QueryPayload{SanitizedLog: "ERROR boom"}
+	tmpl := promptTemplateFor(CurrentPromptVersion)
+
+	system, user := BuildPrompts(&config.Config{SystemPrompt: "You are a Kubernetes SRE."}, payload)
+	if system != "You are a Kubernetes SRE." {
+		t.Errorf("system prompt = %q, want the custom prompt", system)
+	}
+	if !strings.Contains(user, tmpl.Instructions[0]) {
+		t.Error("Schema instructions should be kept by default")
+	}
+
+	_, user = BuildPrompts(&config.Config{SystemPrompt: "You are a Kubernetes SRE.", NoSchema: true}, payload)
+	if strings.Contains(user, tmpl.Instructions[0]) {
+		t.Error("Schema instructions should be dropped with NoSchema")
+	}
+	if !strings.Contains(user, "ERROR boom") {
+		t.Error("User prompt should still contain the log")
+	}
+}
+
+func TestBuildPrompts_Previous(t *testing.T) {
+	payload := config.QueryPayload{
+		SanitizedLog: "INFO pool size 50",
+		Previous:     &config.PreviousAnalysis{RootCause: "Connection pool exhausted", Fix: "raise max_connections"},
+	}
+	tmpl := promptTemplateFor(CurrentPromptVersion)
+
+	_, user := BuildPrompts(&config.Config{}, payload)
+	if !strings.Contains(user, "Previous Analysis:\nRoot cause: Connection pool exhausted\nSuggested fix: raise max_connections") {
+		t.Errorf("User prompt should contain the previous analysis, got:\n%s", user)
+	}
+	if strings.Index(user, "Previous Analysis") > strings.Index(user, "Log/Error Data") {
+		t.Error("Previous analysis should appear before the log data")
+	}
+	if !strings.HasSuffix(user, tmpl.Compare) {
+		t.Error("Comparison instructions should follow the schema instructions")
+	}
+
+	_, user = BuildPrompts(&config.Config{NoSchema: true}, payload)
+	if strings.Contains(user, tmpl.Compare) {
+		t.Error("Comparison instructions should be dropped with NoSchema")
+	}
+
+	_, user = BuildPrompts(&config.Config{}, config.QueryPayload{SanitizedLog: "INFO pool size 50"})
+	if strings.Contains(user, "Previous Analysis") || strings.Contains(user, tmpl.Compare) {
+		t.Error("Prompt without a previous analysis should be unchanged")
+	}
+}
+
+func TestFormatPrompt_SummarizesRedactions(t *testing.T) {
+	tmpl := promptTemplateFor(CurrentPromptVersion)
+	payload := config.QueryPayload{
+		SanitizedLog: "dial <REDACTED_DB_CONNECTION_STRING> failed\nretry <REDACTED_DB_CONNECTION_STRING>\nretry <REDACTED_DB_CONNECTION_STRING>",
+		Hint:         "token is <REDACTED_GITHUB_TOKEN>",
+	}
+
+	prompt := formatPrompt(tmpl, payload)
+	for _, want := range []string{
+		"Redacted Values:\n- 3 values replaced with <REDACTED_DB_CONNECTION_STRING>\n- 1 value replaced with <REDACTED_GITHUB_TOKEN>",
+		"do not report them as malformed",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Prompt should contain %q, got:\n%s", want, prompt)
+		}
+	}
+	if strings.Index(prompt, "Redacted Values:") < strings.Index(prompt, "Log/Error Data") {
+		t.Error("Redaction summary should follow the log data")
+	}
+
+	if prompt := formatPrompt(tmpl, config.QueryPayload{SanitizedLog: "ERROR boom"}); strings.Contains(prompt, "Redacted Values") {
+		t.Error("Prompt without placeholders should have no redaction summary")
+	}
+}
+
+func TestRedactionSummary_CustomTemplate(t *testing.T) {
+	SetRedactionTemplate("[REDACTED:{type}:{n}]")
+	defer SetRedactionTemplate("")
+
+	summary := RedactionSummary("dial [REDACTED:DB_CONNECTION_STRING:1] failed with [REDACTED:TOKEN:2], then [REDACTED:TOKEN:2]")
+	want := "Redacted Values:\n- 1 value replaced with [REDACTED:DB_CONNECTION_STRING:1]\n- 2 values replaced with [REDACTED:TOKEN:2]"
+	if !strings.HasPrefix(summary, want) {
+		t.Errorf("RedactionSummary() = %q, want prefix %q", summary, want)
+	}
+	if summary := RedactionSummary("token <REDACTED_TOKEN>"); summary != "" {
+		t.Errorf("Default placeholders should not match a custom template, got %q", summary)
+	}
+
+	SetRedactionTemplate("[REDACTED:{rule}]")
+	if summary := RedactionSummary("token [REDACTED:github-pat]"); !strings.Contains(summary, "1 value replaced with [REDACTED:github-pat]") {
+		t.Errorf("RedactionSummary() = %q, want the {rule} placeholder", summary)
+	}
+}
+
+func TestFormatPrompt_Sources(t *testing.T) {
+	tmpl := promptTemplateFor(CurrentPromptVersion)
+	payload := config.QueryPayload{
+		SanitizedLog: "[pod/web-1/app] ERROR upstream connect error\n[pod/web-1/istio-proxy] WARN cluster not ready",
+		Sources: []config.LogSource{
+			{Pod: "web-1", Container: "app", Lines: 1},
+			{Pod: "web-1", Container: "istio-proxy", Lines: 1},
+			{Pod: "db-0", Container: "postgres", Lines: 12},
+		},
+		Interleaved: true,
+	}
+
+	prompt := formatPrompt(tmpl, payload)
+	for _, want := range []string{
+		"Log Sources:\nThe log combines 3 containers of 2 pods.",
+		"- pod web-1: app (1 line), istio-proxy (1 line)\n- pod db-0: postgres (12 lines)",
+		"in timestamp order",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Prompt should contain %q, got:\n%s", want, prompt)
+		}
+	}
+	if strings.Index(prompt, "Log Sources") > strings.Index(prompt, "Log/Error Data") {
+		t.Error("Sources should appear before the log data")
+	}
+
+	xml := formatXMLPrompt(tmpl, payload)
+	if !strings.Contains(xml, "<log_sources>\nThe log combines 3 containers") {
+		t.Errorf("XML prompt should contain the sources tag, got:\n%s", xml)
+	}
+
+	if prompt := formatPrompt(tmpl, config.QueryPayload{SanitizedLog: "ERROR boom"}); strings.Contains(prompt, "Log Sources") {
+		t.Error("Prompt without sources should have no sources section")
+	}
+}
+
+func TestFormatPrompt_Toolchain(t *testing.T) {
+	tmpl := promptTemplateFor(CurrentPromptVersion)
+	payload := config.QueryPayload{
+		SanitizedLog: "npm error code ERESOLVE\nnpm error ERESOLVE unable to resolve dependency tree",
+		Toolchain:    "npm",
+	}
+
+	prompt := formatPrompt(tmpl, payload)
+	if !strings.Contains(prompt, "Log Type:\nThis is output of the npm package manager.") {
+		t.Errorf("Prompt should describe the npm output, got:\n%s", prompt)
+	}
+	if !strings.Contains(prompt, "package-lock.json") {
+		t.Error("Prompt should name npm's lockfile")
+	}
+	if strings.Index(prompt, "Log Type") > strings.Index(prompt, "Log/Error Data") {
+		t.Error("Log type should appear before the log data")
+	}
+
+	if xml := formatXMLPrompt(tmpl, payload); !strings.Contains(xml, "<log_type tool=\"npm\">\nThis is output of the npm") {
+		t.Errorf("XML prompt should contain the log type tag, got:\n%s", xml)
+	}
+
+	payload = config.QueryPayload{SanitizedLog: "> Task :app:compileDebugKotlin FAILED", Toolchain: "gradle", Filtered: true}
+	if prompt := formatPrompt(tmpl, payload); !strings.Contains(prompt, "Gradle build") || !strings.Contains(prompt, "[FILTERED] markers") {
+		t.Errorf("Prompt of a filtered Gradle log should say so, got:\n%s", prompt)
+	}
+
+	if prompt := formatPrompt(tmpl, config.QueryPayload{SanitizedLog: "ERROR boom"}); strings.Contains(prompt, "Log Type") {
+		t.Error("Prompt of an unrecognized log should have no log type section")
+	}
+}
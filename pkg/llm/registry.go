@@ -0,0 +1,112 @@
+package llm
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// Provider describes an LLM provider that NewClient can create clients for
+type Provider struct {
+	Name         string                                   // Name used with --provider, e.g. "openai"
+	DisplayName  string                                   // Name shown to users, e.g. "OpenAI"
+	DefaultModel string                                   // Model used when no override is given
+	TriageModel  string                                   // Cheap model for the --smart-routing first pass (optional)
+	Dialect      string                                   // Prompt dialect its models follow best (optional, default plain)
+	EnvVars      []string                                 // Environment variables that must be set to query it
+	New          func(cfg *config.Config) (Client, error) // Creates a client from config
+	Plugin       string                                   // Path of the plugin executable, empty if compiled in
+}
+
+// providers holds every registered provider by name. Each built-in provider
+// registers itself from an init function in its own file, so excluding the
+// file with a build tag (noopenai, noclaude, minimal) drops it from the binary.
+var providers = map[string]Provider{}
+
+// Register makes a provider available to NewClient. It is meant to be called
+// from init functions and panics if the name is empty or already registered.
+func Register(p Provider) {
+	if p.Name == "" || p.New == nil {
+		panic("llm: Register called with an incomplete provider")
+	}
+	if _, exists := providers[p.Name]; exists {
+		panic("llm: provider " + p.Name + " registered twice")
+	}
+	providers[p.Name] = p
+}
+
+// LookupProvider returns the registered provider with the given name, or
+// else the provider plugin que-provider-NAME on PATH
+func LookupProvider(name string) (Provider, bool) {
+	if p, ok := providers[name]; ok {
+		return p, true
+	}
+	return lookupPlugin(name)
+}
+
+// SetDefaultModel sets the default model of a registered provider whose models
+// depend on the user's setup, such as an Azure OpenAI deployment. Providers
+// that aren't compiled in are ignored.
+func SetDefaultModel(name, model string) {
+	if p, ok := providers[name]; ok && model != "" {
+		p.DefaultModel = model
+		providers[name] = p
+	}
+}
+
+// Providers returns the providers compiled into this binary, sorted by name
+func Providers() []Provider {
+	list := make([]Provider, 0, len(providers))
+	for _, p := range providers {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// ProviderNames returns the names of the providers compiled into this binary, sorted
+func ProviderNames() []string {
+	names := make([]string, 0, len(providers))
+	for _, p := range Providers() {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// ValidateProvider returns an error if name is neither a provider compiled
+// into this binary nor a provider plugin on PATH
+func ValidateProvider(name string) error {
+	if _, ok := LookupProvider(name); ok {
+		return nil
+	}
+	if len(providers) == 0 {
+		return fmt.Errorf("invalid provider: %s (this build includes no providers, and no %s%s is on PATH)", name, PluginPrefix, name)
+	}
+	quoted := make([]string, 0, len(providers))
+	for _, n := range ProviderNames() {
+		quoted = append(quoted, "'"+n+"'")
+	}
+	return fmt.Errorf("invalid provider: %s (this build supports %s, or a plugin named %s%s on PATH)", name, strings.Join(quoted, ", "), PluginPrefix, name)
+}
+
+// MissingEnv returns the required environment variables of p that are unset
+func (p Provider) MissingEnv() []string {
+	var missing []string
+	for _, name := range p.EnvVars {
+		if os.Getenv(name) == "" {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// CheckEnv returns an error naming the first required environment variable of p that is unset
+func (p Provider) CheckEnv() error {
+	if missing := p.MissingEnv(); len(missing) > 0 {
+		return fmt.Errorf("%s environment variable is required for %s provider", missing[0], p.DisplayName)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package llm
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+func TestValidateProvider(t *testing.T) {
+	available := ProviderNames()
+	if !sort.StringsAreSorted(available) {
+		t.Errorf("ProviderNames() = %v, want sorted names", available)
+	}
+	for _, name := range available {
+		if err := ValidateProvider(name); err != nil {
+			t.Errorf("ValidateProvider(%q) = %v, want nil", name, err)
+		}
+	}
+
+	err := ValidateProvider("bedrock")
+	if err == nil {
+		t.Fatal("ValidateProvider(\"bedrock\") = nil, want error")
+	}
+	if !strings.Contains(err.Error(), "invalid provider: bedrock") {
+		t.Errorf("ValidateProvider(\"bedrock\") = %v, want it to name the provider", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	original := providers
+	providers = map[string]Provider{}
+	defer func() { providers = original }()
+
+	Register(Provider{
+		Name:         "fake",
+		DisplayName:  "Fake",
+		DefaultModel: "fake-1",
+		EnvVars:      []string{"QUE_TEST_FAKE_KEY"},
+		New:          func(cfg *config.Config) (Client, error) { return plainClient{}, nil },
+	})
+
+	if _, err := NewClient(&config.Config{Provider: "fake"}); err != nil {
+		t.Errorf("NewClient() error = %v", err)
+	}
+	if got := ResolveModel("fake", ""); got != "fake-1" {
+		t.Errorf("ResolveModel() = %q, want fake-1", got)
+	}
+
+	p, _ := LookupProvider("fake")
+	t.Setenv("QUE_TEST_FAKE_KEY", "")
+	if err := p.CheckEnv(); err == nil || !strings.Contains(err.Error(), "QUE_TEST_FAKE_KEY") {
+		t.Errorf("CheckEnv() = %v, want an error naming QUE_TEST_FAKE_KEY", err)
+	}
+	t.Setenv("QUE_TEST_FAKE_KEY", "secret")
+	if err := p.CheckEnv(); err != nil {
+		t.Errorf("CheckEnv() = %v, want nil", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Register() of a duplicate name should panic")
+		}
+	}()
+	Register(Provider{Name: "fake", New: p.New})
+}
@@ -0,0 +1,141 @@
+package llm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/jenian/que/internal/logging"
+)
+
+// clientRequestIDHeader carries que's own ID for an API call. OpenAI records
+// it with the request, so duplicated calls can be traced with its support.
+const clientRequestIDHeader = "X-Client-Request-Id"
+
+// providerRequestIDHeaders are the response headers providers return their
+// own request ID in (OpenAI, Anthropic)
+var providerRequestIDHeaders = []string{"x-request-id", "request-id"}
+
+type requestIDKey struct{}
+
+// requestIDs are the IDs of one API call: que's own, and the provider's for
+// its last attempt once a response arrived
+type requestIDs struct {
+	client string
+
+	mu       sync.Mutex
+	sent     bool
+	provider string
+}
+
+// withRequestID returns ctx carrying a new client request ID. Every attempt of
+// a call made with the returned context sends the same ID, so a retried call
+// can be told apart from a new one.
+func withRequestID(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, &requestIDs{client: newRequestID()})
+}
+
+// tagRequestIDs adds the request IDs of the call made with ctx to err, so
+// the failure can be escalated with the provider's support. An APIError
+// records them in its fields; other errors are wrapped with the client
+// request ID. Errors of calls that never reached the network are returned
+// unchanged.
+func tagRequestIDs(ctx context.Context, err error) error {
+	ids, _ := ctx.Value(requestIDKey{}).(*requestIDs)
+	if err == nil || ids == nil {
+		return err
+	}
+	ids.mu.Lock()
+	sent, provider := ids.sent, ids.provider
+	ids.mu.Unlock()
+	if !sent {
+		return err
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.ClientRequestID == "" {
+			apiErr.ClientRequestID = ids.client
+		}
+		if apiErr.RequestID == "" {
+			apiErr.RequestID = provider
+		}
+		return err
+	}
+	return fmt.Errorf("%w (client request ID %s)", err, ids.client)
+}
+
+// newRequestID returns a random ID for one API call
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return "que-" + hex.EncodeToString(b)
+}
+
+// requestIDTransport tags every API request with the client request ID from
+// its context (or a fresh one) and logs it next to the provider's request ID
+type requestIDTransport struct {
+	provider string
+	base     http.RoundTripper
+}
+
+// newRequestIDClient returns an HTTP client for provider's API whose requests
+// carry client request IDs and are retried on transient failures. Retries
+// happen below the tagging, so every attempt sends the same ID.
+func newRequestIDClient(provider string, client *http.Client) *http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	tagged := *client
+	retrying := &retryTransport{provider: provider, base: base, sleep: sleepContext}
+	tagged.Transport = &requestIDTransport{provider: provider, base: retrying}
+	return &tagged
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ids, _ := req.Context().Value(requestIDKey{}).(*requestIDs)
+	if ids == nil {
+		ids = &requestIDs{client: newRequestID()}
+	}
+	// RoundTrip must not modify the caller's request
+	req = req.Clone(req.Context())
+	req.Header.Set(clientRequestIDHeader, ids.client)
+
+	resp, err := t.base.RoundTrip(req)
+
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+	ids.sent = true
+	event := logging.Debug()
+	if err != nil || resp.StatusCode >= http.StatusBadRequest {
+		// Failures are worth the IDs at default log levels, for escalation
+		event = logging.Warn()
+	}
+	event = event.Str("provider", t.provider).Str("path", req.URL.Path).Str("client_request_id", ids.client)
+	if err != nil {
+		event.Err(err).Msg("API request failed")
+		return resp, err
+	}
+	ids.provider = providerRequestID(resp.Header)
+	if ids.provider != "" {
+		event = event.Str("request_id", ids.provider)
+	}
+	event.Int("status", resp.StatusCode).Msg("API request")
+	return resp, nil
+}
+
+// providerRequestID returns the provider's ID of the request header answers, or ""
+func providerRequestID(header http.Header) string {
+	for _, name := range providerRequestIDHeaders {
+		if id := header.Get(name); id != "" {
+			return id
+		}
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/logging"
+	"github.com/rs/zerolog"
+)
+
+func TestRequestIDTransport(t *testing.T) {
+	var seen []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get(clientRequestIDHeader))
+		w.Header().Set("request-id", "req_0123")
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	if _, err := logging.InitWithWriter(&logs, "debug", ""); err != nil {
+		t.Fatalf("InitWithWriter() error = %v", err)
+	}
+	t.Cleanup(func() { logging.Logger = zerolog.Nop() })
+
+	client := newRequestIDClient("anthropic", &http.Client{})
+	get := func(ctx context.Context) {
+		req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		resp.Body.Close()
+		if req.Header.Get(clientRequestIDHeader) != "" {
+			t.Error("the caller's request must not be modified")
+		}
+	}
+
+	// A retry reuses the call's context, so it must send the same ID
+	call := withRequestID(context.Background())
+	get(call)
+	get(call)
+	get(context.Background())
+
+	if len(seen) != 3 || !strings.HasPrefix(seen[0], "que-") {
+		t.Fatalf("sent IDs = %q", seen)
+	}
+	if seen[0] != seen[1] {
+		t.Errorf("attempts of one call sent different IDs: %q", seen[:2])
+	}
+	if seen[2] == seen[0] || seen[2] == "" {
+		t.Errorf("a new call should get a fresh ID, got %q", seen[2])
+	}
+	if !strings.Contains(logs.String(), seen[0]) || !strings.Contains(logs.String(), "req_0123") {
+		t.Errorf("log should record both request IDs:\n%s", logs.String())
+	}
+}
+
+func TestTagRequestIDs(t *testing.T) {
+	call := withRequestID(context.Background())
+	err := errors.New("connection reset")
+
+	// Nothing was sent yet, so there is no ID worth reporting
+	if got := tagRequestIDs(call, err); got != err {
+		t.Errorf("tagRequestIDs() before sending = %v, want the error unchanged", got)
+	}
+
+	ids := call.Value(requestIDKey{}).(*requestIDs)
+	ids.sent = true
+	if got := tagRequestIDs(call, err); !errors.Is(got, err) || !strings.Contains(got.Error(), ids.client) {
+		t.Errorf("tagRequestIDs() = %v, want the error wrapped with %s", got, ids.client)
+	}
+}
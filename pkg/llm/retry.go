@@ -0,0 +1,214 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jenian/que/internal/config"
+	"github.com/jenian/que/internal/logging"
+)
+
+const (
+	// DefaultRetryBackoff is the pause before the first retry; it doubles on each one
+	DefaultRetryBackoff = time.Second
+	// maxRetryDelay caps a single pause, including one asked for by Retry-After
+	maxRetryDelay = 30 * time.Second
+)
+
+// retries and retryBackoff are the retry policy for API requests of every
+// provider; rateLimitBudget is how long a request may wait out rate limits
+// and rateLimitNotice tells the user it does
+var (
+	retries         = config.DefaultRetries
+	retryBackoff    = DefaultRetryBackoff
+	rateLimitBudget = config.DefaultRateLimitBudget
+	rateLimitNotice = func(message string) {}
+)
+
+// SetRetries sets how many times API requests that fail with a server error
+// or a network error are retried, and the pause before the first retry. It
+// is meant to be called once at startup; zero retries turns retrying off and
+// a zero backoff keeps the default. Rate limits are waited out within the
+// budget of SetRateLimitBudget instead.
+func SetRetries(n int, backoff time.Duration) {
+	retries = max(n, 0)
+	retryBackoff = DefaultRetryBackoff
+	if backoff > 0 {
+		retryBackoff = backoff
+	}
+}
+
+// SetRateLimitBudget sets how long in total an API request may wait for a
+// provider's rate limit to pass (429 responses) before the rate limit error
+// is returned. Rate limits don't use up the retries of SetRetries; a zero
+// budget fails at once. It is meant to be called once at startup.
+func SetRateLimitBudget(budget time.Duration) {
+	rateLimitBudget = max(budget, 0)
+}
+
+// SetRateLimitNotice sets what is told a message such as "OpenAI: rate
+// limited, retrying in 7s" whenever a request waits for a rate limit. By
+// default nothing is.
+func SetRateLimitNotice(notice func(message string)) {
+	if notice == nil {
+		notice = func(message string) {}
+	}
+	rateLimitNotice = notice
+}
+
+// retryableStatus are the HTTP statuses worth another attempt: server errors
+// and Anthropic's 529 "overloaded". Rate limits (429) are retried separately,
+// within rateLimitBudget.
+var retryableStatus = map[int]bool{
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+	529:                            true,
+}
+
+// retryTransport retries requests that failed transiently with exponential
+// backoff, so a single blip doesn't fail the whole run
+type retryTransport struct {
+	provider string
+	base     http.RoundTripper
+	// sleep waits between attempts; tests replace it
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	failures := 0            // Retried failures other than rate limits
+	var waited time.Duration // Time spent waiting for rate limits
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil {
+			// The previous attempt consumed the body
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(req)
+		canReplay := req.Body == nil || req.GetBody != nil
+		if !canReplay {
+			return resp, err
+		}
+
+		var delay time.Duration
+		if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+			if quotaExhausted(resp) {
+				// No wait brings the quota back
+				return resp, nil
+			}
+			delay = retryAfter(resp)
+			if delay <= 0 {
+				delay = retryDelay(attempt, nil)
+			}
+			if waited+delay > rateLimitBudget {
+				return resp, err
+			}
+			waited += delay
+			rateLimitNotice(fmt.Sprintf("%s: rate limited, retrying in %s", t.provider, formatWait(delay)))
+		} else {
+			if failures >= retries || !retryable(req.Context(), resp, err) {
+				return resp, err
+			}
+			failures++
+			delay = retryDelay(attempt, resp)
+		}
+
+		event := logging.Debug().Str("provider", t.provider).Int("attempt", attempt+1).Dur("backoff", delay)
+		if err != nil {
+			event = event.Err(err)
+		} else {
+			event = event.Int("status", resp.StatusCode)
+			// Drain the body so the connection can be reused
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		event.Msg("Retrying API request")
+
+		if err := t.sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryable reports whether a request that returned resp or err may succeed
+// if sent again. Cancellations and timeouts of the request itself are final.
+func retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil && !errors.Is(err, context.Canceled)
+	}
+	return retryableStatus[resp.StatusCode]
+}
+
+// quotaExhausted reports whether the 429 response resp is OpenAI's
+// insufficient_quota error rather than a rate limit. It reads the start of
+// the body and puts it back for the client to decode.
+func quotaExhausted(resp *http.Response) bool {
+	head, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+	return err == nil && bytes.Contains(head, []byte("insufficient_quota"))
+}
+
+// retryDelay returns the pause before retry number attempt+1: what the
+// provider asked for in Retry-After, or the doubled backoff with jitter
+func retryDelay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if delay := retryAfter(resp); delay > 0 {
+			return min(delay, maxRetryDelay)
+		}
+	}
+	delay := retryBackoff << attempt
+	// Jitter keeps parallel runs (batch workers) from retrying in lockstep
+	delay += time.Duration(rand.Int64N(int64(delay)/2 + 1))
+	return min(delay, maxRetryDelay)
+}
+
+// retryAfter returns the pause resp asks for: Retry-After in seconds or as
+// an HTTP date, or OpenAI's retry-after-ms. It is zero if there is none.
+func retryAfter(resp *http.Response) time.Duration {
+	if ms, err := strconv.Atoi(resp.Header.Get("Retry-After-Ms")); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	value := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
+// formatWait renders a pause in whole seconds, rounding up so that a short
+// pause doesn't read as "0s"
+func formatWait(d time.Duration) string {
+	return fmt.Sprintf("%ds", int((d+time.Second-1)/time.Second))
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
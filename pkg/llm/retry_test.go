@@ -0,0 +1,226 @@
+package llm
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// useRetries sets the retry policy for one test
+func useRetries(t *testing.T, n int) {
+	t.Helper()
+	SetRetries(n, time.Millisecond)
+	t.Cleanup(func() { SetRetries(config.DefaultRetries, 0) })
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []int
+		retries   int
+		wantCalls int
+		want      int
+	}{
+		{"success", []int{200}, 2, 1, 200},
+		{"server error then success", []int{503, 200}, 2, 2, 200},
+		{"rate limited then success", []int{429, 429, 200}, 2, 3, 200},
+		{"rate limits don't use up retries", []int{429, 429, 429, 200}, 0, 4, 200},
+		{"overloaded", []int{529, 200}, 2, 2, 200},
+		{"retries run out", []int{500, 500, 500, 200}, 2, 3, 500},
+		{"retrying off", []int{503, 200}, 0, 1, 503},
+		{"client error is final", []int{400, 200}, 2, 1, 400},
+		{"auth error is final", []int{401, 200}, 2, 1, 401},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useRetries(t, tt.retries)
+			var calls int
+			var bodies []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				bodies = append(bodies, string(body))
+				w.WriteHeader(tt.statuses[calls])
+				calls++
+			}))
+			defer server.Close()
+
+			client := newRequestIDClient("test", &http.Client{})
+			client.Transport.(*requestIDTransport).base.(*retryTransport).sleep = func(ctx context.Context, d time.Duration) error {
+				return nil
+			}
+			req, _ := http.NewRequest("POST", server.URL, strings.NewReader(`{"model": "m"}`))
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			resp.Body.Close()
+
+			if calls != tt.wantCalls || resp.StatusCode != tt.want {
+				t.Errorf("calls = %d, status = %d, want %d calls ending in %d", calls, resp.StatusCode, tt.wantCalls, tt.want)
+			}
+			for _, body := range bodies {
+				if body != `{"model": "m"}` {
+					t.Errorf("attempt sent body %q, want the original body", body)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryTransport_NetworkError(t *testing.T) {
+	useRetries(t, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	var pauses int
+	transport := &retryTransport{provider: "test", base: http.DefaultTransport, sleep: func(ctx context.Context, d time.Duration) error {
+		pauses++
+		return nil
+	}}
+	req, _ := http.NewRequest("GET", url, nil)
+	if _, err := transport.RoundTrip(req); err == nil {
+		t.Fatal("RoundTrip() to a closed server should fail")
+	}
+	if pauses != 2 {
+		t.Errorf("paused %d times, want 2 retries", pauses)
+	}
+}
+
+func TestRetryTransport_Canceled(t *testing.T) {
+	useRetries(t, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	transport := &retryTransport{provider: "test", base: http.DefaultTransport, sleep: func(ctx context.Context, d time.Duration) error {
+		cancel()
+		return sleepContext(ctx, time.Hour)
+	}}
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	if _, err := transport.RoundTrip(req); err != context.Canceled {
+		t.Errorf("RoundTrip() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestRetryTransport_RateLimitBudget(t *testing.T) {
+	useRetries(t, 0)
+	SetRateLimitBudget(time.Minute)
+	var notices []string
+	SetRateLimitNotice(func(message string) { notices = append(notices, message) })
+	t.Cleanup(func() {
+		SetRateLimitBudget(config.DefaultRateLimitBudget)
+		SetRateLimitNotice(nil)
+	})
+
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "25")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	var waited time.Duration
+	transport := &retryTransport{provider: "OpenAI", base: http.DefaultTransport, sleep: func(ctx context.Context, d time.Duration) error {
+		waited += d
+		return nil
+	}}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	resp.Body.Close()
+
+	// Two waits of 25s fit in the minute, a third doesn't
+	if resp.StatusCode != http.StatusTooManyRequests || calls != 3 || waited != 50*time.Second {
+		t.Errorf("status = %d after %d calls and %v of waiting, want 429 after 3 calls and 50s", resp.StatusCode, calls, waited)
+	}
+	if len(notices) != 2 || notices[0] != "OpenAI: rate limited, retrying in 25s" {
+		t.Errorf("notices = %q, want two \"OpenAI: rate limited, retrying in 25s\"", notices)
+	}
+}
+
+func TestRetryTransport_QuotaExhausted(t *testing.T) {
+	useRetries(t, 2)
+	const body = `{"error": {"message": "You exceeded your current quota", "type": "insufficient_quota", "code": "insufficient_quota"}}`
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+
+	transport := &retryTransport{provider: "OpenAI", base: http.DefaultTransport, sleep: func(ctx context.Context, d time.Duration) error {
+		t.Error("an exhausted quota should not be waited for")
+		return nil
+	}}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	got, _ := io.ReadAll(resp.Body)
+	if calls != 1 || resp.StatusCode != http.StatusTooManyRequests || string(got) != body {
+		t.Errorf("%d calls, status %d, body %q, want one call returning the 429 and its body", calls, resp.StatusCode, got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"seconds", http.Header{"Retry-After": []string{"7"}}, 7 * time.Second},
+		{"milliseconds", http.Header{"Retry-After-Ms": []string{"1500"}, "Retry-After": []string{"2"}}, 1500 * time.Millisecond},
+		{"past date", http.Header{"Retry-After": []string{"Wed, 21 Oct 2015 07:28:00 GMT"}}, 0},
+		{"none", http.Header{}, 0},
+		{"garbage", http.Header{"Retry-After": []string{"soon"}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryAfter(&http.Response{Header: tt.header}); got != tt.want {
+				t.Errorf("retryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got := retryAfter(&http.Response{Header: http.Header{"Retry-After": []string{future}}}); got < 59*time.Minute || got > time.Hour {
+		t.Errorf("retryAfter() = %v for a date an hour away", got)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	useRetries(t, 2)
+
+	withRetryAfter := &http.Response{Header: http.Header{"Retry-After": []string{"7"}}}
+	if got := retryDelay(0, withRetryAfter); got != 7*time.Second {
+		t.Errorf("retryDelay() = %v, want the 7s from Retry-After", got)
+	}
+	withRetryAfter.Header.Set("Retry-After", "3600")
+	if got := retryDelay(0, withRetryAfter); got != maxRetryDelay {
+		t.Errorf("retryDelay() = %v, want it capped at %v", got, maxRetryDelay)
+	}
+
+	// Backoff doubles per attempt, plus up to half again as jitter
+	for attempt, base := range []time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond} {
+		if got := retryDelay(attempt, nil); got < base || got > base+base/2 {
+			t.Errorf("retryDelay(%d) = %v, want between %v and %v", attempt, got, base, base+base/2)
+		}
+	}
+}
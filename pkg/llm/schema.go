@@ -0,0 +1,89 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// responseSchemaName names the response schema in structured output requests
+const responseSchemaName = "log_analysis"
+
+// responseSchemaDescription describes the response schema to the model
+const responseSchemaDescription = "Report the analysis of the log: its root cause, the evidence for it and the fix"
+
+// stringArraySchema is the schema of a list of strings
+var stringArraySchema = map[string]any{"type": "array", "items": map[string]any{"type": "string"}}
+
+// fieldSchemas are the JSON schemas of the LLMResponse fields the model fills
+// in. Empty strings and arrays stand for values that don't apply, as the
+// prompt instructions ask, so every field can be required.
+var fieldSchemas = map[string]any{
+	"status":      map[string]any{"type": "string", "enum": []string{"no_problem", "problem_detected", "insufficient_data"}},
+	"severity":    map[string]any{"type": "string", "enum": []string{"critical", "high", "medium", "low", "info"}},
+	"category":    map[string]any{"type": "string", "enum": []string{"network", "auth", "config", "resource", "dependency", "code-bug", ""}},
+	"root_cause":  map[string]any{"type": "string"},
+	"evidence":    map[string]any{"type": "string"},
+	"fix":         map[string]any{"type": "string"},
+	"timeline":    objectArraySchema("time", "event"),
+	"diagnostics": objectArraySchema("command", "reason"),
+	"missing":     stringArraySchema,
+	"comparison":  map[string]any{"type": "string", "enum": []string{"resolved", "unchanged", "regressed", "changed"}},
+}
+
+// objectArraySchema is the schema of a list of objects with the string
+// fields names, all required
+func objectArraySchema(names ...string) map[string]any {
+	properties := make(map[string]any, len(names))
+	for _, name := range names {
+		properties[name] = map[string]any{"type": "string"}
+	}
+	return map[string]any{
+		"type": "array",
+		"items": map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             names,
+			"additionalProperties": false,
+		},
+	}
+}
+
+// ResponseSchema returns the JSON schema of the analysis the prompt built for
+// cfg and payload asks for, or nil if it doesn't ask for one (schema
+// enforcement is off). It follows the pinned prompt version's fields, plus
+// "comparison" when payload has a previous analysis. Every field is required
+// and no others are allowed, as strict structured output demands.
+func ResponseSchema(cfg *config.Config, payload config.QueryPayload) json.RawMessage {
+	if cfg.NoSchema {
+		return nil
+	}
+	fields := promptTemplateFor(cfg.PromptVersion).Fields
+	if payload.Previous != nil {
+		fields = append(fields[:len(fields):len(fields)], "comparison")
+	}
+
+	// Properties are written in the prompt's order, which models generate them in
+	var properties bytes.Buffer
+	properties.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			properties.WriteByte(',')
+		}
+		name, _ := json.Marshal(field)
+		schema, _ := json.Marshal(fieldSchemas[field])
+		properties.Write(name)
+		properties.WriteByte(':')
+		properties.Write(schema)
+	}
+	properties.WriteByte('}')
+
+	schema, _ := json.Marshal(struct {
+		Type                 string          `json:"type"`
+		Properties           json.RawMessage `json:"properties"`
+		Required             []string        `json:"required"`
+		AdditionalProperties bool            `json:"additionalProperties"`
+	}{"object", properties.Bytes(), fields, false})
+	return schema
+}
@@ -0,0 +1,46 @@
+package llm
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+func TestResponseSchema(t *testing.T) {
+	decode := func(t *testing.T, raw json.RawMessage) (required []string, properties map[string]json.RawMessage) {
+		t.Helper()
+		var schema struct {
+			Required   []string                   `json:"required"`
+			Properties map[string]json.RawMessage `json:"properties"`
+		}
+		if err := json.Unmarshal(raw, &schema); err != nil {
+			t.Fatalf("schema isn't valid JSON: %v\n%s", err, raw)
+		}
+		return schema.Required, schema.Properties
+	}
+
+	for _, version := range PromptVersions() {
+		t.Run(version, func(t *testing.T) {
+			required, properties := decode(t, ResponseSchema(&config.Config{PromptVersion: version}, config.QueryPayload{}))
+			if want := promptTemplates[version].Fields; !reflect.DeepEqual(required, want) {
+				t.Errorf("required = %v, want %v", required, want)
+			}
+			for _, field := range required {
+				if string(properties[field]) == "null" {
+					t.Errorf("field %q has no schema", field)
+				}
+			}
+		})
+	}
+
+	required, _ := decode(t, ResponseSchema(&config.Config{}, config.QueryPayload{Previous: &config.PreviousAnalysis{RootCause: "disk full"}}))
+	if required[len(required)-1] != "comparison" {
+		t.Errorf("required = %v, want comparison with a previous analysis", required)
+	}
+
+	if schema := ResponseSchema(&config.Config{NoSchema: true}, config.QueryPayload{}); schema != nil {
+		t.Errorf("ResponseSchema() = %s, want nil with schema enforcement off", schema)
+	}
+}
@@ -0,0 +1,142 @@
+package llm
+
+import (
+	"math"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// maxBytesPerToken is more bytes than a token of log covers in practice
+// (prose averages about five in the newest tokenizers). Reading that much per
+// token of budget leaves trimming to CountTokens rather than to a byte limit.
+const maxBytesPerToken = 8
+
+// tokenizer describes how a model family's tokenizer splits text, enough to
+// estimate token counts without shipping its vocabulary. Text is split into
+// runs of letters, digits, symbols and whitespace like the tokenizers' own
+// pre-tokenizers do, and each run costs tokens by its length.
+type tokenizer struct {
+	lettersPerToken float64 // ASCII letters covered by one token of a word (common words are one token)
+	digitsPerToken  float64 // Digits per token (OpenAI tokenizers group numbers by three)
+	symbolsPerToken float64 // Punctuation per token in runs like "://" or "=="
+}
+
+var (
+	// o200kTokenizer approximates o200k_base (gpt-4o, gpt-4.1, o-series)
+	o200kTokenizer = tokenizer{lettersPerToken: 10, digitsPerToken: 3, symbolsPerToken: 2}
+	// cl100kTokenizer approximates cl100k_base (gpt-4, gpt-3.5-turbo); it is
+	// also used for unknown models, most of which have similar vocabularies
+	cl100kTokenizer = tokenizer{lettersPerToken: 8, digitsPerToken: 3, symbolsPerToken: 2}
+	// claudeTokenizer approximates Anthropic's tokenizer, which splits code
+	// and logs into more tokens than OpenAI's
+	claudeTokenizer = tokenizer{lettersPerToken: 6, digitsPerToken: 2, symbolsPerToken: 1.5}
+)
+
+// tokenizers maps model name prefixes to their tokenizer family
+var tokenizers = map[string]tokenizer{
+	"gpt-4o":        o200kTokenizer,
+	"gpt-4.1":       o200kTokenizer,
+	"o1":            o200kTokenizer,
+	"o3":            o200kTokenizer,
+	"o4":            o200kTokenizer,
+	"gpt-4":         cl100kTokenizer,
+	"gpt-3.5-turbo": cl100kTokenizer,
+	"claude-":       claudeTokenizer,
+}
+
+// runClass is the kind of characters a pre-tokenizer keeps together
+type runClass int
+
+const (
+	letterRun runClass = iota
+	digitRun
+	spaceRun
+	symbolRun
+)
+
+// classify returns the run class of r
+func classify(r rune) runClass {
+	switch {
+	case unicode.IsLetter(r) || unicode.IsMark(r):
+		return letterRun
+	case unicode.IsDigit(r):
+		return digitRun
+	case unicode.IsSpace(r):
+		return spaceRun
+	default:
+		return symbolRun
+	}
+}
+
+// CountTokens estimates how many tokens s takes in the prompt of model, using
+// an approximation of the model family's tokenizer. Unlike EstimateTokens it
+// accounts for text that tokenizes densely, such as hex IDs, timestamps and
+// punctuation-heavy log lines.
+func CountTokens(model, s string) int {
+	t := cl100kTokenizer
+	if best := longestPrefix(model, tokenizers); best != "" {
+		t = tokenizers[best]
+	}
+
+	tokens := 0
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		class := classify(r)
+		j := i + size
+		for j < len(s) {
+			next, n := utf8.DecodeRuneInString(s[j:])
+			if classify(next) != class {
+				break
+			}
+			j += n
+		}
+		tokens += t.runTokens(class, s[i:j])
+		i = j
+	}
+	return tokens
+}
+
+// runTokens returns the tokens of a run of one class
+func (t tokenizer) runTokens(class runClass, run string) int {
+	runes := utf8.RuneCountInString(run)
+	switch class {
+	case letterRun:
+		// Words outside ASCII take about a token per character
+		if runes != len(run) {
+			return runes
+		}
+		return perToken(runes, t.lettersPerToken)
+	case digitRun:
+		return perToken(runes, t.digitsPerToken)
+	case spaceRun:
+		// A single space is part of the next word's token
+		if run == " " {
+			return 0
+		}
+		return 1
+	default:
+		if runes != len(run) {
+			return runes
+		}
+		return perToken(runes, t.symbolsPerToken)
+	}
+}
+
+// perToken returns how many tokens n characters take at perToken characters each
+func perToken(n int, perToken float64) int {
+	return int(math.Ceil(float64(n) / perToken))
+}
+
+// LogBudget returns how many tokens of log fit in the prompt for payload with
+// cfg's model: its context window minus room for the answer and the rest of
+// the prompt (instructions, system context, hint, attachments, previous
+// analysis), counted with the model's tokenizer
+func LogBudget(cfg *config.Config, payload config.QueryPayload) int {
+	model := ResolveModel(cfg.Provider, cfg.Model)
+	payload.SanitizedLog = ""
+	systemPrompt, userPrompt := BuildPrompts(cfg, payload)
+	overhead := CountTokens(model, systemPrompt) + CountTokens(model, userPrompt)
+	return max(ContextWindow(model)-reservedOutputTokens-overhead, reservedPromptTokens)
+}
@@ -0,0 +1,60 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+func TestCountTokens(t *testing.T) {
+	tests := []struct {
+		name  string
+		model string
+		text  string
+		want  int
+	}{
+		{"empty", "gpt-4o", "", 0},
+		{"words", "gpt-4o", "connection refused by upstream", 4},
+		{"numbers in groups of three", "gpt-4o", "port 5432123", 4},
+		{"newline", "gpt-4o", "ERROR\nWARN", 3},
+		{"hex id", "gpt-4o", "3f2a9c81", 7},
+		{"older vocabulary", "gpt-4", "authentication", 2},
+		{"claude", "claude-3-5-sonnet-20241022", "authentication", 3},
+		{"unknown model", "llama3", "authentication", 2},
+		{"non-ASCII", "gpt-4o", "ошибка", 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CountTokens(tt.model, tt.text); got != tt.want {
+				t.Errorf("CountTokens(%q, %q) = %d, want %d", tt.model, tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountTokens_DenseLogs(t *testing.T) {
+	// Request IDs and timestamps take far more tokens than four bytes each
+	line := "2024-01-15T10:00:00.123Z req=9f8e7d6c-5b4a-3210-fedc-ba9876543210 status=500\n"
+	log := strings.Repeat(line, 100)
+	if got, naive := CountTokens("gpt-4o", log), EstimateTokens(log); got <= naive {
+		t.Errorf("CountTokens() = %d, want more than the byte estimate %d for dense log lines", got, naive)
+	}
+}
+
+func TestLogBudget(t *testing.T) {
+	cfg := &config.Config{Provider: "openai", Model: "gpt-4o"}
+	payload := config.QueryPayload{SanitizedLog: strings.Repeat("ERROR boom\n", 1000)}
+
+	budget := LogBudget(cfg, payload)
+	if budget <= LogTokenBudget("gpt-4o")-reservedPromptTokens || budget >= ContextWindow("gpt-4o")-reservedOutputTokens {
+		t.Errorf("LogBudget() = %d, want the context window minus the answer and the prompt around the log", budget)
+	}
+
+	// A large hint leaves less room for the log
+	payload.Hint = strings.Repeat("the deploy changed the connection pool settings ", 500)
+	if withHint := LogBudget(cfg, payload); withHint >= budget {
+		t.Errorf("LogBudget() = %d with a long hint, want less than %d", withHint, budget)
+	}
+}
@@ -0,0 +1,70 @@
+package llm
+
+import "fmt"
+
+// javascriptGuidance steers the analysis of package manager output towards
+// dependency resolution, where most of its failures are. It is formatted
+// with the manager, its lockfile and its reproducible install command.
+const javascriptGuidance = "This is output of the %[1]s package manager. " +
+	"Look first for dependency resolution failures: peer dependency conflicts (ERESOLVE), versions or packages missing from the registry (ETARGET, E404), " +
+	"registry authentication (E401, E403) and unreachable registries, integrity checksum mismatches, %[2]s out of sync with package.json, " +
+	"unsupported Node.js versions (EBADENGINE) and native modules failing to build (node-gyp). " +
+	"The %[1]s environment, when attached, lists the Node.js and package manager versions, the lockfiles present and the configured registries. " +
+	"Prefer fixes that keep %[2]s consistent (change the dependency in package.json, then %[3]s) over --force or --legacy-peer-deps, " +
+	"and say so when a flag would only hide the conflict."
+
+// pythonGuidance steers the analysis of a Python traceback towards the frame
+// that raised and the environment it ran in
+const pythonGuidance = "This log holds a Python traceback. The innermost frame (the last File line before the exception) is where it was raised; " +
+	"the frames before it show how the program got there. Tell apart a bug in the program's own code from a problem in the environment: " +
+	"ModuleNotFoundError and ImportError usually mean a package is missing from the interpreter that ran (e.g. installed in another virtualenv, or for another Python version), " +
+	"and errors inside site-packages often come from an incompatible package version. " +
+	"The python environment, when attached, lists the interpreter, the active virtualenv or conda environment and the installed versions of the packages in the traceback. " +
+	"Install packages with `python -m pip` of that interpreter, and pin a compatible version when the installed one is the cause."
+
+// gradleGuidance steers the analysis of Gradle output, usually an Android build
+const gradleGuidance = "This is output of a Gradle build, usually of an Android app. " +
+	"Find the task that failed (\"> Task :module:task FAILED\" and \"Execution failed for task\") and the first error it printed: " +
+	"Kotlin (e:) and Java compiler errors, unresolved dependencies (Could not resolve, Could not find) and the repositories they were looked up in, " +
+	"Android Gradle Plugin, Gradle and JDK version mismatches, SDK or build-tools that aren't installed, manifest merger and resource linking (AAPT) errors, and R8/D8 failures. " +
+	"Name the module and build file to change; prefer fixing the cause over --offline, clearing caches or disabling the task."
+
+// xcodebuildGuidance steers the analysis of xcodebuild output
+const xcodebuildGuidance = "This is output of xcodebuild, building an iOS or macOS app. " +
+	"Find the target and build command that failed (\"The following build commands failed\" names them with their target) and the first error: " +
+	"Swift and Clang compiler errors, undefined symbols at link time (a missing framework, library or target membership), code signing and provisioning profile errors, " +
+	"CocoaPods or Swift Package Manager dependency problems, deployment target and SDK mismatches, and failing build phase scripts. " +
+	"Name the target and build setting or file to change."
+
+// filteredNote follows the guidance when que left most of a build's output out
+const filteredNote = "Only the failing tasks or targets and the errors of the build are shown; que replaced the rest of its output with [FILTERED] markers, so do not conclude from their absence that other steps didn't run."
+
+// toolchainGuidance returns what to look for in the output of toolchain, or
+// "" for output of no particular tool. filtered tells the model that the
+// build's output was reduced to its failures.
+func toolchainGuidance(toolchain string, filtered bool) string {
+	guidance := guidanceFor(toolchain)
+	if guidance != "" && filtered {
+		guidance += "\n" + filteredNote
+	}
+	return guidance
+}
+
+// guidanceFor returns what to look for in the output of toolchain
+func guidanceFor(toolchain string) string {
+	switch toolchain {
+	case "npm":
+		return fmt.Sprintf(javascriptGuidance, "npm", "package-lock.json", "npm install")
+	case "yarn":
+		return fmt.Sprintf(javascriptGuidance, "yarn", "yarn.lock", "yarn install")
+	case "pnpm":
+		return fmt.Sprintf(javascriptGuidance, "pnpm", "pnpm-lock.yaml", "pnpm install")
+	case "python":
+		return pythonGuidance
+	case "gradle":
+		return gradleGuidance
+	case "xcodebuild":
+		return xcodebuildGuidance
+	}
+	return ""
+}
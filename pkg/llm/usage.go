@@ -0,0 +1,94 @@
+package llm
+
+import (
+	"context"
+
+	"github.com/jenian/que/internal/config"
+)
+
+// UsageReporter is implemented by clients that return the token usage their
+// provider reports with each response. It is separate from Client so test
+// doubles and third-party providers don't have to report usage.
+type UsageReporter interface {
+	// QueryWithPayloadUsage is Client.QueryWithPayload, with the usage of the query
+	QueryWithPayloadUsage(ctx context.Context, cfg *config.Config, payload config.QueryPayload) (string, *config.Usage, error)
+	// QueryWithHistoryUsage is Client.QueryWithHistory, with the usage of the query
+	QueryWithHistoryUsage(ctx context.Context, cfg *config.Config, conversationHistory []string, userQuestion string) (string, *config.Usage, error)
+}
+
+// QueryWithPayload queries client for the initial analysis of payload and
+// returns the usage of the query, or nil if client doesn't report usage
+func QueryWithPayload(ctx context.Context, client Client, cfg *config.Config, payload config.QueryPayload) (string, *config.Usage, error) {
+	if reporter, ok := client.(UsageReporter); ok {
+		return reporter.QueryWithPayloadUsage(ctx, cfg, payload)
+	}
+	response, err := client.QueryWithPayload(ctx, cfg, payload)
+	return response, nil, err
+}
+
+// QueryWithHistory queries client with a follow-up question and returns the
+// usage of the query, or nil if client doesn't report usage. The oldest
+// exchanges are left out when the history outgrows the model (see FitHistory).
+func QueryWithHistory(ctx context.Context, client Client, cfg *config.Config, conversationHistory []string, userQuestion string) (string, *config.Usage, error) {
+	conversationHistory = FitHistory(cfg, conversationHistory)
+	if reporter, ok := client.(UsageReporter); ok {
+		return reporter.QueryWithHistoryUsage(ctx, cfg, conversationHistory, userQuestion)
+	}
+	response, err := client.QueryWithHistory(ctx, cfg, conversationHistory, userQuestion)
+	return response, nil, err
+}
+
+// Prices of prompt tokens read from and written to the prompt cache, relative
+// to other prompt tokens. They are Anthropic's, whose requests are the only
+// ones que marks for caching.
+const (
+	cacheReadPrice  = 0.1
+	cacheWritePrice = 1.25
+)
+
+// NewUsage returns the usage of queries to model that took promptTokens and
+// completionTokens, priced if the model's prices are known
+func NewUsage(model string, promptTokens, completionTokens int) *config.Usage {
+	return newCachedUsage(model, promptTokens, completionTokens, 0, 0)
+}
+
+// newCachedUsage is NewUsage for queries that read cacheRead and wrote
+// cacheWrite of their prompt tokens from and to the prompt cache
+func newCachedUsage(model string, promptTokens, completionTokens, cacheRead, cacheWrite int) *config.Usage {
+	usage := &config.Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		CacheReadTokens:  cacheRead,
+		CacheWriteTokens: cacheWrite,
+	}
+	if cost, ok := EstimateCost(model, promptTokens-cacheRead-cacheWrite, completionTokens); ok {
+		if cacheRead > 0 || cacheWrite > 0 {
+			perToken, _ := EstimateCost(model, 1, 0)
+			cost += perToken * (cacheReadPrice*float64(cacheRead) + cacheWritePrice*float64(cacheWrite))
+		}
+		usage.CostUSD = &cost
+	}
+	return usage
+}
+
+// AddUsage returns the combined usage of queries to model, nil if none of
+// them reported usage
+func AddUsage(model string, usages ...*config.Usage) *config.Usage {
+	var total *config.Usage
+	for _, usage := range usages {
+		if usage == nil {
+			continue
+		}
+		if total == nil {
+			total = &config.Usage{}
+		}
+		total.PromptTokens += usage.PromptTokens
+		total.CompletionTokens += usage.CompletionTokens
+		total.CacheReadTokens += usage.CacheReadTokens
+		total.CacheWriteTokens += usage.CacheWriteTokens
+	}
+	if total == nil {
+		return nil
+	}
+	return newCachedUsage(model, total.PromptTokens, total.CompletionTokens, total.CacheReadTokens, total.CacheWriteTokens)
+}
@@ -0,0 +1,39 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jenian/que/internal/config"
+)
+
+func TestQueryWithPayload_WithoutUsage(t *testing.T) {
+	response, usage, err := QueryWithPayload(context.Background(), plainClient{}, &config.Config{}, config.QueryPayload{})
+	if err != nil || response != "" || usage != nil {
+		t.Errorf("QueryWithPayload() = %q, %+v, %v, want no usage from a client that doesn't report it", response, usage, err)
+	}
+}
+
+func TestAddUsage(t *testing.T) {
+	if got := AddUsage("gpt-4o", nil, nil); got != nil {
+		t.Errorf("AddUsage() = %+v, want nil without reported usage", got)
+	}
+
+	got := AddUsage("gpt-4o", NewUsage("gpt-4o", 1000, 100), nil, NewUsage("gpt-4o", 3000, 300))
+	if got.PromptTokens != 4000 || got.CompletionTokens != 400 {
+		t.Errorf("AddUsage() = %+v, want 4000 prompt and 400 completion tokens", got)
+	}
+	// $2.50 per million input tokens and $10 per million output tokens
+	if got.CostUSD == nil || *got.CostUSD != 0.014 {
+		t.Errorf("CostUSD = %v, want 0.014", got.CostUSD)
+	}
+
+	cached := AddUsage("gpt-4o", newCachedUsage("gpt-4o", 1000, 0, 0, 1000), newCachedUsage("gpt-4o", 1000, 0, 1000, 0))
+	if cached.CacheReadTokens != 1000 || cached.CacheWriteTokens != 1000 {
+		t.Errorf("AddUsage() = %+v, want the cache reads and writes added up", cached)
+	}
+	// A write costs 1.25 times the input price and a read a tenth of it
+	if cached.CostUSD == nil || *cached.CostUSD < 0.003374 || *cached.CostUSD > 0.003376 {
+		t.Errorf("CostUSD = %v, want 0.003375", cached.CostUSD)
+	}
+}